@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"golang.org/x/net/context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// CompositeLimiter 先用本地的限流器判断，本地放过了再去 redis 判断全局的限流。
+// 这样大部分要被限流的请求不用访问 redis；redis 挂了也还有本地的限流兜底，不会直接报错。
+// redis 出错之后 cooldown 之内只用本地的限流，免得每个请求都要等 redis 超时。
+// 注意本地放过、全局限流的请求也会占用本地的额度
+type CompositeLimiter struct {
+	local    Limiter
+	global   Limiter
+	cooldown time.Duration
+	// 全局的限流上一次出错的时间，UnixNano
+	failedAt atomic.Int64
+	now      func() time.Time
+}
+
+func NewCompositeLimiter(local Limiter, global Limiter, cooldown time.Duration) *CompositeLimiter {
+	return &CompositeLimiter{
+		local:    local,
+		global:   global,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+func (c *CompositeLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	limited, err := c.local.Limit(ctx, key)
+	if err != nil || limited {
+		return limited, err
+	}
+	now := c.now()
+	if now.Sub(time.Unix(0, c.failedAt.Load())) < c.cooldown {
+		return false, nil
+	}
+	limited, err = c.global.Limit(ctx, key)
+	if err != nil {
+		// 全局的限流用不了，本地已经判断过了，就按照本地的结果来。
+		// 每次冷却只打一条日志，redis 挂了的时候不会刷屏；key 是手机号或者 IP，不打出来
+		c.failedAt.Store(now.UnixNano())
+		log.Printf("ratelimit: 全局限流失败，%s 之内只用本地的限流 err: %v", c.cooldown, err)
+		return false, nil
+	}
+	return limited, nil
+}
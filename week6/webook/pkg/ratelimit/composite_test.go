@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/net/context"
+	"log"
+	"os"
+	"testing"
+	"time"
+	limitmocks "week6/webook/pkg/ratelimit/mocks"
+)
+
+func TestCompositeLimiter(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (Limiter, Limiter)
+
+		wantLimited bool
+		wantErr     error
+		// 全局限流出错要打日志
+		wantLog string
+	}{
+		{
+			name: "本地限流了，不用访问 redis",
+			mock: func(ctrl *gomock.Controller) (Limiter, Limiter) {
+				local := limitmocks.NewMockLimiter(ctrl)
+				global := limitmocks.NewMockLimiter(ctrl)
+				local.EXPECT().Limit(gomock.Any(), "key").Return(true, nil)
+				return local, global
+			},
+			wantLimited: true,
+		},
+		{
+			name: "本地放过，全局限流",
+			mock: func(ctrl *gomock.Controller) (Limiter, Limiter) {
+				local := limitmocks.NewMockLimiter(ctrl)
+				global := limitmocks.NewMockLimiter(ctrl)
+				local.EXPECT().Limit(gomock.Any(), "key").Return(false, nil)
+				global.EXPECT().Limit(gomock.Any(), "key").Return(true, nil)
+				return local, global
+			},
+			wantLimited: true,
+		},
+		{
+			name: "都放过",
+			mock: func(ctrl *gomock.Controller) (Limiter, Limiter) {
+				local := limitmocks.NewMockLimiter(ctrl)
+				global := limitmocks.NewMockLimiter(ctrl)
+				local.EXPECT().Limit(gomock.Any(), "key").Return(false, nil)
+				global.EXPECT().Limit(gomock.Any(), "key").Return(false, nil)
+				return local, global
+			},
+		},
+		{
+			name: "redis 挂了，按照本地的结果",
+			mock: func(ctrl *gomock.Controller) (Limiter, Limiter) {
+				local := limitmocks.NewMockLimiter(ctrl)
+				global := limitmocks.NewMockLimiter(ctrl)
+				local.EXPECT().Limit(gomock.Any(), "key").Return(false, nil)
+				global.EXPECT().Limit(gomock.Any(), "key").Return(false, errors.New("redis 连不上"))
+				return local, global
+			},
+			wantLog: "redis 连不上",
+		},
+		{
+			name: "本地出错",
+			mock: func(ctrl *gomock.Controller) (Limiter, Limiter) {
+				local := limitmocks.NewMockLimiter(ctrl)
+				global := limitmocks.NewMockLimiter(ctrl)
+				local.EXPECT().Limit(gomock.Any(), "key").Return(false, errors.New("本地出错"))
+				return local, global
+			},
+			wantErr: errors.New("本地出错"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+			local, global := tc.mock(ctrl)
+			limited, err := NewCompositeLimiter(local, global, time.Minute).Limit(context.Background(), "key")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantLimited, limited)
+			if tc.wantLog == "" {
+				assert.Empty(t, buf.String())
+			} else {
+				assert.Contains(t, buf.String(), tc.wantLog)
+				// key 是手机号或者 IP，不能打到日志里面
+				assert.NotContains(t, buf.String(), "key")
+			}
+		})
+	}
+}
+
+// redis 挂了之后冷却期间不再访问 redis，也只打一条日志
+func TestCompositeLimiter_Cooldown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	clock := &fakeClock{now: time.Now()}
+	local := limitmocks.NewMockLimiter(ctrl)
+	global := limitmocks.NewMockLimiter(ctrl)
+	local.EXPECT().Limit(gomock.Any(), "key").Return(false, nil).Times(4)
+	global.EXPECT().Limit(gomock.Any(), "key").Return(false, errors.New("redis 连不上"))
+	c := NewCompositeLimiter(local, global, time.Minute)
+	c.now = clock.Now
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		limited, err := c.Limit(ctx, "key")
+		assert.NoError(t, err)
+		assert.False(t, limited)
+		clock.Add(time.Second * 10)
+	}
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("redis 连不上")))
+
+	// 冷却结束，重新访问 redis
+	clock.Add(time.Minute)
+	global.EXPECT().Limit(gomock.Any(), "key").Return(true, nil)
+	limited, err := c.Limit(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, limited)
+}
@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"math"
+	"time"
+)
+
+// 下面几个都是单机的限流器，不需要访问 redis，阈值也是按照单机算的。
+// 可以单独用，也可以和 RedisSlidingWindowLimiter 组合起来用，见 CompositeLimiter
+
+// TokenBucketLimiter 令牌桶，每 interval 放 rate 个令牌，桶里面最多 capacity 个。
+// 桶满的时候允许一下子来 capacity 个请求
+type TokenBucketLimiter struct {
+	interval time.Duration
+	rate     int
+	capacity int
+	store    *localStore[tokenBucket]
+}
+
+type tokenBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+func NewTokenBucketLimiter(interval time.Duration, rate int, capacity int, opts ...LocalOption) *TokenBucketLimiter {
+	checkLimitArgs(interval, rate)
+	if capacity <= 0 {
+		panic(fmt.Sprintf("ratelimit: capacity 必须大于 0，现在是 %d", capacity))
+	}
+	// 空桶攒满要多久，闲置超过这个时间桶肯定是满的，清理掉也没关系
+	full := interval * time.Duration(capacity) / time.Duration(rate)
+	return &TokenBucketLimiter{
+		interval: interval,
+		rate:     rate,
+		capacity: capacity,
+		store:    newLocalStore[tokenBucket](newLocalConfig(full, opts)),
+	}
+}
+
+func (l *TokenBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return l.store.do(key, func(b *tokenBucket, now time.Time) bool {
+		if b.ts.IsZero() {
+			// 新的 key，桶是满的
+			b.tokens, b.ts = float64(l.capacity), now
+		}
+		if now.After(b.ts) {
+			added := float64(now.Sub(b.ts)) * float64(l.rate) / float64(l.interval)
+			b.tokens = math.Min(float64(l.capacity), b.tokens+added)
+			b.ts = now
+		}
+		if b.tokens < 1 {
+			return true
+		}
+		b.tokens--
+		return false
+	}), nil
+}
+
+// LeakyBucketLimiter 漏桶，请求按照每 interval 流出 rate 个的速率匀速通过，桶里面最多排 capacity 个。
+// 和令牌桶不一样的是，就算很久没有请求，也不会一下子放过很多请求，capacity 是 1 的时候就是严格匀速。
+// 实现上没有真的排队，而是记录桶漏空的时间（也就是 GCRA 算法），放不下就直接拒绝
+type LeakyBucketLimiter struct {
+	// 每个请求流出去要多久
+	emission time.Duration
+	capacity int
+	store    *localStore[leakyBucket]
+}
+
+type leakyBucket struct {
+	// 桶里面的请求全部流出去的时间
+	emptyAt time.Time
+}
+
+func NewLeakyBucketLimiter(interval time.Duration, rate int, capacity int, opts ...LocalOption) *LeakyBucketLimiter {
+	checkLimitArgs(interval, rate)
+	if capacity <= 0 {
+		panic(fmt.Sprintf("ratelimit: capacity 必须大于 0，现在是 %d", capacity))
+	}
+	emission := interval / time.Duration(rate)
+	if emission <= 0 {
+		// interval 比 rate 个纳秒还短，算出来的间隔是 0，等于没有限流
+		panic(fmt.Sprintf("ratelimit: %s 内 %d 个请求太多了", interval, rate))
+	}
+	return &LeakyBucketLimiter{
+		emission: emission,
+		capacity: capacity,
+		store:    newLocalStore[leakyBucket](newLocalConfig(emission*time.Duration(capacity), opts)),
+	}
+}
+
+func (l *LeakyBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return l.store.do(key, func(b *leakyBucket, now time.Time) bool {
+		emptyAt := b.emptyAt
+		if emptyAt.Before(now) {
+			emptyAt = now
+		}
+		// 加上这个请求之后桶里面的量超过了容量
+		if emptyAt.Sub(now)+l.emission > l.emission*time.Duration(l.capacity) {
+			return true
+		}
+		b.emptyAt = emptyAt.Add(l.emission)
+		return false
+	}), nil
+}
+
+// FixedWindowLimiter 固定窗口，每个 interval 最多 rate 个请求。
+// 实现最简单，但是两个窗口交界的地方最多可能放过 2 * rate 个请求
+type FixedWindowLimiter struct {
+	interval time.Duration
+	rate     int
+	store    *localStore[fixedWindow]
+}
+
+type fixedWindow struct {
+	start time.Time
+	cnt   int
+}
+
+func NewFixedWindowLimiter(interval time.Duration, rate int, opts ...LocalOption) *FixedWindowLimiter {
+	checkLimitArgs(interval, rate)
+	return &FixedWindowLimiter{
+		interval: interval,
+		rate:     rate,
+		store:    newLocalStore[fixedWindow](newLocalConfig(interval, opts)),
+	}
+}
+
+func (l *FixedWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return l.store.do(key, func(w *fixedWindow, now time.Time) bool {
+		start := now.Truncate(l.interval)
+		if !w.start.Equal(start) {
+			w.start, w.cnt = start, 0
+		}
+		if w.cnt >= l.rate {
+			return true
+		}
+		w.cnt++
+		return false
+	}), nil
+}
+
+// SlidingLogLimiter 滑动日志，记录窗口内每个请求的时间，和 RedisSlidingWindowLimiter 的算法一样。
+// 最精确，但是每个 key 要存 rate 个时间，rate 很大的时候比较占内存
+type SlidingLogLimiter struct {
+	interval time.Duration
+	rate     int
+	store    *localStore[slidingLog]
+}
+
+type slidingLog struct {
+	// 按照时间先后排好
+	reqs []time.Time
+}
+
+func NewSlidingLogLimiter(interval time.Duration, rate int, opts ...LocalOption) *SlidingLogLimiter {
+	checkLimitArgs(interval, rate)
+	return &SlidingLogLimiter{
+		interval: interval,
+		rate:     rate,
+		store:    newLocalStore[slidingLog](newLocalConfig(interval, opts)),
+	}
+}
+
+func (l *SlidingLogLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	return l.store.do(key, func(log *slidingLog, now time.Time) bool {
+		min := now.Add(-l.interval)
+		i := 0
+		for i < len(log.reqs) && !log.reqs[i].After(min) {
+			i++
+		}
+		log.reqs = log.reqs[i:]
+		if len(log.reqs) >= l.rate {
+			return true
+		}
+		log.reqs = append(log.reqs, now)
+		return false
+	}), nil
+}
+
+// checkLimitArgs 参数不对是配置写错了，和 time.NewTicker 一样直接 panic，
+// 不然 rate 是 0 的时候会在构造的时候除以 0，负数的时候限流不会生效
+func checkLimitArgs(interval time.Duration, rate int) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("ratelimit: interval 必须大于 0，现在是 %s", interval))
+	}
+	if rate <= 0 {
+		panic(fmt.Sprintf("ratelimit: rate 必须大于 0，现在是 %d", rate))
+	}
+}
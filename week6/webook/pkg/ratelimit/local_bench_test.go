@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"golang.org/x/net/context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// go test -bench=. -benchmem ./webook/pkg/ratelimit/
+// 阈值都设得很大，测的是判断本身的开销，不是被限流之后的开销
+
+type benchmarkLimiter struct {
+	name       string
+	newLimiter func(opts ...LocalOption) Limiter
+}
+
+func benchmarkLimiters() []benchmarkLimiter {
+	return []benchmarkLimiter{
+		{name: "TokenBucket", newLimiter: func(opts ...LocalOption) Limiter {
+			return NewTokenBucketLimiter(time.Second, 1000000, 1000000, opts...)
+		}},
+		{name: "LeakyBucket", newLimiter: func(opts ...LocalOption) Limiter {
+			return NewLeakyBucketLimiter(time.Second, 1000000, 1000000, opts...)
+		}},
+		{name: "FixedWindow", newLimiter: func(opts ...LocalOption) Limiter {
+			return NewFixedWindowLimiter(time.Second, 1000000, opts...)
+		}},
+		// 滑动日志每个 key 要存 rate 个时间，阈值小一点，不然内存太大
+		{name: "SlidingLog", newLimiter: func(opts ...LocalOption) Limiter {
+			return NewSlidingLogLimiter(time.Second, 1000, opts...)
+		}},
+	}
+}
+
+// BenchmarkLocalLimiter_SingleKey 所有请求都是同一个 key，分片没有用
+func BenchmarkLocalLimiter_SingleKey(b *testing.B) {
+	for _, bl := range benchmarkLimiters() {
+		b.Run(bl.name, func(b *testing.B) {
+			l := bl.newLimiter()
+			ctx := context.Background()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, _ = l.Limit(ctx, "ip:127.0.0.1")
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkLocalLimiter_ManyKeys 很多个 key 并发，对比一下分片数的影响
+func BenchmarkLocalLimiter_ManyKeys(b *testing.B) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "ip:" + strconv.Itoa(i)
+	}
+	for _, bl := range benchmarkLimiters() {
+		for _, shards := range []int{1, 32, 256} {
+			b.Run(bl.name+"/shards_"+strconv.Itoa(shards), func(b *testing.B) {
+				l := bl.newLimiter(WithShards(shards))
+				ctx := context.Background()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						_, _ = l.Limit(ctx, keys[i%len(keys)])
+						i++
+					}
+				})
+			})
+		}
+	}
+}
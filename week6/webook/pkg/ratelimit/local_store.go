@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// 本地限流器的公共部分：按照 key 分片加锁，减少不同 key 之间的锁竞争；
+// 长时间没有请求的 key 会被清理掉，不然 key 越来越多，内存一直涨。
+// 清理是在请求的时候顺便做的，不用额外起 goroutine，也就不需要 Close
+
+const (
+	defaultShards      = 32
+	defaultIdleTimeout = time.Minute * 10
+)
+
+type localConfig struct {
+	shards      int
+	idleTimeout time.Duration
+	now         func() time.Time
+}
+
+type LocalOption func(cfg *localConfig)
+
+// WithShards 分片数，key 很多、并发很高的时候可以调大一点
+func WithShards(shards int) LocalOption {
+	return func(cfg *localConfig) {
+		if shards > 0 {
+			cfg.shards = shards
+		}
+	}
+}
+
+// WithIdleTimeout 一个 key 多久没有请求就清理掉，要比限流的窗口长，不然刚清理掉计数就重置了
+func WithIdleTimeout(timeout time.Duration) LocalOption {
+	return func(cfg *localConfig) {
+		if timeout > 0 {
+			cfg.idleTimeout = timeout
+		}
+	}
+}
+
+func newLocalConfig(window time.Duration, opts []LocalOption) localConfig {
+	cfg := localConfig{
+		shards:      defaultShards,
+		idleTimeout: defaultIdleTimeout,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// 窗口没过去就清理掉，相当于没限流
+	if cfg.idleTimeout < window {
+		cfg.idleTimeout = window
+	}
+	return cfg
+}
+
+type localStore[T any] struct {
+	shards      []*localShard[T]
+	idleTimeout time.Duration
+	now         func() time.Time
+}
+
+type localShard[T any] struct {
+	mu    sync.Mutex
+	items map[string]*localItem[T]
+	// 上一次清理的时间
+	sweptAt time.Time
+}
+
+type localItem[T any] struct {
+	state    T
+	lastSeen time.Time
+}
+
+func newLocalStore[T any](cfg localConfig) *localStore[T] {
+	s := &localStore[T]{
+		shards:      make([]*localShard[T], cfg.shards),
+		idleTimeout: cfg.idleTimeout,
+		now:         cfg.now,
+	}
+	for i := range s.shards {
+		s.shards[i] = &localShard[T]{
+			items: make(map[string]*localItem[T]),
+		}
+	}
+	return s
+}
+
+// do 在 key 所在分片的锁里面执行 fn，key 第一次出现的时候 state 是零值
+func (s *localStore[T]) do(key string, fn func(state *T, now time.Time) bool) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	now := s.now()
+	sh.sweep(now, s.idleTimeout)
+	item, ok := sh.items[key]
+	if !ok {
+		item = &localItem[T]{}
+		sh.items[key] = item
+	}
+	item.lastSeen = now
+	return fn(&item.state, now)
+}
+
+func (s *localStore[T]) shard(key string) *localShard[T] {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// len 测试用
+func (s *localStore[T]) len() int {
+	cnt := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		cnt += len(sh.items)
+		sh.mu.Unlock()
+	}
+	return cnt
+}
+
+// sweep 每个分片最多 idleTimeout 扫一次，所以一个 key 最多闲置 2 * idleTimeout 就会被清理
+func (sh *localShard[T]) sweep(now time.Time, idleTimeout time.Duration) {
+	if now.Sub(sh.sweptAt) < idleTimeout {
+		return
+	}
+	sh.sweptAt = now
+	for key, item := range sh.items {
+		if now.Sub(item.lastSeen) >= idleTimeout {
+			delete(sh.items, key)
+		}
+	}
+}
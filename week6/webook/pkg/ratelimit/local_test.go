@@ -0,0 +1,194 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeClock 测试里面控制时间
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func withClock(clock *fakeClock) LocalOption {
+	return func(cfg *localConfig) {
+		cfg.now = clock.Now
+	}
+}
+
+// step 一个请求，期望的结果
+type step struct {
+	// 距离上一个请求过了多久
+	after   time.Duration
+	key     string
+	limited bool
+}
+
+func runSteps(t *testing.T, clock *fakeClock, limiter Limiter, steps []step) {
+	for i, s := range steps {
+		clock.Add(s.after)
+		key := s.key
+		if key == "" {
+			key = "ip:127.0.0.1"
+		}
+		limited, err := limiter.Limit(context.Background(), key)
+		require.NoError(t, err)
+		assert.Equal(t, s.limited, limited, "第 %d 个请求", i)
+	}
+}
+
+func TestLocalLimiters(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limiter func(clock *fakeClock) Limiter
+		steps   []step
+	}{
+		{
+			name: "令牌桶",
+			// 每秒 2 个令牌，最多攒 3 个
+			limiter: func(clock *fakeClock) Limiter {
+				return NewTokenBucketLimiter(time.Second, 2, 3, withClock(clock))
+			},
+			steps: []step{
+				// 一开始桶是满的，允许突发
+				{}, {}, {},
+				{limited: true},
+				// 不同的 key 互不影响
+				{key: "ip:127.0.0.2"},
+				// 500ms 补一个令牌
+				{after: time.Millisecond * 500},
+				{limited: true},
+				// 很久没有请求，最多也只攒 3 个
+				{after: time.Minute}, {}, {},
+				{limited: true},
+			},
+		},
+		{
+			name: "漏桶",
+			// 每秒流出 2 个，也就是 500ms 一个，最多排 2 个
+			limiter: func(clock *fakeClock) Limiter {
+				return NewLeakyBucketLimiter(time.Second, 2, 2, withClock(clock))
+			},
+			steps: []step{
+				{}, {},
+				{limited: true},
+				{after: time.Millisecond * 500},
+				{limited: true},
+				// 很久没有请求，也只能放过 capacity 个
+				{after: time.Minute}, {},
+				{limited: true},
+			},
+		},
+		{
+			name: "漏桶严格匀速",
+			limiter: func(clock *fakeClock) Limiter {
+				return NewLeakyBucketLimiter(time.Second, 2, 1, withClock(clock))
+			},
+			steps: []step{
+				{},
+				{after: time.Millisecond * 499, limited: true},
+				{after: time.Millisecond},
+				{after: time.Millisecond * 500},
+			},
+		},
+		{
+			name: "固定窗口",
+			// 每秒 2 个
+			limiter: func(clock *fakeClock) Limiter {
+				return NewFixedWindowLimiter(time.Second, 2, withClock(clock))
+			},
+			steps: []step{
+				// 起始时间是 x.800
+				{}, {},
+				{limited: true},
+				// 到了下一个窗口就重新计数，哪怕离上一个请求只有 200ms
+				{after: time.Millisecond * 200}, {},
+				{limited: true},
+			},
+		},
+		{
+			name: "滑动日志",
+			limiter: func(clock *fakeClock) Limiter {
+				return NewSlidingLogLimiter(time.Second, 2, withClock(clock))
+			},
+			steps: []step{
+				{},
+				{after: time.Millisecond * 500},
+				{after: time.Millisecond * 200, limited: true},
+				// 第一个请求滑出窗口
+				{after: time.Millisecond * 300},
+				{limited: true},
+				{after: time.Millisecond * 500},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.UnixMilli(1700000000800)}
+			runSteps(t, clock, tc.limiter(clock), tc.steps)
+		})
+	}
+}
+
+func TestLocalStore_Evict(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	l := NewSlidingLogLimiter(time.Second, 2, WithShards(4), WithIdleTimeout(time.Minute), withClock(clock))
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		_, err := l.Limit(ctx, "ip:"+strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 100, l.store.len())
+
+	// 没到闲置时间不清理
+	clock.Add(time.Second * 30)
+	_, err := l.Limit(ctx, "ip:0")
+	require.NoError(t, err)
+	assert.Equal(t, 100, l.store.len())
+
+	// 每个分片都有请求之后，闲置的 key 都清理掉了，只剩下刚刚请求过的
+	clock.Add(time.Minute)
+	for i := 100; i < 200; i++ {
+		_, err = l.Limit(ctx, "ip:"+strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 100, l.store.len())
+}
+
+func TestNewLocalConfig(t *testing.T) {
+	// 闲置时间比窗口短，清理掉就相当于没有限流了
+	cfg := newLocalConfig(time.Hour, []LocalOption{WithIdleTimeout(time.Minute), WithShards(0)})
+	assert.Equal(t, time.Hour, cfg.idleTimeout)
+	assert.Equal(t, defaultShards, cfg.shards)
+}
+
+func TestNewLocalLimiter_InvalidArgs(t *testing.T) {
+	testCases := []struct {
+		name string
+		fn   func()
+	}{
+		{name: "令牌桶 rate 是 0", fn: func() { NewTokenBucketLimiter(time.Second, 0, 10) }},
+		{name: "令牌桶 capacity 是负数", fn: func() { NewTokenBucketLimiter(time.Second, 10, -1) }},
+		{name: "漏桶 rate 是 0", fn: func() { NewLeakyBucketLimiter(time.Second, 0, 10) }},
+		{name: "漏桶 interval 太短", fn: func() { NewLeakyBucketLimiter(time.Nanosecond, 10, 10) }},
+		{name: "固定窗口 interval 是 0", fn: func() { NewFixedWindowLimiter(0, 10) }},
+		{name: "滑动日志 rate 是负数", fn: func() { NewSlidingLogLimiter(time.Second, -1) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Panics(t, tc.fn)
+		})
+	}
+}
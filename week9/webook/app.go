@@ -2,10 +2,13 @@ package main
 
 import (
 	events "geekgo/week9/webook/internal/events/article"
+	"geekgo/week9/webook/internal/job"
 	"github.com/gin-gonic/gin"
 )
 
 type App struct {
 	web       *gin.Engine
 	consumers []events.Consumer
+	publisher *job.ScheduledPublisher
+	ranking   *job.RankingJob
 }
@@ -25,6 +25,8 @@ const (
 	ArticleStatusUnpublished
 	ArticleStatusPublished
 	ArticleStatusPrivate
+	// ArticleStatusScheduled 定时发表，到时间之后由后台任务发表
+	ArticleStatusScheduled
 )
 
 func (s ArticleStatus) ToUint8() uint8 {
@@ -39,7 +41,29 @@ func (s ArticleStatus) String() string {
 		return "unpublished"
 	case ArticleStatusPublished:
 		return "published"
+	case ArticleStatusScheduled:
+		return "scheduled"
 	default:
 		return "unknown"
 	}
 }
+
+// ArticleSchedule 文章的定时发表任务
+type ArticleSchedule struct {
+	Id          int64
+	ArticleId   int64
+	AuthorId    int64
+	PublishTime time.Time
+	// Version 抢占的时候拿到的，释放和完成的时候用来确认任务还是自己的
+	Version int64
+}
+
+// Abstract 列表页展示用的摘要，取内容的前 128 个字符
+func (a Article) Abstract() string {
+	const abstractLen = 128
+	cs := []rune(a.Content)
+	if len(cs) <= abstractLen {
+		return a.Content
+	}
+	return string(cs[:abstractLen])
+}
@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+// ArticleRevision 文章的历史版本
+// 每一次 Save 和 Publish 都会记录一个不可变的版本
+type ArticleRevision struct {
+	Id        int64
+	ArticleId int64
+	// Version 在同一篇文章内部单调递增，从 1 开始
+	Version int64
+	Title   string
+	Content string
+	Author
+	// 记录这个版本的时候文章的状态，可以区分是保存草稿还是发表
+	Status ArticleStatus
+	Ctime  time.Time
+}
+
+type DiffOp uint8
+
+const (
+	DiffOpEqual DiffOp = iota
+	DiffOpInsert
+	DiffOpDelete
+)
+
+func (op DiffOp) String() string {
+	switch op {
+	case DiffOpInsert:
+		return "+"
+	case DiffOpDelete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// DiffLine 行级别的 diff 结果
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
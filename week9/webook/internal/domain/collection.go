@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Collection 收藏夹
+type Collection struct {
+	Id    int64
+	Name  string
+	Uid   int64
+	Ctime time.Time
+	Utime time.Time
+}
+
+// CollectionItem 收藏夹里面的一条收藏
+type CollectionItem struct {
+	Id    int64
+	Cid   int64
+	Biz   string
+	BizId int64
+	Uid   int64
+	Ctime time.Time
+	Utime time.Time
+}
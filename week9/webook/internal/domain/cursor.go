@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// Cursor 按照 (utime, id) 倒序分页的游标，零值代表第一页
+type Cursor struct {
+	Utime time.Time
+	Id    int64
+}
+
+func (c Cursor) IsZero() bool {
+	return c.Id == 0 && c.Utime.IsZero()
+}
+
+// String 对前端来说游标是不透明的
+func (c Cursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	raw := fmt.Sprintf("%d_%d", c.Utime.UnixMilli(), c.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, err
+	}
+	var utime, id int64
+	_, err = fmt.Sscanf(string(raw), "%d_%d", &utime, &id)
+	if err != nil {
+		return Cursor{}, err
+	}
+	return Cursor{Utime: time.UnixMilli(utime), Id: id}, nil
+}
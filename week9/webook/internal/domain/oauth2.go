@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// OAuthUserInfo 第三方登录之后拿到的用户信息
+type OAuthUserInfo struct {
+	// Provider 第三方的名字，比如 github、google
+	Provider string
+	// ExternalId 第三方里面的用户 id，OIDC 里面就是 sub
+	ExternalId string
+	Email      string
+	// EmailVerified 第三方有没有验证过这个邮箱
+	EmailVerified bool
+	Name          string
+}
+
+// OAuthBinding 一个 webook 用户可以绑定多个第三方账号，每个第三方只能绑定一个
+type OAuthBinding struct {
+	Id         int64
+	Uid        int64
+	Provider   string
+	ExternalId string
+	Email      string
+	Ctime      time.Time
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// HotArticle 热榜上的一篇文章
+type HotArticle struct {
+	Id       int64
+	Title    string
+	AuthorId int64
+	// 第一次发表的时间，热度按照这个时间衰减
+	PublishTime time.Time
+	Intr        Interactive
+	Score       float64
+}
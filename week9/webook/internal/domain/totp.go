@@ -0,0 +1,16 @@
+package domain
+
+// TOTP 用户绑定的两步验证，Secret 是加密之后的
+type TOTP struct {
+	Uid     int64
+	Secret  string
+	Enabled bool
+}
+
+// PreAuth 第一步验证通过之后，pre-auth token 对应的登录信息
+type PreAuth struct {
+	Uid int64
+	// Account 第一步在 LoginGuardService 里面的账号，两步验证也通过了才清掉它的失败次数。
+	// 短信和第三方登录是空的
+	Account string
+}
@@ -1,7 +1,11 @@
 package domain
 
 type User struct {
-	Id       int64
-	Email    string
-	Password string
+	Id            int64
+	Email         string
+	EmailVerified bool
+	Password      string
+	Phone         string
+
+	WechatInfo WechatInfo
 }
@@ -1 +1,9 @@
 package domain
+
+// WechatInfo 微信扫码登录之后拿到的用户标识
+type WechatInfo struct {
+	// OpenId 同一个用户在不同的应用里面不一样
+	OpenId string
+	// UnionId 同一个开放平台账号下面的所有应用都一样，没有绑定开放平台的时候为空
+	UnionId string
+}
@@ -2,9 +2,10 @@ package article
 
 import (
 	"context"
+	"errors"
 	"geekgo/week9/webook/internal/repository"
 	"geekgo/week9/webook/pkgs/logger"
-	"geekgo/week9/webook/pkgs/saramax/metrics"
+	"geekgo/week9/webook/pkgs/saramax"
 	"github.com/IBM/sarama"
 	"time"
 )
@@ -12,6 +13,11 @@ import (
 // consumer调用的时候 比较复杂 sarama要初始化consumer组 还要setup consume等方法
 // 这里在pkg里自己封装一个saramax consumer_handler 调用saramax里面的处理json解码的部分 传入consume函数
 
+const (
+	batchSize     = 100
+	batchDuration = time.Millisecond * 500
+)
+
 type Consumer interface {
 	Start() error
 }
@@ -20,6 +26,8 @@ type InteractiveReadEventConsumer struct {
 	client sarama.Client
 	repo   repository.InteractiveRepository // 消费的业务就是阅读数加1 这里调用repo阅读数+1
 	l      logger.LoggerV1
+	// 重试之后还是更新不了阅读数的事件投递到 read_article_dlq，修好之后用 saramax.DeadLetterReplayer 重放
+	dlq *saramax.DeadLetterProducer
 }
 
 func (i *InteractiveReadEventConsumer) Start() error {
@@ -29,26 +37,60 @@ func (i *InteractiveReadEventConsumer) Start() error {
 	if err != nil {
 		return err
 	}
+	// 热门文章的阅读事件很多，一条消息更新一次数据库扛不住，攒一批聚合之后再更新
+	//handler := saramax.NewHandler[ReadEvent](i.l, i.Consume) // saramax 封装了ConsumerGroupHandler的实现
+	//handler := metrics.NewPrometheusKafkaConsumerHandler[ReadEvent](i.l, i.Consume)
+	handler := saramax.NewBatchHandler[ReadEvent](i.l, batchSize, batchDuration, i.BatchConsume).
+		WithDeadLetter(i.dlq)
 	// 进行消费
 	go func() {
-		err := cg.Consume(context.Background(),
-			[]string{"read_article"},
-			//saramax.NewHandler[ReadEvent](i.l, i.Consume)) // saramax 封装了ConsumerGroupHandler的实现
-			metrics.NewPrometheusKafkaConsumerHandler[ReadEvent](i.l, i.Consume))
-		if err != nil {
-			// 记录日志
-			//r.l.Error("退出了消费循环异常", logger.Error(err))
+		// 再均衡或者处理失败之后 Consume 就返回了，要重新加入，从上次提交的偏移量接着消费
+		for {
+			err := cg.Consume(context.Background(), []string{"read_article"}, handler)
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			if err != nil {
+				i.l.Error("退出了消费循环异常", logger.Error(err))
+			}
 		}
 	}()
 	return err
 }
 
+// BatchConsume 同一篇文章的阅读事件先合并，一批只更新一次
+func (i *InteractiveReadEventConsumer) BatchConsume(msgs []*sarama.ConsumerMessage, ts []ReadEvent) error {
+	cnts := make(map[int64]int64, len(ts))
+	// 保持第一次出现的顺序
+	aids := make([]int64, 0, len(ts))
+	for _, t := range ts {
+		if _, ok := cnts[t.Aid]; !ok {
+			aids = append(aids, t.Aid)
+		}
+		cnts[t.Aid]++
+	}
+	bizs := make([]string, 0, len(aids))
+	vals := make([]int64, 0, len(aids))
+	for _, aid := range aids {
+		bizs = append(bizs, "article")
+		vals = append(vals, cnts[aid])
+	}
+	ctx, span := saramax.StartConsumeSpan(context.Background(), msgs...)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	return i.repo.BatchIncrReadCnt(ctx, bizs, aids, vals)
+}
+
 func (i *InteractiveReadEventConsumer) Consume(msg *sarama.ConsumerMessage, t ReadEvent) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, span := saramax.StartConsumeSpan(context.Background(), msg)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 	return i.repo.IncrReadCnt(ctx, "article", t.Aid)
 }
 
-func NewInteractiveReadEventConsumer(client sarama.Client, repo repository.InteractiveRepository, l logger.LoggerV1) *InteractiveReadEventConsumer {
-	return &InteractiveReadEventConsumer{client: client, repo: repo, l: l}
+func NewInteractiveReadEventConsumer(client sarama.Client, repo repository.InteractiveRepository, l logger.LoggerV1,
+	dlq *saramax.DeadLetterProducer) *InteractiveReadEventConsumer {
+	return &InteractiveReadEventConsumer{client: client, repo: repo, l: l, dlq: dlq}
 }
@@ -3,7 +3,9 @@ package article
 import (
 	"context"
 	"encoding/json"
+	"geekgo/week9/webook/pkgs/saramax"
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type Producer interface {
@@ -19,13 +21,19 @@ func (k *KafkaProducer) ProduceReadEvent(ctx context.Context, evt ReadEvent) err
 	if err != nil {
 		return err
 	}
-	_, _, err = k.producer.SendMessage(
-
-		&sarama.ProducerMessage{
-			Topic: "read_article",
-			// Key: // The partitioning key for this message.
-			Value: sarama.ByteEncoder(data), // type ByteEncoder []byte
-		})
+	msg := &sarama.ProducerMessage{
+		Topic: "read_article",
+		// Key: // The partitioning key for this message.
+		Value: sarama.ByteEncoder(data), // type ByteEncoder []byte
+	}
+	// trace 放在消息头里面，消费者那边接着这个 trace
+	_, span := saramax.StartProduceSpan(ctx, msg)
+	defer span.End()
+	_, _, err = k.producer.SendMessage(msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 	return err
 }
 
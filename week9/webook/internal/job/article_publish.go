@@ -0,0 +1,64 @@
+package job
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/pkgs/logger"
+	"time"
+)
+
+// ScheduledPublisher 定时发表的后台任务
+// 多个实例可以同时跑，抢占的时候用的是乐观锁，一个定时发表只会被一个实例执行
+type ScheduledPublisher struct {
+	svc service.ArticleService
+	l   logger.LoggerV1
+	// 没有到时间的任务的时候，等多久再去抢占
+	interval time.Duration
+}
+
+func NewScheduledPublisher(svc service.ArticleService, l logger.LoggerV1) *ScheduledPublisher {
+	return &ScheduledPublisher{
+		svc:      svc,
+		l:        l,
+		interval: time.Second * 5,
+	}
+}
+
+func (p *ScheduledPublisher) Start() error {
+	go func() {
+		err := p.Schedule(context.Background())
+		if err != nil {
+			p.l.Error("定时发表任务退出", logger.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (p *ScheduledPublisher) Schedule(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// 抢占加上发表，一起给一个超时时间
+		dbCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		aid, err := p.svc.PublishScheduled(dbCtx)
+		cancel()
+		switch err {
+		case nil:
+			p.l.Info("定时发表成功", logger.Int64("aid", aid))
+			// 马上进入下一轮，可能还有别的到时间了
+			continue
+		case service.ErrNoDueSchedule:
+		case service.ErrScheduleUnsupported:
+			p.l.Warn("文章存储不支持定时发表，定时发表任务退出")
+			return nil
+		default:
+			p.l.Error("定时发表失败", logger.Int64("aid", aid), logger.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.interval):
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package job
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/pkgs/logger"
+	"time"
+)
+
+// RankingJob 定时重新计算热榜
+// 多个实例都跑也没关系，算出来的结果是一样的，只是浪费一点资源
+type RankingJob struct {
+	svc      service.RankingService
+	l        logger.LoggerV1
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func NewRankingJob(svc service.RankingService, l logger.LoggerV1) *RankingJob {
+	return &RankingJob{
+		svc:      svc,
+		l:        l,
+		interval: time.Minute,
+		timeout:  time.Second * 30,
+	}
+}
+
+func (j *RankingJob) Start() error {
+	go func() {
+		err := j.Run(context.Background())
+		if err != nil {
+			j.l.Error("热榜任务退出", logger.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (j *RankingJob) Run(ctx context.Context) error {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		rankCtx, cancel := context.WithTimeout(ctx, j.timeout)
+		start := time.Now()
+		err := j.svc.RankHot(rankCtx)
+		cancel()
+		if err == service.ErrRankingUnsupported {
+			j.l.Warn("文章存储不支持热榜，热榜任务退出")
+			return nil
+		}
+		if err != nil {
+			j.l.Error("计算热榜失败", logger.Error(err))
+		} else {
+			j.l.Debug("计算热榜成功", logger.Int64("duration_ms", time.Since(start).Milliseconds()))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
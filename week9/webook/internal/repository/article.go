@@ -3,10 +3,22 @@ package repository
 import (
 	"context"
 	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository/cache"
 	"geekgo/week9/webook/internal/repository/dao"
+	"geekgo/week9/webook/pkgs/logger"
 	"time"
 )
 
+var (
+	ErrPossibleIncorrectAuthor = dao.ErrPossibleIncorrectAuthor
+	ErrArticleNotFound         = dao.ErrRecordNotFound
+	ErrScheduleNotFound        = dao.ErrScheduleNotFound
+	// ErrNoDueSchedule 没有到时间的定时发表任务
+	ErrNoDueSchedule        = dao.ErrNoDueSchedule
+	ErrScheduleLeaseExpired = dao.ErrScheduleLeaseExpired
+	ErrScheduleUnsupported  = dao.ErrScheduleUnsupported
+)
+
 type ArticleRepository interface {
 	Update(ctx context.Context, art domain.Article) error
 	Create(ctx context.Context, art domain.Article) (int64, error)
@@ -14,19 +26,231 @@ type ArticleRepository interface {
 	SyncStatus(ctx context.Context, aid int64, uid int64, status domain.ArticleStatus) error
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPublishedById(ctx context.Context, id int64) (domain.Article, error)
+	ListRevisions(ctx context.Context, aid int64, uid int64) ([]domain.ArticleRevision, error)
+	GetRevision(ctx context.Context, aid int64, uid int64, version int64) (domain.ArticleRevision, error)
+	// Schedule 保存草稿和设置定时发表在一个事务里面
+	Schedule(ctx context.Context, art domain.Article, publishTime time.Time) (int64, error)
+	CancelSchedule(ctx context.Context, aid int64, uid int64) error
+	PreemptSchedule(ctx context.Context) (domain.ArticleSchedule, error)
+	ReleaseSchedule(ctx context.Context, s domain.ArticleSchedule) error
+	FinishSchedule(ctx context.Context, s domain.ArticleSchedule) error
+	ListByAuthor(ctx context.Context, uid int64, cursor domain.Cursor, limit int) ([]domain.Article, error)
+	ListPublished(ctx context.Context, authorId int64, cursor domain.Cursor, limit int) ([]domain.Article, error)
 }
 
 // 制作库和线上库 mysql同库不同表 可以统一使用一个ArticleDAO
 type articleRepository struct {
 	dao dao.ArticleDAO
+	// 定时发表任务
+	scheduleDAO dao.ArticleScheduleDAO
+	// 只缓存线上库的数据，制作库只有作者自己看，没必要缓存
+	cache cache.ArticleCache
+	l     logger.LoggerV1
+}
+
+func (repo *articleRepository) Schedule(ctx context.Context, art domain.Article, publishTime time.Time) (int64, error) {
+	return repo.scheduleDAO.Upsert(ctx, dao.Article{
+		Id:       art.Id,
+		Title:    art.Title,
+		Content:  art.Content,
+		AuthorId: art.Author.Id,
+		Status:   art.Status.ToUint8(),
+	}, publishTime.UnixMilli())
+}
+
+func (repo *articleRepository) CancelSchedule(ctx context.Context, aid int64, uid int64) error {
+	return repo.scheduleDAO.Cancel(ctx, aid, uid)
+}
+
+func (repo *articleRepository) PreemptSchedule(ctx context.Context) (domain.ArticleSchedule, error) {
+	s, err := repo.scheduleDAO.Preempt(ctx)
+	if err != nil {
+		return domain.ArticleSchedule{}, err
+	}
+	return domain.ArticleSchedule{
+		Id:          s.Id,
+		ArticleId:   s.ArticleId,
+		AuthorId:    s.AuthorId,
+		PublishTime: time.UnixMilli(s.PublishTime),
+		Version:     s.Version,
+	}, nil
+}
+
+func (repo *articleRepository) ReleaseSchedule(ctx context.Context, s domain.ArticleSchedule) error {
+	return repo.scheduleDAO.Release(ctx, s.Id, s.Version)
+}
+
+func (repo *articleRepository) FinishSchedule(ctx context.Context, s domain.ArticleSchedule) error {
+	return repo.scheduleDAO.Finish(ctx, s.Id, s.Version)
+}
+
+func (repo *articleRepository) ListRevisions(ctx context.Context, aid int64, uid int64) ([]domain.ArticleRevision, error) {
+	revs, err := repo.dao.ListRevisions(ctx, aid, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.ArticleRevision, 0, len(revs))
+	for _, rev := range revs {
+		res = append(res, repo.revisionToDomain(rev))
+	}
+	return res, nil
+}
+
+func (repo *articleRepository) GetRevision(ctx context.Context, aid int64, uid int64, version int64) (domain.ArticleRevision, error) {
+	rev, err := repo.dao.GetRevision(ctx, aid, uid, version)
+	if err != nil {
+		return domain.ArticleRevision{}, err
+	}
+	return repo.revisionToDomain(rev), nil
+}
+
+func (repo *articleRepository) revisionToDomain(rev dao.ArticleRevision) domain.ArticleRevision {
+	return domain.ArticleRevision{
+		Id:        rev.Id,
+		ArticleId: rev.ArticleId,
+		Version:   rev.Version,
+		Title:     rev.Title,
+		Content:   rev.Content,
+		Author: domain.Author{
+			Id: rev.AuthorId,
+		},
+		Status: domain.ArticleStatus(rev.Status),
+		Ctime:  time.UnixMilli(rev.Ctime),
+	}
+}
+
+func (repo *articleRepository) ListByAuthor(ctx context.Context, uid int64, cursor domain.Cursor, limit int) ([]domain.Article, error) {
+	arts, err := repo.dao.ListByAuthor(ctx, uid, repo.toDAOCursor(cursor), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, repo.toDomain(art))
+	}
+	return res, nil
+}
+
+func (repo *articleRepository) ListPublished(ctx context.Context, authorId int64, cursor domain.Cursor, limit int) ([]domain.Article, error) {
+	// 第一页是最多人看的，走缓存
+	if cursor.IsZero() && limit <= cache.FirstPageSize {
+		arts, err := repo.firstPage(ctx, authorId)
+		if err != nil {
+			return nil, err
+		}
+		if len(arts) > limit {
+			arts = arts[:limit]
+		}
+		return arts, nil
+	}
+	return repo.listPublished(ctx, authorId, cursor, limit)
+}
+
+func (repo *articleRepository) firstPage(ctx context.Context, authorId int64) ([]domain.Article, error) {
+	arts, err := repo.cache.GetFirstPage(ctx, authorId)
+	if err == nil {
+		return arts, nil
+	}
+	// 和 GetPublishedById 一样，读的过程中有文章发表或者撤回了，就不回写
+	ver, verErr := repo.cache.FirstPageVersion(ctx, authorId)
+	arts, err = repo.listPublished(ctx, authorId, domain.Cursor{}, cache.FirstPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if verErr != nil {
+		repo.l.Error("获取作者文章列表第一页缓存版本号失败，不回写",
+			logger.Int64("author_id", authorId), logger.Error(verErr))
+		return arts, nil
+	}
+	err = repo.cache.SetFirstPage(ctx, authorId, arts, ver)
+	if err != nil {
+		repo.l.Error("回写作者文章列表第一页缓存失败",
+			logger.Int64("author_id", authorId), logger.Error(err))
+	}
+	return arts, nil
+}
+
+func (repo *articleRepository) listPublished(ctx context.Context, authorId int64, cursor domain.Cursor, limit int) ([]domain.Article, error) {
+	arts, err := repo.dao.ListPublished(ctx, authorId, repo.toDAOCursor(cursor), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, repo.toDomain(dao.Article(art)))
+	}
+	return res, nil
+}
+
+// prefetchFirstPage 发表之后，作者的粉丝大概率会去看作者的文章列表，提前把第一页准备好
+func (repo *articleRepository) prefetchFirstPage(authorId int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// 后面又有发表或者撤回的话，版本号变了，这次读到的不会覆盖掉
+	ver, err := repo.cache.FirstPageVersion(ctx, authorId)
+	if err == nil {
+		var arts []domain.Article
+		arts, err = repo.listPublished(ctx, authorId, domain.Cursor{}, cache.FirstPageSize)
+		if err == nil {
+			err = repo.cache.SetFirstPage(ctx, authorId, arts, ver)
+		}
+	}
+	if err != nil {
+		repo.l.Error("预加载作者文章列表第一页失败",
+			logger.Int64("author_id", authorId), logger.Error(err))
+	}
+}
+
+// invalidate 线上库变了，删掉文章本身和作者列表第一页的缓存
+func (repo *articleRepository) invalidate(ctx context.Context, aid int64, authorId int64) {
+	err := repo.cache.DelPub(ctx, aid)
+	if err != nil {
+		repo.l.Error("删除文章缓存失败",
+			logger.Int64("aid", aid), logger.Error(err))
+	}
+	err = repo.cache.DelFirstPage(ctx, authorId)
+	if err != nil {
+		repo.l.Error("删除作者文章列表第一页缓存失败",
+			logger.Int64("author_id", authorId), logger.Error(err))
+	}
+}
+
+func (repo *articleRepository) toDAOCursor(cursor domain.Cursor) dao.Cursor {
+	if cursor.IsZero() {
+		return dao.Cursor{}
+	}
+	return dao.Cursor{
+		Utime: cursor.Utime.UnixMilli(),
+		Id:    cursor.Id,
+	}
+}
+
+func (repo *articleRepository) toDomain(art dao.Article) domain.Article {
+	return domain.Article{
+		Id:      art.Id,
+		Title:   art.Title,
+		Content: art.Content,
+		Author: domain.Author{
+			Id: art.AuthorId,
+		},
+		Status: domain.ArticleStatus(art.Status),
+		Ctime:  time.UnixMilli(art.Ctime),
+		Utime:  time.UnixMilli(art.Utime),
+	}
 }
 
 func (repo *articleRepository) GetPublishedById(ctx context.Context, id int64) (domain.Article, error) {
+	res, err := repo.cache.GetPub(ctx, id)
+	if err == nil {
+		return res, nil
+	}
+	// 读数据库之前拿版本号，读的过程中文章被修改或者撤回了，就不会把旧数据写回去
+	ver, verErr := repo.cache.PubVersion(ctx, id)
 	da, err := repo.dao.GetPublishedById(ctx, id)
 	if err != nil {
 		return domain.Article{}, err
 	}
-	return domain.Article{
+	res = domain.Article{
 		Id:      da.Id,
 		Title:   da.Title,
 		Content: da.Content,
@@ -36,7 +260,16 @@ func (repo *articleRepository) GetPublishedById(ctx context.Context, id int64) (
 		Status: domain.ArticleStatus(da.Status),
 		Ctime:  time.UnixMilli(da.Ctime),
 		Utime:  time.UnixMilli(da.Utime),
-	}, err
+	}
+	if verErr != nil {
+		repo.l.Error("获取文章缓存版本号失败，不回写", logger.Int64("aid", id), logger.Error(verErr))
+		return res, nil
+	}
+	err = repo.cache.SetPub(ctx, res, ver)
+	if err != nil {
+		repo.l.Error("回写文章缓存失败", logger.Int64("aid", id), logger.Error(err))
+	}
+	return res, nil
 }
 
 func (repo *articleRepository) GetById(ctx context.Context, id int64) (domain.Article, error) {
@@ -58,7 +291,12 @@ func (repo *articleRepository) GetById(ctx context.Context, id int64) (domain.Ar
 }
 
 func (repo *articleRepository) SyncStatus(ctx context.Context, aid int64, uid int64, status domain.ArticleStatus) error {
-	return repo.dao.SyncStatus(ctx, aid, uid, status.ToUint8())
+	err := repo.dao.SyncStatus(ctx, aid, uid, status.ToUint8())
+	if err != nil {
+		return err
+	}
+	repo.invalidate(ctx, aid, uid)
+	return nil
 }
 
 func (repo *articleRepository) Sync(ctx context.Context, art domain.Article) (int64, error) {
@@ -69,7 +307,12 @@ func (repo *articleRepository) Sync(ctx context.Context, art domain.Article) (in
 		AuthorId: art.Author.Id,
 		Status:   art.Status.ToUint8(),
 	})
-	return id, err
+	if err != nil {
+		return id, err
+	}
+	repo.invalidate(ctx, id, art.Author.Id)
+	go repo.prefetchFirstPage(art.Author.Id)
+	return id, nil
 }
 
 func (repo *articleRepository) Create(ctx context.Context, art domain.Article) (int64, error) {
@@ -92,8 +335,12 @@ func (repo *articleRepository) Update(ctx context.Context, art domain.Article) e
 	})
 }
 
-func NewArticleRepository(dao dao.ArticleDAO) ArticleRepository {
+func NewArticleRepository(dao dao.ArticleDAO, scheduleDAO dao.ArticleScheduleDAO,
+	cache cache.ArticleCache, l logger.LoggerV1) ArticleRepository {
 	return &articleRepository{
-		dao: dao,
+		dao:         dao,
+		scheduleDAO: scheduleDAO,
+		cache:       cache,
+		l:           l,
 	}
 }
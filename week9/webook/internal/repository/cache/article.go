@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// FirstPageSize 缓存作者已发表文章列表的第一页，只缓存这么多条
+const FirstPageSize = 50
+
+// versionTTL 版本号要比任何一次读数据库的时间都长，不然过期之后旧的读请求又能回写了
+const versionTTL = time.Hour
+
+//go:embed lua/set_with_version.lua
+var luaSetWithVersion string
+
+type ArticleCache interface {
+	GetPub(ctx context.Context, id int64) (domain.Article, error)
+	// PubVersion 缓存没命中，读数据库之前先拿到版本号，回写的时候交给 SetPub
+	PubVersion(ctx context.Context, id int64) (int64, error)
+	// SetPub version 和缓存里面的对不上，说明读数据库的时候文章被 DelPub 过了，不回写
+	SetPub(ctx context.Context, art domain.Article, version int64) error
+	// DelPub 删掉缓存，同时版本号加 1，让正在读数据库的请求不能回写旧数据
+	DelPub(ctx context.Context, id int64) error
+	// GetFirstPage 作者已发表文章的第一页，里面的 Content 只有摘要
+	GetFirstPage(ctx context.Context, authorId int64) ([]domain.Article, error)
+	// FirstPageVersion 和 PubVersion 一样，读数据库之前拿到，回写的时候交给 SetFirstPage
+	FirstPageVersion(ctx context.Context, authorId int64) (int64, error)
+	SetFirstPage(ctx context.Context, authorId int64, arts []domain.Article, version int64) error
+	// DelFirstPage 删掉缓存，同时版本号加 1
+	DelFirstPage(ctx context.Context, authorId int64) error
+}
+
+type RedisArticleCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisArticleCache(client redis.Cmdable) ArticleCache {
+	return &RedisArticleCache{client: client}
+}
+
+func (r *RedisArticleCache) GetPub(ctx context.Context, id int64) (domain.Article, error) {
+	data, err := r.client.Get(ctx, r.pubKey(id)).Bytes()
+	if err != nil {
+		return domain.Article{}, err
+	}
+	var art articleEntity
+	err = json.Unmarshal(data, &art)
+	return art.toDomain(), err
+}
+
+func (r *RedisArticleCache) PubVersion(ctx context.Context, id int64) (int64, error) {
+	return r.version(ctx, r.pubKey(id))
+}
+
+func (r *RedisArticleCache) SetPub(ctx context.Context, art domain.Article, version int64) error {
+	data, err := json.Marshal(newArticleEntity(art))
+	if err != nil {
+		return err
+	}
+	ttl := r.pubTTL(len(data))
+	if ttl <= 0 {
+		// 太大了，不缓存，不然 redis 的大 key 问题比打到数据库还麻烦
+		return nil
+	}
+	return r.client.Eval(ctx, luaSetWithVersion, []string{r.pubKey(art.Id)},
+		data, ttl.Milliseconds(), version).Err()
+}
+
+func (r *RedisArticleCache) DelPub(ctx context.Context, id int64) error {
+	return r.delWithVersion(ctx, r.pubKey(id))
+}
+
+func (r *RedisArticleCache) GetFirstPage(ctx context.Context, authorId int64) ([]domain.Article, error) {
+	data, err := r.client.Get(ctx, r.firstPageKey(authorId)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var ents []articleEntity
+	err = json.Unmarshal(data, &ents)
+	if err != nil {
+		return nil, err
+	}
+	arts := make([]domain.Article, 0, len(ents))
+	for _, ent := range ents {
+		arts = append(arts, ent.toDomain())
+	}
+	return arts, nil
+}
+
+func (r *RedisArticleCache) FirstPageVersion(ctx context.Context, authorId int64) (int64, error) {
+	return r.version(ctx, r.firstPageKey(authorId))
+}
+
+func (r *RedisArticleCache) SetFirstPage(ctx context.Context, authorId int64, arts []domain.Article, version int64) error {
+	// 列表页只要摘要，没必要把全文都放进去
+	page := make([]articleEntity, 0, len(arts))
+	for _, art := range arts {
+		art.Content = art.Abstract()
+		page = append(page, newArticleEntity(art))
+	}
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	return r.client.Eval(ctx, luaSetWithVersion, []string{r.firstPageKey(authorId)},
+		data, (time.Minute * 10).Milliseconds(), version).Err()
+}
+
+func (r *RedisArticleCache) DelFirstPage(ctx context.Context, authorId int64) error {
+	return r.delWithVersion(ctx, r.firstPageKey(authorId))
+}
+
+func (r *RedisArticleCache) version(ctx context.Context, key string) (int64, error) {
+	ver, err := r.client.Get(ctx, r.versionKey(key)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return ver, err
+}
+
+// delWithVersion 删掉缓存，同时版本号加 1，让正在读数据库的请求不能回写旧数据
+func (r *RedisArticleCache) delWithVersion(ctx context.Context, key string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, r.versionKey(key))
+		pipe.Expire(ctx, r.versionKey(key), versionTTL)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	return err
+}
+
+// pubTTL 根据文章的大小决定过期时间
+// 小文章占不了多少内存，可以多缓存一会；大文章缓存时间短一点；特别大的不缓存
+func (r *RedisArticleCache) pubTTL(size int) time.Duration {
+	switch {
+	case size <= 16*1024:
+		return time.Minute * 30
+	case size <= 256*1024:
+		return time.Minute * 10
+	case size <= 1024*1024:
+		return time.Minute
+	default:
+		return 0
+	}
+}
+
+func (r *RedisArticleCache) pubKey(id int64) string {
+	return fmt.Sprintf("article:pub:detail:%d", id)
+}
+
+// versionKey 和 lua/set_with_version.lua 里面的要一致
+func (r *RedisArticleCache) versionKey(key string) string {
+	return key + ":ver"
+}
+
+func (r *RedisArticleCache) firstPageKey(authorId int64) string {
+	return fmt.Sprintf("article:pub:first_page:%d", authorId)
+}
+
+// articleEntity 缓存里面存的结构
+// domain.Article 里面嵌入了 Author，直接 JSON 序列化的话 Author.Id 会被 Article.Id 覆盖掉
+type articleEntity struct {
+	Id         int64  `json:"id"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	AuthorId   int64  `json:"author_id"`
+	AuthorName string `json:"author_name"`
+	Status     uint8  `json:"status"`
+	Ctime      int64  `json:"ctime"`
+	Utime      int64  `json:"utime"`
+}
+
+func newArticleEntity(art domain.Article) articleEntity {
+	return articleEntity{
+		Id:         art.Id,
+		Title:      art.Title,
+		Content:    art.Content,
+		AuthorId:   art.Author.Id,
+		AuthorName: art.Author.Name,
+		Status:     art.Status.ToUint8(),
+		Ctime:      art.Ctime.UnixMilli(),
+		Utime:      art.Utime.UnixMilli(),
+	}
+}
+
+func (a articleEntity) toDomain() domain.Article {
+	return domain.Article{
+		Id:      a.Id,
+		Title:   a.Title,
+		Content: a.Content,
+		Author: domain.Author{
+			Id:   a.AuthorId,
+			Name: a.AuthorName,
+		},
+		Status: domain.ArticleStatus(a.Status),
+		Ctime:  time.UnixMilli(a.Ctime),
+		Utime:  time.UnixMilli(a.Utime),
+	}
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ArticleCacheTestSuite struct {
+	suite.Suite
+	mr     *miniredis.Miniredis
+	client redis.Cmdable
+	cache  ArticleCache
+}
+
+func (s *ArticleCacheTestSuite) SetupTest() {
+	s.mr = miniredis.RunT(s.T())
+	s.client = redis.NewClient(&redis.Options{
+		Addr: s.mr.Addr(),
+	})
+	s.cache = NewRedisArticleCache(s.client)
+}
+
+func (s *ArticleCacheTestSuite) TestPub() {
+	t := s.T()
+	// 缓存里面的时间精度是毫秒
+	now := time.UnixMilli(time.Now().UnixMilli())
+	testCases := []struct {
+		name    string
+		art     domain.Article
+		wantTTL time.Duration
+		// 太大的文章不缓存
+		wantCached bool
+	}{
+		{
+			name: "小文章",
+			art: domain.Article{
+				Id:      1,
+				Title:   "标题",
+				Content: "内容",
+				Author:  domain.Author{Id: 123},
+				Status:  domain.ArticleStatusPublished,
+				Ctime:   now,
+				Utime:   now,
+			},
+			wantTTL:    time.Minute * 30,
+			wantCached: true,
+		},
+		{
+			name: "中等大小的文章",
+			art: domain.Article{
+				Id:      2,
+				Content: strings.Repeat("a", 100*1024),
+				Ctime:   now,
+				Utime:   now,
+			},
+			wantTTL:    time.Minute * 10,
+			wantCached: true,
+		},
+		{
+			name: "大文章",
+			art: domain.Article{
+				Id:      3,
+				Content: strings.Repeat("a", 512*1024),
+				Ctime:   now,
+				Utime:   now,
+			},
+			wantTTL:    time.Minute,
+			wantCached: true,
+		},
+		{
+			name: "超大文章",
+			art: domain.Article{
+				Id:      4,
+				Content: strings.Repeat("a", 2*1024*1024),
+				Ctime:   now,
+				Utime:   now,
+			},
+			wantCached: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			err := s.cache.SetPub(ctx, tc.art, 0)
+			require.NoError(t, err)
+
+			got, err := s.cache.GetPub(ctx, tc.art.Id)
+			if !tc.wantCached {
+				assert.Equal(t, redis.Nil, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.art, got)
+			assert.Equal(t, tc.wantTTL, s.mr.TTL(s.cache.(*RedisArticleCache).pubKey(tc.art.Id)))
+
+			err = s.cache.DelPub(ctx, tc.art.Id)
+			require.NoError(t, err)
+			_, err = s.cache.GetPub(ctx, tc.art.Id)
+			assert.Equal(t, redis.Nil, err)
+		})
+	}
+}
+
+func (s *ArticleCacheTestSuite) TestPubExpire() {
+	t := s.T()
+	ctx := context.Background()
+	err := s.cache.SetPub(ctx, domain.Article{Id: 1, Content: "内容"}, 0)
+	require.NoError(t, err)
+	s.mr.FastForward(time.Minute * 31)
+	_, err = s.cache.GetPub(ctx, 1)
+	assert.Equal(t, redis.Nil, err)
+}
+
+// 读数据库的时候文章被撤回了，读到的旧数据不能写回缓存
+func (s *ArticleCacheTestSuite) TestPubStaleWriteBack() {
+	t := s.T()
+	ctx := context.Background()
+	ver, err := s.cache.PubVersion(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), ver)
+
+	err = s.cache.DelPub(ctx, 1)
+	require.NoError(t, err)
+	err = s.cache.SetPub(ctx, domain.Article{Id: 1, Content: "旧内容"}, ver)
+	require.NoError(t, err)
+	_, err = s.cache.GetPub(ctx, 1)
+	assert.Equal(t, redis.Nil, err)
+
+	// 拿到新的版本号之后读的，可以回写
+	ver, err = s.cache.PubVersion(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), ver)
+	err = s.cache.SetPub(ctx, domain.Article{Id: 1, Content: "新内容"}, ver)
+	require.NoError(t, err)
+	got, err := s.cache.GetPub(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "新内容", got.Content)
+}
+
+func (s *ArticleCacheTestSuite) TestFirstPage() {
+	t := s.T()
+	ctx := context.Background()
+	const authorId = 123
+	now := time.UnixMilli(time.Now().UnixMilli())
+
+	_, err := s.cache.GetFirstPage(ctx, authorId)
+	assert.Equal(t, redis.Nil, err)
+
+	arts := []domain.Article{
+		{Id: 2, Title: "长文章", Content: strings.Repeat("长", 1000), Utime: now, Ctime: now},
+		{Id: 1, Title: "短文章", Content: "短", Utime: now, Ctime: now},
+	}
+	err = s.cache.SetFirstPage(ctx, authorId, arts, 0)
+	require.NoError(t, err)
+
+	got, err := s.cache.GetFirstPage(ctx, authorId)
+	require.NoError(t, err)
+	// 缓存里面只有摘要
+	assert.Equal(t, []domain.Article{
+		{Id: 2, Title: "长文章", Content: strings.Repeat("长", 128), Utime: now, Ctime: now},
+		{Id: 1, Title: "短文章", Content: "短", Utime: now, Ctime: now},
+	}, got)
+
+	err = s.cache.DelFirstPage(ctx, authorId)
+	require.NoError(t, err)
+	_, err = s.cache.GetFirstPage(ctx, authorId)
+	assert.Equal(t, redis.Nil, err)
+
+	// 删除之前拿到的版本号，读到的是撤回之前的列表，不能回写
+	err = s.cache.SetFirstPage(ctx, authorId, arts, 0)
+	require.NoError(t, err)
+	_, err = s.cache.GetFirstPage(ctx, authorId)
+	assert.Equal(t, redis.Nil, err)
+	ver, err := s.cache.FirstPageVersion(ctx, authorId)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), ver)
+	err = s.cache.SetFirstPage(ctx, authorId, arts, ver)
+	require.NoError(t, err)
+	_, err = s.cache.GetFirstPage(ctx, authorId)
+	require.NoError(t, err)
+}
+
+func TestArticleCache(t *testing.T) {
+	suite.Run(t, new(ArticleCacheTestSuite))
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrCodeSendTooMany   = errors.New("发送验证码太频繁")
+	ErrCodeVerifyTooMany = errors.New("验证次数太多")
+	ErrUnknownForCode    = errors.New("验证码相关的未知错误")
+)
+
+var (
+	//go:embed lua/set_code.lua
+	luaSetCode string
+	//go:embed lua/verify_code.lua
+	luaVerifyCode string
+)
+
+type CodeCache interface {
+	// Set 一分钟之内只能发一次，验证码十分钟有效
+	Set(ctx context.Context, biz string, phone string, code string) error
+	// Verify 一个验证码最多验证三次，验证成功之后就不能再用了
+	Verify(ctx context.Context, biz string, phone string, inputCode string) (bool, error)
+}
+
+type RedisCodeCache struct {
+	cmd redis.Cmdable
+}
+
+func NewRedisCodeCache(cmd redis.Cmdable) CodeCache {
+	return &RedisCodeCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisCodeCache) Set(ctx context.Context, biz string, phone string, code string) error {
+	res, err := c.cmd.Eval(ctx, luaSetCode, []string{c.key(biz, phone)}, code).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return nil
+	case -1:
+		return ErrCodeSendTooMany
+	default:
+		// -2 是有人手动设置了这个 key 但是没有过期时间
+		return ErrUnknownForCode
+	}
+}
+
+func (c *RedisCodeCache) Verify(ctx context.Context, biz string, phone string, inputCode string) (bool, error) {
+	res, err := c.cmd.Eval(ctx, luaVerifyCode, []string{c.key(biz, phone)}, inputCode).Int()
+	if err != nil {
+		return false, err
+	}
+	switch res {
+	case 0:
+		return true, nil
+	case -1:
+		// 一直输错，或者已经用过了
+		return false, ErrCodeVerifyTooMany
+	default:
+		// -2 输错了，-3 没发过或者过期了，都当作验证码不对
+		return false, nil
+	}
+}
+
+func (c *RedisCodeCache) key(biz string, phone string) string {
+	return fmt.Sprintf("phone_code:%s:%s", biz, phone)
+}
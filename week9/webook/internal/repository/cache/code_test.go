@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisCodeCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewRedisCodeCache(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}))
+	ctx := context.Background()
+
+	// 没发过验证码
+	ok, err := c.Verify(ctx, "login", "13800000000", "123456")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	err = c.Set(ctx, "login", "13800000000", "123456")
+	require.NoError(t, err)
+	err = c.Set(ctx, "login", "13800000000", "654321")
+	assert.Equal(t, ErrCodeSendTooMany, err)
+	// 过了一分钟可以重新发
+	mr.FastForward(time.Minute + time.Second)
+	err = c.Set(ctx, "login", "13800000000", "654321")
+	require.NoError(t, err)
+
+	ok, err = c.Verify(ctx, "login", "13800000000", "123456")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.Verify(ctx, "login", "13800000000", "654321")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// 用过了就不能再用
+	_, err = c.Verify(ctx, "login", "13800000000", "654321")
+	assert.Equal(t, ErrCodeVerifyTooMany, err)
+
+	// 输错三次
+	err = c.Set(ctx, "login", "13900000000", "123456")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		ok, err = c.Verify(ctx, "login", "13900000000", "000000")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+	_, err = c.Verify(ctx, "login", "13900000000", "123456")
+	assert.Equal(t, ErrCodeVerifyTooMany, err)
+
+	// 没有过期时间的 key
+	mr.Set("phone_code:login:13700000000", "123456")
+	err = c.Set(ctx, "login", "13700000000", "123456")
+	assert.Equal(t, ErrUnknownForCode, err)
+}
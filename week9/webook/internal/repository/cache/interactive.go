@@ -27,9 +27,17 @@ type InteractiveCache interface {
 	IncrLikeCntIfPresent(ctx context.Context, biz string, bizId int64) error
 	DecrLikeCntIfPresent(ctx context.Context, biz string, bizId int64) error
 	IncrReadCntIfPresent(ctx context.Context, biz string, bizId int64) error
+	// BatchIncrReadCntIfPresent 用 pipeline 一次发过去，减少网络往返
+	BatchIncrReadCntIfPresent(ctx context.Context, bizs []string, bizIds []int64, cnts []int64) error
 	IncrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error
+	DecrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error
+	// BatchDecrCollectCntIfPresent 删除收藏夹的时候用，bizs 和 bizIds 一一对应
+	BatchDecrCollectCntIfPresent(ctx context.Context, bizs []string, bizIds []int64) error
 	Get(ctx context.Context, biz string, bizId int64) (domain.Interactive, error)
 	Set(ctx context.Context, biz string, bizId int64, intr domain.Interactive) error
+	// GetByIds 只返回命中缓存的
+	GetByIds(ctx context.Context, biz string, bizIds []int64) (map[int64]domain.Interactive, error)
+	SetByIds(ctx context.Context, biz string, intrs map[int64]domain.Interactive) error
 }
 
 type RedisInteractiveCache struct {
@@ -72,6 +80,57 @@ func (r *RedisInteractiveCache) Set(ctx context.Context, biz string, bizId int64
 	return r.client.Expire(ctx, key, time.Minute*15).Err()
 }
 
+func (r *RedisInteractiveCache) GetByIds(ctx context.Context, biz string, bizIds []int64) (map[int64]domain.Interactive, error) {
+	// 一次 pipeline 把所有的 HMGET 发过去
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, 0, len(bizIds))
+	for _, bizId := range bizIds {
+		cmds = append(cmds, pipe.HMGet(ctx, r.key(biz, bizId),
+			fieldLikeCnt, fieldCollectCnt, fieldReadCnt))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]domain.Interactive, len(bizIds))
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		// key 不存在的时候，所有的字段都是 nil
+		if vals[0] == nil && vals[1] == nil && vals[2] == nil {
+			continue
+		}
+		res[bizIds[i]] = domain.Interactive{
+			LikeCnt:    r.parseCnt(vals[0]),
+			CollectCnt: r.parseCnt(vals[1]),
+			ReadCnt:    r.parseCnt(vals[2]),
+		}
+	}
+	return res, nil
+}
+
+func (r *RedisInteractiveCache) SetByIds(ctx context.Context, biz string, intrs map[int64]domain.Interactive) error {
+	if len(intrs) == 0 {
+		return nil
+	}
+	pipe := r.client.Pipeline()
+	for bizId, intr := range intrs {
+		key := r.key(biz, bizId)
+		pipe.HMSet(ctx, key,
+			fieldLikeCnt, intr.LikeCnt,
+			fieldCollectCnt, intr.CollectCnt,
+			fieldReadCnt, intr.ReadCnt)
+		pipe.Expire(ctx, key, time.Minute*15)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisInteractiveCache) parseCnt(val any) int64 {
+	str, _ := val.(string)
+	cnt, _ := strconv.ParseInt(str, 10, 64)
+	return cnt
+}
+
 func (r *RedisInteractiveCache) IncrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error {
 	return r.client.Eval(ctx, luaIncrCnt, []string{r.key(biz, bizId)},
 		fieldCollectCnt, 1).Err()
@@ -81,6 +140,37 @@ func (r *RedisInteractiveCache) IncrReadCntIfPresent(ctx context.Context, biz st
 	return r.client.Eval(ctx, luaIncrCnt, []string{r.key(biz, bizId)}, fieldReadCnt, 1).Err()
 }
 
+func (r *RedisInteractiveCache) DecrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error {
+	return r.client.Eval(ctx, luaIncrCnt, []string{r.key(biz, bizId)},
+		fieldCollectCnt, -1).Err()
+}
+
+func (r *RedisInteractiveCache) BatchDecrCollectCntIfPresent(ctx context.Context, bizs []string, bizIds []int64) error {
+	deltas := make([]int64, len(bizs))
+	for i := range deltas {
+		deltas[i] = -1
+	}
+	return r.batchIncrIfPresent(ctx, fieldCollectCnt, bizs, bizIds, deltas)
+}
+
+func (r *RedisInteractiveCache) BatchIncrReadCntIfPresent(ctx context.Context,
+	bizs []string, bizIds []int64, cnts []int64) error {
+	return r.batchIncrIfPresent(ctx, fieldReadCnt, bizs, bizIds, cnts)
+}
+
+func (r *RedisInteractiveCache) batchIncrIfPresent(ctx context.Context, field string,
+	bizs []string, bizIds []int64, deltas []int64) error {
+	if len(bizs) == 0 {
+		return nil
+	}
+	pipe := r.client.Pipeline()
+	for i := range bizs {
+		pipe.Eval(ctx, luaIncrCnt, []string{r.key(bizs[i], bizIds[i])}, field, deltas[i])
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 func (r *RedisInteractiveCache) key(biz string, bizId int64) string {
 	return fmt.Sprintf("interactive:%s:%d", biz, bizId)
 }
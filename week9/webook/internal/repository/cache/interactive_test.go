@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type InteractiveCacheTestSuite struct {
+	suite.Suite
+	mr    *miniredis.Miniredis
+	cache InteractiveCache
+}
+
+func (s *InteractiveCacheTestSuite) SetupTest() {
+	s.mr = miniredis.RunT(s.T())
+	s.cache = NewRedisInteractiveCache(redis.NewClient(&redis.Options{
+		Addr: s.mr.Addr(),
+	}))
+}
+
+func (s *InteractiveCacheTestSuite) TestBatchIncrReadCntIfPresent() {
+	t := s.T()
+	ctx := context.Background()
+	err := s.cache.Set(ctx, "article", 1, domain.Interactive{ReadCnt: 10, LikeCnt: 2})
+	require.NoError(t, err)
+
+	err = s.cache.BatchIncrReadCntIfPresent(ctx,
+		[]string{"article", "article"}, []int64{1, 2}, []int64{5, 3})
+	require.NoError(t, err)
+
+	intr, err := s.cache.Get(ctx, "article", 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Interactive{ReadCnt: 15, LikeCnt: 2}, intr)
+	// 缓存里面没有的不会凭空创建出来
+	_, err = s.cache.Get(ctx, "article", 2)
+	assert.Equal(t, ErrKeyNotExist, err)
+}
+
+func (s *InteractiveCacheTestSuite) TestBatchDecrCollectCntIfPresent() {
+	t := s.T()
+	ctx := context.Background()
+	err := s.cache.Set(ctx, "article", 1, domain.Interactive{CollectCnt: 3})
+	require.NoError(t, err)
+
+	err = s.cache.BatchDecrCollectCntIfPresent(ctx, []string{"article", "article"}, []int64{1, 2})
+	require.NoError(t, err)
+	intr, err := s.cache.Get(ctx, "article", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), intr.CollectCnt)
+
+	// 空的收藏夹
+	err = s.cache.BatchDecrCollectCntIfPresent(ctx, nil, nil)
+	assert.NoError(t, err)
+}
+
+func (s *InteractiveCacheTestSuite) TestGetByIds() {
+	t := s.T()
+	ctx := context.Background()
+	err := s.cache.SetByIds(ctx, "article", map[int64]domain.Interactive{
+		1: {ReadCnt: 10, LikeCnt: 2, CollectCnt: 1},
+		// 数据库里面没有的也会回写 0
+		3: {},
+	})
+	require.NoError(t, err)
+	assert.True(t, s.mr.TTL("interactive:article:1") > 0)
+
+	res, err := s.cache.GetByIds(ctx, "article", []int64{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]domain.Interactive{
+		1: {ReadCnt: 10, LikeCnt: 2, CollectCnt: 1},
+		3: {},
+	}, res)
+}
+
+func TestRedisInteractiveCache(t *testing.T) {
+	suite.Run(t, new(InteractiveCacheTestSuite))
+}
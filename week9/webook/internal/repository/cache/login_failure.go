@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	//go:embed lua/login_failure.lua
+	luaLoginFailure string
+	//go:embed lua/login_check.lua
+	luaLoginCheck string
+)
+
+type LoginLockConfig struct {
+	// Window 统计登录失败的滑动窗口
+	Window time.Duration
+	// AccountThreshold 一个账号在窗口内失败这么多次就锁住
+	AccountThreshold int
+	// IPThreshold 一个 IP 在窗口内失败这么多次就不让这个 IP 登录了，不管是哪个账号
+	IPThreshold int
+	// BaseLock 第一次锁多久，之后每次翻倍，最多 MaxLock
+	BaseLock time.Duration
+	MaxLock  time.Duration
+	// LevelTTL 这么久没有再被锁，锁的时长就从 BaseLock 重新开始
+	LevelTTL time.Duration
+}
+
+// LoginFailureCache 登录失败计数，按照账号和 IP 分别统计
+type LoginFailureCache interface {
+	// Check 返回账号还要锁多久，以及这个 IP 还要等多久，都是 0 才能登录
+	Check(ctx context.Context, account string, ip string) (time.Duration, time.Duration, error)
+	// RecordFailure 返回值不是 0 说明这次失败之后账号被锁住了
+	RecordFailure(ctx context.Context, account string, ip string) (time.Duration, error)
+	// Reset 登录成功之后清掉这个账号的失败次数和锁过的次数
+	Reset(ctx context.Context, account string) error
+	// Unlock 管理员解锁
+	Unlock(ctx context.Context, account string) error
+}
+
+type RedisLoginFailureCache struct {
+	cmd redis.Cmdable
+	cfg LoginLockConfig
+	now func() time.Time
+}
+
+func NewRedisLoginFailureCache(cmd redis.Cmdable, cfg LoginLockConfig) LoginFailureCache {
+	return &RedisLoginFailureCache{
+		cmd: cmd,
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+func (c *RedisLoginFailureCache) Check(ctx context.Context, account string, ip string) (time.Duration, time.Duration, error) {
+	res, err := c.cmd.Eval(ctx, luaLoginCheck, []string{c.lockKey(account), c.ipKey(ip)},
+		c.now().UnixMilli(), c.cfg.Window.Milliseconds(), c.cfg.IPThreshold).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("login_check.lua 返回值不对 %v", res)
+	}
+	return time.Duration(res[0]) * time.Millisecond, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func (c *RedisLoginFailureCache) RecordFailure(ctx context.Context, account string, ip string) (time.Duration, error) {
+	res, err := c.cmd.Eval(ctx, luaLoginFailure,
+		[]string{c.accountKey(account), c.ipKey(ip), c.lockKey(account), c.levelKey(account)},
+		c.now().UnixMilli(), c.cfg.Window.Milliseconds(), c.cfg.AccountThreshold, uuid.New().String(),
+		c.cfg.BaseLock.Milliseconds(), c.cfg.MaxLock.Milliseconds(), c.cfg.LevelTTL.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(res) * time.Millisecond, nil
+}
+
+func (c *RedisLoginFailureCache) Reset(ctx context.Context, account string) error {
+	// IP 的计数不清，不然攻击者用自己的账号登录一次就能接着试别人的密码
+	return c.cmd.Del(ctx, c.accountKey(account), c.levelKey(account)).Err()
+}
+
+func (c *RedisLoginFailureCache) Unlock(ctx context.Context, account string) error {
+	return c.cmd.Del(ctx, c.accountKey(account), c.levelKey(account), c.lockKey(account)).Err()
+}
+
+func (c *RedisLoginFailureCache) accountKey(account string) string {
+	return fmt.Sprintf("login_failure:account:%s", account)
+}
+
+func (c *RedisLoginFailureCache) ipKey(ip string) string {
+	return fmt.Sprintf("login_failure:ip:%s", ip)
+}
+
+func (c *RedisLoginFailureCache) lockKey(account string) string {
+	return fmt.Sprintf("login_lock:%s", account)
+}
+
+func (c *RedisLoginFailureCache) levelKey(account string) string {
+	return fmt.Sprintf("login_lock_level:%s", account)
+}
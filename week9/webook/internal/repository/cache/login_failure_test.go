@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisLoginFailureCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.UnixMilli(1700000000000)
+	c := NewRedisLoginFailureCache(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}), LoginLockConfig{
+		Window:           time.Minute * 15,
+		AccountThreshold: 3,
+		IPThreshold:      5,
+		BaseLock:         time.Minute,
+		MaxLock:          time.Minute * 3,
+		LevelTTL:         time.Hour * 24,
+	}).(*RedisLoginFailureCache)
+	c.now = func() time.Time {
+		return now
+	}
+	// 锁的时间在 redis 里面，时间要一起往前走
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		mr.FastForward(d)
+	}
+	ctx := context.Background()
+
+	// 失败两次还不锁
+	for i := 0; i < 2; i++ {
+		lock, err := c.RecordFailure(ctx, "a@b.com", "1.1.1.1")
+		require.NoError(t, err)
+		assert.Equal(t, time.Duration(0), lock)
+	}
+	// 第三次锁一分钟
+	lock, err := c.RecordFailure(ctx, "a@b.com", "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, lock)
+	lock, ipWait, err := c.Check(ctx, "a@b.com", "2.2.2.2")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, lock)
+	assert.Equal(t, time.Duration(0), ipWait)
+	// 别的账号不受影响
+	lock, _, err = c.Check(ctx, "c@d.com", "2.2.2.2")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), lock)
+
+	// 解锁之后再失败三次，锁两分钟，然后是三分钟封顶
+	for _, want := range []time.Duration{time.Minute * 2, time.Minute * 3, time.Minute * 3} {
+		advance(time.Minute * 5)
+		for i := 0; i < 3; i++ {
+			lock, err = c.RecordFailure(ctx, "a@b.com", "2.2.2.2")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, want, lock)
+	}
+
+	// 登录成功之后重新从一分钟开始
+	err = c.Reset(ctx, "a@b.com")
+	require.NoError(t, err)
+	advance(time.Minute * 5)
+	for i := 0; i < 3; i++ {
+		lock, err = c.RecordFailure(ctx, "a@b.com", "3.3.3.3")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, time.Minute, lock)
+
+	// 管理员解锁
+	err = c.Unlock(ctx, "a@b.com")
+	require.NoError(t, err)
+	lock, _, err = c.Check(ctx, "a@b.com", "3.3.3.3")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), lock)
+
+	// 一个 IP 试了很多账号
+	for i := 0; i < 5; i++ {
+		_, err = c.RecordFailure(ctx, fmt.Sprintf("user%d@b.com", i), "4.4.4.4")
+		require.NoError(t, err)
+		advance(time.Minute)
+	}
+	_, ipWait, err = c.Check(ctx, "x@b.com", "4.4.4.4")
+	require.NoError(t, err)
+	// 最早的那次失败是 5 分钟之前
+	assert.Equal(t, time.Minute*10, ipWait)
+	advance(time.Minute * 10)
+	_, ipWait, err = c.Check(ctx, "x@b.com", "4.4.4.4")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ipWait)
+}
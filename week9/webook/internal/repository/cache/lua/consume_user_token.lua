@@ -0,0 +1,9 @@
+local key = KEYS[1]
+local id = ARGV[1]
+if redis.call("get", key) == id then
+    -- 用完就删掉，不能再用了
+    redis.call("del", key)
+    return 0
+end
+-- 过期了、用过了，或者后面又发了新的
+return -1
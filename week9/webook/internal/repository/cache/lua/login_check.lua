@@ -0,0 +1,20 @@
+local lockKey = KEYS[1]
+local ipKey = KEYS[2]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local ipThreshold = tonumber(ARGV[3])
+
+-- 账号还要锁多久，毫秒，-2 是没锁
+local lock = redis.call('PTTL', lockKey)
+if lock < 0 then
+    lock = 0
+end
+
+-- IP 要等最早的那次失败滑出窗口才能再试
+local ipWait = 0
+redis.call('ZREMRANGEBYSCORE', ipKey, '-inf', now - window)
+if redis.call('ZCARD', ipKey) >= ipThreshold then
+    local oldest = redis.call('ZRANGE', ipKey, 0, 0, 'WITHSCORES')
+    ipWait = tonumber(oldest[2]) + window - now
+end
+return {lock, ipWait}
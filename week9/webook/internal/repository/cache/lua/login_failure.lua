@@ -0,0 +1,41 @@
+-- 登录失败一次，账号和 IP 各记一次，和 ratelimit 的 slide_window.lua 一样用 zset 做滑动窗口
+-- login_failure:account:xxx@xx.com
+local accountKey = KEYS[1]
+-- login_failure:ip:127.0.0.1
+local ipKey = KEYS[2]
+-- login_lock:xxx@xx.com 存在就是锁住了
+local lockKey = KEYS[3]
+-- login_lock_level:xxx@xx.com 锁过几次
+local levelKey = KEYS[4]
+
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local accountThreshold = tonumber(ARGV[3])
+-- 同一毫秒可能有多次失败，member 不能直接用 now
+local member = ARGV[4]
+-- 第一次锁多久，之后每次翻倍，最多 maxLock
+local baseLock = tonumber(ARGV[5])
+local maxLock = tonumber(ARGV[6])
+-- 锁过的次数多久之后清零
+local levelTTL = tonumber(ARGV[7])
+
+local min = now - window
+for _, key in ipairs({accountKey, ipKey}) do
+    redis.call('ZREMRANGEBYSCORE', key, '-inf', min)
+    redis.call('ZADD', key, now, member)
+    redis.call('PEXPIRE', key, window)
+end
+
+if redis.call('ZCARD', accountKey) < accountThreshold then
+    return 0
+end
+local level = redis.call('INCR', levelKey)
+redis.call('PEXPIRE', levelKey, levelTTL)
+local lock = baseLock * math.pow(2, level - 1)
+if lock > maxLock then
+    lock = maxLock
+end
+redis.call('SET', lockKey, level, 'PX', lock)
+-- 解锁之后重新计数
+redis.call('DEL', accountKey)
+return lock
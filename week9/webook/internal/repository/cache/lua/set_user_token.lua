@@ -0,0 +1,16 @@
+-- 一个用户同一个用途只有最新的 token 有效
+-- user_token:reset_password:123
+local key = KEYS[1]
+-- token 的 id，token 本身不存
+local id = ARGV[1]
+-- 有效期，秒
+local expiration = tonumber(ARGV[2])
+-- 多久之内不能重新发，秒
+local interval = tonumber(ARGV[3])
+local ttl = tonumber(redis.call("ttl", key))
+if ttl > expiration - interval then
+    -- 发送太频繁
+    return -1
+end
+redis.call("set", key, id, "EX", expiration)
+return 0
@@ -0,0 +1,15 @@
+-- 带版本号的缓存，文章详情 article:pub:detail:1，作者列表第一页 article:pub:first_page:123
+local key = KEYS[1]
+-- 版本号，每次删除缓存都会加 1，比如 article:pub:detail:1:ver
+local verKey = key..":ver"
+local val = ARGV[1]
+local ttl = tonumber(ARGV[2])
+-- 读数据库之前拿到的版本号
+local ver = tonumber(ARGV[3])
+local cur = tonumber(redis.call("get", verKey) or "0")
+if cur ~= ver then
+    -- 读数据库的时候数据被修改或者撤回了，读到的可能是旧数据，不能回写
+    return 0
+end
+redis.call("set", key, val, "PX", ttl)
+return 1
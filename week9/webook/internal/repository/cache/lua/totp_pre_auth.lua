@@ -0,0 +1,16 @@
+-- 密码验证通过之后拿到的 pre-auth token，还可以试几次验证码
+-- 返回 {uid, account}，uid 是 -1 说明不存在，-2 说明试太多次了
+local key = KEYS[1]
+local cnt = tonumber(redis.call("hincrby", key, "cnt", -1))
+local uid = redis.call("hget", key, "uid")
+if uid == false then
+    -- 过期了，或者已经用过了，hincrby 会创建一个新的 key，要删掉
+    redis.call("del", key)
+    return {-1, ""}
+end
+if cnt < 0 then
+    -- 试太多次了
+    redis.call("del", key)
+    return {-2, ""}
+end
+return {tonumber(uid), redis.call("hget", key, "account") or ""}
@@ -0,0 +1,10 @@
+-- 防重放：验证码对应的周期必须比上一次用过的大，同一个验证码、更早的验证码都不能再用
+local key = KEYS[1]
+local step = tonumber(ARGV[1])
+local expiration = tonumber(ARGV[2])
+local last = tonumber(redis.call("get", key))
+if last ~= nil and step <= last then
+    return 0
+end
+redis.call("set", key, step, "EX", expiration)
+return 1
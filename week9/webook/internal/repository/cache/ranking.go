@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// RankingCache 热榜，每个 biz 一个 zset，member 是 bizId，score 是热度
+// 标题之类展示用的数据放在同名的 hash 里面
+type RankingCache interface {
+	// Replace 整个榜单一次性替换掉
+	Replace(ctx context.Context, biz string, arts []domain.HotArticle) error
+	// Get 按照热度倒序分页，榜单不存在的时候返回 ErrKeyNotExist
+	Get(ctx context.Context, biz string, offset int, limit int) ([]domain.HotArticle, error)
+}
+
+type RedisRankingCache struct {
+	client redis.Cmdable
+	// 比计算的间隔长得多，任务挂了一段时间榜单也还在
+	expiration time.Duration
+}
+
+func NewRedisRankingCache(client redis.Cmdable) RankingCache {
+	return &RedisRankingCache{
+		client:     client,
+		expiration: time.Hour,
+	}
+}
+
+func (r *RedisRankingCache) Replace(ctx context.Context, biz string, arts []domain.HotArticle) error {
+	key, detailKey := r.key(biz), r.detailKey(biz)
+	tmpKey, tmpDetailKey := key+":tmp", detailKey+":tmp"
+	members := make([]redis.Z, 0, len(arts))
+	details := make(map[string]any, len(arts))
+	for _, art := range arts {
+		member := strconv.FormatInt(art.Id, 10)
+		members = append(members, redis.Z{
+			Score:  art.Score,
+			Member: member,
+		})
+		data, err := json.Marshal(hotArticleEntity{
+			Title:       art.Title,
+			AuthorId:    art.AuthorId,
+			PublishTime: art.PublishTime.UnixMilli(),
+		})
+		if err != nil {
+			return err
+		}
+		details[member] = data
+	}
+	// 先写到临时 key，再 RENAME 过去，读的人不会看到写了一半的榜单
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, tmpKey, tmpDetailKey)
+	if len(arts) > 0 {
+		pipe.ZAdd(ctx, tmpKey, members...)
+		pipe.HSet(ctx, tmpDetailKey, details)
+		pipe.Rename(ctx, tmpKey, key)
+		pipe.Rename(ctx, tmpDetailKey, detailKey)
+		pipe.Expire(ctx, key, r.expiration)
+		pipe.Expire(ctx, detailKey, r.expiration)
+		pipe.Del(ctx, r.emptyKey(biz))
+	} else {
+		// 一篇文章都没有，也要留下一个空榜单的标记，不然每次读都会触发重建
+		pipe.Del(ctx, key, detailKey)
+		pipe.Set(ctx, r.emptyKey(biz), 1, r.expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisRankingCache) Get(ctx context.Context, biz string, offset int, limit int) ([]domain.HotArticle, error) {
+	key := r.key(biz)
+	zs, err := r.client.ZRevRangeWithScores(ctx, key, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(zs) == 0 {
+		// 区分是翻到头了，还是榜单没了
+		cnt, err := r.client.Exists(ctx, key, r.emptyKey(biz)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if cnt == 0 {
+			return nil, ErrKeyNotExist
+		}
+		return []domain.HotArticle{}, nil
+	}
+	members := make([]string, 0, len(zs))
+	for _, z := range zs {
+		members = append(members, z.Member.(string))
+	}
+	vals, err := r.client.HMGet(ctx, r.detailKey(biz), members...).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.HotArticle, 0, len(zs))
+	for i, z := range zs {
+		id, _ := strconv.ParseInt(members[i], 10, 64)
+		art := domain.HotArticle{
+			Id:    id,
+			Score: z.Score,
+		}
+		if str, ok := vals[i].(string); ok {
+			var ent hotArticleEntity
+			if json.Unmarshal([]byte(str), &ent) == nil {
+				art.Title = ent.Title
+				art.AuthorId = ent.AuthorId
+				art.PublishTime = time.UnixMilli(ent.PublishTime)
+			}
+		}
+		res = append(res, art)
+	}
+	return res, nil
+}
+
+func (r *RedisRankingCache) key(biz string) string {
+	return fmt.Sprintf("ranking:hot:%s", biz)
+}
+
+func (r *RedisRankingCache) detailKey(biz string) string {
+	return fmt.Sprintf("ranking:hot:%s:detail", biz)
+}
+
+func (r *RedisRankingCache) emptyKey(biz string) string {
+	return fmt.Sprintf("ranking:hot:%s:empty", biz)
+}
+
+type hotArticleEntity struct {
+	Title       string `json:"title"`
+	AuthorId    int64  `json:"author_id"`
+	PublishTime int64  `json:"publish_time"`
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisRankingCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := NewRedisRankingCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	// 还没有算过
+	_, err := cache.Get(ctx, "article", 0, 10)
+	assert.Equal(t, ErrKeyNotExist, err)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	err = cache.Replace(ctx, "article", []domain.HotArticle{
+		{Id: 1, Title: "一", AuthorId: 11, PublishTime: now, Score: 1},
+		{Id: 2, Title: "二", AuthorId: 22, PublishTime: now, Score: 3},
+		{Id: 3, Title: "三", AuthorId: 33, PublishTime: now, Score: 2},
+	})
+	require.NoError(t, err)
+
+	arts, err := cache.Get(ctx, "article", 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.HotArticle{
+		{Id: 2, Title: "二", AuthorId: 22, PublishTime: now, Score: 3},
+		{Id: 3, Title: "三", AuthorId: 33, PublishTime: now, Score: 2},
+	}, arts)
+	arts, err = cache.Get(ctx, "article", 2, 2)
+	require.NoError(t, err)
+	require.Len(t, arts, 1)
+	assert.Equal(t, int64(1), arts[0].Id)
+	// 翻到头了不是榜单丢了
+	arts, err = cache.Get(ctx, "article", 4, 2)
+	require.NoError(t, err)
+	assert.Len(t, arts, 0)
+
+	// 替换之后旧的不会残留
+	err = cache.Replace(ctx, "article", []domain.HotArticle{
+		{Id: 4, Title: "四", PublishTime: now, Score: 1},
+	})
+	require.NoError(t, err)
+	arts, err = cache.Get(ctx, "article", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, arts, 1)
+	assert.Equal(t, int64(4), arts[0].Id)
+	assert.False(t, mr.Exists("ranking:hot:article:tmp"))
+
+	// 空榜单
+	err = cache.Replace(ctx, "article", nil)
+	require.NoError(t, err)
+	arts, err = cache.Get(ctx, "article", 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, arts, 0)
+
+	// Redis 数据丢了
+	mr.FlushAll()
+	_, err = cache.Get(ctx, "article", 0, 10)
+	assert.Equal(t, ErrKeyNotExist, err)
+}
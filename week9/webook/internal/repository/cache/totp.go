@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	ErrPreAuthNotFound = errors.New("pre-auth token 不存在或者已经过期")
+	ErrPreAuthTooMany  = errors.New("验证码输错太多次了")
+)
+
+var (
+	//go:embed lua/totp_step.lua
+	luaTOTPStep string
+	//go:embed lua/totp_pre_auth.lua
+	luaTOTPPreAuth string
+)
+
+const (
+	// preAuthExpiration 输完密码之后，要在这个时间之内输入验证码
+	preAuthExpiration = time.Minute * 5
+	// preAuthAttempts 一个 pre-auth token 最多试几次验证码
+	preAuthAttempts = 5
+	// totpStepExpiration 比验证码允许的时间偏差长就行
+	totpStepExpiration = time.Minute * 5
+)
+
+type TOTPCache interface {
+	// SetPreAuth 密码验证通过之后，token 对应到用户
+	SetPreAuth(ctx context.Context, token string, pa domain.PreAuth) error
+	// AttemptPreAuth 每调用一次就少一次机会
+	AttemptPreAuth(ctx context.Context, token string) (domain.PreAuth, error)
+	DelPreAuth(ctx context.Context, token string) error
+	// UseStep 这个周期的验证码还没有用过才返回 true
+	UseStep(ctx context.Context, uid int64, step int64) (bool, error)
+}
+
+type RedisTOTPCache struct {
+	cmd redis.Cmdable
+}
+
+func NewRedisTOTPCache(cmd redis.Cmdable) TOTPCache {
+	return &RedisTOTPCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisTOTPCache) SetPreAuth(ctx context.Context, token string, pa domain.PreAuth) error {
+	key := c.preAuthKey(token)
+	pipe := c.cmd.TxPipeline()
+	pipe.HSet(ctx, key, "uid", pa.Uid, "account", pa.Account, "cnt", preAuthAttempts)
+	pipe.Expire(ctx, key, preAuthExpiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *RedisTOTPCache) AttemptPreAuth(ctx context.Context, token string) (domain.PreAuth, error) {
+	res, err := c.cmd.Eval(ctx, luaTOTPPreAuth, []string{c.preAuthKey(token)}).Slice()
+	if err != nil {
+		return domain.PreAuth{}, err
+	}
+	if len(res) != 2 {
+		return domain.PreAuth{}, fmt.Errorf("pre-auth 脚本返回值不对 %v", res)
+	}
+	uid, ok1 := res[0].(int64)
+	account, ok2 := res[1].(string)
+	if !ok1 || !ok2 {
+		return domain.PreAuth{}, fmt.Errorf("pre-auth 脚本返回值不对 %v", res)
+	}
+	switch uid {
+	case -1:
+		return domain.PreAuth{}, ErrPreAuthNotFound
+	case -2:
+		return domain.PreAuth{}, ErrPreAuthTooMany
+	default:
+		return domain.PreAuth{Uid: uid, Account: account}, nil
+	}
+}
+
+func (c *RedisTOTPCache) DelPreAuth(ctx context.Context, token string) error {
+	return c.cmd.Del(ctx, c.preAuthKey(token)).Err()
+}
+
+func (c *RedisTOTPCache) UseStep(ctx context.Context, uid int64, step int64) (bool, error) {
+	return c.cmd.Eval(ctx, luaTOTPStep, []string{c.stepKey(uid)},
+		step, int64(totpStepExpiration/time.Second)).Bool()
+}
+
+func (c *RedisTOTPCache) preAuthKey(token string) string {
+	return fmt.Sprintf("totp:pre_auth:%s", token)
+}
+
+func (c *RedisTOTPCache) stepKey(uid int64) string {
+	return fmt.Sprintf("totp:last_step:%d", uid)
+}
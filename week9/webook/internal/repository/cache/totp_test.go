@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisTOTPCache_PreAuth(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewRedisTOTPCache(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}))
+	ctx := context.Background()
+
+	_, err := c.AttemptPreAuth(ctx, "not-exist")
+	assert.Equal(t, ErrPreAuthNotFound, err)
+	// 不存在的 token 不能留下垃圾
+	assert.False(t, mr.Exists("totp:pre_auth:not-exist"))
+
+	err = c.SetPreAuth(ctx, "token", domain.PreAuth{Uid: 123, Account: "a@qq.com"})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		pa, err := c.AttemptPreAuth(ctx, "token")
+		require.NoError(t, err)
+		assert.Equal(t, domain.PreAuth{Uid: 123, Account: "a@qq.com"}, pa)
+	}
+	_, err = c.AttemptPreAuth(ctx, "token")
+	assert.Equal(t, ErrPreAuthTooMany, err)
+	_, err = c.AttemptPreAuth(ctx, "token")
+	assert.Equal(t, ErrPreAuthNotFound, err)
+
+	// 用完删掉
+	// 短信和第三方登录没有账号
+	err = c.SetPreAuth(ctx, "token2", domain.PreAuth{Uid: 123})
+	require.NoError(t, err)
+	pa, err := c.AttemptPreAuth(ctx, "token2")
+	require.NoError(t, err)
+	assert.Equal(t, domain.PreAuth{Uid: 123}, pa)
+	err = c.DelPreAuth(ctx, "token2")
+	require.NoError(t, err)
+	_, err = c.AttemptPreAuth(ctx, "token2")
+	assert.Equal(t, ErrPreAuthNotFound, err)
+
+	// 过期
+	err = c.SetPreAuth(ctx, "token3", domain.PreAuth{Uid: 123})
+	require.NoError(t, err)
+	mr.FastForward(time.Minute*5 + time.Second)
+	_, err = c.AttemptPreAuth(ctx, "token3")
+	assert.Equal(t, ErrPreAuthNotFound, err)
+}
+
+func TestRedisTOTPCache_UseStep(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewRedisTOTPCache(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}))
+	ctx := context.Background()
+
+	ok, err := c.UseStep(ctx, 1, 100)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// 同一个验证码不能用两次
+	ok, err = c.UseStep(ctx, 1, 100)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	// 更早的也不行
+	ok, err = c.UseStep(ctx, 1, 99)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.UseStep(ctx, 1, 101)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// 别的用户不受影响
+	ok, err = c.UseStep(ctx, 2, 100)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var ErrUserTokenSendTooMany = errors.New("发送太频繁")
+
+var (
+	//go:embed lua/set_user_token.lua
+	luaSetUserToken string
+	//go:embed lua/consume_user_token.lua
+	luaConsumeUserToken string
+)
+
+// userTokenInterval 同一个用户同一个用途，一分钟之内只能发一次
+const userTokenInterval = time.Minute
+
+// UserTokenCache 邮件里面的验证邮箱、重置密码的 token。
+// 只存 token 的 id，同一个用户同一个用途只有最后发的那个有效
+type UserTokenCache interface {
+	Set(ctx context.Context, biz string, uid int64, id string, expiration time.Duration) error
+	// Consume 校验通过就删掉，返回 false 说明过期了、用过了或者不是最新的
+	Consume(ctx context.Context, biz string, uid int64, id string) (bool, error)
+}
+
+type RedisUserTokenCache struct {
+	cmd redis.Cmdable
+}
+
+func NewRedisUserTokenCache(cmd redis.Cmdable) UserTokenCache {
+	return &RedisUserTokenCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisUserTokenCache) Set(ctx context.Context, biz string, uid int64, id string, expiration time.Duration) error {
+	res, err := c.cmd.Eval(ctx, luaSetUserToken, []string{c.key(biz, uid)}, id,
+		int64(expiration/time.Second), int64(userTokenInterval/time.Second)).Int()
+	if err != nil {
+		return err
+	}
+	if res == -1 {
+		return ErrUserTokenSendTooMany
+	}
+	return nil
+}
+
+func (c *RedisUserTokenCache) Consume(ctx context.Context, biz string, uid int64, id string) (bool, error) {
+	res, err := c.cmd.Eval(ctx, luaConsumeUserToken, []string{c.key(biz, uid)}, id).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 0, nil
+}
+
+func (c *RedisUserTokenCache) key(biz string, uid int64) string {
+	return fmt.Sprintf("user_token:%s:%d", biz, uid)
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisUserTokenCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewRedisUserTokenCache(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}))
+	ctx := context.Background()
+
+	// 没发过
+	ok, err := c.Consume(ctx, "reset_password", 1, "id1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	err = c.Set(ctx, "reset_password", 1, "id1", time.Minute*30)
+	require.NoError(t, err)
+	err = c.Set(ctx, "reset_password", 1, "id2", time.Minute*30)
+	assert.Equal(t, ErrUserTokenSendTooMany, err)
+	// 别的用途不受影响
+	err = c.Set(ctx, "verify_email", 1, "id3", time.Hour*24)
+	require.NoError(t, err)
+
+	// 过了一分钟可以重新发，之前的就失效了
+	mr.FastForward(time.Minute + time.Second)
+	err = c.Set(ctx, "reset_password", 1, "id2", time.Minute*30)
+	require.NoError(t, err)
+	ok, err = c.Consume(ctx, "reset_password", 1, "id1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.Consume(ctx, "reset_password", 1, "id2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// 只能用一次
+	ok, err = c.Consume(ctx, "reset_password", 1, "id2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 过期了
+	mr.FastForward(time.Hour * 24)
+	ok, err = c.Consume(ctx, "verify_email", 1, "id3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
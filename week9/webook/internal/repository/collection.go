@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository/dao"
+	"time"
+)
+
+var (
+	ErrCollectionNotFound  = dao.ErrCollectionNotFound
+	ErrCollectItemNotFound = dao.ErrRecordNotFound
+)
+
+type CollectionRepository interface {
+	Create(ctx context.Context, c domain.Collection) (int64, error)
+	Rename(ctx context.Context, id int64, uid int64, name string) error
+	List(ctx context.Context, uid int64) ([]domain.Collection, error)
+	ListItems(ctx context.Context, cid int64, uid int64, maxId int64, limit int) ([]domain.CollectionItem, error)
+	MoveItem(ctx context.Context, biz string, bizId int64, uid int64, toCid int64) error
+}
+
+type collectionRepository struct {
+	dao dao.CollectionDAO
+}
+
+func NewCollectionRepository(dao dao.CollectionDAO) CollectionRepository {
+	return &collectionRepository{dao: dao}
+}
+
+func (repo *collectionRepository) Create(ctx context.Context, c domain.Collection) (int64, error) {
+	return repo.dao.Insert(ctx, dao.Collection{
+		Name: c.Name,
+		Uid:  c.Uid,
+	})
+}
+
+func (repo *collectionRepository) Rename(ctx context.Context, id int64, uid int64, name string) error {
+	return repo.dao.UpdateName(ctx, id, uid, name)
+}
+
+func (repo *collectionRepository) List(ctx context.Context, uid int64) ([]domain.Collection, error) {
+	cs, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Collection, 0, len(cs))
+	for _, c := range cs {
+		res = append(res, domain.Collection{
+			Id:    c.Id,
+			Name:  c.Name,
+			Uid:   c.Uid,
+			Ctime: time.UnixMilli(c.Ctime),
+			Utime: time.UnixMilli(c.Utime),
+		})
+	}
+	return res, nil
+}
+
+func (repo *collectionRepository) ListItems(ctx context.Context, cid int64, uid int64, maxId int64, limit int) ([]domain.CollectionItem, error) {
+	items, err := repo.dao.FindItems(ctx, cid, uid, maxId, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.CollectionItem, 0, len(items))
+	for _, item := range items {
+		res = append(res, domain.CollectionItem{
+			Id:    item.Id,
+			Cid:   item.Cid,
+			Biz:   item.Biz,
+			BizId: item.BizId,
+			Uid:   item.Uid,
+			Ctime: time.UnixMilli(item.Ctime),
+			Utime: time.UnixMilli(item.Utime),
+		})
+	}
+	return res, nil
+}
+
+func (repo *collectionRepository) MoveItem(ctx context.Context, biz string, bizId int64, uid int64, toCid int64) error {
+	return repo.dao.MoveItem(ctx, biz, bizId, uid, toCid)
+}
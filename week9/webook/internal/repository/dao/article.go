@@ -17,12 +17,49 @@ type ArticleDAO interface {
 	SyncStatus(ctx context.Context, aid int64, uid int64, status uint8) error
 	GetById(ctx context.Context, id int64) (Article, error)
 	GetPublishedById(ctx context.Context, id int64) (PublishedArticle, error)
+	ListRevisions(ctx context.Context, aid int64, uid int64) ([]ArticleRevision, error)
+	GetRevision(ctx context.Context, aid int64, uid int64, version int64) (ArticleRevision, error)
+	// ListByAuthor 创作者自己的文章列表，按照 (utime, id) 倒序
+	ListByAuthor(ctx context.Context, uid int64, cursor Cursor, limit int) ([]Article, error)
+	// ListPublished 读者看到的某个作者已经发表的文章列表
+	ListPublished(ctx context.Context, authorId int64, cursor Cursor, limit int) ([]PublishedArticle, error)
+}
+
+// Cursor 按照 (utime, id) 分页，Id 为 0 的时候从头开始
+type Cursor struct {
+	Utime int64
+	Id    int64
 }
 
 type GORMArticleDAO struct {
 	db *gorm.DB
 }
 
+func (dao *GORMArticleDAO) ListByAuthor(ctx context.Context, uid int64, cursor Cursor, limit int) ([]Article, error) {
+	var res []Article
+	db := dao.db.WithContext(ctx).Where("author_id = ?", uid)
+	err := dao.keyset(db, cursor, limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMArticleDAO) ListPublished(ctx context.Context, authorId int64, cursor Cursor, limit int) ([]PublishedArticle, error) {
+	var res []PublishedArticle
+	// 读者只能看到已经发表的，仅自己可见的不展示
+	db := dao.db.WithContext(ctx).Model(&PublishedArticle{}).
+		Where("author_id = ? AND status = ?", authorId, articleStatusPublished)
+	err := dao.keyset(db, cursor, limit).Find(&res).Error
+	return res, err
+}
+
+// keyset 在 (author_id, utime, id) 上分页，不用 OFFSET，翻到很后面也不会变慢
+func (dao *GORMArticleDAO) keyset(db *gorm.DB, cursor Cursor, limit int) *gorm.DB {
+	if cursor.Id > 0 {
+		db = db.Where("utime < ? OR (utime = ? AND id < ?)",
+			cursor.Utime, cursor.Utime, cursor.Id)
+	}
+	return db.Order("utime DESC, id DESC").Limit(limit)
+}
+
 func (dao *GORMArticleDAO) GetPublishedById(ctx context.Context, id int64) (PublishedArticle, error) {
 	var pubart PublishedArticle
 	err := dao.db.Model(&PublishedArticle{}).WithContext(ctx).Where("id=?", id).First(&pubart).Error
@@ -96,30 +133,86 @@ func (dao *GORMArticleDAO) Sync(ctx context.Context, art Article) (int64, error)
 	return id, err
 }
 
-func (dao *GORMArticleDAO) UpdateById(ctx context.Context, art Article) error {
-	now := time.Now().UnixMilli()
+func (dao *GORMArticleDAO) ListRevisions(ctx context.Context, aid int64, uid int64) ([]ArticleRevision, error) {
+	// 先用 author_id 校验文章是不是本人的
+	err := dao.checkAuthor(ctx, aid, uid)
+	if err != nil {
+		return nil, err
+	}
+	var res []ArticleRevision
+	err = dao.db.WithContext(ctx).
+		Where("article_id = ? AND author_id = ?", aid, uid).
+		Order("version DESC").
+		Find(&res).Error
+	return res, err
+}
 
-	res := dao.db.Model(&Article{}).WithContext(ctx).Where("id = ? AND author_id=?", art.Id, art.AuthorId).Updates(
-		map[string]any{
-			"title":   art.Title,
-			"content": art.Content,
-			"status":  art.Status,
-			"utime":   now,
-		})
-	if res.Error != nil {
-		return res.Error
+func (dao *GORMArticleDAO) GetRevision(ctx context.Context, aid int64, uid int64, version int64) (ArticleRevision, error) {
+	err := dao.checkAuthor(ctx, aid, uid)
+	if err != nil {
+		return ArticleRevision{}, err
 	}
-	if res.RowsAffected == 0 {
-		return errors.New("更新数据失败")
+	var res ArticleRevision
+	err = dao.db.WithContext(ctx).
+		Where("article_id = ? AND author_id = ? AND version = ?", aid, uid, version).
+		First(&res).Error
+	return res, err
+}
+
+func (dao *GORMArticleDAO) checkAuthor(ctx context.Context, aid int64, uid int64) error {
+	var cnt int64
+	err := dao.db.WithContext(ctx).Model(&Article{}).
+		Where("id = ? AND author_id = ?", aid, uid).
+		Count(&cnt).Error
+	if err != nil {
+		return err
+	}
+	if cnt != 1 {
+		return ErrPossibleIncorrectAuthor
 	}
 	return nil
 }
 
+func (dao *GORMArticleDAO) UpdateById(ctx context.Context, art Article) error {
+	now := time.Now().UnixMilli()
+	// 更新制作库的同时记录一个版本
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Article{}).Where("id = ? AND author_id=?", art.Id, art.AuthorId).Updates(
+			map[string]any{
+				"title":   art.Title,
+				"content": art.Content,
+				"status":  art.Status,
+				"utime":   now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("更新数据失败")
+		}
+		// 保存成草稿或者直接发表了，之前设置的定时发表就作废了，不然到时间会把草稿发出去
+		if art.Status != articleStatusScheduled {
+			err := cancelWaitingSchedule(tx, art.Id, now)
+			if err != nil {
+				return err
+			}
+		}
+		return insertRevision(tx, art, now)
+	})
+}
+
 func (dao *GORMArticleDAO) Insert(ctx context.Context, art Article) (int64, error) {
 	now := time.Now().UnixMilli()
 	art.Utime = now
 	art.Ctime = now
-	err := dao.db.WithContext(ctx).Create(&art).Error
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&art).Error
+		if err != nil {
+			return err
+		}
+		// 新建的文章版本号从 1 开始
+		return insertRevision(tx, art, now)
+	})
 	return art.Id, err
 }
 
@@ -129,6 +222,14 @@ func NewGORMArticleDAO(db *gorm.DB) ArticleDAO {
 	}
 }
 
+// 和 domain.ArticleStatus 保持一致
+const (
+	articleStatusUnpublished uint8 = 1
+	articleStatusPublished   uint8 = 2
+	articleStatusPrivate     uint8 = 3
+	articleStatusScheduled   uint8 = 4
+)
+
 type PublishedArticle Article
 
 type Article struct {
@@ -139,8 +240,10 @@ type Article struct {
 	Title   string `gorm:"type=varchar(4096)" bson:"title,omitempty"`
 	Content string `gorm:"type=BLOB" bson:"content,omitempty"`
 	// 作者
-	AuthorId int64 `gorm:"index" bson:"author_id,omitempty"`
+	// 列表是按照作者查询，再按照 utime 排序，所以是联合索引
+	// PublishedArticle 也用这个定义，用 composite 让两张表的索引名字不一样
+	AuthorId int64 `gorm:"index:,composite:author_id_utime" bson:"author_id,omitempty"`
 	Status   uint8 `bson:"status,omitempty"`
 	Ctime    int64 `bson:"ctime,omitempty"`
-	Utime    int64 `bson:"utime,omitempty"`
+	Utime    int64 `gorm:"index:,composite:author_id_utime" bson:"utime,omitempty"`
 }
@@ -0,0 +1,41 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+)
+
+// ArticleRevision 文章的历史版本，只插入，不更新
+type ArticleRevision struct {
+	Id int64 `gorm:"primaryKey,autoIncrement" bson:"id,omitempty"`
+	// 同一篇文章的版本号唯一
+	ArticleId int64  `gorm:"uniqueIndex:article_id_version" bson:"article_id,omitempty"`
+	Version   int64  `gorm:"uniqueIndex:article_id_version" bson:"version,omitempty"`
+	Title     string `gorm:"type=varchar(4096)" bson:"title,omitempty"`
+	Content   string `gorm:"type=BLOB" bson:"content,omitempty"`
+	// 冗余作者 id，查询版本的时候直接用 author_id 校验
+	AuthorId int64 `gorm:"index" bson:"author_id,omitempty"`
+	Status   uint8 `bson:"status,omitempty"`
+	Ctime    int64 `bson:"ctime,omitempty"`
+}
+
+// insertRevision 在事务里面记录一个版本，版本号是当前最大版本号 + 1
+// 并发保存的时候依赖唯一索引兜底，后插入的那个事务会失败
+func insertRevision(tx *gorm.DB, art Article, now int64) error {
+	var version int64
+	err := tx.Model(&ArticleRevision{}).
+		Where("article_id = ?", art.Id).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&version).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&ArticleRevision{
+		ArticleId: art.Id,
+		Version:   version + 1,
+		Title:     art.Title,
+		Content:   art.Content,
+		AuthorId:  art.AuthorId,
+		Status:    art.Status,
+		Ctime:     now,
+	}).Error
+}
@@ -0,0 +1,259 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("没有可以取消的定时发表")
+	// ErrNoDueSchedule 没有到时间的定时发表任务，不能和 ErrRecordNotFound 混在一起，
+	// 不然文章被删了的任务会被当成没有任务，一直被抢占
+	ErrNoDueSchedule = errors.New("没有到时间的定时发表任务")
+	// ErrScheduleLeaseExpired 执行太久了，任务已经被别的实例抢走了，或者被取消、重新设置了
+	ErrScheduleLeaseExpired = errors.New("定时发表任务已经不归这个实例了")
+	// ErrScheduleUnsupported 文章存储不是 MySQL，定时发表不可用
+	ErrScheduleUnsupported = errors.New("当前的文章存储不支持定时发表")
+)
+
+type ArticleScheduleDAO interface {
+	// Upsert 保存草稿并且设置定时发表，已经设置过的就更新发表时间，返回文章 id
+	Upsert(ctx context.Context, art Article, publishTime int64) (int64, error)
+	// Cancel 取消定时发表，草稿恢复成设置之前的状态
+	Cancel(ctx context.Context, aid int64, uid int64) error
+	// Preempt 抢占一个已经到时间的定时发表任务
+	Preempt(ctx context.Context) (ArticleSchedule, error)
+	// Release 和 Finish 的 version 是 Preempt 返回的，中间被别人抢走了就返回 ErrScheduleLeaseExpired
+	Release(ctx context.Context, id int64, version int64) error
+	Finish(ctx context.Context, id int64, version int64) error
+}
+
+type GORMArticleScheduleDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMArticleScheduleDAO(db *gorm.DB) ArticleScheduleDAO {
+	return &GORMArticleScheduleDAO{db: db}
+}
+
+func (dao *GORMArticleScheduleDAO) Upsert(ctx context.Context, art Article, publishTime int64) (int64, error) {
+	now := time.Now().UnixMilli()
+	art.Status = articleStatusScheduled
+	// 设置定时发表之前的状态，取消的时候恢复，新建的文章就是未发表
+	prevStatus := articleStatusUnpublished
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 保存草稿和设置定时发表在一个事务里面，不会出现草稿是定时发表但是没有任务的情况
+		txDAO := NewGORMArticleDAO(tx)
+		var err error
+		if art.Id > 0 {
+			var cur Article
+			// 顺便校验是不是本人的文章
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("status").
+				Where("id=? AND author_id=?", art.Id, art.AuthorId).First(&cur).Error
+			if err == gorm.ErrRecordNotFound {
+				return ErrPossibleIncorrectAuthor
+			}
+			if err != nil {
+				return err
+			}
+			prevStatus = cur.Status
+			err = txDAO.UpdateById(ctx, art)
+		} else {
+			art.Id, err = txDAO.Insert(ctx, art)
+		}
+		if err != nil {
+			return err
+		}
+		// 重新设置发表时间的时候 version 也要加 1，让正在执行的旧任务失效
+		updates := map[string]any{
+			"publish_time": publishTime,
+			"status":       scheduleStatusWaiting,
+			"version":      gorm.Expr("version + 1"),
+			"utime":        now,
+		}
+		// 已经是定时发表了，说明只是修改发表时间，保留第一次设置的时候记下来的状态
+		if prevStatus != articleStatusScheduled {
+			updates["prev_status"] = prevStatus
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "article_id"}},
+			DoUpdates: clause.Assignments(updates),
+		}).Create(&ArticleSchedule{
+			ArticleId:   art.Id,
+			AuthorId:    art.AuthorId,
+			PublishTime: publishTime,
+			Status:      scheduleStatusWaiting,
+			PrevStatus:  prevStatus,
+			Ctime:       now,
+			Utime:       now,
+		}).Error
+	})
+	return art.Id, err
+}
+
+func (dao *GORMArticleScheduleDAO) Cancel(ctx context.Context, aid int64, uid int64) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 只有还在等待的才能取消，已经在发表的就来不及了
+		var s ArticleSchedule
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("article_id=? AND author_id=? AND status=?", aid, uid, scheduleStatusWaiting).
+			First(&s).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrScheduleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&ArticleSchedule{}).
+			Where("id=? AND version=?", s.Id, s.Version).
+			Updates(map[string]any{
+				"status":  scheduleStatusCancelled,
+				"version": gorm.Expr("version + 1"),
+				"utime":   now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return ErrScheduleNotFound
+		}
+		// 恢复成设置定时发表之前的状态，已经发表的文章修改之后定时发表，取消了还是已发表
+		status := s.PrevStatus
+		if status == 0 || status == articleStatusScheduled {
+			status = articleStatusUnpublished
+		}
+		return tx.Model(&Article{}).
+			Where("id=? AND author_id=? AND status=?", aid, uid, articleStatusScheduled).
+			Updates(map[string]any{
+				"status": status,
+				"utime":  now,
+			}).Error
+	})
+}
+
+// cancelWaitingSchedule 取消还在等待的定时发表，version 也要加 1。
+// 正在执行的不动，定时发表自己也是通过 Sync 发表的
+func cancelWaitingSchedule(tx *gorm.DB, aid int64, now int64) error {
+	return tx.Model(&ArticleSchedule{}).
+		Where("article_id=? AND status=?", aid, scheduleStatusWaiting).
+		Updates(map[string]any{
+			"status":  scheduleStatusCancelled,
+			"version": gorm.Expr("version + 1"),
+			"utime":   now,
+		}).Error
+}
+
+func (dao *GORMArticleScheduleDAO) Preempt(ctx context.Context) (ArticleSchedule, error) {
+	// 和 cron job 的抢占一样，用 version 做乐观锁，多个实例同时抢也只有一个能成功
+	db := dao.db.WithContext(ctx)
+	for {
+		now := time.Now().UnixMilli()
+		var s ArticleSchedule
+		// 到了发表时间还在等待的，或者被抢占了但是一分钟都没有完成的（抢占的实例可能已经挂了）
+		err := db.Where("publish_time <= ? AND status = ?", now, scheduleStatusWaiting).
+			Or("utime < ? AND status = ?",
+				time.Now().Add(-time.Minute).UnixMilli(), scheduleStatusRunning).
+			First(&s).Error
+		if err == gorm.ErrRecordNotFound {
+			return ArticleSchedule{}, ErrNoDueSchedule
+		}
+		if err != nil {
+			return ArticleSchedule{}, err
+		}
+		res := db.Model(&ArticleSchedule{}).Where("id=? AND version=?", s.Id, s.Version).Updates(
+			map[string]any{
+				"status":  scheduleStatusRunning,
+				"version": gorm.Expr("version + 1"),
+				"utime":   now,
+			})
+		if res.Error != nil {
+			return ArticleSchedule{}, res.Error
+		}
+		if res.RowsAffected == 1 {
+			s.Version = s.Version + 1
+			return s, nil
+		}
+		// 被别人抢走了，进入下一轮
+	}
+}
+
+func (dao *GORMArticleScheduleDAO) Release(ctx context.Context, id int64, version int64) error {
+	return dao.update(ctx, id, version, scheduleStatusWaiting)
+}
+
+func (dao *GORMArticleScheduleDAO) Finish(ctx context.Context, id int64, version int64) error {
+	return dao.update(ctx, id, version, scheduleStatusDone)
+}
+
+// update version 对得上才说明任务还是自己的，version 也要加 1，和 Preempt 一样
+func (dao *GORMArticleScheduleDAO) update(ctx context.Context, id int64, version int64, status uint8) error {
+	res := dao.db.WithContext(ctx).Model(&ArticleSchedule{}).
+		Where("id=? AND version=? AND status=?", id, version, scheduleStatusRunning).
+		Updates(map[string]any{
+			"status":  status,
+			"version": gorm.Expr("version + 1"),
+			"utime":   time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		return ErrScheduleLeaseExpired
+	}
+	return nil
+}
+
+// UnsupportedArticleScheduleDAO 文章不存在 MySQL 里面的时候用，所有方法都返回 ErrScheduleUnsupported，
+// 定时发表的后台任务看到这个错误就退出
+type UnsupportedArticleScheduleDAO struct {
+}
+
+func NewUnsupportedArticleScheduleDAO() ArticleScheduleDAO {
+	return &UnsupportedArticleScheduleDAO{}
+}
+
+func (dao *UnsupportedArticleScheduleDAO) Upsert(ctx context.Context, art Article, publishTime int64) (int64, error) {
+	return 0, ErrScheduleUnsupported
+}
+
+func (dao *UnsupportedArticleScheduleDAO) Cancel(ctx context.Context, aid int64, uid int64) error {
+	return ErrScheduleUnsupported
+}
+
+func (dao *UnsupportedArticleScheduleDAO) Preempt(ctx context.Context) (ArticleSchedule, error) {
+	return ArticleSchedule{}, ErrScheduleUnsupported
+}
+
+func (dao *UnsupportedArticleScheduleDAO) Release(ctx context.Context, id int64, version int64) error {
+	return ErrScheduleUnsupported
+}
+
+func (dao *UnsupportedArticleScheduleDAO) Finish(ctx context.Context, id int64, version int64) error {
+	return ErrScheduleUnsupported
+}
+
+// ArticleSchedule 定时发表的任务，相当于一个持久化的延迟队列
+type ArticleSchedule struct {
+	Id int64 `gorm:"primaryKey,autoIncrement"`
+	// 一篇文章只会有一个定时发表任务
+	ArticleId   int64 `gorm:"uniqueIndex"`
+	AuthorId    int64
+	PublishTime int64 `gorm:"index"`
+	Status      uint8
+	// PrevStatus 设置定时发表之前文章的状态
+	PrevStatus uint8
+	Version    int64
+	Ctime      int64
+	Utime      int64
+}
+
+const (
+	scheduleStatusWaiting uint8 = iota
+	scheduleStatusRunning
+	scheduleStatusDone
+	scheduleStatusCancelled
+)
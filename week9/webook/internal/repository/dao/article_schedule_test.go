@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"context"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestGORMArticleScheduleDAO_Preempt(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&ArticleSchedule{})
+	require.NoError(t, err)
+	ctx := context.Background()
+	dao := NewGORMArticleScheduleDAO(db)
+
+	// 没有任务，不能和文章不存在混在一起
+	_, err = dao.Preempt(ctx)
+	assert.Equal(t, ErrNoDueSchedule, err)
+	assert.NotEqual(t, ErrRecordNotFound, err)
+
+	now := time.Now()
+	err = db.Create(&ArticleSchedule{Id: 1, ArticleId: 11, AuthorId: 123,
+		PublishTime: now.Add(-time.Second).UnixMilli(), Status: scheduleStatusWaiting}).Error
+	require.NoError(t, err)
+	s, err := dao.Preempt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), s.ArticleId)
+
+	// 执行太久了，被别的实例当成挂了，抢走了
+	err = db.Model(&ArticleSchedule{}).Where("id = ?", 1).
+		Update("utime", now.Add(-time.Minute*2).UnixMilli()).Error
+	require.NoError(t, err)
+	other, err := dao.Preempt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, s.Version+1, other.Version)
+
+	// 原来的实例不能再释放或者完成别人的任务
+	err = dao.Finish(ctx, s.Id, s.Version)
+	assert.Equal(t, ErrScheduleLeaseExpired, err)
+	err = dao.Release(ctx, s.Id, s.Version)
+	assert.Equal(t, ErrScheduleLeaseExpired, err)
+	err = dao.Finish(ctx, other.Id, other.Version)
+	require.NoError(t, err)
+	_, err = dao.Preempt(ctx)
+	assert.Equal(t, ErrNoDueSchedule, err)
+}
+
+func TestGORMArticleScheduleDAO_UpsertCancel(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Article{}, &ArticleRevision{}, &ArticleSchedule{})
+	require.NoError(t, err)
+	ctx := context.Background()
+	dao := NewGORMArticleScheduleDAO(db)
+	publishTime := time.Now().Add(time.Hour).UnixMilli()
+
+	// 已经发表的文章，定时发表修改之后的内容，再取消，还是已发表
+	err = db.Create(&Article{Id: 1, Title: "v1", AuthorId: 123, Status: articleStatusPublished}).Error
+	require.NoError(t, err)
+	aid, err := dao.Upsert(ctx, Article{Id: 1, Title: "v2", AuthorId: 123}, publishTime)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), aid)
+	var art Article
+	require.NoError(t, db.First(&art, 1).Error)
+	assert.Equal(t, articleStatusScheduled, art.Status)
+	assert.Equal(t, "v2", art.Title)
+	// 修改发表时间不能把原来的状态覆盖成定时发表
+	_, err = dao.Upsert(ctx, Article{Id: 1, Title: "v3", AuthorId: 123}, publishTime+1000)
+	require.NoError(t, err)
+	require.NoError(t, dao.Cancel(ctx, 1, 123))
+	require.NoError(t, db.First(&art, 1).Error)
+	assert.Equal(t, articleStatusPublished, art.Status)
+	assert.Equal(t, ErrScheduleNotFound, dao.Cancel(ctx, 1, 123))
+
+	// 新建的文章直接定时发表，取消之后是未发表
+	aid, err = dao.Upsert(ctx, Article{Title: "new", AuthorId: 123}, publishTime)
+	require.NoError(t, err)
+	require.NoError(t, dao.Cancel(ctx, aid, 123))
+	var created Article
+	require.NoError(t, db.First(&created, aid).Error)
+	assert.Equal(t, articleStatusUnpublished, created.Status)
+
+	// 别人的文章，草稿和任务都不会写进去
+	_, err = dao.Upsert(ctx, Article{Id: 1, Title: "hack", AuthorId: 456}, publishTime)
+	assert.Equal(t, ErrPossibleIncorrectAuthor, err)
+	var unchanged Article
+	require.NoError(t, db.First(&unchanged, 1).Error)
+	assert.Equal(t, "v3", unchanged.Title)
+}
+
+// 定时发表之后又保存成草稿，或者直接发表了，到时间也不能再发表
+func TestGORMArticleScheduleDAO_CancelOnUpdate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Article{}, &PublishedArticle{}, &ArticleRevision{}, &ArticleSchedule{})
+	require.NoError(t, err)
+	ctx := context.Background()
+	dao := NewGORMArticleScheduleDAO(db)
+	artDAO := NewGORMArticleDAO(db)
+	publishTime := time.Now().Add(-time.Second).UnixMilli()
+
+	aid, err := dao.Upsert(ctx, Article{Title: "定时", AuthorId: 123}, publishTime)
+	require.NoError(t, err)
+	err = artDAO.UpdateById(ctx, Article{Id: aid, Title: "草稿", AuthorId: 123, Status: articleStatusUnpublished})
+	require.NoError(t, err)
+	_, err = dao.Preempt(ctx)
+	assert.Equal(t, ErrNoDueSchedule, err)
+	var pubCnt int64
+	require.NoError(t, db.Model(&PublishedArticle{}).Count(&pubCnt).Error)
+	assert.Equal(t, int64(0), pubCnt)
+
+	aid, err = dao.Upsert(ctx, Article{Title: "定时", AuthorId: 123}, publishTime)
+	require.NoError(t, err)
+	_, err = artDAO.Sync(ctx, Article{Id: aid, Title: "马上发表", AuthorId: 123, Status: articleStatusPublished})
+	require.NoError(t, err)
+	_, err = dao.Preempt(ctx)
+	assert.Equal(t, ErrNoDueSchedule, err)
+}
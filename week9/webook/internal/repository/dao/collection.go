@@ -0,0 +1,117 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrCollectionNotFound = errors.New("收藏夹不存在")
+
+// CollectionDAO 收藏夹本身的增删改查
+// 会影响 collect_cnt 的操作，比如说收藏、取消收藏和删除收藏夹，都在 InteractiveDAO 里面
+type CollectionDAO interface {
+	Insert(ctx context.Context, c Collection) (int64, error)
+	UpdateName(ctx context.Context, id int64, uid int64, name string) error
+	FindByUid(ctx context.Context, uid int64) ([]Collection, error)
+	// FindItems 按照 id 倒序分页，maxId 为 0 的时候从头开始
+	FindItems(ctx context.Context, cid int64, uid int64, maxId int64, limit int) ([]UserCollectionBiz, error)
+	// MoveItem 把收藏挪到另外一个收藏夹，不影响 collect_cnt
+	MoveItem(ctx context.Context, biz string, bizId int64, uid int64, toCid int64) error
+}
+
+type GORMCollectionDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMCollectionDAO(db *gorm.DB) CollectionDAO {
+	return &GORMCollectionDAO{db: db}
+}
+
+func (dao *GORMCollectionDAO) Insert(ctx context.Context, c Collection) (int64, error) {
+	now := time.Now().UnixMilli()
+	c.Ctime = now
+	c.Utime = now
+	err := dao.db.WithContext(ctx).Create(&c).Error
+	return c.Id, err
+}
+
+func (dao *GORMCollectionDAO) UpdateName(ctx context.Context, id int64, uid int64, name string) error {
+	res := dao.db.WithContext(ctx).Model(&Collection{}).
+		Where("id = ? AND uid = ?", id, uid).
+		Updates(map[string]any{
+			"name":  name,
+			"utime": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
+
+func (dao *GORMCollectionDAO) FindByUid(ctx context.Context, uid int64) ([]Collection, error) {
+	var res []Collection
+	err := dao.db.WithContext(ctx).
+		Where("uid = ?", uid).
+		Order("id ASC").
+		Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMCollectionDAO) FindItems(ctx context.Context, cid int64, uid int64, maxId int64, limit int) ([]UserCollectionBiz, error) {
+	err := checkCollection(dao.db.WithContext(ctx), cid, uid)
+	if err != nil {
+		return nil, err
+	}
+	db := dao.db.WithContext(ctx).Where("cid = ? AND uid = ?", cid, uid)
+	if maxId > 0 {
+		db = db.Where("id < ?", maxId)
+	}
+	var res []UserCollectionBiz
+	err = db.Order("id DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMCollectionDAO) MoveItem(ctx context.Context, biz string, bizId int64, uid int64, toCid int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := checkCollection(tx, toCid, uid)
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&UserCollectionBiz{}).
+			Where("biz = ? AND biz_id = ? AND uid = ?", biz, bizId, uid).
+			Updates(map[string]any{
+				"cid":   toCid,
+				"utime": time.Now().UnixMilli(),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// checkCollection 收藏夹必须是用户自己的，cid 为 0 是默认收藏夹，每个人都有
+func checkCollection(db *gorm.DB, cid int64, uid int64) error {
+	if cid == 0 {
+		return nil
+	}
+	var cnt int64
+	err := db.Model(&Collection{}).
+		Where("id = ? AND uid = ?", cid, uid).
+		Count(&cnt).Error
+	if err != nil {
+		return err
+	}
+	if cnt != 1 {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
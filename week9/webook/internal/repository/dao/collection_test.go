@@ -0,0 +1,125 @@
+package dao
+
+import (
+	"context"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type CollectionDAOTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	dao     CollectionDAO
+	intrDAO InteractiveDAO
+}
+
+func (s *CollectionDAOTestSuite) SetupTest() {
+	t := s.T()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Collection{}, &UserCollectionBiz{}, &Interactive{})
+	require.NoError(t, err)
+	s.db = db
+	s.dao = NewGORMCollectionDAO(db)
+	s.intrDAO = NewGORMInteractiveDAO(db)
+}
+
+func (s *CollectionDAOTestSuite) TestCRUD() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Insert(ctx, Collection{Name: "Go", Uid: 123})
+	require.NoError(t, err)
+
+	err = s.dao.UpdateName(ctx, id, 456, "篡改")
+	assert.Equal(t, ErrCollectionNotFound, err)
+	err = s.dao.UpdateName(ctx, id, 123, "Golang")
+	require.NoError(t, err)
+
+	cs, err := s.dao.FindByUid(ctx, 123)
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	assert.Equal(t, "Golang", cs[0].Name)
+}
+
+func (s *CollectionDAOTestSuite) TestCollectCnt() {
+	t := s.T()
+	ctx := context.Background()
+	cid1, err := s.dao.Insert(ctx, Collection{Name: "Go", Uid: 123})
+	require.NoError(t, err)
+	cid2, err := s.dao.Insert(ctx, Collection{Name: "Java", Uid: 123})
+	require.NoError(t, err)
+	other, err := s.dao.Insert(ctx, Collection{Name: "别人的", Uid: 456})
+	require.NoError(t, err)
+
+	// 不能收藏到别人的收藏夹
+	err = s.intrDAO.InsertCollectInfo(ctx, "article", 1, other, 123)
+	assert.Equal(t, ErrCollectionNotFound, err)
+
+	for bizId := int64(1); bizId <= 3; bizId++ {
+		err = s.intrDAO.InsertCollectInfo(ctx, "article", bizId, cid1, 123)
+		require.NoError(t, err)
+	}
+	err = s.intrDAO.InsertCollectInfo(ctx, "article", 1, 0, 456)
+	require.NoError(t, err)
+	s.assertCollectCnt(1, 2)
+	s.assertCollectCnt(2, 1)
+
+	// 分页
+	items, err := s.dao.FindItems(ctx, cid1, 123, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, int64(3), items[0].BizId)
+	assert.Equal(t, int64(2), items[1].BizId)
+	items, err = s.dao.FindItems(ctx, cid1, 123, items[1].Id, 2)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, int64(1), items[0].BizId)
+	_, err = s.dao.FindItems(ctx, other, 123, 0, 2)
+	assert.Equal(t, ErrCollectionNotFound, err)
+
+	// 移动不影响计数
+	err = s.dao.MoveItem(ctx, "article", 3, 123, other)
+	assert.Equal(t, ErrCollectionNotFound, err)
+	err = s.dao.MoveItem(ctx, "article", 3, 123, cid2)
+	require.NoError(t, err)
+	err = s.dao.MoveItem(ctx, "article", 10, 123, cid2)
+	assert.Equal(t, ErrRecordNotFound, err)
+	items, err = s.dao.FindItems(ctx, cid2, 123, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	s.assertCollectCnt(3, 1)
+
+	// 取消收藏
+	err = s.intrDAO.DeleteCollectInfo(ctx, "article", 2, 123)
+	require.NoError(t, err)
+	err = s.intrDAO.DeleteCollectInfo(ctx, "article", 2, 123)
+	assert.Equal(t, ErrRecordNotFound, err)
+	s.assertCollectCnt(2, 0)
+
+	// 删除收藏夹，里面的收藏一起删掉
+	_, err = s.intrDAO.DeleteCollection(ctx, cid1, 456)
+	assert.Equal(t, ErrCollectionNotFound, err)
+	deleted, err := s.intrDAO.DeleteCollection(ctx, cid1, 123)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, int64(1), deleted[0].BizId)
+	s.assertCollectCnt(1, 1)
+	s.assertCollectCnt(3, 1)
+}
+
+func (s *CollectionDAOTestSuite) assertCollectCnt(bizId int64, want int64) {
+	intr, err := s.intrDAO.Get(context.Background(), "article", bizId)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), want, intr.CollectCnt)
+}
+
+func TestGORMCollectionDAO(t *testing.T) {
+	suite.Run(t, new(CollectionDAOTestSuite))
+}
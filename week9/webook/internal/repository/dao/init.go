@@ -10,5 +10,10 @@ func InitTable(db *gorm.DB) error {
 		&UserCollectionBiz{},
 		&Interactive{},
 		&Collection{},
+		&ArticleRevision{},
+		&ArticleSchedule{},
+		&OAuthBinding{},
+		&UserTOTP{},
+		&UserRecoveryCode{},
 	)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"sort"
 	"time"
 )
 
@@ -13,10 +14,21 @@ type InteractiveDAO interface {
 	InsertLikeInfo(ctx context.Context, biz string, bizId int64, uid int64) error
 	DeleteLikeInfo(ctx context.Context, biz string, bizId int64, uid int64) error
 	InsertCollectInfo(ctx context.Context, biz string, bizId int64, cid int64, uid int64) error
+	// DeleteCollectInfo 取消收藏，同时 collect_cnt - 1
+	DeleteCollectInfo(ctx context.Context, biz string, bizId int64, uid int64) error
+	// DeleteCollection 删除收藏夹和里面的收藏，返回被删掉的收藏，调用方要用来更新缓存
+	DeleteCollection(ctx context.Context, cid int64, uid int64) ([]UserCollectionBiz, error)
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
+	// BatchIncrReadCnt 在一个事务里面给多个资源加阅读数，bizs、bizIds 和 cnts 一一对应
+	BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64, cnts []int64) error
 	GetCollectionInfo(ctx context.Context, biz string, bizId int64, uid int64) (UserCollectionBiz, error)
 	GetLikeInfo(ctx context.Context, biz string, bizId int64, uid int64) (UserLikeBiz, error)
 	Get(ctx context.Context, biz string, bizId int64) (Interactive, error)
+	// GetByIds 不存在的资源不会出现在结果里面
+	GetByIds(ctx context.Context, biz string, bizIds []int64) ([]Interactive, error)
+	// GetLikeInfos 用户点赞过的，已经取消的不算
+	GetLikeInfos(ctx context.Context, biz string, bizIds []int64, uid int64) ([]UserLikeBiz, error)
+	GetCollectionInfos(ctx context.Context, biz string, bizIds []int64, uid int64) ([]UserCollectionBiz, error)
 }
 
 type GORMInteractiveDAO struct {
@@ -43,6 +55,30 @@ func (dao *GORMInteractiveDAO) Get(ctx context.Context, biz string, bizId int64)
 	return res, err
 }
 
+func (dao *GORMInteractiveDAO) GetByIds(ctx context.Context, biz string, bizIds []int64) ([]Interactive, error) {
+	var res []Interactive
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id IN ?", biz, bizIds).
+		Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMInteractiveDAO) GetLikeInfos(ctx context.Context, biz string, bizIds []int64, uid int64) ([]UserLikeBiz, error) {
+	var res []UserLikeBiz
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id IN ? AND uid = ? AND status = ?", biz, bizIds, uid, 1).
+		Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMInteractiveDAO) GetCollectionInfos(ctx context.Context, biz string, bizIds []int64, uid int64) ([]UserCollectionBiz, error) {
+	var res []UserCollectionBiz
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id IN ? AND uid = ?", biz, bizIds, uid).
+		Find(&res).Error
+	return res, err
+}
+
 func (dao *GORMInteractiveDAO) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
 	now := time.Now().UnixMilli()
 	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
@@ -61,11 +97,51 @@ func (dao *GORMInteractiveDAO) IncrReadCnt(ctx context.Context, biz string, bizI
 	}).Error
 }
 
+func (dao *GORMInteractiveDAO) BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64, cnts []int64) error {
+	// 按照 (biz, biz_id) 排序之后再更新，多个事务加锁的顺序一致，不会死锁
+	idx := make([]int, len(bizs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		if bizs[idx[i]] != bizs[idx[j]] {
+			return bizs[idx[i]] < bizs[idx[j]]
+		}
+		return bizIds[idx[i]] < bizIds[idx[j]]
+	})
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, i := range idx {
+			err := tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]any{
+					"read_cnt": gorm.Expr("read_cnt + ?", cnts[i]),
+					"utime":    now,
+				}),
+			}).Create(&Interactive{
+				Biz:     bizs[i],
+				BizId:   bizIds[i],
+				ReadCnt: cnts[i],
+				Ctime:   now,
+				Utime:   now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (dao *GORMInteractiveDAO) InsertCollectInfo(ctx context.Context, biz string, bizId int64, cid int64, uid int64) error {
 	now := time.Now().UnixMilli()
 	return dao.db.WithContext(ctx).Transaction(
 		func(tx *gorm.DB) error {
-			err := tx.Model(&UserCollectionBiz{}).WithContext(ctx).Create(
+			// 不能收藏到别人的收藏夹里面
+			err := checkCollection(tx, cid, uid)
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&UserCollectionBiz{}).WithContext(ctx).Create(
 				&UserCollectionBiz{
 
 					// 收藏夹 ID
@@ -100,6 +176,65 @@ func (dao *GORMInteractiveDAO) InsertCollectInfo(ctx context.Context, biz string
 
 }
 
+func (dao *GORMInteractiveDAO) DeleteCollectInfo(ctx context.Context, biz string, bizId int64, uid int64) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("biz = ? AND biz_id = ? AND uid = ?", biz, bizId, uid).
+			Delete(&UserCollectionBiz{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// 没有收藏过，计数不能减
+			return ErrRecordNotFound
+		}
+		return decrCollectCnt(tx, biz, bizId, now)
+	})
+}
+
+func (dao *GORMInteractiveDAO) DeleteCollection(ctx context.Context, cid int64, uid int64) ([]UserCollectionBiz, error) {
+	var items []UserCollectionBiz
+	now := time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND uid = ?", cid, uid).Delete(&Collection{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrCollectionNotFound
+		}
+		// 和 BatchIncrReadCnt 一样按照 (biz, biz_id) 的顺序更新计数，避免死锁
+		err := tx.Where("cid = ? AND uid = ?", cid, uid).
+			Order("biz ASC, biz_id ASC").
+			Find(&items).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("cid = ? AND uid = ?", cid, uid).Delete(&UserCollectionBiz{}).Error
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err = decrCollectCnt(tx, item.Biz, item.BizId, now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+// decrCollectCnt 收藏的时候一定已经有 Interactive 了，这里只需要更新
+func decrCollectCnt(tx *gorm.DB, biz string, bizId int64, now int64) error {
+	return tx.Model(&Interactive{}).
+		Where("biz = ? AND biz_id = ? AND collect_cnt > 0", biz, bizId).
+		Updates(map[string]any{
+			"collect_cnt": gorm.Expr("collect_cnt - 1"),
+			"utime":       now,
+		}).Error
+}
+
 func (dao *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, bizId int64, uid int64) error {
 	// 先对用户喜欢谋篇文章的表更新 再更新Interactive表文章的like数
 	now := time.Now().UnixMilli()
@@ -222,7 +357,8 @@ type UserLikeBiz struct {
 type Collection struct {
 	Id   int64  `gorm:"primaryKey,autoIncrement"`
 	Name string `gorm:"type=varchar(1024)"`
-	Uid  int64  `gorm:""`
+	// 按照用户查询收藏夹列表
+	Uid int64 `gorm:"index"`
 
 	Ctime int64
 	Utime int64
@@ -0,0 +1,51 @@
+package dao
+
+import (
+	"context"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"sort"
+	"testing"
+)
+
+func TestGORMInteractiveDAO_GetByIds(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Interactive{}, &UserLikeBiz{}, &UserCollectionBiz{}, &Collection{})
+	require.NoError(t, err)
+	dao := NewGORMInteractiveDAO(db)
+	ctx := context.Background()
+
+	require.NoError(t, dao.IncrReadCnt(ctx, "article", 1))
+	require.NoError(t, dao.IncrReadCnt(ctx, "article", 2))
+	require.NoError(t, dao.IncrReadCnt(ctx, "video", 3))
+	require.NoError(t, dao.InsertLikeInfo(ctx, "article", 1, 123))
+	require.NoError(t, dao.InsertLikeInfo(ctx, "article", 2, 123))
+	// 取消点赞之后不算
+	require.NoError(t, dao.DeleteLikeInfo(ctx, "article", 2, 123))
+	require.NoError(t, dao.InsertCollectInfo(ctx, "article", 2, 0, 123))
+
+	intrs, err := dao.GetByIds(ctx, "article", []int64{1, 2, 3})
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(intrs))
+	for _, intr := range intrs {
+		ids = append(ids, intr.BizId)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	assert.Equal(t, []int64{1, 2}, ids)
+
+	likes, err := dao.GetLikeInfos(ctx, "article", []int64{1, 2, 3}, 123)
+	require.NoError(t, err)
+	require.Len(t, likes, 1)
+	assert.Equal(t, int64(1), likes[0].BizId)
+
+	cols, err := dao.GetCollectionInfos(ctx, "article", []int64{1, 2, 3}, 123)
+	require.NoError(t, err)
+	require.Len(t, cols, 1)
+	assert.Equal(t, int64(2), cols[0].BizId)
+}
@@ -1 +1,259 @@
 package dao
+
+import (
+	"context"
+	"errors"
+	"github.com/bwmarrin/snowflake"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// MongoDBArticleDAO 制作库、线上库和历史版本分别放在三个 collection 里面
+// MongoDB 的事务要求副本集，这里没有用事务，和 GORMArticleDAO 相比一致性要弱一些
+type MongoDBArticleDAO struct {
+	col     *mongo.Collection
+	liveCol *mongo.Collection
+	revCol  *mongo.Collection
+	// MongoDB 没有自增主键，用雪花算法生成 id
+	node *snowflake.Node
+}
+
+func NewMongoDBArticleDAO(db *mongo.Database, node *snowflake.Node) ArticleDAO {
+	return &MongoDBArticleDAO{
+		col:     db.Collection("articles"),
+		liveCol: db.Collection("published_articles"),
+		revCol:  db.Collection("article_revisions"),
+		node:    node,
+	}
+}
+
+func (m *MongoDBArticleDAO) Insert(ctx context.Context, art Article) (int64, error) {
+	now := time.Now().UnixMilli()
+	art.Id = m.node.Generate().Int64()
+	art.Ctime = now
+	art.Utime = now
+	_, err := m.col.InsertOne(ctx, art)
+	if err != nil {
+		return 0, err
+	}
+	return art.Id, m.insertRevision(ctx, art, now)
+}
+
+func (m *MongoDBArticleDAO) UpdateById(ctx context.Context, art Article) error {
+	now := time.Now().UnixMilli()
+	filter := bson.M{"id": art.Id, "author_id": art.AuthorId}
+	update := bson.M{"$set": bson.M{
+		"title":   art.Title,
+		"content": art.Content,
+		"status":  art.Status,
+		"utime":   now,
+	}}
+	res, err := m.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	// 用 MatchedCount 而不是 ModifiedCount，内容没有变化也算更新成功
+	if res.MatchedCount == 0 {
+		return errors.New("更新数据失败")
+	}
+	return m.insertRevision(ctx, art, now)
+}
+
+func (m *MongoDBArticleDAO) Sync(ctx context.Context, art Article) (int64, error) {
+	var (
+		id  = art.Id
+		err error
+	)
+	if id == 0 {
+		id, err = m.Insert(ctx, art)
+	} else {
+		err = m.UpdateById(ctx, art)
+	}
+	if err != nil {
+		return 0, err
+	}
+	art.Id = id
+	now := time.Now().UnixMilli()
+	filter := bson.M{"id": id, "author_id": art.AuthorId}
+	upsert := bson.M{
+		"$set": bson.M{
+			"title":   art.Title,
+			"content": art.Content,
+			"status":  art.Status,
+			"utime":   now,
+		},
+		"$setOnInsert": bson.M{
+			"ctime": now,
+		},
+	}
+	_, err = m.liveCol.UpdateOne(ctx, filter, upsert, options.Update().SetUpsert(true))
+	return id, err
+}
+
+func (m *MongoDBArticleDAO) SyncStatus(ctx context.Context, aid int64, uid int64, status uint8) error {
+	now := time.Now().UnixMilli()
+	filter := bson.M{"id": aid, "author_id": uid}
+	update := bson.M{"$set": bson.M{
+		"status": status,
+		"utime":  now,
+	}}
+	res, err := m.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 1 {
+		return ErrPossibleIncorrectAuthor
+	}
+	res, err = m.liveCol.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount != 1 {
+		return ErrPossibleIncorrectAuthor
+	}
+	return nil
+}
+
+func (m *MongoDBArticleDAO) GetById(ctx context.Context, id int64) (Article, error) {
+	var art Article
+	err := m.col.FindOne(ctx, bson.M{"id": id}).Decode(&art)
+	return art, m.translateErr(err)
+}
+
+func (m *MongoDBArticleDAO) GetPublishedById(ctx context.Context, id int64) (PublishedArticle, error) {
+	var art PublishedArticle
+	err := m.liveCol.FindOne(ctx, bson.M{"id": id}).Decode(&art)
+	return art, m.translateErr(err)
+}
+
+func (m *MongoDBArticleDAO) ListRevisions(ctx context.Context, aid int64, uid int64) ([]ArticleRevision, error) {
+	err := m.checkAuthor(ctx, aid, uid)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := m.revCol.Find(ctx,
+		bson.M{"article_id": aid, "author_id": uid},
+		options.Find().SetSort(bson.D{{Key: "version", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var res []ArticleRevision
+	err = cursor.All(ctx, &res)
+	return res, err
+}
+
+func (m *MongoDBArticleDAO) GetRevision(ctx context.Context, aid int64, uid int64, version int64) (ArticleRevision, error) {
+	err := m.checkAuthor(ctx, aid, uid)
+	if err != nil {
+		return ArticleRevision{}, err
+	}
+	var res ArticleRevision
+	err = m.revCol.FindOne(ctx,
+		bson.M{"article_id": aid, "author_id": uid, "version": version}).Decode(&res)
+	return res, m.translateErr(err)
+}
+
+func (m *MongoDBArticleDAO) ListByAuthor(ctx context.Context, uid int64, cursor Cursor, limit int) ([]Article, error) {
+	var res []Article
+	err := m.find(ctx, m.col, bson.M{"author_id": uid}, cursor, limit, &res)
+	return res, err
+}
+
+func (m *MongoDBArticleDAO) ListPublished(ctx context.Context, authorId int64, cursor Cursor, limit int) ([]PublishedArticle, error) {
+	var res []PublishedArticle
+	err := m.find(ctx, m.liveCol,
+		bson.M{"author_id": authorId, "status": articleStatusPublished}, cursor, limit, &res)
+	return res, err
+}
+
+// find 和 GORMArticleDAO.keyset 一样，按照 (utime, id) 倒序分页
+func (m *MongoDBArticleDAO) find(ctx context.Context, col *mongo.Collection,
+	filter bson.M, cursor Cursor, limit int, res any) error {
+	if cursor.Id > 0 {
+		filter["$or"] = bson.A{
+			bson.M{"utime": bson.M{"$lt": cursor.Utime}},
+			bson.M{"utime": cursor.Utime, "id": bson.M{"$lt": cursor.Id}},
+		}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "utime", Value: -1}, {Key: "id", Value: -1}}).
+		SetLimit(int64(limit))
+	c, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return c.All(ctx, res)
+}
+
+func (m *MongoDBArticleDAO) checkAuthor(ctx context.Context, aid int64, uid int64) error {
+	cnt, err := m.col.CountDocuments(ctx, bson.M{"id": aid, "author_id": uid})
+	if err != nil {
+		return err
+	}
+	if cnt != 1 {
+		return ErrPossibleIncorrectAuthor
+	}
+	return nil
+}
+
+// insertRevision 版本号是当前最大版本号 + 1，并发的时候依赖 (article_id, version) 唯一索引兜底
+func (m *MongoDBArticleDAO) insertRevision(ctx context.Context, art Article, now int64) error {
+	var last ArticleRevision
+	err := m.revCol.FindOne(ctx, bson.M{"article_id": art.Id},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	_, err = m.revCol.InsertOne(ctx, ArticleRevision{
+		Id:        m.node.Generate().Int64(),
+		ArticleId: art.Id,
+		Version:   last.Version + 1,
+		Title:     art.Title,
+		Content:   art.Content,
+		AuthorId:  art.AuthorId,
+		Status:    art.Status,
+		Ctime:     now,
+	})
+	return err
+}
+
+// translateErr 和 GORM 的实现保持一致，找不到的时候返回 ErrRecordNotFound
+func (m *MongoDBArticleDAO) translateErr(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// InitCollections 创建索引
+func InitCollections(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	index := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "author_id", Value: 1},
+				{Key: "utime", Value: -1},
+				{Key: "id", Value: -1},
+			},
+		},
+	}
+	_, err := db.Collection("articles").Indexes().CreateMany(ctx, index)
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("published_articles").Indexes().CreateMany(ctx, index)
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("article_revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "article_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
@@ -0,0 +1,123 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	// ErrOAuthBindingDuplicate 这个第三方账号已经绑定过了，或者这个用户已经绑定过这个第三方了
+	ErrOAuthBindingDuplicate = errors.New("第三方账号已经绑定过了")
+)
+
+type OAuthBindingDAO interface {
+	// Insert 给已有的用户绑定第三方账号
+	Insert(ctx context.Context, b OAuthBinding) error
+	// InsertWithUser 第三方账号第一次登录，创建用户和绑定关系在一个事务里面，返回新用户的 id
+	InsertWithUser(ctx context.Context, b OAuthBinding) (int64, error)
+	FindByExternalId(ctx context.Context, provider string, externalId string) (OAuthBinding, error)
+	FindByUid(ctx context.Context, uid int64) ([]OAuthBinding, error)
+	Delete(ctx context.Context, uid int64, provider string) error
+}
+
+type GORMOAuthBindingDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMOAuthBindingDAO(db *gorm.DB) OAuthBindingDAO {
+	return &GORMOAuthBindingDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMOAuthBindingDAO) Insert(ctx context.Context, b OAuthBinding) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return dao.insert(tx, b)
+	})
+}
+
+func (dao *GORMOAuthBindingDAO) InsertWithUser(ctx context.Context, b OAuthBinding) (int64, error) {
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		u := User{
+			Ctime: now,
+			Utime: now,
+		}
+		err := tx.Create(&u).Error
+		if err != nil {
+			return err
+		}
+		b.Uid = u.Id
+		return dao.insert(tx, b)
+	})
+	return b.Uid, err
+}
+
+// insert 唯一索引兜底，先查一遍是为了给出明确的错误，不依赖具体数据库的错误码
+func (dao *GORMOAuthBindingDAO) insert(tx *gorm.DB, b OAuthBinding) error {
+	var cnt int64
+	err := tx.Model(&OAuthBinding{}).
+		Where("(provider = ? AND external_id = ?) OR (uid = ? AND provider = ?)",
+			b.Provider, b.ExternalId, b.Uid, b.Provider).
+		Count(&cnt).Error
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return ErrOAuthBindingDuplicate
+	}
+	now := time.Now().UnixMilli()
+	b.Ctime = now
+	b.Utime = now
+	err = tx.Create(&b).Error
+	if isUniqueConflict(err) {
+		return ErrOAuthBindingDuplicate
+	}
+	return err
+}
+
+func (dao *GORMOAuthBindingDAO) FindByExternalId(ctx context.Context, provider string, externalId string) (OAuthBinding, error) {
+	var b OAuthBinding
+	err := dao.db.WithContext(ctx).
+		Where("provider = ? AND external_id = ?", provider, externalId).
+		First(&b).Error
+	return b, err
+}
+
+func (dao *GORMOAuthBindingDAO) FindByUid(ctx context.Context, uid int64) ([]OAuthBinding, error) {
+	var res []OAuthBinding
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).
+		Order("id").Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMOAuthBindingDAO) Delete(ctx context.Context, uid int64, provider string) error {
+	res := dao.db.WithContext(ctx).
+		Where("uid = ? AND provider = ?", uid, provider).
+		Delete(&OAuthBinding{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// OAuthBinding 一个用户可以绑定多个第三方账号。
+// 同一个第三方账号只能绑定一个用户，同一个用户在同一个第三方也只能绑定一个账号
+type OAuthBinding struct {
+	Id         int64  `gorm:"primaryKey,autoIncrement"`
+	Uid        int64  `gorm:"uniqueIndex:uid_provider"`
+	Provider   string `gorm:"type:varchar(64);uniqueIndex:uid_provider;uniqueIndex:provider_external_id"`
+	ExternalId string `gorm:"type:varchar(255);uniqueIndex:provider_external_id"`
+	Email      string
+	Ctime      int64
+	Utime      int64
+}
+
+func (OAuthBinding) TableName() string {
+	return "users_oauth_bindings"
+}
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type OAuthBindingDAOTestSuite struct {
+	suite.Suite
+	db  *gorm.DB
+	dao OAuthBindingDAO
+}
+
+func (s *OAuthBindingDAOTestSuite) SetupTest() {
+	t := s.T()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&User{}, &OAuthBinding{})
+	require.NoError(t, err)
+	s.db = db
+	s.dao = NewGORMOAuthBindingDAO(db)
+}
+
+func (s *OAuthBindingDAOTestSuite) TestBindings() {
+	t := s.T()
+	ctx := context.Background()
+	// 第一次登录，连用户一起创建
+	uid, err := s.dao.InsertWithUser(ctx, OAuthBinding{Provider: "github", ExternalId: "1"})
+	require.NoError(t, err)
+	assert.True(t, uid > 0)
+	var cnt int64
+	err = s.db.Model(&User{}).Where("id = ?", uid).Count(&cnt).Error
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	// 同一个第三方账号不能再创建一个用户，事务回滚，用户也不会多出来
+	_, err = s.dao.InsertWithUser(ctx, OAuthBinding{Provider: "github", ExternalId: "1"})
+	assert.Equal(t, ErrOAuthBindingDuplicate, err)
+	err = s.db.Model(&User{}).Count(&cnt).Error
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	err = s.dao.Insert(ctx, OAuthBinding{Uid: uid, Provider: "google", ExternalId: "abc", Email: "a@b.com"})
+	require.NoError(t, err)
+	// 同一个用户同一个第三方只能绑定一个
+	err = s.dao.Insert(ctx, OAuthBinding{Uid: uid, Provider: "google", ExternalId: "def"})
+	assert.Equal(t, ErrOAuthBindingDuplicate, err)
+	// 已经被别人绑定了
+	err = s.dao.Insert(ctx, OAuthBinding{Uid: uid + 1, Provider: "google", ExternalId: "abc"})
+	assert.Equal(t, ErrOAuthBindingDuplicate, err)
+
+	b, err := s.dao.FindByExternalId(ctx, "google", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, uid, b.Uid)
+	bs, err := s.dao.FindByUid(ctx, uid)
+	require.NoError(t, err)
+	require.Len(t, bs, 2)
+	assert.Equal(t, "github", bs[0].Provider)
+
+	err = s.dao.Delete(ctx, uid, "google")
+	require.NoError(t, err)
+	err = s.dao.Delete(ctx, uid, "google")
+	assert.Equal(t, ErrRecordNotFound, err)
+	_, err = s.dao.FindByExternalId(ctx, "google", "abc")
+	assert.Equal(t, ErrRecordNotFound, err)
+}
+
+func TestGORMOAuthBindingDAO(t *testing.T) {
+	suite.Run(t, new(OAuthBindingDAOTestSuite))
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+)
+
+// ErrRankingUnsupported 文章存储不是 MySQL，热榜不可用
+var ErrRankingUnsupported = errors.New("当前的文章存储不支持热榜")
+
+// RankingDAO 计算热榜要用的数据，直接从 published_articles 和 interactives 里面捞
+// 用 MongoDB 存文章的时候 published_articles 不在 MySQL 里面，用 UnsupportedRankingDAO
+type RankingDAO interface {
+	// ListArticleCandidates since 之后发表的文章，按照 id 升序分页，maxId 是上一批最大的 id
+	ListArticleCandidates(ctx context.Context, since int64, maxId int64, limit int) ([]ArticleCandidate, error)
+}
+
+// ArticleCandidate 一篇已发表的文章和它的计数
+type ArticleCandidate struct {
+	Id         int64
+	Title      string
+	AuthorId   int64
+	Ctime      int64
+	ReadCnt    int64
+	LikeCnt    int64
+	CollectCnt int64
+}
+
+type GORMRankingDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMRankingDAO(db *gorm.DB) RankingDAO {
+	return &GORMRankingDAO{db: db}
+}
+
+func (dao *GORMRankingDAO) ListArticleCandidates(ctx context.Context, since int64, maxId int64, limit int) ([]ArticleCandidate, error) {
+	var res []ArticleCandidate
+	// 还没有人看过的文章没有 interactives，所以是 LEFT JOIN
+	err := dao.db.WithContext(ctx).Table("published_articles AS p").
+		Select("p.id, p.title, p.author_id, p.ctime, "+
+			"COALESCE(i.read_cnt, 0) AS read_cnt, "+
+			"COALESCE(i.like_cnt, 0) AS like_cnt, "+
+			"COALESCE(i.collect_cnt, 0) AS collect_cnt").
+		Joins("LEFT JOIN interactives AS i ON i.biz = ? AND i.biz_id = p.id", "article").
+		Where("p.status = ? AND p.ctime >= ? AND p.id > ?", articleStatusPublished, since, maxId).
+		Order("p.id ASC").
+		Limit(limit).
+		Scan(&res).Error
+	return res, err
+}
+
+// UnsupportedRankingDAO 文章不存在 MySQL 里面的时候用，热榜任务看到 ErrRankingUnsupported 就退出
+type UnsupportedRankingDAO struct {
+}
+
+func NewUnsupportedRankingDAO() RankingDAO {
+	return &UnsupportedRankingDAO{}
+}
+
+func (dao *UnsupportedRankingDAO) ListArticleCandidates(ctx context.Context, since int64, maxId int64, limit int) ([]ArticleCandidate, error) {
+	return nil, ErrRankingUnsupported
+}
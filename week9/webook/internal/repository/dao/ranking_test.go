@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"context"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestGORMRankingDAO_ListArticleCandidates(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&PublishedArticle{}, &Interactive{})
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+	old := time.Now().Add(-time.Hour * 24 * 30).UnixMilli()
+	err = db.Create([]PublishedArticle{
+		{Id: 1, Title: "有人看", AuthorId: 11, Status: articleStatusPublished, Ctime: now},
+		{Id: 2, Title: "没人看", AuthorId: 22, Status: articleStatusPublished, Ctime: now},
+		{Id: 3, Title: "撤回了", AuthorId: 33, Status: articleStatusPrivate, Ctime: now},
+		{Id: 4, Title: "太老了", AuthorId: 44, Status: articleStatusPublished, Ctime: old},
+	}).Error
+	require.NoError(t, err)
+	err = db.Create(&Interactive{Biz: "article", BizId: 1, ReadCnt: 10, LikeCnt: 2, CollectCnt: 1}).Error
+	require.NoError(t, err)
+	// 别的业务的同一个 id 不能算进来
+	err = db.Create(&Interactive{Biz: "video", BizId: 2, ReadCnt: 100}).Error
+	require.NoError(t, err)
+
+	dao := NewGORMRankingDAO(db)
+	since := time.Now().Add(-time.Hour * 24 * 7).UnixMilli()
+	res, err := dao.ListArticleCandidates(ctx, since, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []ArticleCandidate{
+		{Id: 1, Title: "有人看", AuthorId: 11, Ctime: now, ReadCnt: 10, LikeCnt: 2, CollectCnt: 1},
+	}, res)
+	res, err = dao.ListArticleCandidates(ctx, since, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []ArticleCandidate{
+		{Id: 2, Title: "没人看", AuthorId: 22, Ctime: now},
+	}, res)
+}
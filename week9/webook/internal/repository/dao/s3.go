@@ -1 +1,149 @@
 package dao
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// S3ArticleDAO 线上库的内容放到对象存储里面，MySQL 里面只保留元数据和摘要
+// 制作库和历史版本还是在 MySQL 里面，只有作者自己会看
+type S3ArticleDAO struct {
+	// 制作库相关的操作直接复用
+	*GORMArticleDAO
+	oss    *s3.S3
+	bucket *string
+	l      logger.LoggerV1
+}
+
+func NewS3ArticleDAO(oss *s3.S3, bucket string, db *gorm.DB, l logger.LoggerV1) ArticleDAO {
+	return &S3ArticleDAO{
+		GORMArticleDAO: &GORMArticleDAO{db: db},
+		oss:            oss,
+		bucket:         aws.String(bucket),
+		l:              l,
+	}
+}
+
+func (dao *S3ArticleDAO) Sync(ctx context.Context, art Article) (int64, error) {
+	var (
+		id  = art.Id
+		err error
+	)
+	now := time.Now().UnixMilli()
+	err = dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txDAO := NewGORMArticleDAO(tx)
+		if art.Id == 0 {
+			id, err = txDAO.Insert(ctx, art)
+		} else {
+			err = txDAO.UpdateById(ctx, art)
+		}
+		if err != nil {
+			return err
+		}
+		art.Id = id
+		// 线上库只存摘要，不再把整篇文章塞进 published_articles
+		abstract := abstractOf(art.Content)
+		publishedArt := PublishedArticle(art)
+		publishedArt.Content = abstract
+		publishedArt.Ctime = now
+		publishedArt.Utime = now
+		err = tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"title":   art.Title,
+				"content": abstract,
+				"status":  art.Status,
+				"utime":   now,
+			}),
+		}).Create(&publishedArt).Error
+		if err != nil {
+			return err
+		}
+		// 在事务里面写对象存储，写失败了整个事务回滚，标题、摘要和内容要么都是新的，要么都是旧的。
+		// 反过来写成功了但是提交失败，只是内容提前更新了，作者重新发表一次就一致了
+		_, err = dao.oss.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      dao.bucket,
+			Key:         dao.key(id),
+			Body:        bytes.NewReader([]byte(art.Content)),
+			ContentType: aws.String("text/plain;charset=utf-8"),
+		})
+		return err
+	})
+	return id, err
+}
+
+func (dao *S3ArticleDAO) SyncStatus(ctx context.Context, aid int64, uid int64, status uint8) error {
+	err := dao.GORMArticleDAO.SyncStatus(ctx, aid, uid, status)
+	if err != nil {
+		return err
+	}
+	if status != articleStatusPrivate {
+		return nil
+	}
+	// 撤回之后读者就看不到了，内容也没必要放在对象存储上，重新发表的时候会再写一次
+	// 删除失败的话只是多占了一点空间，GetPublishedById 会根据状态判断，不会泄露内容。
+	// 数据库已经改好了，这里不能返回 error，不然上层以为撤回失败，缓存也不会删
+	_, err = dao.oss.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: dao.bucket,
+		Key:    dao.key(aid),
+	})
+	if err != nil {
+		dao.l.Error("撤回之后删除对象存储里面的内容失败",
+			logger.Int64("aid", aid),
+			logger.Error(err))
+	}
+	return nil
+}
+
+func (dao *S3ArticleDAO) GetPublishedById(ctx context.Context, id int64) (PublishedArticle, error) {
+	art, err := dao.GORMArticleDAO.GetPublishedById(ctx, id)
+	if err != nil {
+		return PublishedArticle{}, err
+	}
+	if art.Status != articleStatusPublished {
+		// 不是发表状态的，内容已经不在对象存储里面了
+		art.Content = ""
+		return art, nil
+	}
+	res, err := dao.oss.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: dao.bucket,
+		Key:    dao.key(id),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return PublishedArticle{}, ErrRecordNotFound
+		}
+		return PublishedArticle{}, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return PublishedArticle{}, err
+	}
+	art.Content = string(data)
+	return art, nil
+}
+
+func (dao *S3ArticleDAO) key(id int64) *string {
+	return aws.String(strconv.FormatInt(id, 10))
+}
+
+// abstractOf 和 domain.Article.Abstract 保持一致，取前 128 个字符
+func abstractOf(content string) string {
+	const abstractLen = 128
+	if utf8.RuneCountInString(content) <= abstractLen {
+		return content
+	}
+	return string([]rune(content)[:abstractLen])
+}
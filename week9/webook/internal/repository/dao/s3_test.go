@@ -0,0 +1,240 @@
+package dao
+
+import (
+	"context"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/glebarez/sqlite"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testBucket = "webook-articles"
+
+// S3ArticleDAOTestSuite 元数据用内存的 sqlite，对象存储用进程内的 fake S3
+type S3ArticleDAOTestSuite struct {
+	suite.Suite
+	db  *gorm.DB
+	oss *s3.S3
+	srv *httptest.Server
+	dao ArticleDAO
+}
+
+func (s *S3ArticleDAOTestSuite) SetupTest() {
+	t := s.T()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// 内存数据库每个连接都是独立的，只能用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Article{}, &PublishedArticle{}, &ArticleRevision{}, &ArticleSchedule{})
+	require.NoError(t, err)
+	s.db = db
+
+	backend := s3mem.New()
+	err = backend.CreateBucket(testBucket)
+	require.NoError(t, err)
+	s.srv = httptest.NewServer(gofakes3.New(backend).Server())
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:         aws.String(s.srv.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+	})
+	require.NoError(t, err)
+	s.oss = s3.New(sess)
+	s.dao = NewS3ArticleDAO(s.oss, testBucket, db, logger.NewNoOpLogger())
+}
+
+func (s *S3ArticleDAOTestSuite) TearDownTest() {
+	s.srv.Close()
+}
+
+func (s *S3ArticleDAOTestSuite) TestSync() {
+	t := s.T()
+	ctx := context.Background()
+	content := strings.Repeat("内容", 100)
+
+	// 新建并发表
+	id, err := s.dao.Sync(ctx, Article{
+		Title:    "标题",
+		Content:  content,
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	require.NoError(t, err)
+	assert.True(t, id > 0)
+
+	// 线上库只有摘要
+	var pub PublishedArticle
+	err = s.db.Where("id = ?", id).First(&pub).Error
+	require.NoError(t, err)
+	assert.Equal(t, []rune(content)[:128], []rune(pub.Content))
+	assert.Equal(t, content, s.object(id))
+
+	art, err := s.dao.GetPublishedById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, content, art.Content)
+	assert.Equal(t, "标题", art.Title)
+
+	// 修改之后再发表
+	_, err = s.dao.Sync(ctx, Article{
+		Id:       id,
+		Title:    "新的标题",
+		Content:  "新的内容",
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	require.NoError(t, err)
+	art, err = s.dao.GetPublishedById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "新的内容", art.Content)
+	assert.Equal(t, "新的标题", art.Title)
+
+	// 别人的文章
+	_, err = s.dao.Sync(ctx, Article{
+		Id:       id,
+		Title:    "篡改",
+		Content:  "篡改",
+		AuthorId: 456,
+		Status:   articleStatusPublished,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "新的内容", s.object(id))
+}
+
+func (s *S3ArticleDAOTestSuite) TestSyncOSSFailed() {
+	t := s.T()
+	ctx := context.Background()
+	// 桶不存在，写对象存储失败，发表失败
+	failed := NewS3ArticleDAO(s.oss, "not-exist", s.db, logger.NewNoOpLogger())
+	id, err := failed.Sync(ctx, Article{
+		Title:    "标题",
+		Content:  "内容",
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	assert.Error(t, err)
+	// 事务回滚了，读者看到的是文章不存在，作者重新发表一次就好
+	_, err = s.dao.GetPublishedById(ctx, id)
+	assert.Equal(t, ErrRecordNotFound, err)
+}
+
+func (s *S3ArticleDAOTestSuite) TestRepublishOSSFailed() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Sync(ctx, Article{
+		Title:    "标题",
+		Content:  "内容",
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	require.NoError(t, err)
+	failed := NewS3ArticleDAO(s.oss, "not-exist", s.db, logger.NewNoOpLogger())
+	_, err = failed.Sync(ctx, Article{
+		Id:       id,
+		Title:    "新的标题",
+		Content:  "新的内容",
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	assert.Error(t, err)
+	// 标题、摘要和内容都还是旧的，不会出现新标题配旧内容
+	art, err := s.dao.GetPublishedById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "标题", art.Title)
+	assert.Equal(t, "内容", art.Content)
+	draft, err := s.dao.GetById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "标题", draft.Title)
+}
+
+func (s *S3ArticleDAOTestSuite) TestSyncStatus() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Sync(ctx, Article{
+		Title:    "标题",
+		Content:  "内容",
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	require.NoError(t, err)
+
+	err = s.dao.SyncStatus(ctx, id, 456, articleStatusPrivate)
+	assert.Equal(t, ErrPossibleIncorrectAuthor, err)
+	assert.Equal(t, "内容", s.object(id))
+
+	err = s.dao.SyncStatus(ctx, id, 123, articleStatusPrivate)
+	require.NoError(t, err)
+	_, err = s.oss.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    s.dao.(*S3ArticleDAO).key(id),
+	})
+	assert.Error(t, err)
+	art, err := s.dao.GetPublishedById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, articleStatusPrivate, art.Status)
+	assert.Equal(t, "", art.Content)
+
+	// 重新发表，内容又回来了
+	_, err = s.dao.Sync(ctx, Article{
+		Id:       id,
+		Title:    "标题",
+		Content:  "内容",
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	require.NoError(t, err)
+	art, err = s.dao.GetPublishedById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "内容", art.Content)
+}
+
+func (s *S3ArticleDAOTestSuite) TestSyncStatusOSSFailed() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Sync(ctx, Article{
+		Title:    "标题",
+		Content:  "内容",
+		AuthorId: 123,
+		Status:   articleStatusPublished,
+	})
+	require.NoError(t, err)
+	// 删除对象存储里面的内容失败，撤回还是成功的
+	s.dao = NewS3ArticleDAO(s.oss, "not-exist", s.db, logger.NewNoOpLogger())
+	err = s.dao.SyncStatus(ctx, id, 123, articleStatusPrivate)
+	require.NoError(t, err)
+	art, err := s.dao.GetPublishedById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, articleStatusPrivate, art.Status)
+	assert.Equal(t, "", art.Content)
+}
+
+func (s *S3ArticleDAOTestSuite) object(id int64) string {
+	res, err := s.oss.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    s.dao.(*S3ArticleDAO).key(id),
+	})
+	require.NoError(s.T(), err)
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	require.NoError(s.T(), err)
+	return string(data)
+}
+
+func TestS3ArticleDAO(t *testing.T) {
+	suite.Run(t, new(S3ArticleDAOTestSuite))
+}
@@ -0,0 +1,150 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ErrTOTPEnabled 已经开启了两步验证，要先关掉才能重新绑定
+var ErrTOTPEnabled = errors.New("已经开启了两步验证")
+
+type TOTPDAO interface {
+	FindByUid(ctx context.Context, uid int64) (UserTOTP, error)
+	// SavePending 还没有开启的时候可以反复覆盖，已经开启了返回 ErrTOTPEnabled
+	SavePending(ctx context.Context, uid int64, secret string) error
+	// Enable 开启两步验证，恢复码整个换掉
+	Enable(ctx context.Context, uid int64, recoveryCodes []string) error
+	// Delete 关闭两步验证，密钥和恢复码都删掉
+	Delete(ctx context.Context, uid int64) error
+	// UseRecoveryCode 恢复码只能用一次，用掉了返回 true
+	UseRecoveryCode(ctx context.Context, uid int64, code string) (bool, error)
+}
+
+type GORMTOTPDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMTOTPDAO(db *gorm.DB) TOTPDAO {
+	return &GORMTOTPDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMTOTPDAO) FindByUid(ctx context.Context, uid int64) (UserTOTP, error) {
+	var res UserTOTP
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).First(&res).Error
+	return res, err
+}
+
+func (dao *GORMTOTPDAO) SavePending(ctx context.Context, uid int64, secret string) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		var old UserTOTP
+		err := tx.Where("uid = ?", uid).First(&old).Error
+		switch err {
+		case nil:
+			if old.Enabled {
+				return ErrTOTPEnabled
+			}
+			// 带上 enabled = false，防止并发的时候刚好被开启了
+			res := tx.Model(&UserTOTP{}).Where("uid = ? AND enabled = ?", uid, false).
+				Updates(map[string]any{
+					"secret": secret,
+					"utime":  now,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrTOTPEnabled
+			}
+			return nil
+		case gorm.ErrRecordNotFound:
+			return tx.Create(&UserTOTP{
+				Uid:    uid,
+				Secret: secret,
+				Ctime:  now,
+				Utime:  now,
+			}).Error
+		default:
+			return err
+		}
+	})
+}
+
+func (dao *GORMTOTPDAO) Enable(ctx context.Context, uid int64, recoveryCodes []string) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		res := tx.Model(&UserTOTP{}).Where("uid = ?", uid).
+			Updates(map[string]any{
+				"enabled": true,
+				"utime":   now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		err := tx.Where("uid = ?", uid).Delete(&UserRecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+		codes := make([]UserRecoveryCode, 0, len(recoveryCodes))
+		for _, c := range recoveryCodes {
+			codes = append(codes, UserRecoveryCode{
+				Uid:   uid,
+				Code:  c,
+				Ctime: now,
+			})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (dao *GORMTOTPDAO) Delete(ctx context.Context, uid int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("uid = ?", uid).Delete(&UserRecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", uid).Delete(&UserTOTP{}).Error
+	})
+}
+
+func (dao *GORMTOTPDAO) UseRecoveryCode(ctx context.Context, uid int64, code string) (bool, error) {
+	// 直接删，两个请求同时用同一个恢复码，只有一个能删掉
+	res := dao.db.WithContext(ctx).
+		Where("uid = ? AND code = ?", uid, code).
+		Delete(&UserRecoveryCode{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// UserTOTP 用户的两步验证密钥，Secret 是加密之后的
+type UserTOTP struct {
+	Id     int64  `gorm:"primaryKey,autoIncrement"`
+	Uid    int64  `gorm:"unique"`
+	Secret string `gorm:"type:varchar(255)"`
+	// 扫码之后输对了第一个验证码才算开启
+	Enabled bool
+	Ctime   int64
+	Utime   int64
+}
+
+func (UserTOTP) TableName() string {
+	return "users_totp"
+}
+
+// UserRecoveryCode 手机丢了的时候用，Code 存的是哈希
+type UserRecoveryCode struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Uid   int64  `gorm:"uniqueIndex:uid_code"`
+	Code  string `gorm:"type:varchar(64);uniqueIndex:uid_code"`
+	Ctime int64
+}
+
+func (UserRecoveryCode) TableName() string {
+	return "users_recovery_codes"
+}
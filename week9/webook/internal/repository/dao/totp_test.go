@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type TOTPDAOTestSuite struct {
+	suite.Suite
+	db  *gorm.DB
+	dao TOTPDAO
+}
+
+func (s *TOTPDAOTestSuite) SetupTest() {
+	t := s.T()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&UserTOTP{}, &UserRecoveryCode{})
+	require.NoError(t, err)
+	s.db = db
+	s.dao = NewGORMTOTPDAO(db)
+}
+
+func (s *TOTPDAOTestSuite) TestEnable() {
+	t := s.T()
+	ctx := context.Background()
+
+	// 没开启之前可以重新扫码
+	err := s.dao.SavePending(ctx, 1, "secret1")
+	require.NoError(t, err)
+	err = s.dao.SavePending(ctx, 1, "secret2")
+	require.NoError(t, err)
+	res, err := s.dao.FindByUid(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "secret2", res.Secret)
+	assert.False(t, res.Enabled)
+
+	err = s.dao.Enable(ctx, 1, []string{"c1", "c2"})
+	require.NoError(t, err)
+	res, err = s.dao.FindByUid(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, res.Enabled)
+	// 开启之后就不能覆盖了
+	err = s.dao.SavePending(ctx, 1, "secret3")
+	assert.Equal(t, ErrTOTPEnabled, err)
+
+	// 恢复码只能用一次，也不能用别人的
+	ok, err := s.dao.UseRecoveryCode(ctx, 2, "c1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = s.dao.UseRecoveryCode(ctx, 1, "c1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = s.dao.UseRecoveryCode(ctx, 1, "c1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 关闭之后都删掉
+	err = s.dao.Delete(ctx, 1)
+	require.NoError(t, err)
+	_, err = s.dao.FindByUid(ctx, 1)
+	assert.Equal(t, ErrRecordNotFound, err)
+	ok, err = s.dao.UseRecoveryCode(ctx, 1, "c2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestTOTPDAO(t *testing.T) {
+	suite.Run(t, new(TOTPDAOTestSuite))
+}
@@ -16,6 +16,11 @@ var ErrUserDuplicate = errors.New("账户已注册")
 type UserDAO interface {
 	Insert(ctx context.Context, u User) error
 	FindByEmail(ctx context.Context, email string) (User, error)
+	FindByPhone(ctx context.Context, phone string) (User, error)
+	FindByWechat(ctx context.Context, openId string) (User, error)
+	FindById(ctx context.Context, id int64) (User, error)
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	MarkEmailVerified(ctx context.Context, id int64) error
 }
 
 type GORMUserDAO struct {
@@ -37,24 +42,80 @@ func (dao *GORMUserDAO) FindByEmail(ctx context.Context, email string) (User, er
 	return u, err
 }
 
+func (dao *GORMUserDAO) FindByPhone(ctx context.Context, phone string) (User, error) {
+	var u User
+	err := dao.db.WithContext(ctx).Where("phone = ?", phone).First(&u).Error
+	if err == gorm.ErrRecordNotFound {
+		return User{}, ErrDataNotFound
+	}
+	return u, err
+}
+
+func (dao *GORMUserDAO) FindByWechat(ctx context.Context, openId string) (User, error) {
+	var u User
+	err := dao.db.WithContext(ctx).Where("wechat_open_id = ?", openId).First(&u).Error
+	if err == gorm.ErrRecordNotFound {
+		return User{}, ErrDataNotFound
+	}
+	return u, err
+}
+
+func (dao *GORMUserDAO) FindById(ctx context.Context, id int64) (User, error) {
+	var u User
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&u).Error
+	if err == gorm.ErrRecordNotFound {
+		return User{}, ErrDataNotFound
+	}
+	return u, err
+}
+
+func (dao *GORMUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"password": password,
+			"utime":    time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GORMUserDAO) MarkEmailVerified(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"email_verified": true,
+			"utime":          time.Now().UnixMilli(),
+		}).Error
+}
+
 func (dao *GORMUserDAO) Insert(ctx context.Context, u User) error {
 	now := time.Now().UnixMilli()
 	u.Ctime = now
 	u.Utime = now
 	err := dao.db.WithContext(ctx).Create(&u).Error
+	if isUniqueConflict(err) {
+		return ErrUserDuplicate
+	}
+	return err
+}
+
+// isUniqueConflict 违反了唯一索引
+func isUniqueConflict(err error) bool {
 	if me, ok := err.(*mysql.MySQLError); ok {
 		const uniqueIndexErrNo uint16 = 1062
-		if me.Number == uniqueIndexErrNo {
-			return ErrUserDuplicate
-		}
+		return me.Number == uniqueIndexErrNo
 	}
-	return err
+	return false
 }
 
 type User struct {
-	Id       int64          `gorm:"primaryKey,autoIncrement"`
-	Email    sql.NullString `gorm:"unique"`
-	Password string
-	Ctime    int64
-	Utime    int64
+	Id    int64          `gorm:"primaryKey,autoIncrement"`
+	Email sql.NullString `gorm:"unique"`
+	// 点过验证邮件里面的链接，或者通过邮件重置过密码
+	EmailVerified bool
+	Password      string
+	// 手机号登录的用户没有邮箱，邮箱登录的用户没有手机号，所以都是 NULL 的唯一索引
+	Phone sql.NullString `gorm:"unique"`
+	// 微信扫码登录用 openid 找用户，unionid 先存起来，以后接入别的微信应用的时候用
+	WechatOpenId  sql.NullString `gorm:"unique"`
+	WechatUnionId sql.NullString
+	Ctime         int64
+	Utime         int64
 }
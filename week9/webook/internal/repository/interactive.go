@@ -5,21 +5,34 @@ import (
 	"geekgo/week9/webook/internal/domain"
 	"geekgo/week9/webook/internal/repository/cache"
 	"geekgo/week9/webook/internal/repository/dao"
+	"geekgo/week9/webook/pkgs/logger"
+	"go.opentelemetry.io/otel/trace"
+	"time"
 )
 
 type InteractiveRepository interface {
 	IncrLike(ctx context.Context, biz string, bizId int64, uid int64) error
 	DecrLike(ctx context.Context, biz string, bizId int64, uid int64) error
 	Collect(ctx context.Context, biz string, bizId int64, cid int64, uid int64) error
+	Uncollect(ctx context.Context, biz string, bizId int64, uid int64) error
+	// DeleteCollection 删除收藏夹会连带删除里面的收藏，所以放在这里维护 collect_cnt
+	DeleteCollection(ctx context.Context, cid int64, uid int64) error
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
+	// BatchIncrReadCnt bizs、bizIds 和 cnts 一一对应，同一个资源调用方要先聚合好
+	BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64, cnts []int64) error
 	Get(ctx context.Context, biz string, bizId int64) (domain.Interactive, error)
 	Liked(ctx context.Context, biz string, bizId int64, uid int64) (bool, error)
 	Collected(ctx context.Context, biz string, bizId int64, uid int64) (bool, error)
+	// GetByIds 没有数据的资源计数都是 0
+	GetByIds(ctx context.Context, biz string, bizIds []int64) (map[int64]domain.Interactive, error)
+	LikedByIds(ctx context.Context, biz string, bizIds []int64, uid int64) (map[int64]bool, error)
+	CollectedByIds(ctx context.Context, biz string, bizIds []int64, uid int64) (map[int64]bool, error)
 }
 
 type CachedReadCntRepository struct {
 	cache cache.InteractiveCache
 	dao   dao.InteractiveDAO
+	l     logger.LoggerV1
 }
 
 func (c *CachedReadCntRepository) Get(ctx context.Context, biz string, bizId int64) (domain.Interactive, error) {
@@ -40,7 +53,11 @@ func (c *CachedReadCntRepository) Get(ctx context.Context, biz string, bizId int
 	if err != nil {
 		return domain.Interactive{}, err
 	}
+	// 请求结束之后 ctx 就被取消了，gin 的 Context 还会被复用，只留下 trace
+	ctx = trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
 	go func() {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
 		er := c.cache.Set(ctx, biz, bizId, intr)
 		// 记录日志
 		if er != nil {
@@ -50,6 +67,73 @@ func (c *CachedReadCntRepository) Get(ctx context.Context, biz string, bizId int
 	return intr, nil
 }
 
+func (c *CachedReadCntRepository) GetByIds(ctx context.Context, biz string, bizIds []int64) (map[int64]domain.Interactive, error) {
+	res, err := c.cache.GetByIds(ctx, biz, bizIds)
+	if err != nil {
+		// 缓存出问题了，全部当成没命中
+		res = make(map[int64]domain.Interactive, len(bizIds))
+	}
+	misses := make([]int64, 0, len(bizIds))
+	for _, bizId := range bizIds {
+		if _, ok := res[bizId]; !ok {
+			misses = append(misses, bizId)
+		}
+	}
+	if len(misses) == 0 {
+		return res, nil
+	}
+	intrs, err := c.dao.GetByIds(ctx, biz, misses)
+	if err != nil {
+		return nil, err
+	}
+	// 数据库里面没有的也回写，计数是 0，免得每次都打到数据库
+	loaded := make(map[int64]domain.Interactive, len(misses))
+	for _, bizId := range misses {
+		loaded[bizId] = domain.Interactive{}
+	}
+	for _, intr := range intrs {
+		loaded[intr.BizId] = domain.Interactive{
+			LikeCnt:    intr.LikeCnt,
+			CollectCnt: intr.CollectCnt,
+			ReadCnt:    intr.ReadCnt,
+		}
+	}
+	for bizId, intr := range loaded {
+		res[bizId] = intr
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		// 回写失败了也没关系，下次还是从数据库加载
+		_ = c.cache.SetByIds(ctx, biz, loaded)
+	}()
+	return res, nil
+}
+
+func (c *CachedReadCntRepository) LikedByIds(ctx context.Context, biz string, bizIds []int64, uid int64) (map[int64]bool, error) {
+	likes, err := c.dao.GetLikeInfos(ctx, biz, bizIds, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(likes))
+	for _, like := range likes {
+		res[like.BizId] = true
+	}
+	return res, nil
+}
+
+func (c *CachedReadCntRepository) CollectedByIds(ctx context.Context, biz string, bizIds []int64, uid int64) (map[int64]bool, error) {
+	cols, err := c.dao.GetCollectionInfos(ctx, biz, bizIds, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(cols))
+	for _, col := range cols {
+		res[col.BizId] = true
+	}
+	return res, nil
+}
+
 func (c *CachedReadCntRepository) Liked(ctx context.Context, biz string, bizId int64, uid int64) (bool, error) {
 	_, err := c.dao.GetLikeInfo(ctx, biz, bizId, uid)
 	switch err {
@@ -91,12 +175,71 @@ func (c *CachedReadCntRepository) IncrReadCnt(ctx context.Context, biz string, b
 	return c.cache.IncrReadCntIfPresent(ctx, biz, bizId)
 }
 
+func (c *CachedReadCntRepository) BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64, cnts []int64) error {
+	// 和 IncrReadCnt 一样，先数据库再缓存
+	err := c.dao.BatchIncrReadCnt(ctx, bizs, bizIds, cnts)
+	if err != nil {
+		return err
+	}
+	// 数据库已经提交了，这里返回 error 的话消费者会重试，阅读数就加多了
+	// 缓存更新失败只是短时间内不准，过期之后会从数据库重新加载
+	err = c.cache.BatchIncrReadCntIfPresent(ctx, bizs, bizIds, cnts)
+	if err != nil {
+		c.l.Error("批量更新阅读数缓存失败",
+			logger.Int64("cnt", int64(len(bizIds))), logger.Error(err))
+	}
+	return nil
+}
+
 func (c *CachedReadCntRepository) Collect(ctx context.Context, biz string, bizId int64, cid int64, uid int64) error {
 	err := c.dao.InsertCollectInfo(ctx, biz, bizId, cid, uid)
 	if err != nil {
 		return err
 	}
-	return c.cache.IncrCollectCntIfPresent(ctx, biz, bizId)
+	// 数据库已经提交了，缓存更新失败只是短时间内不准，不能让调用方以为没收藏上
+	err = c.cache.IncrCollectCntIfPresent(ctx, biz, bizId)
+	if err != nil {
+		c.logCollectCacheErr(biz, bizId, err)
+	}
+	return nil
+}
+
+func (c *CachedReadCntRepository) Uncollect(ctx context.Context, biz string, bizId int64, uid int64) error {
+	err := c.dao.DeleteCollectInfo(ctx, biz, bizId, uid)
+	if err != nil {
+		return err
+	}
+	// 和 Collect 一样，数据库提交了就算成功
+	err = c.cache.DecrCollectCntIfPresent(ctx, biz, bizId)
+	if err != nil {
+		c.logCollectCacheErr(biz, bizId, err)
+	}
+	return nil
+}
+
+func (c *CachedReadCntRepository) DeleteCollection(ctx context.Context, cid int64, uid int64) error {
+	items, err := c.dao.DeleteCollection(ctx, cid, uid)
+	if err != nil {
+		return err
+	}
+	bizs := make([]string, 0, len(items))
+	bizIds := make([]int64, 0, len(items))
+	for _, item := range items {
+		bizs = append(bizs, item.Biz)
+		bizIds = append(bizIds, item.BizId)
+	}
+	// 和 Collect 一样，数据库提交了就算成功
+	err = c.cache.BatchDecrCollectCntIfPresent(ctx, bizs, bizIds)
+	if err != nil {
+		c.l.Error("删除收藏夹之后更新收藏数缓存失败",
+			logger.Int64("cid", cid), logger.Error(err))
+	}
+	return nil
+}
+
+func (c *CachedReadCntRepository) logCollectCacheErr(biz string, bizId int64, err error) {
+	c.l.Error("更新收藏数缓存失败",
+		logger.String("biz", biz), logger.Int64("biz_id", bizId), logger.Error(err))
 }
 
 func (c *CachedReadCntRepository) IncrLike(ctx context.Context, biz string, bizId int64, uid int64) error {
@@ -118,6 +261,6 @@ func (c *CachedReadCntRepository) DecrLike(ctx context.Context, biz string, bizI
 	return c.cache.DecrLikeCntIfPresent(ctx, biz, bizId)
 }
 
-func NewCachedReadCntRepository(cache cache.InteractiveCache, dao dao.InteractiveDAO) InteractiveRepository {
-	return &CachedReadCntRepository{cache: cache, dao: dao}
+func NewCachedReadCntRepository(cache cache.InteractiveCache, dao dao.InteractiveDAO, l logger.LoggerV1) InteractiveRepository {
+	return &CachedReadCntRepository{cache: cache, dao: dao, l: l}
 }
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/repository/cache"
+	"time"
+)
+
+type LoginFailureRepository interface {
+	Check(ctx context.Context, account string, ip string) (time.Duration, time.Duration, error)
+	RecordFailure(ctx context.Context, account string, ip string) (time.Duration, error)
+	Reset(ctx context.Context, account string) error
+	Unlock(ctx context.Context, account string) error
+}
+
+type CachedLoginFailureRepository struct {
+	cache cache.LoginFailureCache
+}
+
+func NewLoginFailureRepository(cache cache.LoginFailureCache) LoginFailureRepository {
+	return &CachedLoginFailureRepository{
+		cache: cache,
+	}
+}
+
+func (repo *CachedLoginFailureRepository) Check(ctx context.Context, account string,
+	ip string) (time.Duration, time.Duration, error) {
+	return repo.cache.Check(ctx, account, ip)
+}
+
+func (repo *CachedLoginFailureRepository) RecordFailure(ctx context.Context, account string,
+	ip string) (time.Duration, error) {
+	return repo.cache.RecordFailure(ctx, account, ip)
+}
+
+func (repo *CachedLoginFailureRepository) Reset(ctx context.Context, account string) error {
+	return repo.cache.Reset(ctx, account)
+}
+
+func (repo *CachedLoginFailureRepository) Unlock(ctx context.Context, account string) error {
+	return repo.cache.Unlock(ctx, account)
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository/dao"
+	"time"
+)
+
+var (
+	ErrOAuthBindingDuplicate = dao.ErrOAuthBindingDuplicate
+	ErrOAuthBindingNotFound  = dao.ErrRecordNotFound
+)
+
+type OAuthBindingRepository interface {
+	Create(ctx context.Context, b domain.OAuthBinding) error
+	// CreateWithUser 返回新用户的 id
+	CreateWithUser(ctx context.Context, b domain.OAuthBinding) (int64, error)
+	FindByExternalId(ctx context.Context, provider string, externalId string) (domain.OAuthBinding, error)
+	FindByUid(ctx context.Context, uid int64) ([]domain.OAuthBinding, error)
+	Delete(ctx context.Context, uid int64, provider string) error
+}
+
+type oauthBindingRepository struct {
+	dao dao.OAuthBindingDAO
+}
+
+func NewOAuthBindingRepository(dao dao.OAuthBindingDAO) OAuthBindingRepository {
+	return &oauthBindingRepository{dao: dao}
+}
+
+func (repo *oauthBindingRepository) Create(ctx context.Context, b domain.OAuthBinding) error {
+	return repo.dao.Insert(ctx, repo.toEntity(b))
+}
+
+func (repo *oauthBindingRepository) CreateWithUser(ctx context.Context, b domain.OAuthBinding) (int64, error) {
+	return repo.dao.InsertWithUser(ctx, repo.toEntity(b))
+}
+
+func (repo *oauthBindingRepository) FindByExternalId(ctx context.Context, provider string, externalId string) (domain.OAuthBinding, error) {
+	b, err := repo.dao.FindByExternalId(ctx, provider, externalId)
+	return repo.toDomain(b), err
+}
+
+func (repo *oauthBindingRepository) FindByUid(ctx context.Context, uid int64) ([]domain.OAuthBinding, error) {
+	bs, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.OAuthBinding, 0, len(bs))
+	for _, b := range bs {
+		res = append(res, repo.toDomain(b))
+	}
+	return res, nil
+}
+
+func (repo *oauthBindingRepository) Delete(ctx context.Context, uid int64, provider string) error {
+	return repo.dao.Delete(ctx, uid, provider)
+}
+
+func (repo *oauthBindingRepository) toEntity(b domain.OAuthBinding) dao.OAuthBinding {
+	return dao.OAuthBinding{
+		Uid:        b.Uid,
+		Provider:   b.Provider,
+		ExternalId: b.ExternalId,
+		Email:      b.Email,
+	}
+}
+
+func (repo *oauthBindingRepository) toDomain(b dao.OAuthBinding) domain.OAuthBinding {
+	return domain.OAuthBinding{
+		Id:         b.Id,
+		Uid:        b.Uid,
+		Provider:   b.Provider,
+		ExternalId: b.ExternalId,
+		Email:      b.Email,
+		Ctime:      time.UnixMilli(b.Ctime),
+	}
+}
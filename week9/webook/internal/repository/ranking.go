@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository/cache"
+	"geekgo/week9/webook/internal/repository/dao"
+	"time"
+)
+
+var (
+	// ErrRankingNotFound 榜单不在 Redis 里面，需要重建
+	ErrRankingNotFound    = cache.ErrKeyNotExist
+	ErrRankingUnsupported = dao.ErrRankingUnsupported
+)
+
+type RankingRepository interface {
+	// ListArticleCandidates 从数据库里面捞 since 之后发表的文章和它们的计数
+	ListArticleCandidates(ctx context.Context, since time.Time, maxId int64, limit int) ([]domain.HotArticle, error)
+	ReplaceHot(ctx context.Context, biz string, arts []domain.HotArticle) error
+	GetHot(ctx context.Context, biz string, offset int, limit int) ([]domain.HotArticle, error)
+}
+
+type rankingRepository struct {
+	dao   dao.RankingDAO
+	cache cache.RankingCache
+}
+
+func NewRankingRepository(dao dao.RankingDAO, cache cache.RankingCache) RankingRepository {
+	return &rankingRepository{dao: dao, cache: cache}
+}
+
+func (repo *rankingRepository) ListArticleCandidates(ctx context.Context, since time.Time, maxId int64, limit int) ([]domain.HotArticle, error) {
+	cands, err := repo.dao.ListArticleCandidates(ctx, since.UnixMilli(), maxId, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.HotArticle, 0, len(cands))
+	for _, c := range cands {
+		res = append(res, domain.HotArticle{
+			Id:          c.Id,
+			Title:       c.Title,
+			AuthorId:    c.AuthorId,
+			PublishTime: time.UnixMilli(c.Ctime),
+			Intr: domain.Interactive{
+				ReadCnt:    c.ReadCnt,
+				LikeCnt:    c.LikeCnt,
+				CollectCnt: c.CollectCnt,
+			},
+		})
+	}
+	return res, nil
+}
+
+func (repo *rankingRepository) ReplaceHot(ctx context.Context, biz string, arts []domain.HotArticle) error {
+	return repo.cache.Replace(ctx, biz, arts)
+}
+
+func (repo *rankingRepository) GetHot(ctx context.Context, biz string, offset int, limit int) ([]domain.HotArticle, error) {
+	return repo.cache.Get(ctx, biz, offset, limit)
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository/cache"
+	"geekgo/week9/webook/internal/repository/dao"
+)
+
+var (
+	ErrTOTPEnabled     = dao.ErrTOTPEnabled
+	ErrTOTPNotFound    = dao.ErrRecordNotFound
+	ErrPreAuthNotFound = cache.ErrPreAuthNotFound
+	ErrPreAuthTooMany  = cache.ErrPreAuthTooMany
+)
+
+// TOTPRepository 密钥和恢复码在数据库里面，登录过程中的状态在 Redis 里面
+type TOTPRepository interface {
+	FindByUid(ctx context.Context, uid int64) (domain.TOTP, error)
+	SavePending(ctx context.Context, uid int64, secret string) error
+	// Enable recoveryCodes 是哈希之后的
+	Enable(ctx context.Context, uid int64, recoveryCodes []string) error
+	Delete(ctx context.Context, uid int64) error
+	UseRecoveryCode(ctx context.Context, uid int64, code string) (bool, error)
+
+	SetPreAuth(ctx context.Context, token string, pa domain.PreAuth) error
+	AttemptPreAuth(ctx context.Context, token string) (domain.PreAuth, error)
+	DelPreAuth(ctx context.Context, token string) error
+	UseStep(ctx context.Context, uid int64, step int64) (bool, error)
+}
+
+type totpRepository struct {
+	dao   dao.TOTPDAO
+	cache cache.TOTPCache
+}
+
+func NewTOTPRepository(dao dao.TOTPDAO, cache cache.TOTPCache) TOTPRepository {
+	return &totpRepository{
+		dao:   dao,
+		cache: cache,
+	}
+}
+
+func (repo *totpRepository) FindByUid(ctx context.Context, uid int64) (domain.TOTP, error) {
+	t, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return domain.TOTP{}, err
+	}
+	return domain.TOTP{
+		Uid:     t.Uid,
+		Secret:  t.Secret,
+		Enabled: t.Enabled,
+	}, nil
+}
+
+func (repo *totpRepository) SavePending(ctx context.Context, uid int64, secret string) error {
+	return repo.dao.SavePending(ctx, uid, secret)
+}
+
+func (repo *totpRepository) Enable(ctx context.Context, uid int64, recoveryCodes []string) error {
+	return repo.dao.Enable(ctx, uid, recoveryCodes)
+}
+
+func (repo *totpRepository) Delete(ctx context.Context, uid int64) error {
+	return repo.dao.Delete(ctx, uid)
+}
+
+func (repo *totpRepository) UseRecoveryCode(ctx context.Context, uid int64, code string) (bool, error) {
+	return repo.dao.UseRecoveryCode(ctx, uid, code)
+}
+
+func (repo *totpRepository) SetPreAuth(ctx context.Context, token string, pa domain.PreAuth) error {
+	return repo.cache.SetPreAuth(ctx, token, pa)
+}
+
+func (repo *totpRepository) AttemptPreAuth(ctx context.Context, token string) (domain.PreAuth, error) {
+	return repo.cache.AttemptPreAuth(ctx, token)
+}
+
+func (repo *totpRepository) DelPreAuth(ctx context.Context, token string) error {
+	return repo.cache.DelPreAuth(ctx, token)
+}
+
+func (repo *totpRepository) UseStep(ctx context.Context, uid int64, step int64) (bool, error) {
+	return repo.cache.UseStep(ctx, uid, step)
+}
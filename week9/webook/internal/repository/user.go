@@ -16,6 +16,11 @@ var (
 type UserRepository interface {
 	Create(ctx context.Context, user domain.User) error
 	FindByEmail(ctx context.Context, email string) (domain.User, error)
+	FindByPhone(ctx context.Context, phone string) (domain.User, error)
+	FindByWechat(ctx context.Context, openId string) (domain.User, error)
+	FindById(ctx context.Context, id int64) (domain.User, error)
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	MarkEmailVerified(ctx context.Context, id int64) error
 }
 
 type userRepository struct {
@@ -35,6 +40,29 @@ func (repo *userRepository) FindByEmail(ctx context.Context, email string) (doma
 	return repo.entityToDomain(ud), err
 }
 
+func (repo *userRepository) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
+	ud, err := repo.dao.FindByPhone(ctx, phone)
+	return repo.entityToDomain(ud), err
+}
+
+func (repo *userRepository) FindByWechat(ctx context.Context, openId string) (domain.User, error) {
+	ud, err := repo.dao.FindByWechat(ctx, openId)
+	return repo.entityToDomain(ud), err
+}
+
+func (repo *userRepository) FindById(ctx context.Context, id int64) (domain.User, error) {
+	ud, err := repo.dao.FindById(ctx, id)
+	return repo.entityToDomain(ud), err
+}
+
+func (repo *userRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return repo.dao.UpdatePassword(ctx, id, password)
+}
+
+func (repo *userRepository) MarkEmailVerified(ctx context.Context, id int64) error {
+	return repo.dao.MarkEmailVerified(ctx, id)
+}
+
 func (repo *userRepository) Create(ctx context.Context, user domain.User) error {
 	err := repo.dao.Insert(ctx, dao.User{
 		Id: user.Id,
@@ -42,7 +70,20 @@ func (repo *userRepository) Create(ctx context.Context, user domain.User) error
 			String: user.Email,
 			Valid:  user.Email != "",
 		},
-		Password: user.Password,
+		EmailVerified: user.EmailVerified,
+		Password:      user.Password,
+		Phone: sql.NullString{
+			String: user.Phone,
+			Valid:  user.Phone != "",
+		},
+		WechatOpenId: sql.NullString{
+			String: user.WechatInfo.OpenId,
+			Valid:  user.WechatInfo.OpenId != "",
+		},
+		WechatUnionId: sql.NullString{
+			String: user.WechatInfo.UnionId,
+			Valid:  user.WechatInfo.UnionId != "",
+		},
 	})
 	return err
 
@@ -50,8 +91,14 @@ func (repo *userRepository) Create(ctx context.Context, user domain.User) error
 
 func (repo *userRepository) entityToDomain(ud dao.User) domain.User {
 	return domain.User{
-		Id:       ud.Id,
-		Email:    ud.Email.String,
-		Password: ud.Password,
+		Id:            ud.Id,
+		Email:         ud.Email.String,
+		EmailVerified: ud.EmailVerified,
+		Password:      ud.Password,
+		Phone:         ud.Phone.String,
+		WechatInfo: domain.WechatInfo{
+			OpenId:  ud.WechatOpenId.String,
+			UnionId: ud.WechatUnionId.String,
+		},
 	}
 }
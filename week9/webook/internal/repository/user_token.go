@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/repository/cache"
+	"time"
+)
+
+var ErrUserTokenSendTooMany = cache.ErrUserTokenSendTooMany
+
+type UserTokenRepository interface {
+	Store(ctx context.Context, biz string, uid int64, id string, expiration time.Duration) error
+	Consume(ctx context.Context, biz string, uid int64, id string) (bool, error)
+}
+
+type CachedUserTokenRepository struct {
+	cache cache.UserTokenCache
+}
+
+func NewUserTokenRepository(cache cache.UserTokenCache) UserTokenRepository {
+	return &CachedUserTokenRepository{
+		cache: cache,
+	}
+}
+
+func (repo *CachedUserTokenRepository) Store(ctx context.Context, biz string, uid int64,
+	id string, expiration time.Duration) error {
+	return repo.cache.Set(ctx, biz, uid, id, expiration)
+}
+
+func (repo *CachedUserTokenRepository) Consume(ctx context.Context, biz string, uid int64, id string) (bool, error) {
+	return repo.cache.Consume(ctx, biz, uid, id)
+}
@@ -2,9 +2,21 @@ package service
 
 import (
 	"context"
+	"errors"
 	"geekgo/week9/webook/internal/domain"
 	events "geekgo/week9/webook/internal/events/article"
 	"geekgo/week9/webook/internal/repository"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+	"time"
+)
+
+var (
+	ErrPossibleIncorrectAuthor = repository.ErrPossibleIncorrectAuthor
+	ErrArticleNotFound         = repository.ErrArticleNotFound
+	ErrScheduleNotFound        = repository.ErrScheduleNotFound
+	ErrNoDueSchedule           = repository.ErrNoDueSchedule
+	ErrScheduleUnsupported     = repository.ErrScheduleUnsupported
 )
 
 type ArticleService interface {
@@ -13,6 +25,22 @@ type ArticleService interface {
 	Withdraw(ctx context.Context, aid int64, uid int64) error
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPublishedById(ctx context.Context, id, uid int64) (domain.Article, error)
+	ListRevisions(ctx context.Context, aid int64, uid int64) ([]domain.ArticleRevision, error)
+	DiffRevisions(ctx context.Context, aid int64, uid int64, from int64, to int64) ([]domain.DiffLine, error)
+	// Rollback 把制作库（publish 为 true 时连同线上库）回滚到某个版本，publish 为 false 的时候状态不变
+	// 回滚本身也会记录成一个新的版本
+	Rollback(ctx context.Context, aid int64, uid int64, version int64, publish bool) (int64, error)
+	// Schedule 保存草稿并且设置定时发表，重复调用就是修改发表时间
+	// 已经发表的文章也可以定时发表修改之后的内容，取消之后恢复成原来的状态
+	Schedule(ctx context.Context, art domain.Article, publishTime time.Time) (int64, error)
+	CancelSchedule(ctx context.Context, aid int64, uid int64) error
+	// PublishScheduled 抢占一个到时间的定时发表任务并发表，返回发表的文章 id
+	// 没有到时间的任务返回 ErrNoDueSchedule，文章已经不是定时发表状态的任务直接结束，不会发表
+	PublishScheduled(ctx context.Context) (int64, error)
+	// ListByAuthor 创作者自己的文章列表
+	ListByAuthor(ctx context.Context, uid int64, cursor domain.Cursor, limit int) ([]domain.Article, error)
+	// ListPublished 读者看某个作者发表的文章列表
+	ListPublished(ctx context.Context, authorId int64, cursor domain.Cursor, limit int) ([]domain.Article, error)
 }
 
 type articleService struct {
@@ -20,9 +48,110 @@ type articleService struct {
 	producer events.Producer
 }
 
+func (svc *articleService) ListByAuthor(ctx context.Context, uid int64, cursor domain.Cursor, limit int) ([]domain.Article, error) {
+	return svc.repo.ListByAuthor(ctx, uid, cursor, limit)
+}
+
+func (svc *articleService) ListPublished(ctx context.Context, authorId int64, cursor domain.Cursor, limit int) ([]domain.Article, error) {
+	return svc.repo.ListPublished(ctx, authorId, cursor, limit)
+}
+
+func (svc *articleService) Schedule(ctx context.Context, art domain.Article, publishTime time.Time) (int64, error) {
+	art.Status = domain.ArticleStatusScheduled
+	return svc.repo.Schedule(ctx, art, publishTime)
+}
+
+func (svc *articleService) CancelSchedule(ctx context.Context, aid int64, uid int64) error {
+	return svc.repo.CancelSchedule(ctx, aid, uid)
+}
+
+func (svc *articleService) PublishScheduled(ctx context.Context) (int64, error) {
+	s, err := svc.repo.PreemptSchedule(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// 发表的是制作库里面最新的草稿
+	art, err := svc.repo.GetById(ctx, s.ArticleId)
+	if err == repository.ErrArticleNotFound {
+		// 文章已经删掉了，任务直接结束，不然每一轮都会抢到它
+		return s.ArticleId, errors.Join(err, svc.repo.FinishSchedule(ctx, s))
+	}
+	if err == nil && art.Status != domain.ArticleStatusScheduled {
+		// 抢占之前作者已经保存成草稿或者直接发表了，不能把后面改的内容发出去
+		return s.ArticleId, svc.repo.FinishSchedule(ctx, s)
+	}
+	if err == nil {
+		art.Status = domain.ArticleStatusPublished
+		_, err = svc.repo.Sync(ctx, art)
+	}
+	if err != nil {
+		// 发表失败，释放掉，下一轮再重试
+		if er := svc.repo.ReleaseSchedule(ctx, s); er != nil {
+			return s.ArticleId, errors.Join(err, er)
+		}
+		return s.ArticleId, err
+	}
+	return s.ArticleId, svc.repo.FinishSchedule(ctx, s)
+}
+
+func (svc *articleService) ListRevisions(ctx context.Context, aid int64, uid int64) ([]domain.ArticleRevision, error) {
+	return svc.repo.ListRevisions(ctx, aid, uid)
+}
+
+func (svc *articleService) DiffRevisions(ctx context.Context, aid int64, uid int64, from int64, to int64) ([]domain.DiffLine, error) {
+	var (
+		eg             errgroup.Group
+		fromRev, toRev domain.ArticleRevision
+	)
+	eg.Go(func() error {
+		var err error
+		fromRev, err = svc.repo.GetRevision(ctx, aid, uid, from)
+		return err
+	})
+	eg.Go(func() error {
+		var err error
+		toRev, err = svc.repo.GetRevision(ctx, aid, uid, to)
+		return err
+	})
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return diffLines(fromRev.Content, toRev.Content), nil
+}
+
+func (svc *articleService) Rollback(ctx context.Context, aid int64, uid int64, version int64, publish bool) (int64, error) {
+	rev, err := svc.repo.GetRevision(ctx, aid, uid, version)
+	if err != nil {
+		return 0, err
+	}
+	art := domain.Article{
+		Id:      aid,
+		Title:   rev.Title,
+		Content: rev.Content,
+		Author: domain.Author{
+			Id: uid,
+		},
+	}
+	if publish {
+		art.Status = domain.ArticleStatusPublished
+		return svc.Publish(ctx, art)
+	}
+	// 只回滚制作库的内容，状态保持不变，已经发表的文章不会因此变成未发表
+	cur, err := svc.repo.GetById(ctx, aid)
+	if err != nil {
+		return 0, err
+	}
+	art.Status = cur.Status
+	return svc.Save(ctx, art)
+}
+
 func (svc *articleService) GetPublishedById(ctx context.Context, id, uid int64) (domain.Article, error) {
 	art, err := svc.repo.GetPublishedById(ctx, id)
 	if err == nil {
+		// 请求结束之后 ctx 就被取消了，gin 的 Context 还会被复用，
+		// 这里只留下 trace，阅读事件和这个请求在同一条链路上
+		ctx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
 		go func() {
 			er := svc.producer.ProduceReadEvent(ctx,
 				events.ReadEvent{
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"geekgo/week9/webook/internal/domain"
+	"strings"
+)
+
+// maxDiffCells 去掉首尾相同的行之后，两边行数的乘积超过这个值就不再算最长公共子序列，
+// 直接把中间整段当成删除再插入。任何作者都能调 diff 接口，不能让两篇超长的文章把 CPU 占满
+const maxDiffCells = 1 << 24
+
+// diffLines 基于最长公共子序列计算两段文本的行级别 diff
+// 用 Hirschberg 算法，时间还是 O(n*m)，但是空间只要 O(m)，不会因为文章长就分配一个巨大的矩阵
+func diffLines(from, to string) []domain.DiffLine {
+	a := splitLines(from)
+	b := splitLines(to)
+	res := make([]domain.DiffLine, 0, len(a)+len(b))
+	// 一般只改了中间的几行，首尾相同的部分先去掉
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		res = append(res, domain.DiffLine{Op: domain.DiffOpEqual, Text: a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	tail := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if len(a)*len(b) > maxDiffCells {
+		res = appendLines(res, domain.DiffOpDelete, a)
+		res = appendLines(res, domain.DiffOpInsert, b)
+	} else {
+		res = hirschberg(res, a, b)
+	}
+	return appendLines(res, domain.DiffOpEqual, tail)
+}
+
+// hirschberg 把 a 从中间切开，找到 b 里面让两半的最长公共子序列加起来最长的切分点，再分别递归
+func hirschberg(res []domain.DiffLine, a, b []string) []domain.DiffLine {
+	switch {
+	case len(a) == 0:
+		return appendLines(res, domain.DiffOpInsert, b)
+	case len(b) == 0:
+		return appendLines(res, domain.DiffOpDelete, a)
+	case len(a) == 1:
+		for j := range b {
+			if b[j] == a[0] {
+				res = appendLines(res, domain.DiffOpInsert, b[:j])
+				res = append(res, domain.DiffLine{Op: domain.DiffOpEqual, Text: a[0]})
+				return appendLines(res, domain.DiffOpInsert, b[j+1:])
+			}
+		}
+		res = append(res, domain.DiffLine{Op: domain.DiffOpDelete, Text: a[0]})
+		return appendLines(res, domain.DiffOpInsert, b)
+	}
+	mid := len(a) / 2
+	fwd := lcsPrefixLens(a[:mid], b)
+	bwd := lcsSuffixLens(a[mid:], b)
+	k, best := 0, -1
+	for j := 0; j <= len(b); j++ {
+		if fwd[j]+bwd[j] > best {
+			k, best = j, fwd[j]+bwd[j]
+		}
+	}
+	res = hirschberg(res, a[:mid], b[:k])
+	return hirschberg(res, a[mid:], b[k:])
+}
+
+// lcsPrefixLens 返回 res[j] = a 和 b[:j] 的最长公共子序列长度，只保留一行
+func lcsPrefixLens(a, b []string) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = maxInt(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// lcsSuffixLens 返回 res[j] = a 和 b[j:] 的最长公共子序列长度
+func lcsSuffixLens(a, b []string) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				cur[j] = prev[j+1] + 1
+			} else {
+				cur[j] = maxInt(prev[j], cur[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+func appendLines(res []domain.DiffLine, op domain.DiffOp, lines []string) []domain.DiffLine {
+	for _, line := range lines {
+		res = append(res, domain.DiffLine{Op: op, Text: line})
+	}
+	return res
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"geekgo/week9/webook/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	testCases := []struct {
+		name string
+		from string
+		to   string
+		want []domain.DiffLine
+	}{
+		{
+			name: "完全一样",
+			from: "a\nb",
+			to:   "a\nb",
+			want: []domain.DiffLine{
+				{Op: domain.DiffOpEqual, Text: "a"},
+				{Op: domain.DiffOpEqual, Text: "b"},
+			},
+		},
+		{
+			name: "从空白开始",
+			from: "",
+			to:   "a\nb",
+			want: []domain.DiffLine{
+				{Op: domain.DiffOpInsert, Text: "a"},
+				{Op: domain.DiffOpInsert, Text: "b"},
+			},
+		},
+		{
+			name: "修改中间一行",
+			from: "a\nb\nc",
+			to:   "a\nx\nc",
+			want: []domain.DiffLine{
+				{Op: domain.DiffOpEqual, Text: "a"},
+				{Op: domain.DiffOpDelete, Text: "b"},
+				{Op: domain.DiffOpInsert, Text: "x"},
+				{Op: domain.DiffOpEqual, Text: "c"},
+			},
+		},
+		{
+			name: "删除末尾，兼容 windows 换行",
+			from: "a\r\nb\r\nc",
+			to:   "a\nb",
+			want: []domain.DiffLine{
+				{Op: domain.DiffOpEqual, Text: "a"},
+				{Op: domain.DiffOpEqual, Text: "b"},
+				{Op: domain.DiffOpDelete, Text: "c"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, diffLines(tc.from, tc.to))
+		})
+	}
+}
+
+// 随机生成的文本，diff 要能还原出两边的内容，并且相同的行数等于最长公共子序列的长度
+func TestDiffLinesRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func() string {
+		lines := make([]string, r.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return strings.Join(lines, "\n")
+	}
+	for i := 0; i < 500; i++ {
+		from, to := gen(), gen()
+		res := diffLines(from, to)
+		var a, b []string
+		equal := 0
+		for _, line := range res {
+			switch line.Op {
+			case domain.DiffOpEqual:
+				a = append(a, line.Text)
+				b = append(b, line.Text)
+				equal++
+			case domain.DiffOpDelete:
+				a = append(a, line.Text)
+			case domain.DiffOpInsert:
+				b = append(b, line.Text)
+			}
+		}
+		assert.Equal(t, from, strings.Join(a, "\n"))
+		assert.Equal(t, to, strings.Join(b, "\n"))
+		assert.Equal(t, lcsLen(splitLines(from), splitLines(to)), equal)
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	n := 5000
+	from := make([]string, 0, n+2)
+	to := make([]string, 0, n+2)
+	from = append(from, "head")
+	to = append(to, "head")
+	for i := 0; i < n; i++ {
+		from = append(from, "a")
+		to = append(to, "b")
+	}
+	from = append(from, "tail")
+	to = append(to, "tail")
+	res := diffLines(strings.Join(from, "\n"), strings.Join(to, "\n"))
+	// 超过上限之后中间整段删除再插入，首尾相同的行还在
+	assert.Equal(t, 2*n+2, len(res))
+	assert.Equal(t, domain.DiffLine{Op: domain.DiffOpEqual, Text: "head"}, res[0])
+	assert.Equal(t, domain.DiffLine{Op: domain.DiffOpDelete, Text: "a"}, res[1])
+	assert.Equal(t, domain.DiffLine{Op: domain.DiffOpInsert, Text: "b"}, res[n+1])
+	assert.Equal(t, domain.DiffLine{Op: domain.DiffOpEqual, Text: "tail"}, res[2*n+1])
+}
+
+// lcsLen 用完整的矩阵算最长公共子序列的长度，只在测试里面对比结果
+func lcsLen(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				dp[i+1][j+1] = dp[i][j] + 1
+			} else {
+				dp[i+1][j+1] = maxInt(dp[i][j+1], dp[i+1][j])
+			}
+		}
+	}
+	return dp[len(a)][len(b)]
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// fakeArticleRepository 只记录 Rollback 和 PublishScheduled 用到的几个方法
+type fakeArticleRepository struct {
+	repository.ArticleRepository
+	cur      domain.Article
+	updated  domain.Article
+	synced   domain.Article
+	finished bool
+}
+
+func (r *fakeArticleRepository) PreemptSchedule(ctx context.Context) (domain.ArticleSchedule, error) {
+	return domain.ArticleSchedule{Id: 1, ArticleId: r.cur.Id, Version: 1}, nil
+}
+
+func (r *fakeArticleRepository) FinishSchedule(ctx context.Context, s domain.ArticleSchedule) error {
+	r.finished = true
+	return nil
+}
+
+func (r *fakeArticleRepository) GetRevision(ctx context.Context, aid int64, uid int64, version int64) (domain.ArticleRevision, error) {
+	return domain.ArticleRevision{Title: "旧标题", Content: "旧内容"}, nil
+}
+
+func (r *fakeArticleRepository) GetById(ctx context.Context, id int64) (domain.Article, error) {
+	return r.cur, nil
+}
+
+func (r *fakeArticleRepository) Update(ctx context.Context, art domain.Article) error {
+	r.updated = art
+	return nil
+}
+
+func (r *fakeArticleRepository) Sync(ctx context.Context, art domain.Article) (int64, error) {
+	r.synced = art
+	return art.Id, nil
+}
+
+func TestArticleService_Rollback(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cur     domain.ArticleStatus
+		publish bool
+
+		wantUpdated domain.ArticleStatus
+		wantSynced  domain.ArticleStatus
+	}{
+		{
+			name:        "只回滚制作库，已发表的还是已发表",
+			cur:         domain.ArticleStatusPublished,
+			wantUpdated: domain.ArticleStatusPublished,
+		},
+		{
+			name:        "只回滚制作库，仅自己可见的还是仅自己可见",
+			cur:         domain.ArticleStatusPrivate,
+			wantUpdated: domain.ArticleStatusPrivate,
+		},
+		{
+			name:       "回滚并发表",
+			cur:        domain.ArticleStatusUnpublished,
+			publish:    true,
+			wantSynced: domain.ArticleStatusPublished,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeArticleRepository{
+				cur: domain.Article{Id: 1, Author: domain.Author{Id: 2}, Status: tc.cur},
+			}
+			svc := NewArticleService(repo, nil)
+			id, err := svc.Rollback(context.Background(), 1, 2, 3, tc.publish)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), id)
+			assert.Equal(t, tc.wantUpdated, repo.updated.Status)
+			assert.Equal(t, tc.wantSynced, repo.synced.Status)
+		})
+	}
+}
+
+func TestArticleService_PublishScheduled(t *testing.T) {
+	testCases := []struct {
+		name string
+		cur  domain.ArticleStatus
+
+		wantSynced domain.ArticleStatus
+	}{
+		{
+			name:       "还是定时发表，发表",
+			cur:        domain.ArticleStatusScheduled,
+			wantSynced: domain.ArticleStatusPublished,
+		},
+		{
+			name: "已经保存成草稿了，不发表",
+			cur:  domain.ArticleStatusUnpublished,
+		},
+		{
+			name: "已经直接发表了，不用修改之后的草稿覆盖",
+			cur:  domain.ArticleStatusPublished,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeArticleRepository{
+				cur: domain.Article{Id: 1, Author: domain.Author{Id: 2}, Status: tc.cur},
+			}
+			svc := NewArticleService(repo, nil)
+			aid, err := svc.PublishScheduled(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), aid)
+			assert.Equal(t, tc.wantSynced, repo.synced.Status)
+			assert.True(t, repo.finished)
+		})
+	}
+}
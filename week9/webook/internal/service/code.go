@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"geekgo/week9/webook/internal/repository"
+	"geekgo/week9/webook/internal/service/sms"
+	"math/big"
+)
+
+var (
+	ErrCodeSendTooMany   = repository.ErrCodeSendTooMany
+	ErrCodeVerifyTooMany = repository.ErrCodeVerifyTooMany
+)
+
+const codeTplId = "1877556"
+
+type CodeService interface {
+	Send(ctx context.Context, biz string, phone string) error
+	Verify(ctx context.Context, biz string, phone string, inputCode string) (bool, error)
+}
+
+type codeService struct {
+	repo   repository.CodeRepository
+	smsSvc sms.Service
+}
+
+func NewCodeService(repo repository.CodeRepository, smsSvc sms.Service) CodeService {
+	return &codeService{
+		repo:   repo,
+		smsSvc: smsSvc,
+	}
+}
+
+func (svc *codeService) Send(ctx context.Context, biz string, phone string) error {
+	code, err := svc.generateCode()
+	if err != nil {
+		return err
+	}
+	// 先存起来，存成功了才发，发送频率的限制在存的时候就检查了
+	err = svc.repo.Store(ctx, biz, phone, code)
+	if err != nil {
+		return err
+	}
+	err = svc.smsSvc.Send(ctx, codeTplId, []string{code}, phone)
+	if err != nil {
+		err = fmt.Errorf("发送短信出现异常 %w", err)
+	}
+	return err
+}
+
+func (svc *codeService) Verify(ctx context.Context, biz string, phone string, inputCode string) (bool, error) {
+	return svc.repo.Verify(ctx, biz, phone, inputCode)
+}
+
+// generateCode 验证码用 crypto/rand，不能被猜出来
+func (svc *codeService) generateCode() (string, error) {
+	num, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", num.Int64()), nil
+}
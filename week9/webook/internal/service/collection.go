@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+)
+
+var (
+	ErrCollectionNotFound  = repository.ErrCollectionNotFound
+	ErrCollectItemNotFound = repository.ErrCollectItemNotFound
+)
+
+type CollectionService interface {
+	Create(ctx context.Context, c domain.Collection) (int64, error)
+	Rename(ctx context.Context, id int64, uid int64, name string) error
+	List(ctx context.Context, uid int64) ([]domain.Collection, error)
+	// Delete 删除收藏夹，里面的收藏也一起删掉
+	Delete(ctx context.Context, id int64, uid int64) error
+	ListItems(ctx context.Context, cid int64, uid int64, maxId int64, limit int) ([]domain.CollectionItem, error)
+	MoveItem(ctx context.Context, biz string, bizId int64, uid int64, toCid int64) error
+}
+
+type collectionService struct {
+	repo repository.CollectionRepository
+	// 删除收藏夹会影响收藏计数
+	intrRepo repository.InteractiveRepository
+}
+
+func NewCollectionService(repo repository.CollectionRepository, intrRepo repository.InteractiveRepository) CollectionService {
+	return &collectionService{repo: repo, intrRepo: intrRepo}
+}
+
+func (c *collectionService) Create(ctx context.Context, col domain.Collection) (int64, error) {
+	return c.repo.Create(ctx, col)
+}
+
+func (c *collectionService) Rename(ctx context.Context, id int64, uid int64, name string) error {
+	return c.repo.Rename(ctx, id, uid, name)
+}
+
+func (c *collectionService) List(ctx context.Context, uid int64) ([]domain.Collection, error) {
+	return c.repo.List(ctx, uid)
+}
+
+func (c *collectionService) Delete(ctx context.Context, id int64, uid int64) error {
+	return c.intrRepo.DeleteCollection(ctx, id, uid)
+}
+
+func (c *collectionService) ListItems(ctx context.Context, cid int64, uid int64, maxId int64, limit int) ([]domain.CollectionItem, error) {
+	return c.repo.ListItems(ctx, cid, uid, maxId, limit)
+}
+
+func (c *collectionService) MoveItem(ctx context.Context, biz string, bizId int64, uid int64, toCid int64) error {
+	return c.repo.MoveItem(ctx, biz, bizId, uid, toCid)
+}
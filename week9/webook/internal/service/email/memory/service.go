@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"geekgo/week9/webook/internal/service/email"
+	"sync"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender 开发环境和测试用，不真的发邮件，打印出来，也可以用 Mails 拿到发过的邮件
+type Sender struct {
+	mu    sync.Mutex
+	mails []Mail
+}
+
+func NewSender() *Sender {
+	return &Sender{}
+}
+
+var _ email.Sender = &Sender{}
+
+func (s *Sender) Send(ctx context.Context, to string, subject string, body string) error {
+	fmt.Println(to, subject, body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mails = append(s.mails, Mail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// Mails 按照发送顺序返回
+func (s *Sender) Mails() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]Mail, len(s.mails))
+	copy(res, s.mails)
+	return res
+}
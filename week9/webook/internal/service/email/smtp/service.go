@@ -0,0 +1,133 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"geekgo/week9/webook/internal/service/email"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// smtp.example.com:465 是隐式 TLS，587 和 25 用 STARTTLS
+	Addr     string
+	Username string
+	Password string
+	// 发件人，可以带名字，比如 webook <noreply@example.com>
+	From string
+}
+
+type Sender struct {
+	cfg  Config
+	host string
+	from *mail.Address
+}
+
+func NewSender(cfg Config) (email.Sender, error) {
+	host, port, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("发件人格式不对 %w", err)
+	}
+	if port == "25" && cfg.Username != "" {
+		// net/smtp 在没有 TLS 的时候会拒绝 PLAIN 认证，这里提前报出来
+		return nil, fmt.Errorf("25 端口不支持认证，请用 465 或者 587")
+	}
+	return &Sender{cfg: cfg, host: host, from: from}, nil
+}
+
+func (s *Sender) Send(ctx context.Context, to string, subject string, body string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("收件人格式不对 %w", err)
+	}
+	msg := s.message(rcpt, subject, body)
+	c, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if s.cfg.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.host))
+		if err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err = c.Rcpt(rcpt.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *Sender) dial(ctx context.Context) (*smtp.Client, error) {
+	dialer := &net.Dialer{Timeout: time.Second * 5}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if strings.HasSuffix(s.cfg.Addr, ":465") {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.host}}).
+			DialContext(ctx, "tcp", s.cfg.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 整个发送过程的超时
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Second * 30)
+	}
+	_ = conn.SetDeadline(deadline)
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: s.host})
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// message 标题用 RFC 2047 编码，不然中文会乱码
+func (s *Sender) message(to *mail.Address, subject string, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
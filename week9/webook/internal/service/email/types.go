@@ -0,0 +1,9 @@
+package email
+
+import "context"
+
+// Sender 发邮件，不同的实现在子包里面
+type Sender interface {
+	// Send body 是 HTML
+	Send(ctx context.Context, to string, subject string, body string) error
+}
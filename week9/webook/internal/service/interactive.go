@@ -11,7 +11,10 @@ type InteractiveService interface {
 	Like(ctx context.Context, biz string, bizId int64, uid int64) error
 	CancelLike(ctx context.Context, biz string, bizId int64, uid int64) error
 	Collect(ctx context.Context, biz string, bizId int64, cid int64, uid int64) error
+	Uncollect(ctx context.Context, biz string, bizId int64, uid int64) error
 	Get(ctx context.Context, biz string, bizId int64, uid int64) (domain.Interactive, error)
+	// GetByIds 列表页用，一次把计数和用户有没有点赞、收藏都查出来
+	GetByIds(ctx context.Context, biz string, bizIds []int64, uid int64) (map[int64]domain.Interactive, error)
 }
 
 type interactiveService struct {
@@ -50,10 +53,52 @@ func (i *interactiveService) Get(ctx context.Context, biz string, bizId int64, u
 
 }
 
+func (i *interactiveService) GetByIds(ctx context.Context, biz string, bizIds []int64, uid int64) (map[int64]domain.Interactive, error) {
+	if len(bizIds) == 0 {
+		return map[int64]domain.Interactive{}, nil
+	}
+	var (
+		eg        errgroup.Group
+		intrs     map[int64]domain.Interactive
+		liked     map[int64]bool
+		collected map[int64]bool
+	)
+	eg.Go(func() error {
+		var err error
+		intrs, err = i.repo.GetByIds(ctx, biz, bizIds)
+		return err
+	})
+	eg.Go(func() error {
+		var err error
+		liked, err = i.repo.LikedByIds(ctx, biz, bizIds, uid)
+		return err
+	})
+	eg.Go(func() error {
+		var err error
+		collected, err = i.repo.CollectedByIds(ctx, biz, bizIds, uid)
+		return err
+	})
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for _, bizId := range bizIds {
+		intr := intrs[bizId]
+		intr.Liked = liked[bizId]
+		intr.Collected = collected[bizId]
+		intrs[bizId] = intr
+	}
+	return intrs, nil
+}
+
 func (i *interactiveService) Collect(ctx context.Context, biz string, bizId int64, cid int64, uid int64) error {
 	return i.repo.Collect(ctx, biz, bizId, cid, uid)
 }
 
+func (i *interactiveService) Uncollect(ctx context.Context, biz string, bizId int64, uid int64) error {
+	return i.repo.Uncollect(ctx, biz, bizId, uid)
+}
+
 func (i *interactiveService) Like(ctx context.Context, biz string, bizId int64, uid int64) error {
 	return i.repo.IncrLike(ctx, biz, bizId, uid)
 }
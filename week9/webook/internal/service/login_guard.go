@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"geekgo/week9/webook/internal/repository"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrAccountLocked 这个账号密码错太多次了
+	ErrAccountLocked = errors.New("账号已锁定")
+	// ErrIPLocked 这个 IP 登录失败太多次了，不管是哪个账号
+	ErrIPLocked = errors.New("登录失败次数太多")
+)
+
+// LoginGuardService 防止暴力破解密码。
+// 账号在窗口内失败太多次就锁一段时间，每次锁的时间翻倍；IP 失败太多次就要等窗口滑过去
+type LoginGuardService interface {
+	// Check 登录之前调用，返回 ErrAccountLocked 或者 ErrIPLocked 的时候，第一个返回值是还要等多久
+	Check(ctx context.Context, email string, ip string) (time.Duration, error)
+	// OnFailure 密码错了调用，这一次失败导致账号被锁住的时候返回 ErrAccountLocked
+	OnFailure(ctx context.Context, email string, ip string) (time.Duration, error)
+	// OnSuccess 登录成功之后清掉失败次数
+	OnSuccess(ctx context.Context, email string) error
+	// Unlock 管理员解锁
+	Unlock(ctx context.Context, email string) error
+}
+
+type loginGuardService struct {
+	repo repository.LoginFailureRepository
+}
+
+func NewLoginGuardService(repo repository.LoginFailureRepository) LoginGuardService {
+	return &loginGuardService{repo: repo}
+}
+
+func (svc *loginGuardService) Check(ctx context.Context, email string, ip string) (time.Duration, error) {
+	lock, ipWait, err := svc.repo.Check(ctx, svc.account(email), ip)
+	if err != nil {
+		return 0, err
+	}
+	// 两个都有的时候，告诉他要等更久的那个
+	switch {
+	case lock > 0 && lock >= ipWait:
+		return lock, ErrAccountLocked
+	case ipWait > 0:
+		return ipWait, ErrIPLocked
+	default:
+		return 0, nil
+	}
+}
+
+func (svc *loginGuardService) OnFailure(ctx context.Context, email string, ip string) (time.Duration, error) {
+	lock, err := svc.repo.RecordFailure(ctx, svc.account(email), ip)
+	if err != nil {
+		return 0, err
+	}
+	if lock > 0 {
+		return lock, ErrAccountLocked
+	}
+	return 0, nil
+}
+
+func (svc *loginGuardService) OnSuccess(ctx context.Context, email string) error {
+	return svc.repo.Reset(ctx, svc.account(email))
+}
+
+func (svc *loginGuardService) Unlock(ctx context.Context, email string) error {
+	return svc.repo.Unlock(ctx, svc.account(email))
+}
+
+// account 换个大小写不能绕过去
+func (svc *loginGuardService) account(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"geekgo/week9/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLoginGuardService_Check(t *testing.T) {
+	testCases := []struct {
+		name   string
+		lock   time.Duration
+		ipWait time.Duration
+		err    error
+
+		wantWait time.Duration
+		wantErr  error
+	}{
+		{
+			name: "可以登录",
+		},
+		{
+			name:     "账号锁了",
+			lock:     time.Minute,
+			wantWait: time.Minute,
+			wantErr:  ErrAccountLocked,
+		},
+		{
+			name:     "IP 被限制了",
+			ipWait:   time.Minute,
+			wantWait: time.Minute,
+			wantErr:  ErrIPLocked,
+		},
+		{
+			name:     "都有的时候看哪个更久",
+			lock:     time.Minute,
+			ipWait:   time.Minute * 2,
+			wantWait: time.Minute * 2,
+			wantErr:  ErrIPLocked,
+		},
+		{
+			name:    "redis 出错",
+			err:     errors.New("mock redis error"),
+			wantErr: errors.New("mock redis error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeLoginFailureRepository{lock: tc.lock, ipWait: tc.ipWait, err: tc.err}
+			svc := NewLoginGuardService(repo)
+			wait, err := svc.Check(context.Background(), " A@B.com", "1.1.1.1")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantWait, wait)
+			// 大小写和空格不能绕过去
+			assert.Equal(t, "a@b.com", repo.account)
+		})
+	}
+}
+
+type fakeLoginFailureRepository struct {
+	repository.LoginFailureRepository
+	lock    time.Duration
+	ipWait  time.Duration
+	err     error
+	account string
+}
+
+func (f *fakeLoginFailureRepository) Check(ctx context.Context, account string,
+	ip string) (time.Duration, time.Duration, error) {
+	f.account = account
+	return f.lock, f.ipWait, f.err
+}
@@ -0,0 +1,83 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// tokenResponse RFC 6749 里面 token 接口的响应，OIDC 多了一个 id_token
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode 授权码换 token，client_secret 放在表单里面
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (Token, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub 默认返回的是表单格式
+	req.Header.Set("Accept", "application/json")
+	var res tokenResponse
+	err = doJSON(client, req, &res)
+	if err != nil {
+		return Token{}, "", err
+	}
+	// GitHub 出错的时候 HTTP 状态码也是 200
+	if res.Error != "" {
+		return Token{}, "", fmt.Errorf("换取 token 失败 %s %s", res.Error, res.ErrorDescription)
+	}
+	if res.AccessToken == "" {
+		return Token{}, "", fmt.Errorf("没有返回 access_token")
+	}
+	token := Token{
+		AccessToken:  res.AccessToken,
+		TokenType:    res.TokenType,
+		RefreshToken: res.RefreshToken,
+	}
+	if res.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return token, res.IDToken, nil
+}
+
+// getJSON accessToken 不为空的时候带上 Bearer
+func getJSON(ctx context.Context, client *http.Client, u string, accessToken string, val any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return doJSON(client, req, val)
+}
+
+func doJSON(client *http.Client, req *http.Request, val any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// 错误信息一般不长，读一点出来方便排查
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("请求 %s 返回了 HTTP %d %s", req.URL.Path, resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(val)
+}
@@ -0,0 +1,84 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"geekgo/week9/webook/internal/domain"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	githubAuthURL  = "https://github.com/login/oauth/authorize"
+	githubTokenURL = "https://github.com/login/oauth/access_token"
+	githubUserURL  = "https://api.github.com/user"
+)
+
+// GitHubProvider GitHub 不支持 OIDC，用户信息要自己调接口拿
+type GitHubProvider struct {
+	clientId     string
+	clientSecret string
+	redirectURL  string
+	client       *http.Client
+}
+
+func NewGitHubProvider(clientId string, clientSecret string, redirectURL string, client *http.Client) Provider {
+	return &GitHubProvider{
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		client:       client,
+	}
+}
+
+func (g *GitHubProvider) Name() string {
+	return "github"
+}
+
+func (g *GitHubProvider) AuthURL(ctx context.Context, state string) (string, error) {
+	query := url.Values{}
+	query.Set("client_id", g.clientId)
+	query.Set("redirect_uri", g.redirectURL)
+	query.Set("scope", "read:user user:email")
+	query.Set("state", state)
+	return githubAuthURL + "?" + query.Encode(), nil
+}
+
+func (g *GitHubProvider) Exchange(ctx context.Context, code string, state string) (Token, error) {
+	form := url.Values{}
+	form.Set("client_id", g.clientId)
+	form.Set("client_secret", g.clientSecret)
+	form.Set("code", code)
+	form.Set("redirect_uri", g.redirectURL)
+	token, _, err := exchangeCode(ctx, g.client, githubTokenURL, form)
+	return token, err
+}
+
+func (g *GitHubProvider) UserInfo(ctx context.Context, token Token) (domain.OAuthUserInfo, error) {
+	var u struct {
+		Id    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+		// 用户设置了公开邮箱才有
+		Email string `json:"email"`
+	}
+	err := getJSON(ctx, g.client, githubUserURL, token.AccessToken, &u)
+	if err != nil {
+		return domain.OAuthUserInfo{}, err
+	}
+	if u.Id == 0 {
+		return domain.OAuthUserInfo{}, fmt.Errorf("GitHub 没有返回用户 id")
+	}
+	name := u.Name
+	if name == "" {
+		name = u.Login
+	}
+	return domain.OAuthUserInfo{
+		Provider: g.Name(),
+		// login 可以改，id 不会变
+		ExternalId: strconv.FormatInt(u.Id, 10),
+		Email:      u.Email,
+		Name:       name,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGitHubProvider(t *testing.T) {
+	testCases := []struct {
+		name string
+		code string
+
+		wantErr  bool
+		wantInfo domain.OAuthUserInfo
+	}{
+		{
+			name: "成功",
+			code: "the-code",
+			wantInfo: domain.OAuthUserInfo{
+				Provider:   "github",
+				ExternalId: "123",
+				Email:      "a@b.com",
+				Name:       "Tom",
+			},
+		},
+		{
+			// GitHub 出错的时候 HTTP 状态码也是 200
+			name:    "code 不对",
+			code:    "bad-code",
+			wantErr: true,
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "the-code" {
+			_ = json.NewEncoder(w).Encode(tokenResponse{Error: "bad_verification_code"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access-token", TokenType: "bearer"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":123,"login":"tom","name":"Tom","email":"a@b.com"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewGitHubProvider("client-id", "secret", "", newFakeClient(server))
+			token, err := p.Exchange(context.Background(), tc.code, "state")
+			assert.Equal(t, tc.wantErr, err != nil)
+			if err != nil {
+				return
+			}
+			info, err := p.UserInfo(context.Background(), token)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantInfo, info)
+		})
+	}
+}
+
+// newFakeClient 所有请求都转发到 server 上面，server 用来模拟 GitHub 的接口
+func newFakeClient(server *httptest.Server) *http.Client {
+	target, _ := url.Parse(server.URL)
+	return &http.Client{
+		Transport: rewriteTransport{
+			target: target,
+			next:   server.Client().Transport,
+		},
+	}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,253 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidIDToken = errors.New("ID Token 校验失败")
+
+const (
+	// 找不到 kid 的时候会重新拉 JWKS，限制一下频率，免得被人用假 token 打爆对方
+	jwksRefreshInterval = time.Minute
+	// 允许的时钟偏差
+	idTokenLeeway = time.Minute
+)
+
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	// 默认是 openid email profile
+	Scopes []string
+}
+
+// IDTokenClaims 只解析需要用到的字段
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// discoveryDoc /.well-known/openid-configuration 里面用到的字段
+type discoveryDoc struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider 通过 discovery 文档拿到各个接口的地址，ID Token 用 jwks_uri 里面的公钥验签
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu sync.Mutex
+	// 第一次用到的时候才去拉，启动的时候对方挂了不影响别的登录方式
+	doc           *discoveryDoc
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+	now           func() time.Time
+}
+
+func NewOIDCProvider(cfg OIDCConfig, client *http.Client) Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+func (o *OIDCProvider) Name() string {
+	return o.cfg.Name
+}
+
+func (o *OIDCProvider) AuthURL(ctx context.Context, state string) (string, error) {
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", o.cfg.ClientId)
+	query.Set("redirect_uri", o.cfg.RedirectURL)
+	query.Set("scope", strings.Join(o.cfg.Scopes, " "))
+	query.Set("state", state)
+	// state 本身就是一次性的随机数，又和浏览器的 cookie 绑定，直接当 nonce 用
+	query.Set("nonce", state)
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+func (o *OIDCProvider) Exchange(ctx context.Context, code string, state string) (Token, error) {
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.cfg.RedirectURL)
+	form.Set("client_id", o.cfg.ClientId)
+	form.Set("client_secret", o.cfg.ClientSecret)
+	token, idToken, err := exchangeCode(ctx, o.client, doc.TokenEndpoint, form)
+	if err != nil {
+		return Token{}, err
+	}
+	if idToken == "" {
+		return Token{}, fmt.Errorf("%w 没有返回 id_token", ErrInvalidIDToken)
+	}
+	claims, err := o.verifyIDToken(ctx, idToken, state)
+	if err != nil {
+		return Token{}, err
+	}
+	token.IDToken = idToken
+	token.Claims = claims
+	return token, nil
+}
+
+func (o *OIDCProvider) UserInfo(ctx context.Context, token Token) (domain.OAuthUserInfo, error) {
+	if token.Claims == nil {
+		return domain.OAuthUserInfo{}, ErrInvalidIDToken
+	}
+	info := domain.OAuthUserInfo{
+		Provider:      o.Name(),
+		ExternalId:    token.Claims.Subject,
+		Email:         token.Claims.Email,
+		EmailVerified: token.Claims.EmailVerified,
+		Name:          token.Claims.Name,
+	}
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return domain.OAuthUserInfo{}, err
+	}
+	// 有些 IdP 的 ID Token 里面不放 email，要再调一次 userinfo
+	if info.Email != "" || doc.UserinfoEndpoint == "" || token.AccessToken == "" {
+		return info, nil
+	}
+	var ui struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	err = getJSON(ctx, o.client, doc.UserinfoEndpoint, token.AccessToken, &ui)
+	if err != nil {
+		return domain.OAuthUserInfo{}, err
+	}
+	// 规范要求 sub 必须和 ID Token 里面的一致，不然就是被替换了
+	if ui.Sub != info.ExternalId {
+		return domain.OAuthUserInfo{}, fmt.Errorf("userinfo 返回的 sub 和 ID Token 不一致")
+	}
+	info.Email, info.EmailVerified = ui.Email, ui.EmailVerified
+	if info.Name == "" {
+		info.Name = ui.Name
+	}
+	return info, nil
+}
+
+func (o *OIDCProvider) verifyIDToken(ctx context.Context, idToken string, nonce string) (*IDTokenClaims, error) {
+	var claims IDTokenClaims
+	token, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return o.key(ctx, kid)
+	},
+		// 不能接受 HS256 之类的对称算法，不然公钥会被当成 HMAC 的密钥
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(o.cfg.Issuer),
+		jwt.WithAudience(o.cfg.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+		jwt.WithTimeFunc(o.now))
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", ErrInvalidIDToken, err)
+	}
+	if !token.Valid || claims.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w nonce 不对", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+func (o *OIDCProvider) discovery(ctx context.Context) (*discoveryDoc, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.doc != nil {
+		return o.doc, nil
+	}
+	var doc discoveryDoc
+	err := getJSON(ctx, o.client, o.cfg.Issuer+"/.well-known/openid-configuration", "", &doc)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != o.cfg.Issuer {
+		return nil, fmt.Errorf("discovery 文档里面的 issuer %s 和配置的不一致", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery 文档不完整")
+	}
+	o.doc = &doc
+	return o.doc, nil
+}
+
+// key 按照 kid 找公钥，找不到就重新拉一次 JWKS，对方轮换 key 的时候能自动拿到新的
+func (o *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if key, ok := o.findKey(kid); ok {
+		return key, nil
+	}
+	if o.now().Sub(o.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("找不到 kid %s 对应的公钥", kid)
+	}
+	var set jsonWebKeySet
+	err = getJSON(ctx, o.client, doc.JWKSURI, "", &set)
+	if err != nil {
+		return nil, err
+	}
+	o.keys = set.publicKeys()
+	o.keysFetchedAt = o.now()
+	if key, ok := o.findKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("找不到 kid %s 对应的公钥", kid)
+}
+
+func (o *OIDCProvider) findKey(kid string) (crypto.PublicKey, bool) {
+	// 没有 kid 的时候，只有一个 key 才能确定用哪个
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key, true
+		}
+	}
+	key, ok := o.keys[kid]
+	return key, ok
+}
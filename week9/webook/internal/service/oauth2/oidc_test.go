@@ -0,0 +1,198 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOIDCProvider(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	idp := newFakeIdP(t, pub)
+	defer idp.server.Close()
+
+	validClaims := func() IDTokenClaims {
+		return IDTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    idp.server.URL,
+				Subject:   "sub-123",
+				Audience:  jwt.ClaimStrings{"client-id"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+			},
+			Nonce:         "the-state",
+			Email:         "a@b.com",
+			EmailVerified: true,
+		}
+	}
+	sign := func(claims IDTokenClaims, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = kid
+		res, err := token.SignedString(priv)
+		require.NoError(t, err)
+		return res
+	}
+
+	testCases := []struct {
+		name    string
+		idToken func() string
+		// 回调带回来的 state
+		state string
+
+		wantErr  bool
+		wantInfo string
+	}{
+		{
+			name: "成功",
+			idToken: func() string {
+				return sign(validClaims(), "k1")
+			},
+			state:    "the-state",
+			wantInfo: "sub-123",
+		},
+		{
+			name: "nonce 不对",
+			idToken: func() string {
+				return sign(validClaims(), "k1")
+			},
+			state:   "other-state",
+			wantErr: true,
+		},
+		{
+			name: "aud 不对",
+			idToken: func() string {
+				c := validClaims()
+				c.Audience = jwt.ClaimStrings{"other-client"}
+				return sign(c, "k1")
+			},
+			state:   "the-state",
+			wantErr: true,
+		},
+		{
+			name: "iss 不对",
+			idToken: func() string {
+				c := validClaims()
+				c.Issuer = "https://evil.com"
+				return sign(c, "k1")
+			},
+			state:   "the-state",
+			wantErr: true,
+		},
+		{
+			name: "过期了",
+			idToken: func() string {
+				c := validClaims()
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				return sign(c, "k1")
+			},
+			state:   "the-state",
+			wantErr: true,
+		},
+		{
+			name: "kid 不认识",
+			idToken: func() string {
+				return sign(validClaims(), "k2")
+			},
+			state:   "the-state",
+			wantErr: true,
+		},
+		{
+			name: "用公钥当 HMAC 的密钥",
+			idToken: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+				token.Header["kid"] = "k1"
+				res, err := token.SignedString([]byte(pub))
+				require.NoError(t, err)
+				return res
+			},
+			state:   "the-state",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			idp.idToken = tc.idToken()
+			p := NewOIDCProvider(OIDCConfig{
+				Name:         "idp",
+				Issuer:       idp.server.URL,
+				ClientId:     "client-id",
+				ClientSecret: "secret",
+				RedirectURL:  "https://meoying.com/oauth2/idp/callback",
+			}, idp.server.Client())
+
+			authURL, err := p.AuthURL(context.Background(), "the-state")
+			require.NoError(t, err)
+			u, err := url.Parse(authURL)
+			require.NoError(t, err)
+			assert.Equal(t, "the-state", u.Query().Get("nonce"))
+
+			token, err := p.Exchange(context.Background(), "the-code", tc.state)
+			assert.Equal(t, tc.wantErr, err != nil)
+			if err != nil {
+				return
+			}
+			info, err := p.UserInfo(context.Background(), token)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantInfo, info.ExternalId)
+			assert.Equal(t, "idp", info.Provider)
+			assert.Equal(t, "a@b.com", info.Email)
+			assert.True(t, info.EmailVerified)
+		})
+	}
+}
+
+// fakeIdP 模拟 discovery、JWKS 和 token 接口
+type fakeIdP struct {
+	server  *httptest.Server
+	idToken string
+}
+
+func newFakeIdP(t *testing.T, pub ed25519.PublicKey) *fakeIdP {
+	idp := &fakeIdP{}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, val any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(val)
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, discoveryDoc{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, jsonWebKeySet{Keys: []jsonWebKey{{
+			Kty: "OKP",
+			Kid: "k1",
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "the-code" || r.PostFormValue("client_secret") != "secret" {
+			writeJSON(w, tokenResponse{Error: "invalid_grant"})
+			return
+		}
+		writeJSON(w, tokenResponse{
+			AccessToken: "access-token",
+			TokenType:   "Bearer",
+			IDToken:     idp.idToken,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
@@ -0,0 +1,52 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"time"
+)
+
+var ErrProviderNotFound = errors.New("不支持的第三方登录")
+
+// Provider 授权码模式的第三方登录。微信的接口和标准的 OAuth2 差别比较大，单独在 wechat 里面实现
+type Provider interface {
+	// Name 第三方的名字，也是路由里面的 :provider
+	Name() string
+	// AuthURL 用户跳转过去授权的地址，state 会在回调的时候原样带回来
+	AuthURL(ctx context.Context, state string) (string, error)
+	// Exchange 用回调拿到的 code 换 token，state 在 OIDC 里面同时也是 nonce
+	Exchange(ctx context.Context, code string, state string) (Token, error)
+	// UserInfo 用 token 拿用户信息
+	UserInfo(ctx context.Context, token Token) (domain.OAuthUserInfo, error)
+}
+
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time
+	// IDToken 只有 OIDC 才有，Exchange 的时候已经校验过了
+	IDToken string
+	// Claims 校验过的 ID Token 里面的内容
+	Claims *IDTokenClaims
+}
+
+// Providers 按照名字找 Provider
+type Providers map[string]Provider
+
+func NewProviders(ps ...Provider) Providers {
+	res := make(Providers, len(ps))
+	for _, p := range ps {
+		res[p.Name()] = p
+	}
+	return res
+}
+
+func (ps Providers) Get(name string) (Provider, error) {
+	p, ok := ps[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return p, nil
+}
@@ -1 +1,93 @@
 package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"geekgo/week9/webook/internal/domain"
+	"net/http"
+	"net/url"
+)
+
+const (
+	authURLPattern = "https://open.weixin.qq.com/connect/qrconnect?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_login&state=%s#wechat_redirect"
+	accessTokenURL = "https://api.weixin.qq.com/sns/oauth2/access_token"
+)
+
+// Service 微信扫码登录，授权码模式
+type Service interface {
+	// AuthURL 用户扫码的页面，state 会在回调的时候原样带回来，用来防 CSRF
+	AuthURL(ctx context.Context, state string) (string, error)
+	// VerifyCode 用回调拿到的 code 换 openid 和 unionid
+	VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error)
+}
+
+type service struct {
+	appId       string
+	appSecret   string
+	redirectURL string
+	client      *http.Client
+}
+
+func NewService(appId string, appSecret string, redirectURL string, client *http.Client) Service {
+	return &service{
+		appId:       appId,
+		appSecret:   appSecret,
+		redirectURL: redirectURL,
+		client:      client,
+	}
+}
+
+func (s *service) AuthURL(ctx context.Context, state string) (string, error) {
+	return fmt.Sprintf(authURLPattern, s.appId, url.QueryEscape(s.redirectURL), url.QueryEscape(state)), nil
+}
+
+func (s *service) VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error) {
+	query := url.Values{}
+	query.Set("appid", s.appId)
+	query.Set("secret", s.appSecret)
+	query.Set("code", code)
+	query.Set("grant_type", "authorization_code")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		accessTokenURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return domain.WechatInfo{}, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return domain.WechatInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return domain.WechatInfo{}, fmt.Errorf("微信返回了 HTTP %d", resp.StatusCode)
+	}
+	var res Result
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return domain.WechatInfo{}, err
+	}
+	// 出错的时候 HTTP 状态码也是 200，要看 errcode
+	if res.ErrCode != 0 {
+		return domain.WechatInfo{}, fmt.Errorf("换取 access_token 失败 %d %s", res.ErrCode, res.ErrMsg)
+	}
+	if res.OpenId == "" {
+		return domain.WechatInfo{}, fmt.Errorf("微信没有返回 openid")
+	}
+	return domain.WechatInfo{
+		OpenId:  res.OpenId,
+		UnionId: res.UnionId,
+	}, nil
+}
+
+// Result 微信 /sns/oauth2/access_token 的响应
+type Result struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	OpenId       string `json:"openid"`
+	Scope        string `json:"scope"`
+	UnionId      string `json:"unionid"`
+
+	ErrCode int64  `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
@@ -0,0 +1,99 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"geekgo/week9/webook/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestService_AuthURL(t *testing.T) {
+	svc := NewService("appid", "secret", "https://meoying.com/oauth2/wechat/callback", http.DefaultClient)
+	authURL, err := svc.AuthURL(context.Background(), "my state")
+	require.NoError(t, err)
+	assert.Equal(t, "https://open.weixin.qq.com/connect/qrconnect?appid=appid"+
+		"&redirect_uri=https%3A%2F%2Fmeoying.com%2Foauth2%2Fwechat%2Fcallback"+
+		"&response_type=code&scope=snsapi_login&state=my+state#wechat_redirect", authURL)
+}
+
+func TestService_VerifyCode(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		resp   Result
+
+		wantInfo domain.WechatInfo
+		wantErr  bool
+	}{
+		{
+			name:   "成功",
+			status: http.StatusOK,
+			resp:   Result{AccessToken: "token", OpenId: "openid", UnionId: "unionid"},
+			wantInfo: domain.WechatInfo{
+				OpenId:  "openid",
+				UnionId: "unionid",
+			},
+		},
+		{
+			name:    "code 不对",
+			status:  http.StatusOK,
+			resp:    Result{ErrCode: 40029, ErrMsg: "invalid code"},
+			wantErr: true,
+		},
+		{
+			name:    "微信挂了",
+			status:  http.StatusBadGateway,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/sns/oauth2/access_token", r.URL.Path)
+				assert.Equal(t, url.Values{
+					"appid":      {"appid"},
+					"secret":     {"secret"},
+					"code":       {"the-code"},
+					"grant_type": {"authorization_code"},
+				}, r.URL.Query())
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.resp)
+			}))
+			defer server.Close()
+
+			svc := NewService("appid", "secret", "", newFakeClient(server))
+			info, err := svc.VerifyCode(context.Background(), "the-code")
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.wantInfo, info)
+		})
+	}
+}
+
+// newFakeClient 所有请求都转发到 server 上面，server 用来模拟微信的接口
+func newFakeClient(server *httptest.Server) *http.Client {
+	target, _ := url.Parse(server.URL)
+	return &http.Client{
+		Transport: rewriteTransport{
+			target: target,
+			next:   server.Client().Transport,
+		},
+	}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+)
+
+var (
+	ErrOAuthBindingNotFound = repository.ErrOAuthBindingNotFound
+	// ErrOAuthAccountLinked 这个第三方账号已经绑定了别的用户
+	ErrOAuthAccountLinked = errors.New("第三方账号已经绑定了别的用户")
+	// ErrOAuthProviderLinked 已经绑定过这个第三方的另一个账号了，要先解绑
+	ErrOAuthProviderLinked = errors.New("已经绑定过这个第三方的账号")
+	// ErrLastLoginMethod 解绑之后就没办法登录了
+	ErrLastLoginMethod = errors.New("这是唯一的登录方式，不能解绑")
+)
+
+// OAuthBindingService 第三方登录，以及已登录用户绑定、解绑第三方账号
+type OAuthBindingService interface {
+	// FindOrCreate 第三方登录，第一次登录就是注册。
+	// 不会按照邮箱去关联已有的用户，第三方的邮箱不一定可信，要关联的话登录之后自己绑定
+	FindOrCreate(ctx context.Context, info domain.OAuthUserInfo) (domain.User, error)
+	Link(ctx context.Context, uid int64, info domain.OAuthUserInfo) error
+	Unlink(ctx context.Context, uid int64, provider string) error
+	List(ctx context.Context, uid int64) ([]domain.OAuthBinding, error)
+}
+
+type oauthBindingService struct {
+	repo     repository.OAuthBindingRepository
+	userRepo repository.UserRepository
+}
+
+func NewOAuthBindingService(repo repository.OAuthBindingRepository,
+	userRepo repository.UserRepository) OAuthBindingService {
+	return &oauthBindingService{repo: repo, userRepo: userRepo}
+}
+
+func (svc *oauthBindingService) FindOrCreate(ctx context.Context, info domain.OAuthUserInfo) (domain.User, error) {
+	b, err := svc.repo.FindByExternalId(ctx, info.Provider, info.ExternalId)
+	switch err {
+	case nil:
+		return svc.userRepo.FindById(ctx, b.Uid)
+	case repository.ErrOAuthBindingNotFound:
+	default:
+		return domain.User{}, err
+	}
+	uid, err := svc.repo.CreateWithUser(ctx, svc.toBinding(0, info))
+	if err == repository.ErrOAuthBindingDuplicate {
+		// 并发的时候别的请求已经创建了
+		b, err = svc.repo.FindByExternalId(ctx, info.Provider, info.ExternalId)
+		uid = b.Uid
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	return svc.userRepo.FindById(ctx, uid)
+}
+
+func (svc *oauthBindingService) Link(ctx context.Context, uid int64, info domain.OAuthUserInfo) error {
+	b, err := svc.repo.FindByExternalId(ctx, info.Provider, info.ExternalId)
+	switch err {
+	case nil:
+		if b.Uid == uid {
+			// 重复绑定，当成功
+			return nil
+		}
+		return ErrOAuthAccountLinked
+	case repository.ErrOAuthBindingNotFound:
+	default:
+		return err
+	}
+	err = svc.repo.Create(ctx, svc.toBinding(uid, info))
+	if err == repository.ErrOAuthBindingDuplicate {
+		return ErrOAuthProviderLinked
+	}
+	return err
+}
+
+func (svc *oauthBindingService) Unlink(ctx context.Context, uid int64, provider string) error {
+	bs, err := svc.repo.FindByUid(ctx, uid)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, b := range bs {
+		found = found || b.Provider == provider
+	}
+	if !found {
+		return ErrOAuthBindingNotFound
+	}
+	// 还绑定了别的第三方，肯定还能登录
+	if len(bs) == 1 {
+		u, err := svc.userRepo.FindById(ctx, uid)
+		if err != nil {
+			return err
+		}
+		if !svc.canLoginWithoutOAuth(u) {
+			return ErrLastLoginMethod
+		}
+	}
+	return svc.repo.Delete(ctx, uid, provider)
+}
+
+func (svc *oauthBindingService) List(ctx context.Context, uid int64) ([]domain.OAuthBinding, error) {
+	return svc.repo.FindByUid(ctx, uid)
+}
+
+// canLoginWithoutOAuth 邮箱密码、手机验证码、微信扫码，有一个就行
+func (svc *oauthBindingService) canLoginWithoutOAuth(u domain.User) bool {
+	return (u.Email != "" && u.Password != "") || u.Phone != "" || u.WechatInfo.OpenId != ""
+}
+
+func (svc *oauthBindingService) toBinding(uid int64, info domain.OAuthUserInfo) domain.OAuthBinding {
+	return domain.OAuthBinding{
+		Uid:        uid,
+		Provider:   info.Provider,
+		ExternalId: info.ExternalId,
+		Email:      info.Email,
+	}
+}
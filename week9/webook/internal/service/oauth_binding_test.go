@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOAuthBindingService_Link(t *testing.T) {
+	testCases := []struct {
+		name     string
+		bindings []domain.OAuthBinding
+
+		wantErr error
+	}{
+		{
+			name: "绑定成功",
+		},
+		{
+			name:     "重复绑定",
+			bindings: []domain.OAuthBinding{{Uid: 1, Provider: "github", ExternalId: "123"}},
+		},
+		{
+			name:     "第三方账号已经绑定了别人",
+			bindings: []domain.OAuthBinding{{Uid: 2, Provider: "github", ExternalId: "123"}},
+			wantErr:  ErrOAuthAccountLinked,
+		},
+		{
+			name:     "已经绑定了另一个 GitHub 账号",
+			bindings: []domain.OAuthBinding{{Uid: 1, Provider: "github", ExternalId: "456"}},
+			wantErr:  ErrOAuthProviderLinked,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeOAuthBindingRepository{bindings: tc.bindings}
+			svc := NewOAuthBindingService(repo, &fakeUserRepository{})
+			err := svc.Link(context.Background(), 1, domain.OAuthUserInfo{
+				Provider:   "github",
+				ExternalId: "123",
+			})
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestOAuthBindingService_Unlink(t *testing.T) {
+	testCases := []struct {
+		name     string
+		user     domain.User
+		bindings []domain.OAuthBinding
+
+		wantErr     error
+		wantDeleted bool
+	}{
+		{
+			name: "还有密码可以登录",
+			user: domain.User{Id: 1, Email: "a@b.com", Password: "hash"},
+			bindings: []domain.OAuthBinding{
+				{Uid: 1, Provider: "github", ExternalId: "123"},
+			},
+			wantDeleted: true,
+		},
+		{
+			name: "还绑定了别的第三方",
+			user: domain.User{Id: 1},
+			bindings: []domain.OAuthBinding{
+				{Uid: 1, Provider: "github", ExternalId: "123"},
+				{Uid: 1, Provider: "google", ExternalId: "abc"},
+			},
+			wantDeleted: true,
+		},
+		{
+			name: "唯一的登录方式",
+			user: domain.User{Id: 1},
+			bindings: []domain.OAuthBinding{
+				{Uid: 1, Provider: "github", ExternalId: "123"},
+			},
+			wantErr: ErrLastLoginMethod,
+		},
+		{
+			name:    "没有绑定",
+			user:    domain.User{Id: 1, Phone: "13800000000"},
+			wantErr: ErrOAuthBindingNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeOAuthBindingRepository{bindings: tc.bindings}
+			userRepo := &fakeUserRepository{users: map[string]domain.User{tc.user.Phone: tc.user}}
+			svc := NewOAuthBindingService(repo, userRepo)
+			err := svc.Unlink(context.Background(), 1, "github")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantDeleted, repo.deleted)
+		})
+	}
+}
+
+type fakeOAuthBindingRepository struct {
+	repository.OAuthBindingRepository
+	bindings []domain.OAuthBinding
+	deleted  bool
+}
+
+func (f *fakeOAuthBindingRepository) Create(ctx context.Context, b domain.OAuthBinding) error {
+	for _, old := range f.bindings {
+		if (old.Uid == b.Uid && old.Provider == b.Provider) ||
+			(old.Provider == b.Provider && old.ExternalId == b.ExternalId) {
+			return repository.ErrOAuthBindingDuplicate
+		}
+	}
+	f.bindings = append(f.bindings, b)
+	return nil
+}
+
+func (f *fakeOAuthBindingRepository) FindByExternalId(ctx context.Context,
+	provider string, externalId string) (domain.OAuthBinding, error) {
+	for _, b := range f.bindings {
+		if b.Provider == provider && b.ExternalId == externalId {
+			return b, nil
+		}
+	}
+	return domain.OAuthBinding{}, repository.ErrOAuthBindingNotFound
+}
+
+func (f *fakeOAuthBindingRepository) FindByUid(ctx context.Context, uid int64) ([]domain.OAuthBinding, error) {
+	var res []domain.OAuthBinding
+	for _, b := range f.bindings {
+		if b.Uid == uid {
+			res = append(res, b)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeOAuthBindingRepository) Delete(ctx context.Context, uid int64, provider string) error {
+	f.deleted = true
+	return nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// 热度 = (阅读 * 1 + 点赞 * 5 + 收藏 * 10 + 1) / (发表了多少小时 + 2) ^ 1.5
+	readWeight    = 1
+	likeWeight    = 5
+	collectWeight = 10
+	gravity       = 1.5
+
+	// 只看最近一周发表的，再早的衰减之后基本上不可能上榜
+	hotWindow = time.Hour * 24 * 7
+	// 榜单只保留这么多
+	hotTopN      = 1000
+	hotBatchSize = 500
+	// 榜单丢了当场重建，最多等这么久
+	rebuildTimeout = time.Minute
+)
+
+// ErrRankingUnsupported 文章存储不支持热榜
+var ErrRankingUnsupported = repository.ErrRankingUnsupported
+
+type RankingService interface {
+	// RankHot 重新计算文章的热榜
+	RankHot(ctx context.Context) error
+	// GetHot 按照热度分页，榜单丢了的时候会当场重建
+	GetHot(ctx context.Context, offset int, limit int) ([]domain.HotArticle, error)
+}
+
+type rankingService struct {
+	repo repository.RankingRepository
+	biz  string
+	// 榜单丢了的时候，同一时刻只有一个请求去重建
+	group singleflight.Group
+	now   func() time.Time
+}
+
+func NewRankingService(repo repository.RankingRepository) RankingService {
+	return &rankingService{
+		repo: repo,
+		biz:  "article",
+		now:  time.Now,
+	}
+}
+
+func (r *rankingService) RankHot(ctx context.Context) error {
+	now := r.now()
+	since := now.Add(-hotWindow)
+	top := make([]domain.HotArticle, 0, hotTopN+hotBatchSize)
+	var maxId int64
+	for {
+		arts, err := r.repo.ListArticleCandidates(ctx, since, maxId, hotBatchSize)
+		if err != nil {
+			return err
+		}
+		for i := range arts {
+			arts[i].Score = hotScore(arts[i].Intr, arts[i].PublishTime, now)
+		}
+		top = r.keepTopN(append(top, arts...))
+		if len(arts) < hotBatchSize {
+			break
+		}
+		maxId = arts[len(arts)-1].Id
+	}
+	return r.repo.ReplaceHot(ctx, r.biz, top)
+}
+
+// keepTopN 每一批处理完就截断，内存里面最多 hotTopN + hotBatchSize 个
+func (r *rankingService) keepTopN(arts []domain.HotArticle) []domain.HotArticle {
+	sort.Slice(arts, func(i, j int) bool {
+		if arts[i].Score != arts[j].Score {
+			return arts[i].Score > arts[j].Score
+		}
+		return arts[i].Id > arts[j].Id
+	})
+	if len(arts) > hotTopN {
+		arts = arts[:hotTopN]
+	}
+	return arts
+}
+
+func (r *rankingService) GetHot(ctx context.Context, offset int, limit int) ([]domain.HotArticle, error) {
+	arts, err := r.repo.GetHot(ctx, r.biz, offset, limit)
+	if err != repository.ErrRankingNotFound {
+		return arts, err
+	}
+	// Redis 数据丢了，从数据库重建，不等下一次定时任务
+	_, err, _ = r.group.Do(r.biz, func() (interface{}, error) {
+		// 所有等着的请求共用这一次重建，不能因为第一个请求的客户端断开就取消
+		rctx, cancel := context.WithTimeout(
+			trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)), rebuildTimeout)
+		defer cancel()
+		return nil, r.RankHot(rctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.GetHot(ctx, r.biz, offset, limit)
+}
+
+// hotScore 类似 Hacker News 的算法，互动越多分数越高，发表时间越久分数越低
+func hotScore(intr domain.Interactive, publishTime time.Time, now time.Time) float64 {
+	weighted := float64(intr.ReadCnt*readWeight + intr.LikeCnt*likeWeight + intr.CollectCnt*collectWeight)
+	hours := now.Sub(publishTime).Hours()
+	if hours < 0 {
+		hours = 0
+	}
+	return (weighted + 1) / math.Pow(hours+2, gravity)
+}
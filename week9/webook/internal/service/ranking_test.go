@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHotScore(t *testing.T) {
+	now := time.Now()
+	intr := domain.Interactive{ReadCnt: 100, LikeCnt: 10, CollectCnt: 5}
+	// 同样的互动，越新越热
+	assert.Greater(t, hotScore(intr, now.Add(-time.Hour), now),
+		hotScore(intr, now.Add(-time.Hour*10), now))
+	// 同样的时间，互动越多越热
+	assert.Greater(t, hotScore(domain.Interactive{LikeCnt: 1}, now, now),
+		hotScore(domain.Interactive{ReadCnt: 1}, now, now))
+	// (100 + 50 + 50 + 1) / 2 ^ 1.5
+	assert.InDelta(t, 71.06, hotScore(intr, now, now), 0.01)
+}
+
+func TestRankingService_GetHot(t *testing.T) {
+	now := time.Now()
+	repo := &fakeRankingRepository{
+		candidates: []domain.HotArticle{
+			{Id: 1, PublishTime: now.Add(-time.Hour * 48), Intr: domain.Interactive{ReadCnt: 1000}},
+			{Id: 2, PublishTime: now.Add(-time.Hour), Intr: domain.Interactive{ReadCnt: 100}},
+			{Id: 3, PublishTime: now.Add(-time.Hour), Intr: domain.Interactive{ReadCnt: 10}},
+		},
+	}
+	svc := NewRankingService(repo).(*rankingService)
+	svc.now = func() time.Time { return now }
+
+	// 榜单不存在，当场重建
+	arts, err := svc.GetHot(context.Background(), 0, 10)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.Id)
+	}
+	assert.Equal(t, []int64{2, 1, 3}, ids)
+	assert.Equal(t, 1, repo.replaced)
+}
+
+type fakeRankingRepository struct {
+	repository.RankingRepository
+	candidates []domain.HotArticle
+	hot        []domain.HotArticle
+	replaced   int
+}
+
+func (f *fakeRankingRepository) ListArticleCandidates(ctx context.Context, since time.Time, maxId int64, limit int) ([]domain.HotArticle, error) {
+	var res []domain.HotArticle
+	for _, c := range f.candidates {
+		if c.Id > maxId && len(res) < limit {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeRankingRepository) ReplaceHot(ctx context.Context, biz string, arts []domain.HotArticle) error {
+	f.replaced++
+	f.hot = arts
+	return nil
+}
+
+func (f *fakeRankingRepository) GetHot(ctx context.Context, biz string, offset int, limit int) ([]domain.HotArticle, error) {
+	if f.hot == nil {
+		return nil, repository.ErrRankingNotFound
+	}
+	if offset >= len(f.hot) {
+		return []domain.HotArticle{}, nil
+	}
+	end := offset + limit
+	if end > len(f.hot) {
+		end = len(f.hot)
+	}
+	return f.hot[offset:end], nil
+}
@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"geekgo/week9/webook/internal/service/sms"
+)
+
+// Service 开发环境用，不真的发短信，验证码打印出来
+type Service struct {
+}
+
+func NewService() sms.Service {
+	return &Service{}
+}
+
+func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	fmt.Println(tplId, args, numbers)
+	return nil
+}
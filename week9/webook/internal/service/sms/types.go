@@ -0,0 +1,9 @@
+package sms
+
+import "context"
+
+// Service 短信服务，不同的供应商在子包里面实现
+type Service interface {
+	// Send tplId 是短信模板，args 是模板里面的参数
+	Send(ctx context.Context, tplId string, args []string, numbers ...string) error
+}
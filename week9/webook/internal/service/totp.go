@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"geekgo/week9/webook/pkgs/totp"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTOTPEnabled = repository.ErrTOTPEnabled
+	// ErrTOTPNotEnabled 没有开启两步验证，或者还没有扫码
+	ErrTOTPNotEnabled  = errors.New("没有开启两步验证")
+	ErrInvalidTOTPCode = errors.New("两步验证码不对")
+	// ErrPreAuthExpired 输完密码太久了，或者已经登录过了，要重新输密码
+	ErrPreAuthExpired = repository.ErrPreAuthNotFound
+	// ErrPreAuthTooMany 验证码输错太多次了，要重新输密码
+	ErrPreAuthTooMany = repository.ErrPreAuthTooMany
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeLen 去掉中间的 - 之后的长度，和 6 位的验证码区分开
+	recoveryCodeLen = 10
+	// totpSkew 前后各允许偏一个周期
+	totpSkew = 1
+)
+
+// TOTPService 可选的两步验证。
+// 开启之后，不管用哪种方式登录都要再输一次 App 上面的验证码，手机丢了可以用恢复码
+type TOTPService interface {
+	// Setup 生成新的密钥给用户扫码，这个时候还没有开启
+	Setup(ctx context.Context, uid int64) (secret string, uri string, err error)
+	// Confirm 输对了扫码之后的第一个验证码才算开启，返回恢复码，只有这一次能看到
+	Confirm(ctx context.Context, uid int64, code string) ([]string, error)
+	// Disable code 可以是验证码，也可以是恢复码
+	Disable(ctx context.Context, uid int64, code string) error
+	Enabled(ctx context.Context, uid int64) (bool, error)
+	// StartLogin 第一步验证通过之后调用，返回 pre-auth token，几分钟之内有效
+	// account 见 domain.PreAuth，CompleteLogin 的时候原样返回
+	StartLogin(ctx context.Context, uid int64, account string) (string, error)
+	// CompleteLogin code 可以是验证码，也可以是恢复码。
+	// 验证码不对的时候也会返回 uid，调用方用来记录失败次数
+	CompleteLogin(ctx context.Context, preAuthToken string, code string) (domain.PreAuth, error)
+}
+
+type TOTPConfig struct {
+	// Issuer App 里面显示的名字
+	Issuer string
+	// Key 加密数据库里面的密钥，拖库了也拿不到
+	Key []byte
+}
+
+type totpService struct {
+	repo     repository.TOTPRepository
+	userRepo repository.UserRepository
+	issuer   string
+	aead     cipher.AEAD
+	now      func() time.Time
+}
+
+func NewTOTPService(repo repository.TOTPRepository, userRepo repository.UserRepository,
+	cfg TOTPConfig) (TOTPService, error) {
+	// 配置里面的 key 长度不固定，哈希一下正好是 AES-256 要的 32 字节
+	key := sha256.Sum256(cfg.Key)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &totpService{
+		repo:     repo,
+		userRepo: userRepo,
+		issuer:   cfg.Issuer,
+		aead:     aead,
+		now:      time.Now,
+	}, nil
+}
+
+func (svc *totpService) Setup(ctx context.Context, uid int64) (string, string, error) {
+	u, err := svc.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	encrypted, err := svc.encrypt(uid, secret)
+	if err != nil {
+		return "", "", err
+	}
+	err = svc.repo.SavePending(ctx, uid, encrypted)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(svc.issuer, svc.accountName(u), secret), nil
+}
+
+func (svc *totpService) Confirm(ctx context.Context, uid int64, code string) ([]string, error) {
+	t, err := svc.repo.FindByUid(ctx, uid)
+	if err == repository.ErrTOTPNotFound {
+		return nil, ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled {
+		return nil, ErrTOTPEnabled
+	}
+	// 开启的时候只能用验证码，证明 App 已经扫好了
+	err = svc.verifyTOTP(ctx, t, code)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := svc.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = svc.repo.Enable(ctx, uid, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (svc *totpService) Disable(ctx context.Context, uid int64, code string) error {
+	t, err := svc.findEnabled(ctx, uid)
+	if err != nil {
+		return err
+	}
+	err = svc.verify(ctx, t, code)
+	if err != nil {
+		return err
+	}
+	return svc.repo.Delete(ctx, uid)
+}
+
+func (svc *totpService) Enabled(ctx context.Context, uid int64) (bool, error) {
+	_, err := svc.findEnabled(ctx, uid)
+	switch err {
+	case nil:
+		return true, nil
+	case ErrTOTPNotEnabled:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (svc *totpService) StartLogin(ctx context.Context, uid int64, account string) (string, error) {
+	token := uuid.New().String()
+	return token, svc.repo.SetPreAuth(ctx, token, domain.PreAuth{Uid: uid, Account: account})
+}
+
+func (svc *totpService) CompleteLogin(ctx context.Context, preAuthToken string, code string) (domain.PreAuth, error) {
+	pa, err := svc.repo.AttemptPreAuth(ctx, preAuthToken)
+	if err != nil {
+		return domain.PreAuth{}, err
+	}
+	t, err := svc.findEnabled(ctx, pa.Uid)
+	if err == ErrTOTPNotEnabled {
+		// 输完密码之后两步验证被关掉了，重新登录一次
+		return domain.PreAuth{}, ErrPreAuthExpired
+	}
+	if err != nil {
+		return domain.PreAuth{}, err
+	}
+	err = svc.verify(ctx, t, code)
+	if err == ErrInvalidTOTPCode {
+		return pa, err
+	}
+	if err != nil {
+		return domain.PreAuth{}, err
+	}
+	// 登录成功了，这个 token 不能再用
+	return pa, svc.repo.DelPreAuth(ctx, preAuthToken)
+}
+
+func (svc *totpService) findEnabled(ctx context.Context, uid int64) (domain.TOTP, error) {
+	t, err := svc.repo.FindByUid(ctx, uid)
+	if err == repository.ErrTOTPNotFound || (err == nil && !t.Enabled) {
+		return domain.TOTP{}, ErrTOTPNotEnabled
+	}
+	return t, err
+}
+
+// verify 6 位数字是验证码，别的按照恢复码处理
+func (svc *totpService) verify(ctx context.Context, t domain.TOTP, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return svc.verifyTOTP(ctx, t, code)
+	}
+	normalized := svc.normalizeRecoveryCode(code)
+	if len(normalized) != recoveryCodeLen {
+		return ErrInvalidTOTPCode
+	}
+	ok, err := svc.repo.UseRecoveryCode(ctx, t.Uid, svc.hashRecoveryCode(normalized))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+func (svc *totpService) verifyTOTP(ctx context.Context, t domain.TOTP, code string) error {
+	secret, err := svc.decrypt(t.Uid, t.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), svc.now(), totpSkew)
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	// 被人看到了验证码，或者请求被截下来重放，同一个周期的验证码都不能再用
+	ok, err = svc.repo.UseStep(ctx, t.Uid, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// generateRecoveryCodes 返回给用户看的恢复码，以及存到数据库里面的哈希
+func (svc *totpService) generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	buf := make([]byte, 8)
+	for i := 0; i < recoveryCodeCount; i++ {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))[:recoveryCodeLen]
+		codes = append(codes, raw[:recoveryCodeLen/2]+"-"+raw[recoveryCodeLen/2:])
+		hashes = append(hashes, svc.hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+func (svc *totpService) normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// hashRecoveryCode 恢复码本身是随机的，不需要 bcrypt 这种慢哈希
+func (svc *totpService) hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// encrypt uid 作为附加数据，别人的密文拷过来也解不开
+func (svc *totpService) encrypt(uid int64, secret string) (string, error) {
+	nonce := make([]byte, svc.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := svc.aead.Seal(nonce, nonce, []byte(secret), []byte(strconv.FormatInt(uid, 10)))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (svc *totpService) decrypt(uid int64, encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	size := svc.aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("两步验证的密钥格式不对")
+	}
+	secret, err := svc.aead.Open(nil, sealed[:size], sealed[size:], []byte(strconv.FormatInt(uid, 10)))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// accountName App 里面显示的账号
+func (svc *totpService) accountName(u domain.User) string {
+	switch {
+	case u.Email != "":
+		return u.Email
+	case u.Phone != "":
+		return u.Phone
+	default:
+		return strconv.FormatInt(u.Id, 10)
+	}
+}
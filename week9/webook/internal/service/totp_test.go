@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"geekgo/week9/webook/pkgs/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTOTPService(t *testing.T) {
+	repo := newFakeTOTPRepository()
+	userRepo := &fakeUserRepository{users: map[string]domain.User{
+		"u1": {Id: 1, Email: "a@b.com"},
+	}}
+	s, err := NewTOTPService(repo, userRepo, TOTPConfig{Issuer: "webook", Key: []byte("test-key")})
+	require.NoError(t, err)
+	svc := s.(*totpService)
+	now := time.Unix(1700000000, 0)
+	svc.now = func() time.Time {
+		return now
+	}
+	ctx := context.Background()
+	codeAt := func(secret string, at time.Time) string {
+		c, err := totp.Code(secret, totp.Step(at))
+		require.NoError(t, err)
+		return c
+	}
+
+	// 还没扫码
+	_, err = svc.Confirm(ctx, 1, "123456")
+	assert.Equal(t, ErrTOTPNotEnabled, err)
+
+	secret, uri, err := svc.Setup(ctx, 1)
+	require.NoError(t, err)
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, secret, u.Query().Get("secret"))
+	// 数据库里面是加密的
+	assert.NotEqual(t, secret, repo.totps[1].Secret)
+	enabled, err := svc.Enabled(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	_, err = svc.Confirm(ctx, 1, "000000")
+	assert.Equal(t, ErrInvalidTOTPCode, err)
+	codes, err := svc.Confirm(ctx, 1, codeAt(secret, now))
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	enabled, err = svc.Enabled(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, enabled)
+	// 开启之后不能重新扫码
+	_, _, err = svc.Setup(ctx, 1)
+	assert.Equal(t, ErrTOTPEnabled, err)
+
+	// 登录
+	token, err := svc.StartLogin(ctx, 1, "a@qq.com")
+	require.NoError(t, err)
+	// 开启的时候用过的验证码不能再用
+	pa, err := svc.CompleteLogin(ctx, token, codeAt(secret, now))
+	assert.Equal(t, ErrInvalidTOTPCode, err)
+	// 输错了也要知道是谁，记失败次数
+	assert.Equal(t, int64(1), pa.Uid)
+	now = now.Add(totp.Period)
+	pa, err = svc.CompleteLogin(ctx, token, codeAt(secret, now))
+	require.NoError(t, err)
+	// 第一步的账号原样带回来
+	assert.Equal(t, domain.PreAuth{Uid: 1, Account: "a@qq.com"}, pa)
+	// token 只能用一次
+	_, err = svc.CompleteLogin(ctx, token, codeAt(secret, now))
+	assert.Equal(t, ErrPreAuthExpired, err)
+
+	// 恢复码，大小写和 - 都无所谓，只能用一次
+	token, err = svc.StartLogin(ctx, 1, "")
+	require.NoError(t, err)
+	pa, err = svc.CompleteLogin(ctx, token, " "+codes[0]+" ")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pa.Uid)
+	token, err = svc.StartLogin(ctx, 1, "")
+	require.NoError(t, err)
+	_, err = svc.CompleteLogin(ctx, token, codes[0])
+	assert.Equal(t, ErrInvalidTOTPCode, err)
+
+	// 关掉
+	err = svc.Disable(ctx, 1, codes[1])
+	require.NoError(t, err)
+	enabled, err = svc.Enabled(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+	// 输完密码之后被关掉了
+	_, err = svc.CompleteLogin(ctx, token, codes[2])
+	assert.Equal(t, ErrPreAuthExpired, err)
+}
+
+// fakeTOTPRepository 数据都在内存里面，pre-auth token 不限次数
+type fakeTOTPRepository struct {
+	totps     map[int64]domain.TOTP
+	codes     map[int64]map[string]bool
+	preAuths  map[string]domain.PreAuth
+	lastSteps map[int64]int64
+}
+
+func newFakeTOTPRepository() *fakeTOTPRepository {
+	return &fakeTOTPRepository{
+		totps:     map[int64]domain.TOTP{},
+		codes:     map[int64]map[string]bool{},
+		preAuths:  map[string]domain.PreAuth{},
+		lastSteps: map[int64]int64{},
+	}
+}
+
+func (f *fakeTOTPRepository) FindByUid(ctx context.Context, uid int64) (domain.TOTP, error) {
+	t, ok := f.totps[uid]
+	if !ok {
+		return domain.TOTP{}, repository.ErrTOTPNotFound
+	}
+	return t, nil
+}
+
+func (f *fakeTOTPRepository) SavePending(ctx context.Context, uid int64, secret string) error {
+	if f.totps[uid].Enabled {
+		return repository.ErrTOTPEnabled
+	}
+	f.totps[uid] = domain.TOTP{Uid: uid, Secret: secret}
+	return nil
+}
+
+func (f *fakeTOTPRepository) Enable(ctx context.Context, uid int64, recoveryCodes []string) error {
+	t := f.totps[uid]
+	t.Enabled = true
+	f.totps[uid] = t
+	f.codes[uid] = map[string]bool{}
+	for _, c := range recoveryCodes {
+		f.codes[uid][c] = true
+	}
+	return nil
+}
+
+func (f *fakeTOTPRepository) Delete(ctx context.Context, uid int64) error {
+	delete(f.totps, uid)
+	delete(f.codes, uid)
+	return nil
+}
+
+func (f *fakeTOTPRepository) UseRecoveryCode(ctx context.Context, uid int64, code string) (bool, error) {
+	if !f.codes[uid][code] {
+		return false, nil
+	}
+	delete(f.codes[uid], code)
+	return true, nil
+}
+
+func (f *fakeTOTPRepository) SetPreAuth(ctx context.Context, token string, pa domain.PreAuth) error {
+	f.preAuths[token] = pa
+	return nil
+}
+
+func (f *fakeTOTPRepository) AttemptPreAuth(ctx context.Context, token string) (domain.PreAuth, error) {
+	pa, ok := f.preAuths[token]
+	if !ok {
+		return domain.PreAuth{}, repository.ErrPreAuthNotFound
+	}
+	return pa, nil
+}
+
+func (f *fakeTOTPRepository) DelPreAuth(ctx context.Context, token string) error {
+	delete(f.preAuths, token)
+	return nil
+}
+
+func (f *fakeTOTPRepository) UseStep(ctx context.Context, uid int64, step int64) (bool, error) {
+	if last, ok := f.lastSteps[uid]; ok && step <= last {
+		return false, nil
+	}
+	f.lastSteps[uid] = step
+	return true, nil
+}
@@ -11,20 +11,28 @@ import (
 var (
 	ErrUserDuplicate         = repository.ErrUserDuplicate
 	ErrInvalidUserOrPassword = errors.New("用户邮箱或密码不正确")
+	ErrEmailNotVerified      = errors.New("邮箱还没有验证")
 )
 
 type UserService interface {
 	SignUp(ctx context.Context, user domain.User) error
 	Login(ctx context.Context, email string, password string) (domain.User, error)
+	// FindOrCreate 手机号登录的时候用，第一次登录就是注册
+	FindOrCreate(ctx context.Context, phone string) (domain.User, error)
+	// FindOrCreateByWechat 微信扫码登录的时候用，第一次登录就是注册
+	FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error)
 }
 
 type userService struct {
 	repo repository.UserRepository
+	// 打开之后邮箱没有验证过的用户不能用邮箱密码登录
+	requireEmailVerified bool
 }
 
-func NewUserService(repo repository.UserRepository) UserService {
+func NewUserService(repo repository.UserRepository, requireEmailVerified bool) UserService {
 	return &userService{
-		repo: repo,
+		repo:                 repo,
+		requireEmailVerified: requireEmailVerified,
 	}
 }
 
@@ -33,10 +41,17 @@ func (svc *userService) Login(ctx context.Context, email string, password string
 	if err == repository.ErrUserNotFound {
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
+	if err != nil {
+		return domain.User{}, err
+	}
 	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	if err != nil {
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
+	// 密码对了才告诉他邮箱没验证，不然就能拿来探测邮箱
+	if svc.requireEmailVerified && !u.EmailVerified {
+		return domain.User{}, ErrEmailNotVerified
+	}
 	return u, nil
 }
 
@@ -48,3 +63,34 @@ func (svc *userService) SignUp(ctx context.Context, user domain.User) error {
 	user.Password = string(hash)
 	return svc.repo.Create(ctx, user)
 }
+
+func (svc *userService) FindOrCreate(ctx context.Context, phone string) (domain.User, error) {
+	u, err := svc.repo.FindByPhone(ctx, phone)
+	if err != repository.ErrUserNotFound {
+		// 绝大部分请求进来这里，nil 和别的错误也都直接返回
+		return u, err
+	}
+	err = svc.repo.Create(ctx, domain.User{
+		Phone: phone,
+	})
+	// 并发的时候可能别的请求已经创建了
+	if err != nil && err != repository.ErrUserDuplicate {
+		return domain.User{}, err
+	}
+	// 这里会遇到主从延迟的问题，最好是强制走主库
+	return svc.repo.FindByPhone(ctx, phone)
+}
+
+func (svc *userService) FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error) {
+	u, err := svc.repo.FindByWechat(ctx, info.OpenId)
+	if err != repository.ErrUserNotFound {
+		return u, err
+	}
+	err = svc.repo.Create(ctx, domain.User{
+		WechatInfo: info,
+	})
+	if err != nil && err != repository.ErrUserDuplicate {
+		return domain.User{}, err
+	}
+	return svc.repo.FindByWechat(ctx, info.OpenId)
+}
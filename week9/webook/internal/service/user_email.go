@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geekgo/week9/webook/internal/repository"
+	"geekgo/week9/webook/internal/service/email"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"html"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrUserTokenSendTooMany = repository.ErrUserTokenSendTooMany
+	// ErrInvalidUserToken 链接被篡改了、过期了、用过了，或者后面又发了新的
+	ErrInvalidUserToken = errors.New("链接已失效")
+)
+
+const (
+	bizVerifyEmail          = "verify_email"
+	bizResetPassword        = "reset_password"
+	verifyEmailExpiration   = time.Hour * 24
+	resetPasswordExpiration = time.Minute * 30
+)
+
+// UserEmailService 验证邮箱、通过邮件重置密码。
+// 邮件里面的链接带着签过名的 token，token 的 id 存在 Redis 里面，用一次就删掉
+type UserEmailService interface {
+	// SendVerifyEmail 邮箱没有注册或者已经验证过了也返回 nil，不让人拿来探测邮箱有没有注册
+	SendVerifyEmail(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	// SendResetPasswordEmail 邮箱没有注册也返回 nil
+	SendResetPasswordEmail(ctx context.Context, email string) error
+	// ResetPassword 返回 uid，调用方要把这个用户已经登录的设备都踢下线
+	ResetPassword(ctx context.Context, token string, password string) (int64, error)
+}
+
+type UserEmailConfig struct {
+	// Key 给 token 签名
+	Key []byte
+	// VerifyURL 和 ResetPasswordURL 是前端的页面，token 拼在查询参数里面
+	VerifyURL        string
+	ResetPasswordURL string
+}
+
+type userEmailService struct {
+	repo      repository.UserRepository
+	tokenRepo repository.UserTokenRepository
+	sender    email.Sender
+	cfg       UserEmailConfig
+}
+
+func NewUserEmailService(repo repository.UserRepository, tokenRepo repository.UserTokenRepository,
+	sender email.Sender, cfg UserEmailConfig) UserEmailService {
+	return &userEmailService{
+		repo:      repo,
+		tokenRepo: tokenRepo,
+		sender:    sender,
+		cfg:       cfg,
+	}
+}
+
+func (svc *userEmailService) SendVerifyEmail(ctx context.Context, email string) error {
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if err == repository.ErrUserNotFound || (err == nil && u.EmailVerified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	link, err := svc.newLink(ctx, bizVerifyEmail, u.Id, verifyEmailExpiration, svc.cfg.VerifyURL)
+	if err != nil {
+		return err
+	}
+	return svc.send(ctx, u.Email, "验证你的邮箱",
+		fmt.Sprintf(`<p>点击下面的链接验证邮箱，24 小时内有效：</p><p><a href="%s">%s</a></p>`, link, link))
+}
+
+func (svc *userEmailService) VerifyEmail(ctx context.Context, token string) error {
+	uid, err := svc.consume(ctx, bizVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	return svc.repo.MarkEmailVerified(ctx, uid)
+}
+
+func (svc *userEmailService) SendResetPasswordEmail(ctx context.Context, email string) error {
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if err == repository.ErrUserNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	link, err := svc.newLink(ctx, bizResetPassword, u.Id, resetPasswordExpiration, svc.cfg.ResetPasswordURL)
+	if err != nil {
+		return err
+	}
+	return svc.send(ctx, u.Email, "重置密码",
+		fmt.Sprintf(`<p>点击下面的链接重置密码，30 分钟内有效：</p><p><a href="%s">%s</a></p>`+
+			`<p>如果不是你本人操作，请忽略这封邮件。</p>`, link, link))
+}
+
+func (svc *userEmailService) ResetPassword(ctx context.Context, token string, password string) (int64, error) {
+	uid, err := svc.consume(ctx, bizResetPassword, token)
+	if err != nil {
+		return 0, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+	err = svc.repo.UpdatePassword(ctx, uid, string(hash))
+	if err != nil {
+		return 0, err
+	}
+	// 能收到邮件，邮箱肯定是他的
+	return uid, svc.repo.MarkEmailVerified(ctx, uid)
+}
+
+// newLink 生成 token 并且把 id 存起来，返回的链接已经转义过，可以直接放进 HTML
+func (svc *userEmailService) newLink(ctx context.Context, biz string, uid int64,
+	expiration time.Duration, base string) (string, error) {
+	claims := userTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+		},
+		Uid: uid,
+		Biz: biz,
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(svc.cfg.Key)
+	if err != nil {
+		return "", err
+	}
+	err = svc.tokenRepo.Store(ctx, biz, uid, claims.ID, expiration)
+	if err != nil {
+		return "", err
+	}
+	return html.EscapeString(base + "?token=" + url.QueryEscape(token)), nil
+}
+
+// consume 校验签名和用途，再到 Redis 里面核销
+func (svc *userEmailService) consume(ctx context.Context, biz string, token string) (int64, error) {
+	var claims userTokenClaims
+	t, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		return svc.cfg.Key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !t.Valid || claims.Biz != biz || claims.ID == "" {
+		return 0, ErrInvalidUserToken
+	}
+	ok, err := svc.tokenRepo.Consume(ctx, biz, claims.Uid, claims.ID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrInvalidUserToken
+	}
+	return claims.Uid, nil
+}
+
+func (svc *userEmailService) send(ctx context.Context, to string, subject string, body string) error {
+	err := svc.sender.Send(ctx, to, subject, body)
+	if err != nil {
+		err = fmt.Errorf("发送邮件出现异常 %w", err)
+	}
+	return err
+}
+
+type userTokenClaims struct {
+	jwt.RegisteredClaims
+	Uid int64
+	// Biz 验证邮箱的 token 不能拿来重置密码
+	Biz string
+}
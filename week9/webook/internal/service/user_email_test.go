@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"geekgo/week9/webook/internal/service/email/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"html"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestUserEmailService_ResetPassword(t *testing.T) {
+	userRepo := &fakeUserRepository{users: map[string]domain.User{
+		"u1": {Id: 1, Email: "a@b.com", Password: "old"},
+	}}
+	sender := memory.NewSender()
+	svc := newTestUserEmailService(userRepo, sender)
+	ctx := context.Background()
+
+	// 没有注册的邮箱不发，但是也不报错
+	err := svc.SendResetPasswordEmail(ctx, "x@b.com")
+	require.NoError(t, err)
+	assert.Len(t, sender.Mails(), 0)
+
+	err = svc.SendResetPasswordEmail(ctx, "a@b.com")
+	require.NoError(t, err)
+	require.Len(t, sender.Mails(), 1)
+	assert.Equal(t, "a@b.com", sender.Mails()[0].To)
+	token := tokenFromMail(t, sender.Mails()[0].Body)
+
+	// 重置密码的 token 不能拿来验证邮箱
+	err = svc.VerifyEmail(ctx, token)
+	assert.Equal(t, ErrInvalidUserToken, err)
+	// 篡改过的
+	_, err = svc.ResetPassword(ctx, token+"x", "hello#world123")
+	assert.Equal(t, ErrInvalidUserToken, err)
+
+	uid, err := svc.ResetPassword(ctx, token, "hello#world123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), uid)
+	u := userRepo.users["u1"]
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("hello#world123")))
+	// 能收到邮件说明邮箱是他的
+	assert.True(t, u.EmailVerified)
+
+	// 只能用一次
+	_, err = svc.ResetPassword(ctx, token, "hello#world456")
+	assert.Equal(t, ErrInvalidUserToken, err)
+}
+
+func TestUserEmailService_VerifyEmail(t *testing.T) {
+	userRepo := &fakeUserRepository{users: map[string]domain.User{
+		"u1": {Id: 1, Email: "a@b.com"},
+	}}
+	sender := memory.NewSender()
+	svc := newTestUserEmailService(userRepo, sender)
+	ctx := context.Background()
+
+	err := svc.SendVerifyEmail(ctx, "a@b.com")
+	require.NoError(t, err)
+	err = svc.SendVerifyEmail(ctx, "a@b.com")
+	assert.Equal(t, ErrUserTokenSendTooMany, err)
+	require.Len(t, sender.Mails(), 1)
+
+	err = svc.VerifyEmail(ctx, tokenFromMail(t, sender.Mails()[0].Body))
+	require.NoError(t, err)
+	assert.True(t, userRepo.users["u1"].EmailVerified)
+
+	// 验证过了就不再发
+	err = svc.SendVerifyEmail(ctx, "a@b.com")
+	require.NoError(t, err)
+	assert.Len(t, sender.Mails(), 1)
+}
+
+func TestUserService_LoginRequireEmailVerified(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hello#world123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	userRepo := &fakeUserRepository{users: map[string]domain.User{
+		"u1": {Id: 1, Email: "a@b.com", Password: string(hash)},
+	}}
+	ctx := context.Background()
+
+	_, err = NewUserService(userRepo, false).Login(ctx, "a@b.com", "hello#world123")
+	assert.NoError(t, err)
+	svc := NewUserService(userRepo, true)
+	// 密码不对的时候不能告诉他邮箱没验证
+	_, err = svc.Login(ctx, "a@b.com", "wrong")
+	assert.Equal(t, ErrInvalidUserOrPassword, err)
+	_, err = svc.Login(ctx, "a@b.com", "hello#world123")
+	assert.Equal(t, ErrEmailNotVerified, err)
+}
+
+func newTestUserEmailService(userRepo repository.UserRepository, sender *memory.Sender) UserEmailService {
+	return NewUserEmailService(userRepo, &fakeUserTokenRepository{tokens: map[string]string{}}, sender, UserEmailConfig{
+		Key:              []byte("test-key"),
+		VerifyURL:        "https://meoying.com/email/verify",
+		ResetPasswordURL: "https://meoying.com/password/reset",
+	})
+}
+
+var mailLinkRegexp = regexp.MustCompile(`href="([^"]+)"`)
+
+func tokenFromMail(t *testing.T, body string) string {
+	m := mailLinkRegexp.FindStringSubmatch(body)
+	require.Len(t, m, 2)
+	u, err := url.Parse(html.UnescapeString(m[1]))
+	require.NoError(t, err)
+	return u.Query().Get("token")
+}
+
+// fakeUserTokenRepository 不管过期时间，发过一次就算太频繁
+type fakeUserTokenRepository struct {
+	tokens map[string]string
+}
+
+func (f *fakeUserTokenRepository) Store(ctx context.Context, biz string, uid int64,
+	id string, expiration time.Duration) error {
+	key := fmt.Sprintf("%s:%d", biz, uid)
+	if _, ok := f.tokens[key]; ok {
+		return repository.ErrUserTokenSendTooMany
+	}
+	f.tokens[key] = id
+	return nil
+}
+
+func (f *fakeUserTokenRepository) Consume(ctx context.Context, biz string, uid int64, id string) (bool, error) {
+	key := fmt.Sprintf("%s:%d", biz, uid)
+	if f.tokens[key] != id {
+		return false, nil
+	}
+	delete(f.tokens, key)
+	return true, nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUserService_FindOrCreate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		users map[string]domain.User
+		// 模拟并发的时候别的请求先创建了
+		createErr error
+
+		wantId     int64
+		wantCreate bool
+		wantErr    error
+	}{
+		{
+			name:   "老用户",
+			users:  map[string]domain.User{"13800000000": {Id: 1, Phone: "13800000000"}},
+			wantId: 1,
+		},
+		{
+			name:       "新用户",
+			users:      map[string]domain.User{},
+			wantId:     1,
+			wantCreate: true,
+		},
+		{
+			name:       "并发创建，唯一索引冲突",
+			users:      map[string]domain.User{},
+			createErr:  repository.ErrUserDuplicate,
+			wantId:     100,
+			wantCreate: true,
+		},
+		{
+			name:       "创建失败",
+			users:      map[string]domain.User{},
+			createErr:  errors.New("mock db error"),
+			wantCreate: true,
+			wantErr:    errors.New("mock db error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeUserRepository{users: tc.users, createErr: tc.createErr}
+			svc := NewUserService(repo, false)
+			u, err := svc.FindOrCreate(context.Background(), "13800000000")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCreate, repo.created)
+			if tc.wantErr != nil {
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantId, u.Id)
+			assert.Equal(t, "13800000000", u.Phone)
+		})
+	}
+}
+
+type fakeUserRepository struct {
+	repository.UserRepository
+	users     map[string]domain.User
+	createErr error
+	created   bool
+}
+
+func (f *fakeUserRepository) FindByEmail(ctx context.Context, email string) (domain.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
+func (f *fakeUserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return f.update(id, func(u *domain.User) {
+		u.Password = password
+	})
+}
+
+func (f *fakeUserRepository) MarkEmailVerified(ctx context.Context, id int64) error {
+	return f.update(id, func(u *domain.User) {
+		u.EmailVerified = true
+	})
+}
+
+func (f *fakeUserRepository) update(id int64, fn func(u *domain.User)) error {
+	for k, u := range f.users {
+		if u.Id == id {
+			fn(&u)
+			f.users[k] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (f *fakeUserRepository) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
+	u, ok := f.users[phone]
+	if !ok {
+		return domain.User{}, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (f *fakeUserRepository) FindById(ctx context.Context, id int64) (domain.User, error) {
+	for _, u := range f.users {
+		if u.Id == id {
+			return u, nil
+		}
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
+func (f *fakeUserRepository) Create(ctx context.Context, user domain.User) error {
+	f.created = true
+	if f.createErr == repository.ErrUserDuplicate {
+		// 别的请求已经插进去了
+		f.users[user.Phone] = domain.User{Id: 100, Phone: user.Phone}
+	}
+	if f.createErr != nil {
+		return f.createErr
+	}
+	user.Id = int64(len(f.users) + 1)
+	f.users[user.Phone] = user
+	return nil
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"errors"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler 管理员用的接口。
+// 现在还没有角色管理，管理员就是配置里面的那几个 uid
+type AdminHandler struct {
+	guardSvc service.LoginGuardService
+	admins   map[int64]struct{}
+}
+
+func NewAdminHandler(guardSvc service.LoginGuardService, adminUids []int64) *AdminHandler {
+	admins := make(map[int64]struct{}, len(adminUids))
+	for _, uid := range adminUids {
+		admins[uid] = struct{}{}
+	}
+	return &AdminHandler{
+		guardSvc: guardSvc,
+		admins:   admins,
+	}
+}
+
+func (h *AdminHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/admin")
+	g.POST("/users/unlock", ginx.WrapReq[UnlockUserReq](h.UnlockUser))
+}
+
+// UnlockUser 用户被锁了打客服电话，核实身份之后解锁
+func (h *AdminHandler) UnlockUser(ctx *gin.Context, req UnlockUserReq) (ginx.Result, error) {
+	if err := h.checkAdmin(ctx); err != nil {
+		return ginx.Result{}, err
+	}
+	if req.Email != "" {
+		err := h.guardSvc.Unlock(ctx.Request.Context(), req.Email)
+		if err != nil {
+			return ginx.Result{}, ginx.ErrSystem.Wrap(err)
+		}
+	}
+	if req.Uid > 0 {
+		err := h.guardSvc.Unlock(ctx.Request.Context(), totpGuardAccount(req.Uid))
+		if err != nil {
+			return ginx.Result{}, ginx.ErrSystem.Wrap(err)
+		}
+	}
+	return ginx.Result{
+		Msg: "解锁成功",
+	}, nil
+}
+
+func (h *AdminHandler) checkAdmin(ctx *gin.Context) error {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		// 没有登录态，登录校验的中间件没有拦住
+		return ginx.ErrUnauthorized.Wrap(err)
+	}
+	if _, ok := h.admins[uid]; !ok {
+		return ginx.ErrForbidden.Wrap(errors.New("不是管理员"))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"encoding/json"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminHandler_UnlockUser(t *testing.T) {
+	testCases := []struct {
+		name string
+		// uid 是 0 就是没有登录态
+		uid  int64
+		body string
+		lang string
+
+		wantStatus   int
+		wantMsg      string
+		wantUnlocked []string
+	}{
+		{
+			name:         "按照邮箱解锁",
+			uid:          1,
+			body:         `{"email":"a@qq.com"}`,
+			wantStatus:   http.StatusOK,
+			wantMsg:      "解锁成功",
+			wantUnlocked: []string{"a@qq.com"},
+		},
+		{
+			name:         "没有邮箱的用户按照 uid 解锁两步验证",
+			uid:          1,
+			body:         `{"uid":123}`,
+			wantStatus:   http.StatusOK,
+			wantMsg:      "解锁成功",
+			wantUnlocked: []string{"totp:123"},
+		},
+		{
+			name:         "邮箱和 uid 一起解锁",
+			uid:          1,
+			body:         `{"email":"a@qq.com","uid":123}`,
+			wantStatus:   http.StatusOK,
+			wantMsg:      "解锁成功",
+			wantUnlocked: []string{"a@qq.com", "totp:123"},
+		},
+		{
+			name:       "邮箱和 uid 都没有",
+			uid:        1,
+			body:       `{}`,
+			lang:       "en",
+			wantStatus: http.StatusBadRequest,
+			wantMsg:    "uid is a required field",
+		},
+		{
+			name:       "不是管理员",
+			uid:        2,
+			body:       `{"uid":123}`,
+			wantStatus: http.StatusForbidden,
+			wantMsg:    "没有权限",
+		},
+		{
+			name:       "没有登录态",
+			body:       `{"uid":123}`,
+			wantStatus: http.StatusUnauthorized,
+			wantMsg:    "请先登录",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			guardSvc := &fakeLoginGuardService{}
+			server := gin.New()
+			server.Use(func(ctx *gin.Context) {
+				if tc.uid > 0 {
+					ctx.Set("claims", ijwt.UserClaim{Uid: tc.uid})
+				}
+			})
+			NewAdminHandler(guardSvc, []int64{1}).RegisterRoutes(server)
+			req := httptest.NewRequest(http.MethodPost, "/admin/users/unlock", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tc.lang)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantStatus, recorder.Code)
+			var res ginx.Result
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+			assert.Equal(t, tc.wantMsg, res.Msg)
+			assert.Equal(t, tc.wantUnlocked, guardSvc.unlocked)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"errors"
 	"geekgo/week9/webook/internal/domain"
 	"geekgo/week9/webook/internal/service"
@@ -17,15 +18,18 @@ type ArticleHandler struct {
 	svc service.ArticleService
 	// articleHandler 还需要组合 interactiveService 在点赞阅读等场景需要使用这个service
 	intrSvc service.InteractiveService
+	rankSvc service.RankingService
 	biz     string
 }
 
 const biz = "article"
 
-func NewArticleHandler(svc service.ArticleService, intrSvc service.InteractiveService) *ArticleHandler {
+func NewArticleHandler(svc service.ArticleService, intrSvc service.InteractiveService,
+	rankSvc service.RankingService) *ArticleHandler {
 	return &ArticleHandler{
 		svc:     svc,
 		intrSvc: intrSvc,
+		rankSvc: rankSvc,
 		biz:     biz,
 	}
 }
@@ -44,11 +48,20 @@ func (ah *ArticleHandler) RegisterRoutes(server *gin.Engine) {
 	g.POST("/edit", ginx.WrapReq[EditReq](ah.EditV1))
 	g.POST("/publish", ginx.WrapReq[EditReq](ah.PublishV1))
 	g.POST("/withdraw", ginx.WrapReq[EditReq](ah.WithdrawV1))
+	g.POST("/schedule", ginx.WrapReq[ScheduleReq](ah.ScheduleV1))
+	g.POST("/schedule/cancel", ginx.WrapReq[CancelScheduleReq](ah.CancelScheduleV1))
 	g.GET("/detail/:id", ginx.WrapReq[struct{}](ah.DetailV1))
+	g.POST("/list", ginx.WrapReq[ListReq](ah.ListV1))
+	g.GET("/revisions/:id", ginx.WrapReq[struct{}](ah.RevisionsV1))
+	g.POST("/revisions/diff", ginx.WrapReq[RevisionDiffReq](ah.RevisionDiffV1))
+	g.POST("/revisions/rollback", ginx.WrapReq[RevisionRollbackReq](ah.RollbackV1))
 	pub := g.Group("/pub")
 	pub.GET("/:id", ginx.WrapReq[struct{}](ah.PubDetailV1))
+	pub.POST("/list", ginx.WrapReq[PubListReq](ah.PubListV1))
+	pub.POST("/hot", ginx.WrapReq[HotListReq](ah.HotListV1))
 	pub.POST("/like", ginx.WrapReq[LikeReq](ah.LikeV1))
 	pub.POST("/collect", ginx.WrapReq[CollectReq](ah.CollectV1))
+	pub.POST("/uncollect", ginx.WrapReq[UncollectReq](ah.UncollectV1))
 
 }
 
@@ -78,7 +91,7 @@ func (ah *ArticleHandler) Edit(ctx *gin.Context) {
 		return
 	}
 	uid := userClaims.Uid
-	aid, err := ah.svc.Save(ctx, domain.Article{
+	aid, err := ah.svc.Save(ctx.Request.Context(), domain.Article{
 		Id:      req.Id,
 		Title:   req.Title,
 		Content: req.Content,
@@ -125,7 +138,7 @@ func (ah *ArticleHandler) Publish(ctx *gin.Context) {
 		return
 	}
 	uid := userClaims.Uid
-	aid, err := ah.svc.Publish(ctx, domain.Article{
+	aid, err := ah.svc.Publish(ctx.Request.Context(), domain.Article{
 		Id:      req.Id,
 		Title:   req.Title,
 		Content: req.Content,
@@ -171,7 +184,7 @@ func (ah *ArticleHandler) Withdraw(ctx *gin.Context) {
 	}
 	uid := userClaims.Uid
 
-	err := ah.svc.Withdraw(ctx, req.Id, uid)
+	err := ah.svc.Withdraw(ctx.Request.Context(), req.Id, uid)
 	if err != nil {
 		ctx.String(http.StatusOK, "系统错误")
 		return
@@ -187,7 +200,7 @@ func (ah *ArticleHandler) Detail(ctx *gin.Context) {
 		ctx.String(http.StatusOK, "系统错误")
 		return
 	}
-	art, err := ah.svc.GetById(ctx, id)
+	art, err := ah.svc.GetById(ctx.Request.Context(), id)
 	if err != nil {
 		ctx.String(http.StatusOK, "系统错误")
 		return
@@ -231,17 +244,25 @@ func (ah *ArticleHandler) Detail(ctx *gin.Context) {
 }
 
 func getUidFromCtxClaims(ctx *gin.Context) (int64, error) {
+	userClaims, err := getCtxClaims(ctx)
+	if err != nil {
+		return 0, errors.New("获取uid出错")
+	}
+	uid := userClaims.Uid
+	return uid, nil
+}
+
+func getCtxClaims(ctx *gin.Context) (ijwt.UserClaim, error) {
 	uc, ok := ctx.Get("claims")
 	if !ok {
-		return 0, errors.New("获取uid出错")
+		return ijwt.UserClaim{}, errors.New("获取claims出错")
 	}
 	userClaims, ok := uc.(ijwt.UserClaim)
 	if !ok {
 		// 应该是系统错误
-		return 0, errors.New("获取uid出错")
+		return ijwt.UserClaim{}, errors.New("获取claims出错")
 	}
-	uid := userClaims.Uid
-	return uid, nil
+	return userClaims, nil
 }
 
 func (ah *ArticleHandler) PubDetail(ctx *gin.Context) {
@@ -273,13 +294,13 @@ func (ah *ArticleHandler) PubDetail(ctx *gin.Context) {
 	var art domain.Article
 
 	eg.Go(func() error {
-		art, err = ah.svc.GetPublishedById(ctx, id, uid)
+		art, err = ah.svc.GetPublishedById(ctx.Request.Context(), id, uid)
 		return err
 	})
 
 	var intr domain.Interactive
 	eg.Go(func() error {
-		intr, err = ah.intrSvc.Get(ctx, ah.biz, id, uid)
+		intr, err = ah.intrSvc.Get(ctx.Request.Context(), ah.biz, id, uid)
 		return err
 	})
 
@@ -337,9 +358,9 @@ func (ah *ArticleHandler) Like(ctx *gin.Context) {
 		return
 	}
 	if req.Like {
-		err = ah.intrSvc.Like(ctx, ah.biz, req.Id, uid)
+		err = ah.intrSvc.Like(ctx.Request.Context(), ah.biz, req.Id, uid)
 	} else {
-		err = ah.intrSvc.CancelLike(ctx, ah.biz, req.Id, uid)
+		err = ah.intrSvc.CancelLike(ctx.Request.Context(), ah.biz, req.Id, uid)
 	}
 	if err != nil {
 		ctx.String(http.StatusOK, "系统错误")
@@ -366,7 +387,7 @@ func (ah *ArticleHandler) Collect(ctx *gin.Context) {
 		ctx.String(http.StatusOK, "系统错误")
 		return
 	}
-	err = ah.intrSvc.Collect(ctx, ah.biz, req.Id, req.Cid, uid)
+	err = ah.intrSvc.Collect(ctx.Request.Context(), ah.biz, req.Id, req.Cid, uid)
 	if err != nil {
 		ctx.String(http.StatusOK, "系统错误")
 		return
@@ -395,7 +416,7 @@ func (ah *ArticleHandler) EditV1(ctx *gin.Context, req EditReq) (ginx.Result, er
 		}, errors.New("assert user claims error")
 	}
 	uid := userClaims.Uid
-	aid, err := ah.svc.Save(ctx, domain.Article{
+	aid, err := ah.svc.Save(ctx.Request.Context(), domain.Article{
 		Id:      req.Id,
 		Title:   req.Title,
 		Content: req.Content,
@@ -436,7 +457,7 @@ func (ah *ArticleHandler) PublishV1(ctx *gin.Context, req EditReq) (ginx.Result,
 		}, errors.New("assert userclaim error")
 	}
 	uid := userClaims.Uid
-	aid, err := ah.svc.Publish(ctx, domain.Article{
+	aid, err := ah.svc.Publish(ctx.Request.Context(), domain.Article{
 		Id:      req.Id,
 		Title:   req.Title,
 		Content: req.Content,
@@ -478,7 +499,7 @@ func (ah *ArticleHandler) WithdrawV1(ctx *gin.Context, req EditReq) (ginx.Result
 	}
 	uid := userClaims.Uid
 
-	err := ah.svc.Withdraw(ctx, req.Id, uid)
+	err := ah.svc.Withdraw(ctx.Request.Context(), req.Id, uid)
 	if err != nil {
 		return ginx.Result{
 			Code: 5,
@@ -501,7 +522,7 @@ func (ah *ArticleHandler) DetailV1(ctx *gin.Context, req struct{}) (ginx.Result,
 			Msg:  "系统错误",
 		}, err
 	}
-	art, err := ah.svc.GetById(ctx, id)
+	art, err := ah.svc.GetById(ctx.Request.Context(), id)
 	if err != nil {
 		return ginx.Result{
 			Code: 5,
@@ -573,18 +594,22 @@ func (ah *ArticleHandler) PubDetailV1(ctx *gin.Context, req struct{}) (ginx.Resu
 	}
 	uid := userClaims.Uid
 
+	// 用 Request 里面的 context，阅读事件和查询才能和这个请求在同一条链路上
+	reqCtx := ctx.Request.Context()
 	var eg errgroup.Group
 	var art domain.Article
 
 	eg.Go(func() error {
-		art, err = ah.svc.GetPublishedById(ctx, id, uid)
-		return err
+		var er error
+		art, er = ah.svc.GetPublishedById(reqCtx, id, uid)
+		return er
 	})
 
 	var intr domain.Interactive
 	eg.Go(func() error {
-		intr, err = ah.intrSvc.Get(ctx, ah.biz, id, uid)
-		return err
+		var er error
+		intr, er = ah.intrSvc.Get(reqCtx, ah.biz, id, uid)
+		return er
 	})
 
 	err = eg.Wait()
@@ -636,9 +661,9 @@ func (ah *ArticleHandler) LikeV1(ctx *gin.Context, req LikeReq) (ginx.Result, er
 		}, err
 	}
 	if req.Like {
-		err = ah.intrSvc.Like(ctx, ah.biz, req.Id, uid)
+		err = ah.intrSvc.Like(ctx.Request.Context(), ah.biz, req.Id, uid)
 	} else {
-		err = ah.intrSvc.CancelLike(ctx, ah.biz, req.Id, uid)
+		err = ah.intrSvc.CancelLike(ctx.Request.Context(), ah.biz, req.Id, uid)
 	}
 	if err != nil {
 		return ginx.Result{
@@ -661,7 +686,13 @@ func (ah *ArticleHandler) CollectV1(ctx *gin.Context, req CollectReq) (ginx.Resu
 			Msg:  "系统错误",
 		}, err
 	}
-	err = ah.intrSvc.Collect(ctx, ah.biz, req.Id, req.Cid, uid)
+	err = ah.intrSvc.Collect(ctx.Request.Context(), ah.biz, req.Id, req.Cid, uid)
+	if err == service.ErrCollectionNotFound {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "收藏夹不存在",
+		}, err
+	}
 	if err != nil {
 		return ginx.Result{
 			Code: 5,
@@ -673,3 +704,418 @@ func (ah *ArticleHandler) CollectV1(ctx *gin.Context, req CollectReq) (ginx.Resu
 		Msg: "ok",
 	}, nil
 }
+
+func (ah *ArticleHandler) UncollectV1(ctx *gin.Context, req UncollectReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = ah.intrSvc.Uncollect(ctx.Request.Context(), ah.biz, req.Id, uid)
+	if err == service.ErrCollectItemNotFound {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "没有收藏过",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "ok",
+	}, nil
+}
+
+func (ah *ArticleHandler) RevisionsV1(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	idStr := ctx.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "参数错误",
+		}, err
+	}
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	revs, err := ah.svc.ListRevisions(ctx.Request.Context(), id, uid)
+	if err == service.ErrPossibleIncorrectAuthor {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "非法访问文章",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	vos := make([]ArticleRevisionVO, 0, len(revs))
+	for _, rev := range revs {
+		vos = append(vos, ArticleRevisionVO{
+			Version: rev.Version,
+			Id:      rev.Id,
+			Title:   rev.Title,
+			Content: rev.Content,
+			Status:  rev.Status.ToUint8(),
+			Ctime:   rev.Ctime.Format(time.DateTime),
+		})
+	}
+	return ginx.Result{
+		Data: vos,
+	}, nil
+}
+
+func (ah *ArticleHandler) RevisionDiffV1(ctx *gin.Context, req RevisionDiffReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	lines, err := ah.svc.DiffRevisions(ctx.Request.Context(), req.Id, uid, req.From, req.To)
+	switch err {
+	case nil:
+	case service.ErrPossibleIncorrectAuthor:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "非法访问文章",
+		}, err
+	case service.ErrArticleNotFound:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "版本不存在",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	vos := make([]DiffLineVO, 0, len(lines))
+	for _, line := range lines {
+		vos = append(vos, DiffLineVO{
+			Op:   line.Op.String(),
+			Text: line.Text,
+		})
+	}
+	return ginx.Result{
+		Data: vos,
+	}, nil
+}
+
+func (ah *ArticleHandler) RollbackV1(ctx *gin.Context, req RevisionRollbackReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	aid, err := ah.svc.Rollback(ctx.Request.Context(), req.Id, uid, req.Version, req.Publish)
+	switch err {
+	case nil:
+	case service.ErrPossibleIncorrectAuthor:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "非法访问文章",
+		}, err
+	case service.ErrArticleNotFound:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "版本不存在",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Data: aid,
+	}, nil
+}
+
+func (ah *ArticleHandler) ScheduleV1(ctx *gin.Context, req ScheduleReq) (ginx.Result, error) {
+	publishTime := time.UnixMilli(req.PublishTime)
+	if !publishTime.After(time.Now()) {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "发表时间必须晚于当前时间",
+		}, errors.New("定时发表时间不合法")
+	}
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	aid, err := ah.svc.Schedule(ctx.Request.Context(), domain.Article{
+		Id:      req.Id,
+		Title:   req.Title,
+		Content: req.Content,
+		Author: domain.Author{
+			Id: uid,
+		},
+	}, publishTime)
+	if err == service.ErrPossibleIncorrectAuthor {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "非法访问文章",
+		}, err
+	}
+	if err == service.ErrScheduleUnsupported {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "暂不支持定时发表",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Data: aid,
+	}, nil
+}
+
+func (ah *ArticleHandler) CancelScheduleV1(ctx *gin.Context, req CancelScheduleReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = ah.svc.CancelSchedule(ctx.Request.Context(), req.Id, uid)
+	if err == service.ErrScheduleNotFound {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "没有可以取消的定时发表",
+		}, err
+	}
+	if err == service.ErrScheduleUnsupported {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "暂不支持定时发表",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "已取消定时发表",
+	}, nil
+}
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+func (ah *ArticleHandler) ListV1(ctx *gin.Context, req ListReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	cursor, err := domain.ParseCursor(req.Cursor)
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "参数错误",
+		}, err
+	}
+	limit := ah.pageSize(req.Limit)
+	// 多查一条，用来判断还有没有下一页
+	arts, err := ah.svc.ListByAuthor(ctx.Request.Context(), uid, cursor, limit+1)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	res := ah.toListVO(arts, limit)
+	err = ah.fillInteractive(ctx.Request.Context(), res.List, uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Data: res,
+	}, nil
+}
+
+func (ah *ArticleHandler) PubListV1(ctx *gin.Context, req PubListReq) (ginx.Result, error) {
+	cursor, err := domain.ParseCursor(req.Cursor)
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "参数错误",
+		}, err
+	}
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	limit := ah.pageSize(req.Limit)
+	arts, err := ah.svc.ListPublished(ctx.Request.Context(), req.AuthorId, cursor, limit+1)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	res := ah.toListVO(arts, limit)
+	err = ah.fillInteractive(ctx.Request.Context(), res.List, uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Data: res,
+	}, nil
+}
+
+func (ah *ArticleHandler) pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+func (ah *ArticleHandler) HotListV1(ctx *gin.Context, req HotListReq) (ginx.Result, error) {
+	if req.Offset < 0 {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "参数错误",
+		}, errors.New("offset 不能是负数")
+	}
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	arts, err := ah.rankSvc.GetHot(ctx.Request.Context(), req.Offset, ah.pageSize(req.Limit))
+	if err == service.ErrRankingUnsupported {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "暂不支持热榜",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	// 榜单里面的计数是计算的时候的，展示用最新的
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.Id)
+	}
+	intrs, err := ah.intrSvc.GetByIds(ctx.Request.Context(), ah.biz, ids, uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	vos := make([]HotArticleVO, 0, len(arts))
+	for _, art := range arts {
+		intr := intrs[art.Id]
+		vos = append(vos, HotArticleVO{
+			Id:          art.Id,
+			Title:       art.Title,
+			AuthorId:    art.AuthorId,
+			Score:       art.Score,
+			ReadCnt:     intr.ReadCnt,
+			LikeCnt:     intr.LikeCnt,
+			CollectCnt:  intr.CollectCnt,
+			Liked:       intr.Liked,
+			Collected:   intr.Collected,
+			PublishTime: art.PublishTime.Format(time.DateTime),
+		})
+	}
+	return ginx.Result{
+		Data: vos,
+	}, nil
+}
+
+// fillInteractive 一次把整页的阅读、点赞、收藏数查出来
+func (ah *ArticleHandler) fillInteractive(ctx context.Context, vos []ArticleVO, uid int64) error {
+	ids := make([]int64, 0, len(vos))
+	for _, vo := range vos {
+		ids = append(ids, vo.Id)
+	}
+	intrs, err := ah.intrSvc.GetByIds(ctx, ah.biz, ids, uid)
+	if err != nil {
+		return err
+	}
+	for i := range vos {
+		intr := intrs[vos[i].Id]
+		vos[i].ReadCnt = intr.ReadCnt
+		vos[i].LikeCnt = intr.LikeCnt
+		vos[i].CollectCnt = intr.CollectCnt
+		vos[i].Liked = intr.Liked
+		vos[i].Collected = intr.Collected
+	}
+	return nil
+}
+
+// toListVO 列表只返回摘要，不返回全文
+func (ah *ArticleHandler) toListVO(arts []domain.Article, limit int) ArticleListVO {
+	res := ArticleListVO{
+		HasMore: len(arts) > limit,
+	}
+	if res.HasMore {
+		arts = arts[:limit]
+	}
+	res.List = make([]ArticleVO, 0, len(arts))
+	for _, art := range arts {
+		res.List = append(res.List, ArticleVO{
+			Id:       art.Id,
+			Title:    art.Title,
+			Abstract: art.Abstract(),
+			Status:   art.Status.ToUint8(),
+			Ctime:    art.Ctime.Format(time.DateTime),
+			Utime:    art.Utime.Format(time.DateTime),
+		})
+	}
+	if len(arts) > 0 {
+		last := arts[len(arts)-1]
+		res.Cursor = domain.Cursor{Utime: last.Utime, Id: last.Id}.String()
+	}
+	return res
+}
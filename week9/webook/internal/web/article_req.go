@@ -14,3 +14,50 @@ type CollectReq struct {
 	Id  int64 `json:"id"`
 	Cid int64 `json:"cid"`
 }
+
+type RevisionDiffReq struct {
+	Id int64 `json:"id"`
+	// 两个版本号
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type RevisionRollbackReq struct {
+	Id      int64 `json:"id"`
+	Version int64 `json:"version"`
+	// 为 true 的时候连同线上库一起回滚
+	Publish bool `json:"publish"`
+}
+
+type ScheduleReq struct {
+	Id      int64  `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// 定时发表的时间，毫秒时间戳
+	PublishTime int64 `json:"publish_time"`
+}
+
+type CancelScheduleReq struct {
+	Id int64 `json:"id"`
+}
+
+type ListReq struct {
+	// 上一页返回的游标，第一页不传
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+type PubListReq struct {
+	AuthorId int64  `json:"author_id"`
+	Cursor   string `json:"cursor"`
+	Limit    int    `json:"limit"`
+}
+
+type UncollectReq struct {
+	Id int64 `json:"id"`
+}
+
+type HotListReq struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
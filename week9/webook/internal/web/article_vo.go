@@ -25,3 +25,40 @@ type ArticleVO struct {
 	Ctime string `json:"ctime"`
 	Utime string `json:"utime"`
 }
+
+type ArticleRevisionVO struct {
+	Id      int64  `json:"id"`
+	Version int64  `json:"version"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Status  uint8  `json:"status"`
+	Ctime   string `json:"ctime"`
+}
+
+type DiffLineVO struct {
+	// + 新增，- 删除，空格 不变
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type ArticleListVO struct {
+	List []ArticleVO `json:"list"`
+	// 下一页的游标
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"has_more"`
+}
+
+type HotArticleVO struct {
+	Id       int64   `json:"id"`
+	Title    string  `json:"title"`
+	AuthorId int64   `json:"author_id"`
+	Score    float64 `json:"score"`
+
+	ReadCnt    int64 `json:"read_cnt"`
+	LikeCnt    int64 `json:"like_cnt"`
+	CollectCnt int64 `json:"collect_cnt"`
+	Liked      bool  `json:"liked"`
+	Collected  bool  `json:"collected"`
+
+	PublishTime string `json:"publish_time"`
+}
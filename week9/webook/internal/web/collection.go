@@ -0,0 +1,218 @@
+package web
+
+import (
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxCollectionNameLen = 64
+
+// CollectionHandler 收藏夹的管理，收藏和取消收藏还是在 ArticleHandler 里面
+type CollectionHandler struct {
+	svc service.CollectionService
+}
+
+func NewCollectionHandler(svc service.CollectionService) *CollectionHandler {
+	return &CollectionHandler{svc: svc}
+}
+
+func (h *CollectionHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/collections")
+	g.POST("/create", ginx.WrapReq[CreateCollectionReq](h.Create))
+	g.POST("/rename", ginx.WrapReq[RenameCollectionReq](h.Rename))
+	g.POST("/delete", ginx.WrapReq[DeleteCollectionReq](h.Delete))
+	g.GET("/list", ginx.WrapReq[struct{}](h.List))
+	g.POST("/items", ginx.WrapReq[CollectionItemsReq](h.Items))
+	g.POST("/items/move", ginx.WrapReq[MoveCollectionItemReq](h.MoveItem))
+}
+
+func (h *CollectionHandler) Create(ctx *gin.Context, req CreateCollectionReq) (ginx.Result, error) {
+	name, ok := h.checkName(req.Name)
+	if !ok {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "收藏夹名字不合法",
+		}, errors.New("收藏夹名字不合法")
+	}
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	id, err := h.svc.Create(ctx.Request.Context(), domain.Collection{
+		Name: name,
+		Uid:  uid,
+	})
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Data: id,
+	}, nil
+}
+
+func (h *CollectionHandler) Rename(ctx *gin.Context, req RenameCollectionReq) (ginx.Result, error) {
+	name, ok := h.checkName(req.Name)
+	if !ok {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "收藏夹名字不合法",
+		}, errors.New("收藏夹名字不合法")
+	}
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = h.svc.Rename(ctx.Request.Context(), req.Id, uid, name)
+	return h.result(err)
+}
+
+func (h *CollectionHandler) Delete(ctx *gin.Context, req DeleteCollectionReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = h.svc.Delete(ctx.Request.Context(), req.Id, uid)
+	return h.result(err)
+}
+
+func (h *CollectionHandler) List(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	cs, err := h.svc.List(ctx.Request.Context(), uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	vos := make([]CollectionVO, 0, len(cs))
+	for _, c := range cs {
+		vos = append(vos, CollectionVO{
+			Id:    c.Id,
+			Name:  c.Name,
+			Ctime: c.Ctime.Format(time.DateTime),
+			Utime: c.Utime.Format(time.DateTime),
+		})
+	}
+	return ginx.Result{
+		Data: vos,
+	}, nil
+}
+
+func (h *CollectionHandler) Items(ctx *gin.Context, req CollectionItemsReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	// 多查一条，用来判断还有没有下一页
+	items, err := h.svc.ListItems(ctx.Request.Context(), req.Cid, uid, req.Cursor, limit+1)
+	if err == service.ErrCollectionNotFound {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "收藏夹不存在",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	res := CollectionItemListVO{
+		HasMore: len(items) > limit,
+	}
+	if res.HasMore {
+		items = items[:limit]
+	}
+	res.List = make([]CollectionItemVO, 0, len(items))
+	for _, item := range items {
+		res.List = append(res.List, CollectionItemVO{
+			Id:    item.Id,
+			Cid:   item.Cid,
+			Biz:   item.Biz,
+			BizId: item.BizId,
+			Ctime: item.Ctime.Format(time.DateTime),
+		})
+	}
+	if len(items) > 0 {
+		res.Cursor = items[len(items)-1].Id
+	}
+	return ginx.Result{
+		Data: res,
+	}, nil
+}
+
+func (h *CollectionHandler) MoveItem(ctx *gin.Context, req MoveCollectionItemReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = h.svc.MoveItem(ctx.Request.Context(), req.Biz, req.BizId, uid, req.Cid)
+	if err == service.ErrCollectItemNotFound {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "没有收藏过",
+		}, err
+	}
+	return h.result(err)
+}
+
+func (h *CollectionHandler) result(err error) (ginx.Result, error) {
+	switch err {
+	case nil:
+		return ginx.Result{
+			Msg: "ok",
+		}, nil
+	case service.ErrCollectionNotFound:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "收藏夹不存在",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+func (h *CollectionHandler) checkName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, name != "" && utf8.RuneCountInString(name) <= maxCollectionNameLen
+}
@@ -0,0 +1,29 @@
+package web
+
+type CreateCollectionReq struct {
+	Name string `json:"name"`
+}
+
+type RenameCollectionReq struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type DeleteCollectionReq struct {
+	Id int64 `json:"id"`
+}
+
+type CollectionItemsReq struct {
+	// 默认收藏夹是 0
+	Cid int64 `json:"cid"`
+	// 上一页最后一条的 id，第一页不传
+	Cursor int64 `json:"cursor"`
+	Limit  int   `json:"limit"`
+}
+
+type MoveCollectionItemReq struct {
+	Biz   string `json:"biz"`
+	BizId int64  `json:"biz_id"`
+	// 目标收藏夹
+	Cid int64 `json:"cid"`
+}
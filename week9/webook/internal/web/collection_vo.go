@@ -0,0 +1,22 @@
+package web
+
+type CollectionVO struct {
+	Id    int64  `json:"id"`
+	Name  string `json:"name"`
+	Ctime string `json:"ctime"`
+	Utime string `json:"utime"`
+}
+
+type CollectionItemVO struct {
+	Id    int64  `json:"id"`
+	Cid   int64  `json:"cid"`
+	Biz   string `json:"biz"`
+	BizId int64  `json:"biz_id"`
+	Ctime string `json:"ctime"`
+}
+
+type CollectionItemListVO struct {
+	List    []CollectionItemVO `json:"list"`
+	Cursor  int64              `json:"cursor"`
+	HasMore bool               `json:"has_more"`
+}
@@ -0,0 +1,27 @@
+package web
+
+import (
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// JWKSHandler 公开签名用的公钥，别的服务（比如 gRPC 服务）拿去自己验签，不需要共享私钥
+type JWKSHandler struct {
+	keys ijwt.KeyProvider
+}
+
+func NewJWKSHandler(keys ijwt.KeyProvider) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+func (h *JWKSHandler) RegisterRoutes(server *gin.Engine) {
+	server.GET("/.well-known/jwks.json", h.JWKS)
+}
+
+func (h *JWKSHandler) JWKS(ctx *gin.Context) {
+	// 轮换的时候新 key 要尽快被看到，缓存时间不能太长
+	ctx.Header("Cache-Control", "public, max-age=300")
+	// 这里按照 RFC 7517 的格式返回，不套 Result
+	ctx.JSON(http.StatusOK, ijwt.NewJWKS(h.keys.PublicKeys()))
+}
@@ -0,0 +1,198 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("jwt key 不存在或者已经下线")
+
+// Key 用来签名和验签的非对称密钥，只有公钥的 key 只能用来验签
+type Key struct {
+	Kid    string
+	Method jwt.SigningMethod
+	// Private 为 nil 说明只能用来验签
+	Private crypto.Signer
+	Public  crypto.PublicKey
+	// RetireAt 轮换下来的旧 key 在这之后就不再接受，零值表示一直有效
+	RetireAt time.Time
+}
+
+func (k *Key) Retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// KeyProvider 管理签名用的 key。
+// 轮换的时候新 key 用来签名，旧 key 在重叠期内还能验签，这样已经发出去的 token 不会一下子全部失效
+type KeyProvider interface {
+	// SigningKey 当前用来签名的 key
+	SigningKey() (*Key, error)
+	// VerifyKey 按照 token 头部的 kid 找验签的 key
+	VerifyKey(kid string) (*Key, error)
+	// PublicKeys 所有还能用来验签的 key，JWKS 接口用
+	PublicKeys() []*Key
+}
+
+type staticKeyProvider struct {
+	signingKid string
+	keys       map[string]*Key
+	// 按照配置的顺序，JWKS 输出稳定一点
+	ordered []*Key
+	now     func() time.Time
+}
+
+// NewStaticKeyProvider keys 里面必须要有 signingKid 对应的私钥
+func NewStaticKeyProvider(signingKid string, keys ...*Key) (KeyProvider, error) {
+	p := &staticKeyProvider{
+		signingKid: signingKid,
+		keys:       make(map[string]*Key, len(keys)),
+		ordered:    keys,
+		now:        time.Now,
+	}
+	for _, k := range keys {
+		if _, ok := p.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("jwt key 重复的 kid %s", k.Kid)
+		}
+		p.keys[k.Kid] = k
+	}
+	k, ok := p.keys[signingKid]
+	if !ok || k.Private == nil {
+		return nil, fmt.Errorf("找不到签名用的私钥 %s", signingKid)
+	}
+	if !k.RetireAt.IsZero() {
+		return nil, fmt.Errorf("签名用的 key %s 不能配置下线时间", signingKid)
+	}
+	return p, nil
+}
+
+func (p *staticKeyProvider) SigningKey() (*Key, error) {
+	return p.keys[p.signingKid], nil
+}
+
+func (p *staticKeyProvider) VerifyKey(kid string) (*Key, error) {
+	k, ok := p.keys[kid]
+	if !ok || k.Retired(p.now()) {
+		return nil, ErrKeyNotFound
+	}
+	return k, nil
+}
+
+func (p *staticKeyProvider) PublicKeys() []*Key {
+	now := p.now()
+	res := make([]*Key, 0, len(p.ordered))
+	for _, k := range p.ordered {
+		if !k.Retired(now) {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// LoadKeyFile 从 PEM 文件读取 key
+func LoadKeyFile(kid string, path string, retireAt time.Time) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePEMKey(kid, data, retireAt)
+}
+
+// LoadOrGenerateKeyFile 文件不存在的时候生成一个 Ed25519 的私钥写进去，只在开发环境用，
+// 每个人本地的 key 都不一样，也不会被提交到 git 里面
+func LoadOrGenerateKeyFile(kid string, path string, retireAt time.Time) (*Key, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return LoadKeyFile(kid, path, retireAt)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, err
+	}
+	// O_EXCL 多个进程同时启动的时候，只有一个能写成功，其它的读它写的
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return LoadKeyFile(kid, path, retireAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParsePEMKey(kid, data, retireAt)
+}
+
+// ParsePEMKey 支持 PKCS8 / PKCS1 的 RSA 私钥、PKCS8 的 Ed25519 私钥，以及 PKIX 的公钥。
+// RSA 用 RS256，Ed25519 用 EdDSA
+func ParsePEMKey(kid string, data []byte, retireAt time.Time) (*Key, error) {
+	if kid == "" {
+		return nil, errors.New("jwt key 缺少 kid")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt key %s 不是合法的 PEM", kid)
+	}
+	var (
+		raw any
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		raw, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		raw, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		raw, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("jwt key %s 不支持的 PEM 类型 %s", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %s 解析失败 %w", kid, err)
+	}
+	key := &Key{
+		Kid:      kid,
+		RetireAt: retireAt,
+	}
+	switch k := raw.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("jwt key %s 只支持 RSA 和 Ed25519", kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,186 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := newTestEd25519Key(t, "old")
+	p, err := NewStaticKeyProvider("old", oldKey)
+	require.NoError(t, err)
+	hdl := &RedisJWT{keys: p}
+	token := signAccessToken(t, hdl)
+
+	// 轮换：新 key 签名，旧 key 一个小时之后下线
+	now := time.Now()
+	oldKey.RetireAt = now.Add(time.Hour)
+	newKey := newTestRSAKey(t, "new")
+	p, err = NewStaticKeyProvider("new", oldKey, newKey)
+	require.NoError(t, err)
+	hdl.keys = p
+
+	// 重叠期内旧 token 还能用
+	uc, err := hdl.ParseAccessToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), uc.Uid)
+	newToken := signAccessToken(t, hdl)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &UserClaim{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", parsed.Header["kid"])
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+	assert.Len(t, p.PublicKeys(), 2)
+
+	// 过了重叠期，旧 key 签的就不认了
+	p.(*staticKeyProvider).now = func() time.Time {
+		return now.Add(time.Hour)
+	}
+	_, err = hdl.ParseAccessToken(token)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = hdl.ParseAccessToken(newToken)
+	assert.NoError(t, err)
+	jwks := NewJWKS(p.PublicKeys())
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "new", jwks.Keys[0].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+
+	// 签名的 key 不能配置下线时间
+	_, err = NewStaticKeyProvider("old", oldKey)
+	assert.Error(t, err)
+	_, err = NewStaticKeyProvider("unknown", oldKey)
+	assert.Error(t, err)
+}
+
+func TestParseToken(t *testing.T) {
+	hdl := &RedisJWT{keys: newTestKeyProvider(t)}
+	ctx, recorder := newTestCtx()
+	err := hdl.setRefreshToken(ctx, 123, "ssid", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	refreshToken := recorder.Header().Get("x-refresh-token")
+
+	// 长 token 不能当成短 token 用
+	_, err = hdl.ParseAccessToken(refreshToken)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	rc, err := hdl.ParseRefreshToken(refreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, "ssid", rc.Ssid)
+
+	// 不认识的 key 签的
+	other := &RedisJWT{keys: newTestKeyProvider(t)}
+	_, err = hdl.ParseAccessToken(signAccessToken(t, other))
+	assert.Error(t, err)
+
+	// 用公钥当 HMAC 的密钥伪造
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Uid: 1,
+	})
+	forged.Header["kid"] = "test"
+	forged.Header["typ"] = typAccessToken
+	key, err := hdl.keys.SigningKey()
+	require.NoError(t, err)
+	forgedStr, err := forged.SignedString([]byte(key.Public.(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = hdl.ParseAccessToken(forgedStr)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestParsePEMKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := ParsePEMKey("rsa", pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+	}), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodRS256, key.Method)
+	assert.NotNil(t, key.Private)
+
+	// 只有公钥的只能验签
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	key, err = ParsePEMKey("rsa-pub", pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	}), time.Time{})
+	require.NoError(t, err)
+	assert.Nil(t, key.Private)
+	_, err = NewStaticKeyProvider("rsa-pub", key)
+	assert.Error(t, err)
+
+	_, err = ParsePEMKey("", nil, time.Time{})
+	assert.Error(t, err)
+	_, err = ParsePEMKey("bad", []byte("bad"), time.Time{})
+	assert.Error(t, err)
+}
+
+func TestLoadOrGenerateKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "dev.pem")
+	key, err := LoadOrGenerateKeyFile("dev", path, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodEdDSA, key.Method)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// 第二次启动读的是同一个 key，之前签发的 token 还能用
+	again, err := LoadOrGenerateKeyFile("dev", path, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, key.Public, again.Public)
+}
+
+func newTestKeyProvider(t *testing.T) KeyProvider {
+	p, err := NewStaticKeyProvider("test", newTestEd25519Key(t, "test"))
+	require.NoError(t, err)
+	return p
+}
+
+func newTestEd25519Key(t *testing.T, kid string) *Key {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	key, err := ParsePEMKey(kid, pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), time.Time{})
+	require.NoError(t, err)
+	return key
+}
+
+func newTestRSAKey(t *testing.T, kid string) *Key {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	key, err := ParsePEMKey(kid, pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), time.Time{})
+	require.NoError(t, err)
+	return key
+}
+
+func signAccessToken(t *testing.T, hdl *RedisJWT) string {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	err := hdl.SetJWTToken(ctx, 123, "ssid")
+	require.NoError(t, err)
+	return ctx.Writer.Header().Get("x-jwt-token")
+}
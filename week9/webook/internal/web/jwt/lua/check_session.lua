@@ -0,0 +1,14 @@
+local key = KEYS[1]
+-- 毫秒
+local now = tonumber(ARGV[1])
+-- 距离上一次更新超过这么久才更新 last_seen，免得每个请求都写一次
+local interval = tonumber(ARGV[2])
+local lastSeen = redis.call("HGET", key, "last_seen")
+if not lastSeen then
+    -- 退出登录了，被踢掉了，或者过期了
+    return 0
+end
+if now - tonumber(lastSeen) >= interval then
+    redis.call("HSET", key, "last_seen", now)
+end
+return 1
@@ -0,0 +1,35 @@
+-- 用户所有会话的 zset，score 是登录时间
+local sessionsKey = KEYS[1]
+-- 这一次登录的会话详情
+local sessionKey = KEYS[2]
+local ssid = ARGV[1]
+-- 毫秒
+local now = tonumber(ARGV[2])
+-- 秒，和长 token 的有效期一致
+local ttl = tonumber(ARGV[3])
+-- 0 表示不限制
+local maxSessions = tonumber(ARGV[4])
+-- 会话详情 key 的前缀，拼上 ssid 就是被踢掉的会话的 key
+local prefix = ARGV[5]
+
+-- 长 token 都过期了的会话顺手清理掉
+redis.call("ZREMRANGEBYSCORE", sessionsKey, "-inf", now - ttl * 1000)
+redis.call("ZADD", sessionsKey, now, ssid)
+redis.call("EXPIRE", sessionsKey, ttl)
+redis.call("HSET", sessionKey, "user_agent", ARGV[6], "ip", ARGV[7], "ctime", now, "last_seen", now)
+redis.call("EXPIRE", sessionKey, ttl)
+
+local evicted = {}
+if maxSessions > 0 then
+    local cnt = redis.call("ZCARD", sessionsKey)
+    if cnt > maxSessions then
+        -- 最早登录的排在前面
+        evicted = redis.call("ZRANGE", sessionsKey, 0, cnt - maxSessions - 1)
+        for _, id in ipairs(evicted) do
+            redis.call("DEL", prefix .. id)
+        end
+        redis.call("ZREMRANGEBYRANK", sessionsKey, 0, cnt - maxSessions - 1)
+    end
+end
+-- 返回被踢掉的 ssid
+return evicted
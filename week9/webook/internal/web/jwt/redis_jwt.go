@@ -11,18 +11,27 @@ import (
 	"time"
 )
 
-var (
-	AtKey = []byte("95osj3fUD7fo0mlYdDbncXz4VD2igvf0")
-	RtKey = []byte("95osj3fUD7fo0mlYdDbncXz4VD2igvfx")
+const (
+	// 放在 JWT 头部的 typ，长短 token 用的是同一把 key，靠这个区分，避免长 token 被当成短 token 用
+	typAccessToken  = "at+jwt"
+	typRefreshToken = "rt+jwt"
 )
 
+var ErrTokenInvalid = errors.New("token 无效")
+
 type RedisJWT struct {
 	cmd redis.Cmdable
+	// 非对称签名，别的服务通过 JWKS 拿到公钥就能自己验签
+	keys KeyProvider
+	// 同时在线的会话上限，超过了就踢掉最早登录的，0 表示不限制
+	maxSessions int
 }
 
-func NewRedisJWT(cmd redis.Cmdable) Handler {
+func NewRedisJWT(cmd redis.Cmdable, keys KeyProvider, maxSessions int) Handler {
 	return &RedisJWT{
-		cmd: cmd,
+		cmd:         cmd,
+		keys:        keys,
+		maxSessions: maxSessions,
 	}
 }
 
@@ -38,9 +47,13 @@ func (r *RedisJWT) ExtractTokenStr(ctx *gin.Context) string {
 func (r *RedisJWT) ClearToken(ctx *gin.Context) error {
 	ctx.Header("x-jwt-token", "")
 	ctx.Header("x-refresh-token", "")
-	claims := ctx.MustGet("claims").(*UserClaim)
-	// 把失效的sessionid 存到redis 因为jwt本身是无状态的， 如果之后认为这个jwttoken已经失效了 需要额外的地方记录 这里选择在redis里记录ssid
-	return r.cmd.Set(ctx, fmt.Sprintf("users:ssid:%s", claims.Ssid), "", time.Hour*24*7).Err()
+	claims := ctx.MustGet("claims").(UserClaim)
+	// jwt本身是无状态的，退出登录要额外的地方记录，这里是把 redis 里面登记的会话删掉
+	err := r.LogoutSession(ctx.Request.Context(), claims.Uid, claims.Ssid)
+	if err == ErrSessionNotFound {
+		return nil
+	}
+	return err
 
 }
 
@@ -48,34 +61,57 @@ func (r *RedisJWT) ClearToken(ctx *gin.Context) error {
 // 这种情况登录校验 就需要校验长token是否还有效，那每次请求都需要携带长token
 // 能不能用一个东西标识这一次登录？这就是ssid, 最后只检验ssid是不是还有效。
 // login之后需要设置 长短token 前端在401时 发送长token回来 验证长token ok后，重新设置短token
+// 每个 ssid 都登记在 redis 里面，用户可以看到自己在哪些设备上登录了，也可以把某个设备踢下线
 func (r *RedisJWT) SetLoginToken(ctx *gin.Context, uid int64) error {
 	ssid := uuid.New().String()
-	err := r.SetJWTToken(ctx, uid, ssid)
+	err := r.registerSession(ctx, uid, ssid)
+	if err != nil {
+		return err
+	}
+	err = r.SetJWTToken(ctx, uid, ssid)
 	if err != nil {
 		return err
 	}
-	err = r.setRefreshToken(ctx, uid, ssid)
+	err = r.setRefreshToken(ctx, uid, ssid, time.Now().Add(sessionExpiration))
 	return err
 }
 
-func (r *RedisJWT) CheckSession(ctx *gin.Context, ssid string) error {
-	val, err := r.cmd.Exists(ctx, fmt.Sprintf("users:ssid:%s", ssid)).Result()
-	switch err {
-	case redis.Nil:
-		return nil
-	case nil:
-		if val == 0 {
-			return nil
+// RotateRefreshToken 长 token 只能用一次，每次刷新都换一个新的长 token，旧的 jti 记到 redis 里面。
+// 如果一个用过的长 token 又被拿来刷新，说明它很可能被偷了，
+// 这时候分不清哪边是真正的用户，所以把整个 ssid 都作废，两边都要重新登录
+func (r *RedisJWT) RotateRefreshToken(ctx *gin.Context, rc RefreshClaims) error {
+	// 没有 jti 的长 token 没法判断有没有用过，直接当成失效
+	if rc.ID == "" || rc.ExpiresAt == nil {
+		return ErrSessionInvalid
+	}
+	err := r.CheckSession(ctx, rc.Ssid)
+	if err != nil {
+		return err
+	}
+	exp := rc.ExpiresAt.Time
+	// 记到长 token 过期就行，过期了本身就用不了
+	ok, err := r.cmd.SetNX(ctx.Request.Context(), r.usedRefreshKey(rc.ID), rc.Ssid, time.Until(exp)).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		err = r.LogoutSession(ctx.Request.Context(), rc.Uid, rc.Ssid)
+		if err != nil && err != ErrSessionNotFound {
+			return err
 		}
-		return errors.New("session已经失效")
-	default:
+		return ErrRefreshTokenReused
+	}
+	err = r.SetJWTToken(ctx, rc.Uid, rc.Ssid)
+	if err != nil {
 		return err
 	}
+	// 新的长 token 不延长有效期，跟着会话一起过期
+	return r.setRefreshToken(ctx, rc.Uid, rc.Ssid, exp)
 }
 
 func (r *RedisJWT) SetJWTToken(ctx *gin.Context, uid int64, ssid string) error {
 	// 设置jwt token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaim{
+	tokenStr, err := r.sign(typAccessToken, UserClaim{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 30)),
 		},
@@ -83,7 +119,6 @@ func (r *RedisJWT) SetJWTToken(ctx *gin.Context, uid int64, ssid string) error {
 		Ssid:      ssid,
 		UserAgent: ctx.Request.UserAgent(),
 	})
-	tokenStr, err := token.SignedString(AtKey)
 	if err != nil {
 		return err
 	}
@@ -92,19 +127,72 @@ func (r *RedisJWT) SetJWTToken(ctx *gin.Context, uid int64, ssid string) error {
 	return nil
 }
 
-func (r *RedisJWT) setRefreshToken(ctx *gin.Context, uid int64, ssid string) error {
+func (r *RedisJWT) setRefreshToken(ctx *gin.Context, uid int64, ssid string, exp time.Time) error {
 	refreshClaims := RefreshClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)),
+			// jti 用来判断这个长 token 是不是已经用过了
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(exp),
 		},
 		Uid:  uid,
 		Ssid: ssid,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, refreshClaims)
-	tokenStr, err := token.SignedString(RtKey)
+	tokenStr, err := r.sign(typRefreshToken, refreshClaims)
 	if err != nil {
 		return err
 	}
 	ctx.Header("x-refresh-token", tokenStr)
 	return nil
 }
+
+func (r *RedisJWT) ParseAccessToken(tokenStr string) (UserClaim, error) {
+	var uc UserClaim
+	err := r.parse(tokenStr, typAccessToken, &uc)
+	return uc, err
+}
+
+func (r *RedisJWT) ParseRefreshToken(tokenStr string) (RefreshClaims, error) {
+	var rc RefreshClaims
+	err := r.parse(tokenStr, typRefreshToken, &rc)
+	return rc, err
+}
+
+func (r *RedisJWT) sign(typ string, claims jwt.Claims) (string, error) {
+	key, err := r.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Kid
+	token.Header["typ"] = typ
+	return token.SignedString(key.Private)
+}
+
+func (r *RedisJWT) parse(tokenStr string, typ string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != typ {
+			return nil, ErrTokenInvalid
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := r.keys.VerifyKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// alg 是 token 自己带的，必须和 key 对得上，不然会被算法混淆攻击
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrTokenInvalid
+		}
+		return key.Public, nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func (r *RedisJWT) usedRefreshKey(jti string) string {
+	return fmt.Sprintf("users:refresh:used:%s", jti)
+}
@@ -0,0 +1,62 @@
+package jwt
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hdl := NewRedisJWT(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}), newTestKeyProvider(t), 0)
+
+	ctx, recorder := newTestCtx()
+	err := hdl.SetLoginToken(ctx, 123)
+	require.NoError(t, err)
+	first := parseRefreshClaims(t, hdl, recorder)
+
+	// 第一次刷新，拿到新的长 token
+	ctx, recorder = newTestCtx()
+	err = hdl.RotateRefreshToken(ctx, first)
+	require.NoError(t, err)
+	assert.NotEmpty(t, recorder.Header().Get("x-jwt-token"))
+	second := parseRefreshClaims(t, hdl, recorder)
+	assert.Equal(t, first.Ssid, second.Ssid)
+	assert.NotEqual(t, first.ID, second.ID)
+	// 有效期跟着会话走，不会越刷越长
+	assert.Equal(t, first.ExpiresAt.Unix(), second.ExpiresAt.Unix())
+
+	// 旧的长 token 又被拿来用了，整个会话作废
+	ctx, _ = newTestCtx()
+	err = hdl.RotateRefreshToken(ctx, first)
+	assert.Equal(t, ErrRefreshTokenReused, err)
+	// 新的长 token 也跟着失效
+	ctx, _ = newTestCtx()
+	err = hdl.RotateRefreshToken(ctx, second)
+	assert.Equal(t, ErrSessionInvalid, err)
+	assert.Equal(t, ErrSessionInvalid, hdl.CheckSession(ctx, first.Ssid))
+
+	// 没有 jti 的长 token
+	err = hdl.RotateRefreshToken(ctx, RefreshClaims{Uid: 123, Ssid: first.Ssid})
+	assert.Equal(t, ErrSessionInvalid, err)
+}
+
+func newTestCtx() (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/users/refresh_token", nil)
+	return ctx, recorder
+}
+
+func parseRefreshClaims(t *testing.T, hdl Handler, recorder *httptest.ResponseRecorder) RefreshClaims {
+	rc, err := hdl.ParseRefreshToken(recorder.Header().Get("x-refresh-token"))
+	require.NoError(t, err)
+	return rc
+}
@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+var (
+	//go:embed lua/register_session.lua
+	luaRegisterSession string
+	//go:embed lua/check_session.lua
+	luaCheckSession string
+)
+
+var (
+	ErrSessionNotFound = errors.New("会话不存在")
+	ErrSessionInvalid  = errors.New("session已经失效")
+	// ErrRefreshTokenReused 长 token 被重复使用了，整个会话已经作废
+	ErrRefreshTokenReused = errors.New("refresh token 被重复使用")
+)
+
+const (
+	// 和长 token 的有效期一致，长 token 过期了会话也就没用了
+	sessionExpiration = time.Hour * 24 * 7
+	// last_seen 不需要很精确
+	lastSeenInterval = time.Minute
+)
+
+// Session 一次登录就是一个会话，一个用户可以同时在多个设备上登录
+type Session struct {
+	Ssid      string
+	UserAgent string
+	IP        string
+	// 登录时间
+	Ctime    time.Time
+	LastSeen time.Time
+}
+
+// registerSession 登记一个新的会话，超过同时在线的上限就踢掉最早登录的
+func (r *RedisJWT) registerSession(ctx *gin.Context, uid int64, ssid string) error {
+	// 被踢掉的会话详情在脚本里面就删了，下一次请求 CheckSession 就过不去
+	return r.cmd.Eval(ctx.Request.Context(), luaRegisterSession,
+		[]string{r.sessionsKey(uid), r.sessionKey(ssid)},
+		ssid, time.Now().UnixMilli(), int64(sessionExpiration/time.Second),
+		r.maxSessions, r.sessionKey(""),
+		ctx.Request.UserAgent(), ctx.ClientIP()).Err()
+}
+
+// CheckSession 会话还在就顺便更新一下最后活跃时间
+func (r *RedisJWT) CheckSession(ctx *gin.Context, ssid string) error {
+	ok, err := r.cmd.Eval(ctx.Request.Context(), luaCheckSession, []string{r.sessionKey(ssid)},
+		time.Now().UnixMilli(), lastSeenInterval.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if ok != 1 {
+		return ErrSessionInvalid
+	}
+	return nil
+}
+
+func (r *RedisJWT) Sessions(ctx context.Context, uid int64) ([]Session, error) {
+	// 最近登录的排在前面
+	ssids, err := r.cmd.ZRevRange(ctx, r.sessionsKey(uid), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ssids) == 0 {
+		return []Session{}, nil
+	}
+	pipe := r.cmd.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ssids))
+	for _, ssid := range ssids {
+		cmds = append(cmds, pipe.HGetAll(ctx, r.sessionKey(ssid)))
+	}
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Session, 0, len(ssids))
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		// 已经过期了，下一次登录的时候会从 zset 里面清理掉
+		if len(vals) == 0 {
+			continue
+		}
+		res = append(res, Session{
+			Ssid:      ssids[i],
+			UserAgent: vals["user_agent"],
+			IP:        vals["ip"],
+			Ctime:     parseMilli(vals["ctime"]),
+			LastSeen:  parseMilli(vals["last_seen"]),
+		})
+	}
+	return res, nil
+}
+
+func (r *RedisJWT) LogoutSession(ctx context.Context, uid int64, ssid string) error {
+	// 只能踢自己的会话，ZREM 返回 0 说明不是这个用户的
+	cnt, err := r.cmd.ZRem(ctx, r.sessionsKey(uid), ssid).Result()
+	if err != nil {
+		return err
+	}
+	if cnt == 0 {
+		return ErrSessionNotFound
+	}
+	return r.cmd.Del(ctx, r.sessionKey(ssid)).Err()
+}
+
+func (r *RedisJWT) LogoutAllSessions(ctx context.Context, uid int64) error {
+	ssids, err := r.cmd.ZRange(ctx, r.sessionsKey(uid), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(ssids)+1)
+	keys = append(keys, r.sessionsKey(uid))
+	for _, ssid := range ssids {
+		keys = append(keys, r.sessionKey(ssid))
+	}
+	return r.cmd.Del(ctx, keys...).Err()
+}
+
+func (r *RedisJWT) sessionsKey(uid int64) string {
+	return fmt.Sprintf("users:sessions:%d", uid)
+}
+
+func (r *RedisJWT) sessionKey(ssid string) string {
+	return fmt.Sprintf("users:session:%s", ssid)
+}
+
+func parseMilli(val string) time.Time {
+	ms, _ := strconv.ParseInt(val, 10, 64)
+	return time.UnixMilli(ms)
+}
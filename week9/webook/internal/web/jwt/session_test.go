@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type SessionTestSuite struct {
+	suite.Suite
+	mr  *miniredis.Miniredis
+	hdl *RedisJWT
+}
+
+func (s *SessionTestSuite) SetupTest() {
+	s.mr = miniredis.RunT(s.T())
+	s.hdl = NewRedisJWT(redis.NewClient(&redis.Options{
+		Addr: s.mr.Addr(),
+	}), newTestKeyProvider(s.T()), 2).(*RedisJWT)
+}
+
+// login 模拟一次登录，返回这次登录的 ssid
+func (s *SessionTestSuite) login(uid int64, ua string) string {
+	t := s.T()
+	ctx := s.newCtx(ua)
+	err := s.hdl.SetLoginToken(ctx, uid)
+	require.NoError(t, err)
+	sessions, err := s.hdl.Sessions(context.Background(), uid)
+	require.NoError(t, err)
+	require.NotEmpty(t, sessions)
+	// 保证登录时间不一样
+	time.Sleep(time.Millisecond * 2)
+	return sessions[0].Ssid
+}
+
+func (s *SessionTestSuite) newCtx(ua string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/users/login", nil)
+	ctx.Request.Header.Set("User-Agent", ua)
+	return ctx
+}
+
+func (s *SessionTestSuite) TestMaxSessions() {
+	t := s.T()
+	ssid1 := s.login(123, "iPhone")
+	ssid2 := s.login(123, "Chrome")
+	// 别的用户不受影响
+	other := s.login(456, "Firefox")
+	ssid3 := s.login(123, "Android")
+
+	sessions, err := s.hdl.Sessions(context.Background(), 123)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, ssid3, sessions[0].Ssid)
+	assert.Equal(t, "Android", sessions[0].UserAgent)
+	assert.Equal(t, "192.0.2.1", sessions[0].IP)
+	assert.Equal(t, ssid2, sessions[1].Ssid)
+
+	// 最早登录的被踢掉了
+	ctx := s.newCtx("iPhone")
+	assert.Equal(t, ErrSessionInvalid, s.hdl.CheckSession(ctx, ssid1))
+	assert.NoError(t, s.hdl.CheckSession(ctx, ssid2))
+	assert.NoError(t, s.hdl.CheckSession(ctx, other))
+}
+
+func (s *SessionTestSuite) TestLogout() {
+	t := s.T()
+	ctx := context.Background()
+	ssid1 := s.login(123, "iPhone")
+	ssid2 := s.login(123, "Chrome")
+	other := s.login(456, "Firefox")
+
+	// 不能踢别人的设备
+	err := s.hdl.LogoutSession(ctx, 123, other)
+	assert.Equal(t, ErrSessionNotFound, err)
+	err = s.hdl.LogoutSession(ctx, 123, ssid1)
+	require.NoError(t, err)
+	assert.Equal(t, ErrSessionInvalid, s.hdl.CheckSession(s.newCtx(""), ssid1))
+	assert.NoError(t, s.hdl.CheckSession(s.newCtx(""), ssid2))
+
+	err = s.hdl.LogoutAllSessions(ctx, 123)
+	require.NoError(t, err)
+	assert.Equal(t, ErrSessionInvalid, s.hdl.CheckSession(s.newCtx(""), ssid2))
+	assert.NoError(t, s.hdl.CheckSession(s.newCtx(""), other))
+	sessions, err := s.hdl.Sessions(ctx, 123)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func (s *SessionTestSuite) TestLastSeen() {
+	t := s.T()
+	ssid := s.login(123, "iPhone")
+	key := s.hdl.sessionKey(ssid)
+	// 假装一个小时之前活跃过
+	old := time.Now().Add(-time.Hour).UnixMilli()
+	s.mr.HSet(key, "last_seen", strconv.FormatInt(old, 10))
+
+	err := s.hdl.CheckSession(s.newCtx("iPhone"), ssid)
+	require.NoError(t, err)
+	sessions, err := s.hdl.Sessions(context.Background(), 123)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.True(t, time.Since(sessions[0].LastSeen) < time.Minute)
+}
+
+func TestSession(t *testing.T) {
+	suite.Run(t, new(SessionTestSuite))
+}
@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -9,7 +10,21 @@ type Handler interface {
 	SetLoginToken(ctx *gin.Context, uid int64) error
 	SetJWTToken(ctx *gin.Context, uid int64, ssid string) error
 	ExtractTokenStr(ctx *gin.Context) string
+	// ParseAccessToken 校验短 token 的签名和有效期，不检查会话
+	ParseAccessToken(tokenStr string) (UserClaim, error)
+	// ParseRefreshToken 校验长 token 的签名和有效期，不检查会话
+	ParseRefreshToken(tokenStr string) (RefreshClaims, error)
+	// RotateRefreshToken 校验长 token 有没有被用过，没用过就换一对新的长短 token，
+	// 用过了就把整个会话作废，返回 ErrRefreshTokenReused
+	RotateRefreshToken(ctx *gin.Context, rc RefreshClaims) error
+	// CheckSession 会话被踢掉或者退出登录了就返回 error
 	CheckSession(ctx *gin.Context, ssid string) error
+	// Sessions 用户当前所有在线的会话，最近登录的排在前面
+	Sessions(ctx context.Context, uid int64) ([]Session, error)
+	// LogoutSession 把某一个设备踢下线，不是这个用户的会话返回 ErrSessionNotFound
+	LogoutSession(ctx context.Context, uid int64, ssid string) error
+	// LogoutAllSessions 退出所有设备，包括当前这个
+	LogoutAllSessions(ctx context.Context, uid int64) error
 }
 
 type UserClaim struct {
@@ -0,0 +1,168 @@
+package web
+
+import (
+	"fmt"
+	"geekgo/week9/webook/internal/service"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// loginHelper 密码、短信、微信、第三方登录最后都走这里。
+// 开启了两步验证的用户先不发 token，返回 pre-auth token，验证码也对了才算登录成功
+type loginHelper struct {
+	totpSvc  service.TOTPService
+	guardSvc service.LoginGuardService
+	jwtHdl   ijwt.Handler
+}
+
+func newLoginHelper(totpSvc service.TOTPService, guardSvc service.LoginGuardService,
+	jwtHdl ijwt.Handler) *loginHelper {
+	return &loginHelper{
+		totpSvc:  totpSvc,
+		guardSvc: guardSvc,
+		jwtHdl:   jwtHdl,
+	}
+}
+
+// loginOrChallenge 第一步已经验证通过了。
+// account 是第一步在 LoginGuardService 里面的账号，真正登录成功之后才清掉失败次数，短信和第三方登录传空字符串
+func (h *loginHelper) loginOrChallenge(ctx *gin.Context, uid int64, account string) (ginx.Result, error) {
+	enabled, err := h.totpSvc.Enabled(ctx.Request.Context(), uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	if enabled {
+		// 验证码输错太多次锁住了，就不再发 pre-auth token
+		wait, err := h.guardSvc.Check(ctx.Request.Context(), totpGuardAccount(uid), ctx.ClientIP())
+		if err != nil {
+			return loginLockedResult(ctx, wait, err)
+		}
+		// 先不发 token，验证码也对了才算登录成功
+		// account 跟着 pre-auth token 走，两步验证也通过了再清掉它的失败次数
+		preAuthToken, err := h.totpSvc.StartLogin(ctx.Request.Context(), uid, account)
+		if err != nil {
+			return ginx.Result{
+				Code: 5,
+				Msg:  "系统错误",
+			}, err
+		}
+		return ginx.Result{
+			Msg: "请输入两步验证码",
+			Data: LoginTOTPVO{
+				RequireTOTP:  true,
+				PreAuthToken: preAuthToken,
+			},
+		}, nil
+	}
+	if account != "" {
+		err = h.guardSvc.OnSuccess(ctx.Request.Context(), account)
+		if err != nil {
+			return ginx.Result{
+				Code: 5,
+				Msg:  "系统错误",
+			}, err
+		}
+	}
+	return h.setLoginToken(ctx, uid)
+}
+
+// completeLogin 第二步，验证码输错了和密码错了一样，按照账号和 IP 记失败次数。
+// 不然知道密码的人每登录一次就能换一个 pre-auth token 接着猜
+func (h *loginHelper) completeLogin(ctx *gin.Context, preAuthToken string, code string) (ginx.Result, error) {
+	pa, err := h.totpSvc.CompleteLogin(ctx.Request.Context(), preAuthToken, code)
+	uid := pa.Uid
+	if uid != 0 {
+		// 账号锁住之前拿到的 pre-auth token 也不能再试，验证码对不对都一样
+		wait, gerr := h.guardSvc.Check(ctx.Request.Context(), totpGuardAccount(uid), ctx.ClientIP())
+		if gerr != nil {
+			return loginLockedResult(ctx, wait, gerr)
+		}
+	}
+	switch err {
+	case nil:
+	case service.ErrInvalidTOTPCode:
+		wait, gerr := h.guardSvc.OnFailure(ctx.Request.Context(), totpGuardAccount(uid), ctx.ClientIP())
+		if gerr != nil {
+			return loginLockedResult(ctx, wait, gerr)
+		}
+		return ginx.Result{
+			Code: 4,
+			Msg:  "验证码不对",
+		}, err
+	case service.ErrPreAuthExpired, service.ErrPreAuthTooMany:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "验证超时或者错误次数太多，请重新登录",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = h.guardSvc.OnSuccess(ctx.Request.Context(), totpGuardAccount(uid))
+	if err == nil && pa.Account != "" {
+		// 第一步的密码也是对的，不然失败次数一直累积，正常用户也会越锁越久
+		err = h.guardSvc.OnSuccess(ctx.Request.Context(), pa.Account)
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return h.setLoginToken(ctx, uid)
+}
+
+func (h *loginHelper) setLoginToken(ctx *gin.Context, uid int64) (ginx.Result, error) {
+	err := h.jwtHdl.SetLoginToken(ctx, uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "登录成功",
+	}, nil
+}
+
+// totpGuardAccount 两步验证按照用户记失败次数，短信和第三方登录的用户不一定有邮箱
+func totpGuardAccount(uid int64) string {
+	return "totp:" + strconv.FormatInt(uid, 10)
+}
+
+// loginLockedResult 账号被锁和 IP 被限制的提示不一样，前端可以按照 retryAfter 倒计时
+func loginLockedResult(ctx *gin.Context, wait time.Duration, err error) (ginx.Result, error) {
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	if seconds > 0 {
+		ctx.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+	minutes := (seconds + 59) / 60
+	switch err {
+	case service.ErrAccountLocked:
+		return ginx.Result{
+			Code: 4,
+			Msg:  fmt.Sprintf("密码错误次数太多，账号已锁定，请 %d 分钟后再试", minutes),
+			Data: LoginLockedVO{Reason: "account", RetryAfter: seconds},
+		}, err
+	case service.ErrIPLocked:
+		return ginx.Result{
+			Code: 4,
+			Msg:  fmt.Sprintf("登录失败次数太多，请 %d 分钟后再试", minutes),
+			Data: LoginLockedVO{Reason: "ip", RetryAfter: seconds},
+		}, err
+	default:
+		// redis 出错了也不能放过去，不然就能趁机暴力破解
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"context"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginHelper(t *testing.T) {
+	testCases := []struct {
+		name    string
+		enabled bool
+		// 两步验证的时候传验证码，空的就是第一步
+		code   string
+		locked bool
+
+		wantCode    int
+		wantUid     int64
+		wantTOTP    bool
+		wantFailure []string
+		wantSuccess []string
+	}{
+		{
+			name:        "没有开启两步验证",
+			wantUid:     123,
+			wantSuccess: []string{"a@qq.com"},
+		},
+		{
+			name:     "开启了两步验证，先不发 token",
+			enabled:  true,
+			wantTOTP: true,
+		},
+		{
+			name:    "验证码对了",
+			enabled: true,
+			code:    "123456",
+			wantUid: 123,
+			// 第一步的账号也要清掉
+			wantSuccess: []string{"totp:123", "a@qq.com"},
+		},
+		{
+			name:        "验证码不对，算一次失败",
+			enabled:     true,
+			code:        "000000",
+			wantCode:    4,
+			wantFailure: []string{"totp:123"},
+		},
+		{
+			name:     "锁住之后验证码对了也不行",
+			enabled:  true,
+			code:     "123456",
+			locked:   true,
+			wantCode: 4,
+		},
+		{
+			name:     "锁住之后不发 pre-auth token",
+			enabled:  true,
+			locked:   true,
+			wantCode: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jwtHdl := &fakeJWTHandler{}
+			guardSvc := &fakeLoginGuardService{locked: tc.locked}
+			h := newLoginHelper(&fakeTOTPService{enabled: tc.enabled}, guardSvc, jwtHdl)
+			server := gin.New()
+			type Req struct {
+				PreAuthToken string `json:"preAuthToken"`
+				Code         string `json:"code"`
+			}
+			server.POST("/login", ginx.WrapReq[Req](func(ctx *gin.Context, req Req) (ginx.Result, error) {
+				if req.Code == "" {
+					return h.loginOrChallenge(ctx, 123, "a@qq.com")
+				}
+				return h.completeLogin(ctx, req.PreAuthToken, req.Code)
+			}))
+			body := `{}`
+			if tc.code != "" {
+				body = `{"preAuthToken":"token","code":"` + tc.code + `"}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			res := decodeResult(t, recorder)
+			assert.Equal(t, tc.wantCode, res.Code)
+			assert.Equal(t, tc.wantUid, jwtHdl.uid)
+			if tc.wantTOTP {
+				data, ok := res.Data.(map[string]any)
+				require.True(t, ok)
+				assert.Equal(t, true, data["requireTotp"])
+			}
+			assert.Equal(t, tc.wantFailure, guardSvc.failures)
+			assert.Equal(t, tc.wantSuccess, guardSvc.successes)
+		})
+	}
+}
+
+type fakeTOTPService struct {
+	service.TOTPService
+	enabled bool
+}
+
+func (f *fakeTOTPService) Enabled(ctx context.Context, uid int64) (bool, error) {
+	return f.enabled, nil
+}
+
+func (f *fakeTOTPService) StartLogin(ctx context.Context, uid int64, account string) (string, error) {
+	return "token", nil
+}
+
+func (f *fakeTOTPService) CompleteLogin(ctx context.Context, preAuthToken string, code string) (domain.PreAuth, error) {
+	pa := domain.PreAuth{Uid: 123, Account: "a@qq.com"}
+	if code != "123456" {
+		return pa, service.ErrInvalidTOTPCode
+	}
+	return pa, nil
+}
+
+type fakeLoginGuardService struct {
+	service.LoginGuardService
+	locked    bool
+	failures  []string
+	successes []string
+	unlocked  []string
+}
+
+func (f *fakeLoginGuardService) Check(ctx context.Context, account string, ip string) (time.Duration, error) {
+	if f.locked {
+		return time.Minute, service.ErrAccountLocked
+	}
+	return 0, nil
+}
+
+func (f *fakeLoginGuardService) OnFailure(ctx context.Context, account string, ip string) (time.Duration, error) {
+	f.failures = append(f.failures, account)
+	return 0, nil
+}
+
+func (f *fakeLoginGuardService) OnSuccess(ctx context.Context, account string) error {
+	f.successes = append(f.successes, account)
+	return nil
+}
+
+func (f *fakeLoginGuardService) Unlock(ctx context.Context, account string) error {
+	f.unlocked = append(f.unlocked, account)
+	return nil
+}
@@ -2,7 +2,6 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 
 	ijwt "geekgo/week9/webook/internal/web/jwt"
 	"net/http"
@@ -36,11 +35,8 @@ func (j *LoginJWTMiddlewareBuilder) Build() gin.HandlerFunc {
 		}
 
 		tokenStr := j.ExtractTokenStr(ctx)
-		var uc = ijwt.UserClaim{}
-		token, err := jwt.ParseWithClaims(tokenStr, &uc, func(token *jwt.Token) (interface{}, error) {
-			return ijwt.AtKey, nil
-		})
-		if err != nil || !token.Valid || token == nil || uc.Uid == 0 {
+		uc, err := j.ParseAccessToken(tokenStr)
+		if err != nil || uc.Uid == 0 {
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
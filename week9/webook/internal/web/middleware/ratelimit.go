@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"fmt"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"geekgo/week9/webook/pkgs/ginx"
+	"geekgo/week9/webook/pkgs/ratelimit"
+	"github.com/gin-gonic/gin"
+	"math"
+	"strconv"
+	"time"
+)
+
+// RateLimitKeyFunc 从请求里面拿限流对象，返回空字符串就是这个请求不限流
+type RateLimitKeyFunc func(ctx *gin.Context) string
+
+// RateLimitKeyByIP 按照 IP 限流
+func RateLimitKeyByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// RateLimitKeyByUid 按照用户限流，要放在登录校验的中间件后面。
+// 不需要登录的路由拿不到 uid，就退化成按照 IP 限流
+func RateLimitKeyByUid(ctx *gin.Context) string {
+	if uc, ok := ctx.Get("claims"); ok {
+		if claims, ok := uc.(ijwt.UserClaim); ok && claims.Uid != 0 {
+			return "uid:" + strconv.FormatInt(claims.Uid, 10)
+		}
+	}
+	return RateLimitKeyByIP(ctx)
+}
+
+type rateLimitRule struct {
+	limiter ratelimit.QuotaLimiter
+	key     RateLimitKeyFunc
+}
+
+// RateLimitMiddlewareBuilder 按照路由限流，每个路由可以用不同的算法、阈值和限流对象。
+// 路由用注册时候的写法，比如 /articles/:id，而不是具体的路径
+type RateLimitMiddlewareBuilder struct {
+	prefix string
+	// key 是 method + " " + 路由，method 是 * 表示所有方法
+	rules map[string]rateLimitRule
+}
+
+func NewRateLimitMiddlewareBuilder(prefix string) *RateLimitMiddlewareBuilder {
+	return &RateLimitMiddlewareBuilder{
+		prefix: prefix,
+		rules:  make(map[string]rateLimitRule),
+	}
+}
+
+// Route method 传 * 表示这个路由的所有方法共用一个规则，同一个路由后面的规则会覆盖前面的
+func (r *RateLimitMiddlewareBuilder) Route(method string, path string,
+	limiter ratelimit.QuotaLimiter, key RateLimitKeyFunc) *RateLimitMiddlewareBuilder {
+	r.rules[method+" "+path] = rateLimitRule{
+		limiter: limiter,
+		key:     key,
+	}
+	return r
+}
+
+func (r *RateLimitMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		method := ctx.Request.Method
+		rule, ok := r.rules[method+" "+route]
+		if !ok {
+			method = "*"
+			rule, ok = r.rules[method+" "+route]
+		}
+		if !ok {
+			return
+		}
+		key := rule.key(ctx)
+		if key == "" {
+			return
+		}
+		res, err := rule.limiter.Take(ctx.Request.Context(), fmt.Sprintf("%s:%s:%s:%s", r.prefix, method, route, key))
+		if err != nil {
+			// 限流器本身出了问题，不能影响正常的请求，redis 挂了的情况 FallbackLimiter 已经处理了
+			return
+		}
+		ctx.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		ctx.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		ctx.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+		if res.Limited {
+			ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			ctx.AbortWithStatusJSON(ginx.ErrTooManyReqs.Status, ginx.ErrTooManyReqs.Result())
+		}
+	}
+}
+
+// ceilSeconds 响应头里面只能写整数秒，向上取整，免得客户端提前重试
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
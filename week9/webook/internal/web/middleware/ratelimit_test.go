@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"geekgo/week9/webook/pkgs/ratelimit"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddlewareBuilder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	cmd := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	server := gin.New()
+	// 模拟登录校验的中间件
+	server.Use(func(ctx *gin.Context) {
+		if uid := ctx.GetHeader("X-Uid"); uid == "1" {
+			// 和 LoginJWTMiddlewareBuilder 一样，放的是值而不是指针
+			ctx.Set("claims", ijwt.UserClaim{Uid: 1})
+		}
+	})
+	server.Use(NewRateLimitMiddlewareBuilder("test").
+		Route(http.MethodPost, "/articles/:id", ratelimit.NewRedisSlidingWindowLimiter(cmd, time.Minute, 2), RateLimitKeyByUid).
+		Route("*", "/users/login", ratelimit.NewRedisTokenBucketLimiter(cmd, time.Second, 1, 1), RateLimitKeyByIP).
+		Route(http.MethodGet, "/down", ratelimit.NewFallbackLimiter(
+			ratelimit.NewRedisSlidingWindowLimiter(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"}), time.Minute, 100),
+			ratelimit.NewLocalSlidingWindowLimiter(time.Minute, 1), time.Minute), RateLimitKeyByIP).
+		Build())
+	ok := func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	}
+	server.POST("/articles/:id", ok)
+	server.GET("/articles/:id", ok)
+	server.POST("/users/login", ok)
+	server.GET("/down", ok)
+
+	do := func(method, path, uid string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Uid", uid)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// 同一个用户，不同的文章也算在同一个路由里面
+	resp := do(http.MethodPost, "/articles/1", "1")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "60", resp.Header().Get("X-RateLimit-Reset"))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/articles/2", "1").Code)
+	resp = do(http.MethodPost, "/articles/3", "1")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"code":4,"msg":"请求太频繁，请稍后再试","data":null}`, resp.Body.String())
+	// 没有登录的按照 IP 算，是另外一个计数
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/articles/3", "").Code)
+	// 没有配置规则的不限流
+	for i := 0; i < 5; i++ {
+		resp = do(http.MethodGet, "/articles/1", "1")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("X-RateLimit-Limit"))
+	}
+
+	// 令牌桶
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/users/login", "").Code)
+	resp = do(http.MethodPost, "/users/login", "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get("Retry-After"))
+
+	// redis 连不上，用本地的兜底
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/down", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/down", "").Code)
+}
+
+func TestRateLimitKeyByIP_TrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	// 和 ioc 里面一样，只信前面的代理
+	err := server.SetTrustedProxies([]string{"10.0.0.1"})
+	assert.NoError(t, err)
+	server.Use(NewRateLimitMiddlewareBuilder("test").
+		Route(http.MethodGet, "/test", ratelimit.NewLocalSlidingWindowLimiter(time.Minute, 1), RateLimitKeyByIP).
+		Build())
+	server.GET("/test", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+	send := func(remoteAddr string, xff string) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", xff)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	// 客户端直接连过来，自己带的 X-Forwarded-For 不算数，换一个也还是同一个 IP
+	assert.Equal(t, http.StatusOK, send("1.1.1.1:1234", "2.2.2.2"))
+	assert.Equal(t, http.StatusTooManyRequests, send("1.1.1.1:1234", "3.3.3.3"))
+	// 从代理过来的，按照代理给的客户端 IP 限流
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", "4.4.4.4"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.1:1234", "4.4.4.4"))
+}
+
+func TestRateLimitMiddlewareBuilder_LimiterError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(NewRateLimitMiddlewareBuilder("test").
+		Route("*", "/hello", errLimiter{}, RateLimitKeyByIP).
+		Build())
+	server.GET("/hello", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	// 限流器出错的时候放过
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+type errLimiter struct {
+	ratelimit.QuotaLimiter
+}
+
+func (errLimiter) Take(ctx context.Context, key string) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("出错了")
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/internal/service/oauth2"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuth2Handler GitHub、OIDC 这种标准的第三方登录，:provider 是配置里面的名字。
+// 绑定第三方账号和登录共用一个回调地址，用 state 里面的 Uid 区分，绑定的入口在 UserHandler 里面
+type OAuth2Handler struct {
+	providers  oauth2.Providers
+	bindingSvc service.OAuthBindingService
+	ijwt.Handler
+	state *OAuth2State
+	login *loginHelper
+}
+
+func NewOAuth2Handler(providers oauth2.Providers, bindingSvc service.OAuthBindingService, totpSvc service.TOTPService,
+	guardSvc service.LoginGuardService, jwtHdl ijwt.Handler, state *OAuth2State) *OAuth2Handler {
+	return &OAuth2Handler{
+		providers:  providers,
+		bindingSvc: bindingSvc,
+		Handler:    jwtHdl,
+		state:      state,
+		login:      newLoginHelper(totpSvc, guardSvc, jwtHdl),
+	}
+}
+
+func (h *OAuth2Handler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/oauth2")
+	g.GET("/:provider/authurl", ginx.WrapReq[struct{}](h.AuthURL))
+	g.Any("/:provider/callback", ginx.WrapReq[OAuth2CallbackReq](h.Callback))
+}
+
+func (h *OAuth2Handler) AuthURL(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	return oauth2AuthURL(ctx, h.providers, h.state, ctx.Param("provider"), 0)
+}
+
+// oauth2AuthURL uid 不为 0 的时候是绑定
+func oauth2AuthURL(ctx *gin.Context, providers oauth2.Providers, st *OAuth2State,
+	name string, uid int64) (ginx.Result, error) {
+	p, err := providers.Get(name)
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "不支持的登录方式",
+		}, err
+	}
+	// state 签过名，回调的时候 Uid 拿出来就能信
+	state, err := st.Set(ctx, oauth2CallbackPath(name), StateClaims{Provider: name, Uid: uid})
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	url, err := p.AuthURL(ctx.Request.Context(), state)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Data: url,
+	}, nil
+}
+
+func (h *OAuth2Handler) Callback(ctx *gin.Context, req OAuth2CallbackReq) (ginx.Result, error) {
+	name := ctx.Param("provider")
+	sc, err := h.state.Verify(ctx, oauth2CallbackPath(name), req.State)
+	if err == nil && sc.Provider != name {
+		err = errInvalidState
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "登录失败",
+		}, err
+	}
+	info, err := oauth2UserInfo(ctx, h.providers, name, req.Code, req.State)
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "授权失败",
+		}, err
+	}
+	if sc.Uid != 0 {
+		return h.link(ctx, sc.Uid, info)
+	}
+	u, err := h.bindingSvc.FindOrCreate(ctx.Request.Context(), info)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return h.login.loginOrChallenge(ctx, u.Id, "")
+}
+
+func (h *OAuth2Handler) link(ctx *gin.Context, uid int64, info domain.OAuthUserInfo) (ginx.Result, error) {
+	err := h.bindingSvc.Link(ctx.Request.Context(), uid, info)
+	switch err {
+	case nil:
+		return ginx.Result{
+			Msg: "绑定成功",
+		}, nil
+	case service.ErrOAuthAccountLinked:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "这个账号已经绑定了别的用户",
+		}, err
+	case service.ErrOAuthProviderLinked:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "已经绑定过了，请先解绑",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+func oauth2CallbackPath(provider string) string {
+	return "/oauth2/" + provider + "/callback"
+}
+
+// oauth2UserInfo 用 code 换 token，再拿用户信息，登录和绑定都要用
+func oauth2UserInfo(ctx *gin.Context, providers oauth2.Providers,
+	name string, code string, state string) (domain.OAuthUserInfo, error) {
+	p, err := providers.Get(name)
+	if err != nil {
+		return domain.OAuthUserInfo{}, err
+	}
+	token, err := p.Exchange(ctx.Request.Context(), code, state)
+	if err != nil {
+		return domain.OAuthUserInfo{}, err
+	}
+	info, err := p.UserInfo(ctx.Request.Context(), token)
+	if err != nil {
+		return domain.OAuthUserInfo{}, err
+	}
+	if info.ExternalId == "" {
+		return domain.OAuthUserInfo{}, errors.New("第三方没有返回用户 id")
+	}
+	return info, nil
+}
@@ -0,0 +1,7 @@
+package web
+
+// OAuth2CallbackReq 回调的时候 code 和 state 都在查询参数里面
+type OAuth2CallbackReq struct {
+	Code  string `form:"code"`
+	State string `form:"state"`
+}
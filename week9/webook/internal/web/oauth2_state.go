@@ -0,0 +1,71 @@
+package web
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	stateCookieName = "jwt-state"
+	// 扫码或者授权的时间，超过了要重新拿 URL
+	stateExpiration = time.Minute * 10
+)
+
+var errInvalidState = errors.New("state 不对")
+
+// OAuth2State 第三方登录的 state 签名之后放在 cookie 里面，回调的时候比对，防止 CSRF。
+// cookie 只在回调的那个路径上面带，用过一次就删掉
+type OAuth2State struct {
+	key []byte
+	// 线上是 https，cookie 要带上 Secure
+	secure bool
+}
+
+func NewOAuth2State(key []byte, secure bool) *OAuth2State {
+	return &OAuth2State{key: key, secure: secure}
+}
+
+// Set 生成一个新的 state，claims 里面的 Provider 和 Uid 会在 Verify 的时候返回
+func (s *OAuth2State) Set(ctx *gin.Context, path string, claims StateClaims) (string, error) {
+	claims.State = uuid.New().String()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(stateExpiration))
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+	ctx.SetCookie(stateCookieName, tokenStr, int(stateExpiration/time.Second),
+		path, "", s.secure, true)
+	return claims.State, nil
+}
+
+func (s *OAuth2State) Verify(ctx *gin.Context, path string, state string) (StateClaims, error) {
+	cookie, err := ctx.Cookie(stateCookieName)
+	if err != nil {
+		return StateClaims{}, errInvalidState
+	}
+	// state 只能用一次
+	ctx.SetCookie(stateCookieName, "", -1, path, "", s.secure, true)
+	var sc StateClaims
+	token, err := jwt.ParseWithClaims(cookie, &sc, func(token *jwt.Token) (interface{}, error) {
+		return s.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return StateClaims{}, errInvalidState
+	}
+	if state == "" || sc.State != state {
+		return StateClaims{}, errInvalidState
+	}
+	return sc, nil
+}
+
+type StateClaims struct {
+	jwt.RegisteredClaims
+	State string
+	// Provider 防止拿 A 的 state 去 B 的回调
+	Provider string `json:",omitempty"`
+	// Uid 绑定第三方账号的时候才有，防止绑定到别人的账号上
+	Uid int64 `json:",omitempty"`
+}
@@ -0,0 +1,149 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/internal/service/oauth2"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOAuth2Handler(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 0 是登录，不然就是这个用户在绑定
+		uid      int64
+		provider string
+		// 篡改回调请求
+		before func(req *http.Request)
+
+		wantCode   int
+		wantUid    int64
+		wantLinked int64
+	}{
+		{
+			name:     "登录成功",
+			provider: "github",
+			before:   func(req *http.Request) {},
+			wantUid:  123,
+		},
+		{
+			name:       "绑定成功",
+			uid:        456,
+			provider:   "github",
+			before:     func(req *http.Request) {},
+			wantLinked: 456,
+		},
+		{
+			name:     "state 拿到别的第三方的回调上面用",
+			provider: "github",
+			before: func(req *http.Request) {
+				req.URL.Path = "/oauth2/google/callback"
+			},
+			wantCode: 4,
+		},
+		{
+			name:     "code 不对",
+			provider: "github",
+			before: func(req *http.Request) {
+				q := req.URL.Query()
+				q.Set("code", "bad-code")
+				req.URL.RawQuery = q.Encode()
+			},
+			wantCode: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jwtHdl := &fakeJWTHandler{}
+			bindingSvc := &fakeOAuthBindingService{}
+			state := NewOAuth2State([]byte("test-key"), false)
+			providers := oauth2.NewProviders(&fakeProvider{name: "github"}, &fakeProvider{name: "google"})
+			hdl := NewOAuth2Handler(providers, bindingSvc, &fakeTOTPService{}, &fakeLoginGuardService{}, jwtHdl, state)
+			server := gin.New()
+			server.Use(func(ctx *gin.Context) {
+				ctx.Set("claims", ijwt.UserClaim{Uid: tc.uid})
+			})
+			// 微信的路由是写死的，要能和 :provider 共存
+			NewOAuth2WechatHandler(&fakeWechatService{}, &fakeUserService{}, &fakeTOTPService{}, &fakeLoginGuardService{}, jwtHdl, state).RegisterRoutes(server)
+			hdl.RegisterRoutes(server)
+			// 绑定的入口
+			NewUserHandler(&fakeUserService{}, nil, nil, &fakeLoginGuardService{}, &fakeTOTPService{}, jwtHdl, nil, bindingSvc, providers, state).RegisterRoutes(server)
+
+			recorder := httptest.NewRecorder()
+			if tc.uid == 0 {
+				server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/oauth2/"+tc.provider+"/authurl", nil))
+			} else {
+				req := httptest.NewRequest(http.MethodPost, "/users/oauth2/link_url",
+					strings.NewReader(`{"provider":"`+tc.provider+`"}`))
+				req.Header.Set("Content-Type", "application/json")
+				server.ServeHTTP(recorder, req)
+			}
+			res := decodeResult(t, recorder)
+			require.Equal(t, 0, res.Code)
+			authURL, err := url.Parse(res.Data.(string))
+			require.NoError(t, err)
+			st := authURL.Query().Get("state")
+			cookies := recorder.Result().Cookies()
+			require.Len(t, cookies, 1)
+			assert.Equal(t, "/oauth2/"+tc.provider+"/callback", cookies[0].Path)
+
+			req := httptest.NewRequest(http.MethodGet, "/oauth2/"+tc.provider+"/callback?"+
+				url.Values{"code": {"the-code"}, "state": {st}}.Encode(), nil)
+			req.AddCookie(cookies[0])
+			tc.before(req)
+			recorder = httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			res = decodeResult(t, recorder)
+			assert.Equal(t, tc.wantCode, res.Code)
+			assert.Equal(t, tc.wantUid, jwtHdl.uid)
+			assert.Equal(t, tc.wantLinked, bindingSvc.linkedUid)
+		})
+	}
+}
+
+type fakeProvider struct {
+	name string
+}
+
+func (f *fakeProvider) Name() string {
+	return f.name
+}
+
+func (f *fakeProvider) AuthURL(ctx context.Context, state string) (string, error) {
+	return "https://idp.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (f *fakeProvider) Exchange(ctx context.Context, code string, state string) (oauth2.Token, error) {
+	if code != "the-code" {
+		return oauth2.Token{}, errors.New("invalid code")
+	}
+	return oauth2.Token{AccessToken: "access-token"}, nil
+}
+
+func (f *fakeProvider) UserInfo(ctx context.Context, token oauth2.Token) (domain.OAuthUserInfo, error) {
+	return domain.OAuthUserInfo{Provider: f.name, ExternalId: "ext-id"}, nil
+}
+
+type fakeOAuthBindingService struct {
+	service.OAuthBindingService
+	linkedUid int64
+}
+
+func (f *fakeOAuthBindingService) FindOrCreate(ctx context.Context, info domain.OAuthUserInfo) (domain.User, error) {
+	return domain.User{Id: 123}, nil
+}
+
+func (f *fakeOAuthBindingService) Link(ctx context.Context, uid int64, info domain.OAuthUserInfo) error {
+	f.linkedUid = uid
+	return nil
+}
@@ -5,41 +5,59 @@ import (
 	"fmt"
 	"geekgo/week9/webook/internal/domain"
 	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/internal/service/oauth2"
 	ijwt "geekgo/week9/webook/internal/web/jwt"
 	"geekgo/week9/webook/pkgs/ginx"
-	regexp "github.com/dlclark/regexp2"
+	"geekgo/week9/webook/pkgs/ratelimit"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
+	"time"
 )
 
 type UserHandler struct {
-	svc              service.UserService
-	emailRegexExp    *regexp.Regexp
-	passwordRegexExp *regexp.Regexp
+	svc      service.UserService
+	codeSvc  service.CodeService
+	emailSvc service.UserEmailService
+	guardSvc service.LoginGuardService
+	totpSvc  service.TOTPService
+	// 发短信、发邮件这些接口按照 IP 限流，同一个手机号、同一个用户的限制在各自的 service 里面
+	limiter ratelimit.Limiter
+	// 绑定、解绑第三方账号
+	bindingSvc      service.OAuthBindingService
+	oauth2Providers oauth2.Providers
+	oauth2State     *OAuth2State
+	login           *loginHelper
 	ijwt.Handler
 }
 
 const (
-	emailRegexPattern = "^\\w+([-+.]\\w+)*@\\w+([-.]\\w+)*\\.\\w+([-.]\\w+)*$"
-	// 和上面比起来，用 ` 看起来就比较清爽
 	//passwordRegexPattern = `^(?=.*[A-Za-z])(?=.*\d)(?=.*[$@$!%*#?&])[A-Za-z\d$@$!%*#?&]{8,}$`
 	passwordRegexPattern = `^(?=.*[A-Za-z])(?=.*\d)`
+	phoneRegexPattern    = `^1[3-9]\d{9}$`
+	bizLogin             = "login"
 )
 
-func NewUserHandler(svc service.UserService, handler ijwt.Handler) *UserHandler {
+func NewUserHandler(svc service.UserService, codeSvc service.CodeService, emailSvc service.UserEmailService,
+	guardSvc service.LoginGuardService, totpSvc service.TOTPService, handler ijwt.Handler, limiter ratelimit.Limiter, bindingSvc service.OAuthBindingService,
+	oauth2Providers oauth2.Providers, oauth2State *OAuth2State) *UserHandler {
 
 	return &UserHandler{
-		svc:              svc,
-		emailRegexExp:    regexp.MustCompile(emailRegexPattern, regexp.None),
-		passwordRegexExp: regexp.MustCompile(passwordRegexPattern, regexp.None),
-		Handler:          handler,
+		svc:             svc,
+		codeSvc:         codeSvc,
+		emailSvc:        emailSvc,
+		guardSvc:        guardSvc,
+		totpSvc:         totpSvc,
+		limiter:         limiter,
+		bindingSvc:      bindingSvc,
+		oauth2Providers: oauth2Providers,
+		oauth2State:     oauth2State,
+		login:           newLoginHelper(totpSvc, guardSvc, handler),
+		Handler:         handler,
 	}
 }
 
 func (uh *UserHandler) RegisterRoutes(server *gin.Engine) {
 	g := server.Group("/users")
-	//g.POST("/signup", uh.SignUp)
 	//g.POST("/login", uh.Login)
 	//g.POST("/edit", uh.Edit)
 	//g.GET("/profile", uh.Profile)
@@ -51,45 +69,36 @@ func (uh *UserHandler) RegisterRoutes(server *gin.Engine) {
 	g.GET("/profile", ginx.WrapReq[struct{}](uh.ProfileV1))
 	//g.POST("/refresh_token", ginx.WrapReq[struct{}](uh.RefreshTokenV1))
 
-}
-func (uh *UserHandler) SignUpV1(ctx *gin.Context, req SignUpReq) (ginx.Result, error) {
+	// 手机验证码登录，没有注册过的手机号直接注册
+	g.POST("/login_sms/code/send", ginx.WrapReq[SendSMSCodeReq](uh.SendSMSLoginCodeV1))
+	g.POST("/login_sms", ginx.WrapReq[LoginSMSReq](uh.LoginSMSV1))
 
-	if req.Password != req.ConfirmPassword {
+	// 开启了两步验证的用户，输完密码之后再输验证码
+	g.POST("/login/totp", ginx.WrapReq[LoginTOTPReq](uh.LoginTOTPV1))
+	g.POST("/totp/setup", ginx.WrapReq[struct{}](uh.TOTPSetupV1))
+	g.POST("/totp/confirm", ginx.WrapReq[TOTPCodeReq](uh.TOTPConfirmV1))
+	g.POST("/totp/disable", ginx.WrapReq[TOTPCodeReq](uh.TOTPDisableV1))
 
-		return ginx.Result{
-			Code: 4,
-			Msg:  "两次密码不一致",
-		}, errors.New("两次密码不一致")
-	}
-	// 校验邮箱密码格式
-	ok, err := uh.emailRegexExp.MatchString(req.Email)
-	if err != nil {
-		return ginx.Result{
-			Code: 5,
-			Msg:  "系统错误",
-		}, errors.New("系统错误")
-	}
-	if !ok {
-		return ginx.Result{
-			Code: 4,
-			Msg:  "邮箱格式不对",
-		}, errors.New("邮箱格式不对")
-	}
-	ok, err = uh.passwordRegexExp.MatchString(req.Password)
-	if err != nil {
-		return ginx.Result{
-			Code: 5,
-			Msg:  "系统错误",
-		}, err
-	}
-	if !ok {
-		return ginx.Result{
-			Code: 4,
-			Msg:  "密码格式不对",
-		}, errors.New("密码格式不对")
-	}
+	// 验证邮箱、忘记密码
+	g.POST("/email/verify/send", ginx.WrapReq[SendVerifyEmailReq](uh.SendVerifyEmailV1))
+	g.POST("/email/verify", ginx.WrapReq[VerifyEmailReq](uh.VerifyEmailV1))
+	g.POST("/password/reset/send", ginx.WrapReq[SendResetPasswordReq](uh.SendResetPasswordV1))
+	g.POST("/password/reset", ginx.WrapReq[ResetPasswordReq](uh.ResetPasswordV1))
 
-	err = uh.svc.SignUp(ctx, domain.User{
+	// 登录设备管理
+	g.GET("/sessions", ginx.WrapReq[struct{}](uh.SessionsV1))
+	g.POST("/sessions/logout", ginx.WrapReq[LogoutSessionReq](uh.LogoutSessionV1))
+	g.POST("/sessions/logout_all", ginx.WrapReq[struct{}](uh.LogoutAllSessionsV1))
+
+	// 绑定第三方账号，授权之后在 /oauth2/:provider/callback 里面完成绑定
+	g.POST("/oauth2/link_url", ginx.WrapReq[OAuth2LinkURLReq](uh.OAuth2LinkURLV1))
+	g.POST("/oauth2/unlink", ginx.WrapReq[OAuth2UnlinkReq](uh.OAuth2UnlinkV1))
+	g.GET("/oauth2/bindings", ginx.WrapReq[struct{}](uh.OAuth2BindingsV1))
+
+}
+func (uh *UserHandler) SignUpV1(ctx *gin.Context, req SignUpReq) (ginx.Result, error) {
+	// 邮箱密码格式、两次密码是否一致，WrapReq 里面已经校验过了
+	err := uh.svc.SignUp(ctx.Request.Context(), domain.User{
 		Email:    req.Email,
 		Password: req.Password,
 	})
@@ -107,85 +116,50 @@ func (uh *UserHandler) SignUpV1(ctx *gin.Context, req SignUpReq) (ginx.Result, e
 		}, err
 
 	}
+	// 验证邮件发不出去也算注册成功，可以在登录页面重新发
+	err = uh.emailSvc.SendVerifyEmail(ctx.Request.Context(), req.Email)
 	return ginx.Result{
 		Msg: "注册成功",
-	}, nil
-}
-
-func (uh *UserHandler) SignUp(ctx *gin.Context) {
-	type SignUpReq struct {
-		Email           string `json:"email"`
-		Password        string `json:"password"`
-		ConfirmPassword string `json:"confirmPassword"`
-	}
-	var req SignUpReq
-	if err := ctx.Bind(&req); err != nil {
-		return
-	}
-
-	if req.Password != req.ConfirmPassword {
-		ctx.String(http.StatusOK, "两次密码不一致")
-	}
-	// 校验邮箱密码格式
-	ok, err := uh.emailRegexExp.MatchString(req.Email)
-	if err != nil {
-		ctx.String(http.StatusOK, "系统错误")
-		return
-	}
-	if !ok {
-		ctx.String(http.StatusOK, "邮箱格式不对")
-		return
-	}
-	ok, err = uh.passwordRegexExp.MatchString(req.Password)
-	if err != nil {
-		ctx.String(http.StatusOK, "系统错误")
-		return
-	}
-	if !ok {
-		ctx.String(http.StatusOK, "密码格式不对")
-		return
-	}
-
-	err = uh.svc.SignUp(ctx, domain.User{
-		Email:    req.Email,
-		Password: req.Password,
-	})
-	// 用户可能已经存在了
-	if err == service.ErrUserDuplicate {
-		ctx.String(http.StatusOK, "邮箱已注册")
-		return
-	}
-	if err != nil {
-		ctx.String(http.StatusOK, "系统错误")
-		return
-	}
-	ctx.String(http.StatusOK, "注册成功")
+	}, err
 }
 
 func (uh *UserHandler) LoginV1(ctx *gin.Context, req LoginReq) (ginx.Result, error) {
 
 	// 检验输入格式
 
-	u, err := uh.svc.Login(ctx, req.Email, req.Password)
+	wait, err := uh.guardSvc.Check(ctx.Request.Context(), req.Email, ctx.ClientIP())
+	if err != nil {
+		return loginLockedResult(ctx, wait, err)
+	}
+	u, err := uh.svc.Login(ctx.Request.Context(), req.Email, req.Password)
 
-	if err == service.ErrInvalidUserOrPassword {
+	switch err {
+	case nil:
+	case service.ErrInvalidUserOrPassword:
+		wait, gerr := uh.guardSvc.OnFailure(ctx.Request.Context(), req.Email, ctx.ClientIP())
+		if gerr != nil {
+			return loginLockedResult(ctx, wait, gerr)
+		}
 		return ginx.Result{
 			Code: 4,
 			Msg:  "邮箱或密码错误",
 		}, err
-
-	}
-	// 设置jwt token
-	err = uh.Handler.SetLoginToken(ctx, u.Id)
-	if err != nil {
+	case service.ErrEmailNotVerified:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "邮箱还没有验证，请先点击验证邮件里面的链接",
+		}, err
+	default:
 		return ginx.Result{
 			Code: 5,
-			Msg:  "SetLoginTokenError",
+			Msg:  "系统错误",
 		}, err
 	}
-	return ginx.Result{
-		Msg: "登录成功",
-	}, nil
+	return uh.login.loginOrChallenge(ctx, u.Id, req.Email)
+}
+
+func (uh *UserHandler) LoginTOTPV1(ctx *gin.Context, req LoginTOTPReq) (ginx.Result, error) {
+	return uh.login.completeLogin(ctx, req.PreAuthToken, req.Code)
 }
 
 func (uh *UserHandler) Login(ctx *gin.Context) {
@@ -199,7 +173,7 @@ func (uh *UserHandler) Login(ctx *gin.Context) {
 	}
 	// 检验输入格式
 
-	u, err := uh.svc.Login(ctx, req.Email, req.Password)
+	u, err := uh.svc.Login(ctx.Request.Context(), req.Email, req.Password)
 
 	if err == service.ErrInvalidUserOrPassword {
 		ctx.String(http.StatusOK, "邮箱或密码错误")
@@ -214,6 +188,161 @@ func (uh *UserHandler) Login(ctx *gin.Context) {
 
 }
 
+func (uh *UserHandler) SendSMSLoginCodeV1(ctx *gin.Context, req SendSMSCodeReq) (ginx.Result, error) {
+	if res, err := uh.limitByIP(ctx, "sms:send"); err != nil {
+		return res, err
+	}
+	err := uh.codeSvc.Send(ctx.Request.Context(), bizLogin, req.Phone)
+	switch err {
+	case nil:
+		return ginx.Result{
+			Msg: "发送成功",
+		}, nil
+	case service.ErrCodeSendTooMany:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "短信发送太频繁，请稍后再试",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+func (uh *UserHandler) LoginSMSV1(ctx *gin.Context, req LoginSMSReq) (ginx.Result, error) {
+	if res, err := uh.limitByIP(ctx, "sms:verify"); err != nil {
+		return res, err
+	}
+	ok, err := uh.codeSvc.Verify(ctx.Request.Context(), bizLogin, req.Phone, req.Code)
+	if err == service.ErrCodeVerifyTooMany {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "验证码已失效，请重新发送",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	if !ok {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "验证码有误",
+		}, errors.New("验证码有误")
+	}
+	u, err := uh.svc.FindOrCreate(ctx.Request.Context(), req.Phone)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return uh.login.loginOrChallenge(ctx, u.Id, "")
+}
+
+// limitByIP 按照 IP 限流，返回 error 说明被限流了或者限流器出错了
+func (uh *UserHandler) limitByIP(ctx *gin.Context, action string) (ginx.Result, error) {
+	limited, err := uh.limiter.Limit(ctx.Request.Context(), fmt.Sprintf("%s:%s", action, ctx.ClientIP()))
+	if err != nil {
+		// redis 出错了保守一点，当作限流，短信和邮件都是要花钱的
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	if limited {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "操作太频繁，请稍后再试",
+		}, errors.New("触发限流")
+	}
+	return ginx.Result{}, nil
+}
+
+func (uh *UserHandler) SendVerifyEmailV1(ctx *gin.Context, req SendVerifyEmailReq) (ginx.Result, error) {
+	if res, err := uh.limitByIP(ctx, "email:verify"); err != nil {
+		return res, err
+	}
+	err := uh.emailSvc.SendVerifyEmail(ctx.Request.Context(), req.Email)
+	return uh.sendEmailResult(err)
+}
+
+func (uh *UserHandler) VerifyEmailV1(ctx *gin.Context, req VerifyEmailReq) (ginx.Result, error) {
+	err := uh.emailSvc.VerifyEmail(ctx.Request.Context(), req.Token)
+	switch err {
+	case nil:
+		return ginx.Result{
+			Msg: "验证成功",
+		}, nil
+	case service.ErrInvalidUserToken:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "链接已失效，请重新发送验证邮件",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+func (uh *UserHandler) SendResetPasswordV1(ctx *gin.Context, req SendResetPasswordReq) (ginx.Result, error) {
+	if res, err := uh.limitByIP(ctx, "email:reset_password"); err != nil {
+		return res, err
+	}
+	err := uh.emailSvc.SendResetPasswordEmail(ctx.Request.Context(), req.Email)
+	return uh.sendEmailResult(err)
+}
+
+// sendEmailResult 邮箱有没有注册都是一样的提示。
+// 只有注册过的邮箱才会发送太频繁，这个时候也不能单独提示，不然就能用来判断邮箱有没有注册
+func (uh *UserHandler) sendEmailResult(err error) (ginx.Result, error) {
+	switch err {
+	case nil, service.ErrUserTokenSendTooMany:
+		return ginx.Result{
+			Msg: "如果邮箱已经注册，你会收到一封邮件",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+func (uh *UserHandler) ResetPasswordV1(ctx *gin.Context, req ResetPasswordReq) (ginx.Result, error) {
+	uid, err := uh.emailSvc.ResetPassword(ctx.Request.Context(), req.Token, req.Password)
+	switch err {
+	case nil:
+	case service.ErrInvalidUserToken:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "链接已失效，请重新发送邮件",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	// 密码可能是被别人改过的，已经登录的设备都要重新登录
+	err = uh.LogoutAllSessions(ctx.Request.Context(), uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "密码已经重置，但是退出其他设备失败",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "密码已经重置，请重新登录",
+	}, nil
+}
+
 func (uh *UserHandler) EditV1(ctx *gin.Context, req ProfileReq) (ginx.Result, error) {
 
 	// 要从登录信息头里面拿到tokenStr 然后解出UserClaim Uid
@@ -295,35 +424,278 @@ func (uh *UserHandler) Profile(ctx *gin.Context) {
 func (uh *UserHandler) RefreshToken(ctx *gin.Context) {
 	// 前端调用refresh_token路由传过来的应该是refresh_token
 	refreshToken := uh.ExtractTokenStr(ctx)
-	var rc ijwt.RefreshClaims
-	token, err := jwt.ParseWithClaims(refreshToken, &rc, func(token *jwt.Token) (interface{}, error) {
-		return ijwt.RtKey, nil
-	})
-	if err != nil || !token.Valid {
+	rc, err := uh.ParseRefreshToken(refreshToken)
+	if err != nil {
 		//zap.L().Error("系统异常", zap.Error(err))
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	err = uh.CheckSession(ctx, rc.Ssid)
+	// 长 token 只能用一次，刷新的时候长短 token 都换新的
+	err = uh.RotateRefreshToken(ctx, rc)
 	if err != nil {
 		//// 信息量不足
 		//zap.L().Error("系统异常", zap.Error(err))
-		//// 要么 redis 有问题，要么已经退出登录
+		//// 要么 redis 有问题，要么已经退出登录，要么长 token 被重复使用了
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	// 搞个新的 access_token
-	err = uh.SetJWTToken(ctx, rc.Uid, rc.Ssid)
-	if err != nil {
-		ctx.AbortWithStatus(http.StatusUnauthorized)
-		//zap.L().Error("系统异常", zap.Error(err))
-		//// 正常来说，msg 的部分就应该包含足够的定位信息
-		//zap.L().Error("ijoihpidf 设置 JWT token 出现异常",
-		//	zap.Error(err),
-		//	zap.String("method", "UserHandler:RefreshToken"))
-		return
-	}
 	ctx.JSON(http.StatusOK, Result{
 		Msg: "刷新成功",
 	})
 }
+
+// SessionsV1 列出当前用户所有登录的设备
+func (uh *UserHandler) SessionsV1(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	uc, err := getCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	sessions, err := uh.Sessions(ctx.Request.Context(), uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	vos := make([]SessionVO, 0, len(sessions))
+	for _, s := range sessions {
+		vos = append(vos, SessionVO{
+			Ssid:      s.Ssid,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Ctime:     s.Ctime.Format(time.DateTime),
+			LastSeen:  s.LastSeen.Format(time.DateTime),
+			Current:   s.Ssid == uc.Ssid,
+		})
+	}
+	return ginx.Result{
+		Data: vos,
+	}, nil
+}
+
+// LogoutSessionV1 把某个设备踢下线，也可以是当前这个设备
+func (uh *UserHandler) LogoutSessionV1(ctx *gin.Context, req LogoutSessionReq) (ginx.Result, error) {
+	uc, err := getCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = uh.LogoutSession(ctx.Request.Context(), uc.Uid, req.Ssid)
+	if err == ijwt.ErrSessionNotFound {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "设备不存在或者已经下线",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "ok",
+	}, nil
+}
+
+// LogoutAllSessionsV1 退出所有设备，包括当前这个
+func (uh *UserHandler) LogoutAllSessionsV1(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	uc, err := getCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = uh.LogoutAllSessions(ctx.Request.Context(), uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	ctx.Header("x-jwt-token", "")
+	ctx.Header("x-refresh-token", "")
+	return ginx.Result{
+		Msg: "ok",
+	}, nil
+}
+
+// OAuth2LinkURLV1 绑定第三方账号，前端跳转到返回的 URL，授权之后回调里面完成绑定
+func (uh *UserHandler) OAuth2LinkURLV1(ctx *gin.Context, req OAuth2LinkURLReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return oauth2AuthURL(ctx, uh.oauth2Providers, uh.oauth2State, req.Provider, uid)
+}
+
+func (uh *UserHandler) OAuth2UnlinkV1(ctx *gin.Context, req OAuth2UnlinkReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = uh.bindingSvc.Unlink(ctx.Request.Context(), uid, req.Provider)
+	switch err {
+	case nil:
+		return ginx.Result{
+			Msg: "解绑成功",
+		}, nil
+	case service.ErrOAuthBindingNotFound:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "没有绑定这个账号",
+		}, err
+	case service.ErrLastLoginMethod:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "解绑之后就没办法登录了，请先设置密码或者绑定手机",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+func (uh *UserHandler) OAuth2BindingsV1(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	bs, err := uh.bindingSvc.List(ctx.Request.Context(), uid)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	res := make([]OAuthBindingVO, 0, len(bs))
+	for _, b := range bs {
+		res = append(res, OAuthBindingVO{
+			Provider: b.Provider,
+			Email:    b.Email,
+			Ctime:    b.Ctime.Format(time.DateTime),
+		})
+	}
+	return ginx.Result{
+		Data: res,
+	}, nil
+}
+
+// TOTPSetupV1 返回密钥和 otpauth 链接，前端显示成二维码，扫完之后调用 confirm
+func (uh *UserHandler) TOTPSetupV1(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	secret, uri, err := uh.totpSvc.Setup(ctx.Request.Context(), uid)
+	switch err {
+	case nil:
+		return ginx.Result{
+			Data: TOTPSetupVO{
+				Secret: secret,
+				URI:    uri,
+			},
+		}, nil
+	case service.ErrTOTPEnabled:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "已经开启了两步验证，请先关闭",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+// TOTPConfirmV1 恢复码只在这里返回一次
+func (uh *UserHandler) TOTPConfirmV1(ctx *gin.Context, req TOTPCodeReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	codes, err := uh.totpSvc.Confirm(ctx.Request.Context(), uid, req.Code)
+	switch err {
+	case nil:
+		return ginx.Result{
+			Msg:  "两步验证已开启，请保存好恢复码",
+			Data: codes,
+		}, nil
+	case service.ErrInvalidTOTPCode:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "验证码不对",
+		}, err
+	case service.ErrTOTPNotEnabled:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "请先扫码",
+		}, err
+	case service.ErrTOTPEnabled:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "已经开启了两步验证",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+func (uh *UserHandler) TOTPDisableV1(ctx *gin.Context, req TOTPCodeReq) (ginx.Result, error) {
+	uid, err := getUidFromCtxClaims(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	err = uh.totpSvc.Disable(ctx.Request.Context(), uid, req.Code)
+	switch err {
+	case nil:
+		return ginx.Result{
+			Msg: "两步验证已关闭",
+		}, nil
+	case service.ErrInvalidTOTPCode:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "验证码不对",
+		}, err
+	case service.ErrTOTPNotEnabled:
+		return ginx.Result{
+			Code: 4,
+			Msg:  "没有开启两步验证",
+		}, err
+	default:
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+}
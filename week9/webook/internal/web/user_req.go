@@ -1,18 +1,77 @@
 package web
 
+// SignUpReq 密码最长 72 是 bcrypt 的限制，再长的部分会被忽略
 type SignUpReq struct {
-	Email           string `json:"email"`
-	Password        string `json:"password"`
-	ConfirmPassword string `json:"confirmPassword"`
+	Email           string `json:"email" validate:"required,email,max=128"`
+	Password        string `json:"password" validate:"required,min=8,max=72,password"`
+	ConfirmPassword string `json:"confirmPassword" validate:"eqfield=Password"`
 }
 
+// LoginReq 登录不校验密码格式，规则改了之后老用户还要能登录
 type LoginReq struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,max=128"`
+	Password string `json:"password" validate:"required,max=72"`
 }
 
+// LoginTOTPReq Code 可以是 App 上面的验证码，也可以是恢复码
+type LoginTOTPReq struct {
+	PreAuthToken string `json:"preAuthToken" validate:"required"`
+	Code         string `json:"code" validate:"required,max=32"`
+}
+
+type TOTPCodeReq struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type SendVerifyEmailReq struct {
+	Email string `json:"email" validate:"required,email,max=128"`
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type SendResetPasswordReq struct {
+	Email string `json:"email" validate:"required,email,max=128"`
+}
+
+type ResetPasswordReq struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"required,min=8,max=72,password"`
+	ConfirmPassword string `json:"confirmPassword" validate:"eqfield=Password"`
+}
+
+// ProfileReq 生日不能是将来的日期，见 birthdayValidation
 type ProfileReq struct {
-	NickName string `json:"nickname"`
-	Birthday string `json:"birthday"`
-	AboutMe  string `json:"aboutMe"`
+	NickName string `json:"nickname" validate:"max=32"`
+	Birthday string `json:"birthday" validate:"omitempty,datetime=2006-01-02,birthday"`
+	AboutMe  string `json:"aboutMe" validate:"max=1024"`
+}
+
+type LogoutSessionReq struct {
+	Ssid string `json:"ssid"`
+}
+
+type SendSMSCodeReq struct {
+	Phone string `json:"phone" validate:"required,phone"`
+}
+
+type LoginSMSReq struct {
+	Phone string `json:"phone" validate:"required,phone"`
+	Code  string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type OAuth2LinkURLReq struct {
+	Provider string `json:"provider" validate:"required"`
+}
+
+type OAuth2UnlinkReq struct {
+	Provider string `json:"provider" validate:"required"`
+}
+
+// UnlockUserReq 邮箱和 uid 至少要有一个。
+// 邮箱解锁的是密码登录，uid 解锁的是两步验证，短信和第三方登录的用户没有邮箱，只能按照 uid 解锁
+type UnlockUserReq struct {
+	Email string `json:"email" validate:"omitempty,email"`
+	Uid   int64  `json:"uid" validate:"required_without=Email"`
 }
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"encoding/json"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 只测校验不通过的情况，校验不通过的请求走不到 service
+func TestUserHandler_Validate(t *testing.T) {
+	testCases := []struct {
+		name string
+		path string
+		body string
+		lang string
+
+		wantMsg    string
+		wantFields []ginx.FieldError
+	}{
+		{
+			name:    "密码没有数字",
+			path:    "/users/signup",
+			body:    `{"email":"a@qq.com","password":"abcdefgh","confirmPassword":"abcdefgh"}`,
+			wantMsg: "password必须同时包含字母和数字",
+			wantFields: []ginx.FieldError{
+				{Field: "password", Tag: "password", Msg: "password必须同时包含字母和数字"},
+			},
+		},
+		{
+			name:    "两次密码不一致",
+			path:    "/users/password/reset",
+			body:    `{"token":"t","password":"hello123","confirmPassword":"hello1234"}`,
+			lang:    "en",
+			wantMsg: "confirmPassword must be equal to Password",
+			wantFields: []ginx.FieldError{
+				{Field: "confirmPassword", Tag: "eqfield", Msg: "confirmPassword must be equal to Password"},
+			},
+		},
+		{
+			name:    "手机号码不对",
+			path:    "/users/login_sms/code/send",
+			body:    `{"phone":"12345"}`,
+			wantMsg: "phone必须是一个有效的手机号码",
+			wantFields: []ginx.FieldError{
+				{Field: "phone", Tag: "phone", Msg: "phone必须是一个有效的手机号码"},
+			},
+		},
+		{
+			name:    "生日在将来",
+			path:    "/users/edit",
+			body:    `{"birthday":"2999-01-01"}`,
+			wantMsg: "birthday不能是将来的日期",
+			wantFields: []ginx.FieldError{
+				{Field: "birthday", Tag: "birthday", Msg: "birthday不能是将来的日期"},
+			},
+		},
+		{
+			name:    "生日在将来，英文",
+			path:    "/users/edit",
+			body:    `{"birthday":"2999-01-01"}`,
+			lang:    "en",
+			wantMsg: "birthday cannot be in the future",
+			wantFields: []ginx.FieldError{
+				{Field: "birthday", Tag: "birthday", Msg: "birthday cannot be in the future"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hdl := NewUserHandler(&fakeUserService{}, nil, nil, nil, nil, &fakeJWTHandler{}, nil, nil, nil, nil)
+			server := gin.New()
+			hdl.RegisterRoutes(server)
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tc.lang)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			var res struct {
+				Code int               `json:"code"`
+				Msg  string            `json:"msg"`
+				Data []ginx.FieldError `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+			assert.Equal(t, ginx.CodeBadRequest, res.Code)
+			assert.Equal(t, tc.wantMsg, res.Msg)
+			assert.Equal(t, tc.wantFields, res.Data)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package web
+
+type SessionVO struct {
+	Ssid      string `json:"ssid"`
+	UserAgent string `json:"userAgent"`
+	IP        string `json:"ip"`
+	Ctime     string `json:"ctime"`
+	LastSeen  string `json:"lastSeen"`
+	// 是不是发起这个请求的设备
+	Current bool `json:"current"`
+}
+
+type OAuthBindingVO struct {
+	Provider string `json:"provider"`
+	Email    string `json:"email"`
+	Ctime    string `json:"ctime"`
+}
+
+type LoginLockedVO struct {
+	// account 是账号被锁了，ip 是这个 IP 失败太多次了
+	Reason string `json:"reason"`
+	// RetryAfter 还要等多少秒
+	RetryAfter int64 `json:"retryAfter"`
+}
+
+// LoginTOTPVO 开启了两步验证，密码对了之后返回这个，带着 PreAuthToken 去输验证码
+type LoginTOTPVO struct {
+	RequireTOTP  bool   `json:"requireTotp"`
+	PreAuthToken string `json:"preAuthToken"`
+}
+
+type TOTPSetupVO struct {
+	// Secret 扫不了码的时候手动输入
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
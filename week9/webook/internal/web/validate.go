@@ -0,0 +1,48 @@
+package web
+
+import (
+	"geekgo/week9/webook/pkgs/ginx"
+	regexp "github.com/dlclark/regexp2"
+	"github.com/go-playground/validator/v10"
+	"time"
+)
+
+// 请求里面用到的自定义校验规则，路由注册之前就要注册好，所以放在 init 里面
+func init() {
+	err := ginx.RegisterValidation("password", regexValidation(passwordRegexPattern), map[string]string{
+		ginx.LocaleZH: "{0}必须同时包含字母和数字",
+		ginx.LocaleEN: "{0} must contain both letters and digits",
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = ginx.RegisterValidation("phone", regexValidation(phoneRegexPattern), map[string]string{
+		ginx.LocaleZH: "{0}必须是一个有效的手机号码",
+		ginx.LocaleEN: "{0} must be a valid phone number",
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = ginx.RegisterValidation("birthday", birthdayValidation, map[string]string{
+		ginx.LocaleZH: "{0}不能是将来的日期",
+		ginx.LocaleEN: "{0} cannot be in the future",
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// birthdayValidation 生日不能是将来的日期，格式要先用 datetime=2006-01-02 校验
+func birthdayValidation(fl validator.FieldLevel) bool {
+	birthday, err := time.Parse(time.DateOnly, fl.Field().String())
+	return err == nil && !birthday.After(time.Now())
+}
+
+// regexValidation 标准库的 regexp 不支持 (?=...)，密码的规则要用 regexp2
+func regexValidation(pattern string) validator.Func {
+	exp := regexp.MustCompile(pattern, regexp.None)
+	return func(fl validator.FieldLevel) bool {
+		ok, err := exp.MatchString(fl.Field().String())
+		return err == nil && ok
+	}
+}
@@ -1 +1,85 @@
 package web
+
+import (
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/internal/service/oauth2/wechat"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"geekgo/week9/webook/pkgs/ginx"
+	"github.com/gin-gonic/gin"
+)
+
+const wechatCallbackPath = "/oauth2/wechat/callback"
+
+// OAuth2WechatHandler 微信扫码登录
+type OAuth2WechatHandler struct {
+	svc     wechat.Service
+	userSvc service.UserService
+	ijwt.Handler
+	state *OAuth2State
+	login *loginHelper
+}
+
+func NewOAuth2WechatHandler(svc wechat.Service, userSvc service.UserService, totpSvc service.TOTPService,
+	guardSvc service.LoginGuardService, jwtHdl ijwt.Handler, state *OAuth2State) *OAuth2WechatHandler {
+	return &OAuth2WechatHandler{
+		svc:     svc,
+		userSvc: userSvc,
+		Handler: jwtHdl,
+		state:   state,
+		login:   newLoginHelper(totpSvc, guardSvc, jwtHdl),
+	}
+}
+
+func (h *OAuth2WechatHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/oauth2/wechat")
+	g.GET("/authurl", ginx.WrapReq[struct{}](h.AuthURL))
+	g.Any("/callback", ginx.WrapReq[WechatCallbackReq](h.Callback))
+}
+
+func (h *OAuth2WechatHandler) AuthURL(ctx *gin.Context, req struct{}) (ginx.Result, error) {
+	state, err := h.state.Set(ctx, wechatCallbackPath, StateClaims{Provider: "wechat"})
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	url, err := h.svc.AuthURL(ctx.Request.Context(), state)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "构造扫码登录URL失败",
+		}, err
+	}
+	return ginx.Result{
+		Data: url,
+	}, nil
+}
+
+func (h *OAuth2WechatHandler) Callback(ctx *gin.Context, req WechatCallbackReq) (ginx.Result, error) {
+	sc, err := h.state.Verify(ctx, wechatCallbackPath, req.State)
+	if err == nil && sc.Provider != "wechat" {
+		err = errInvalidState
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "登录失败",
+		}, err
+	}
+	info, err := h.svc.VerifyCode(ctx.Request.Context(), req.Code)
+	if err != nil {
+		return ginx.Result{
+			Code: 4,
+			Msg:  "授权码有误",
+		}, err
+	}
+	u, err := h.userSvc.FindOrCreateByWechat(ctx.Request.Context(), info)
+	if err != nil {
+		return ginx.Result{
+			Code: 5,
+			Msg:  "系统错误",
+		}, err
+	}
+	return h.login.loginOrChallenge(ctx, u.Id, "")
+}
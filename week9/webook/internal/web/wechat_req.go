@@ -0,0 +1,7 @@
+package web
+
+// WechatCallbackReq 微信回调的时候 code 和 state 都在查询参数里面
+type WechatCallbackReq struct {
+	Code  string `form:"code"`
+	State string `form:"state"`
+}
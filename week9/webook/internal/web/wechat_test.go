@@ -0,0 +1,150 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"geekgo/week9/webook/internal/domain"
+	"geekgo/week9/webook/internal/service"
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"geekgo/week9/webook/pkgs/ginx"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	ginx.L = logger.NewNoOpLogger()
+	ginx.InitCounter(prometheus.CounterOpts{
+		Namespace: "test",
+		Name:      "ginx_biz_code",
+	})
+	os.Exit(m.Run())
+}
+
+func TestOAuth2WechatHandler(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 篡改回调请求
+		before func(req *http.Request, state string)
+
+		wantCode int
+		wantUid  int64
+	}{
+		{
+			name:    "登录成功",
+			before:  func(req *http.Request, state string) {},
+			wantUid: 123,
+		},
+		{
+			name: "state 对不上",
+			before: func(req *http.Request, state string) {
+				req.URL.RawQuery = url.Values{"code": {"the-code"}, "state": {"other"}}.Encode()
+			},
+			wantCode: 4,
+		},
+		{
+			name: "没有 cookie",
+			before: func(req *http.Request, state string) {
+				req.Header.Del("Cookie")
+			},
+			wantCode: 4,
+		},
+		{
+			name: "cookie 被篡改",
+			before: func(req *http.Request, state string) {
+				req.Header.Set("Cookie", stateCookieName+"=forged")
+			},
+			wantCode: 4,
+		},
+		{
+			name: "code 不对",
+			before: func(req *http.Request, state string) {
+				req.URL.RawQuery = url.Values{"code": {"bad-code"}, "state": {state}}.Encode()
+			},
+			wantCode: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jwtHdl := &fakeJWTHandler{}
+			hdl := NewOAuth2WechatHandler(&fakeWechatService{}, &fakeUserService{}, &fakeTOTPService{}, &fakeLoginGuardService{}, jwtHdl,
+				NewOAuth2State([]byte("test-key"), false))
+			server := gin.New()
+			hdl.RegisterRoutes(server)
+
+			// 先拿扫码的 URL
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/oauth2/wechat/authurl", nil))
+			res := decodeResult(t, recorder)
+			require.Equal(t, 0, res.Code)
+			authURL, err := url.Parse(res.Data.(string))
+			require.NoError(t, err)
+			state := authURL.Query().Get("state")
+			require.NotEmpty(t, state)
+			cookies := recorder.Result().Cookies()
+			require.Len(t, cookies, 1)
+			assert.Equal(t, "/oauth2/wechat/callback", cookies[0].Path)
+			assert.True(t, cookies[0].HttpOnly)
+
+			// 微信回调
+			req := httptest.NewRequest(http.MethodGet, "/oauth2/wechat/callback?"+
+				url.Values{"code": {"the-code"}, "state": {state}}.Encode(), nil)
+			req.AddCookie(cookies[0])
+			tc.before(req, state)
+			recorder = httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			res = decodeResult(t, recorder)
+			assert.Equal(t, tc.wantCode, res.Code)
+			assert.Equal(t, tc.wantUid, jwtHdl.uid)
+		})
+	}
+}
+
+func decodeResult(t *testing.T, recorder *httptest.ResponseRecorder) ginx.Result {
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var res ginx.Result
+	err := json.NewDecoder(recorder.Body).Decode(&res)
+	require.NoError(t, err)
+	return res
+}
+
+type fakeWechatService struct {
+}
+
+func (f *fakeWechatService) AuthURL(ctx context.Context, state string) (string, error) {
+	return "https://open.weixin.qq.com/connect/qrconnect?state=" + url.QueryEscape(state), nil
+}
+
+func (f *fakeWechatService) VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error) {
+	if code != "the-code" {
+		return domain.WechatInfo{}, errors.New("invalid code")
+	}
+	return domain.WechatInfo{OpenId: "openid"}, nil
+}
+
+type fakeUserService struct {
+	service.UserService
+}
+
+func (f *fakeUserService) FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error) {
+	return domain.User{Id: 123, WechatInfo: info}, nil
+}
+
+type fakeJWTHandler struct {
+	ijwt.Handler
+	uid int64
+}
+
+func (f *fakeJWTHandler) SetLoginToken(ctx *gin.Context, uid int64) error {
+	f.uid = uid
+	return nil
+}
@@ -0,0 +1,19 @@
+package ioc
+
+import (
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/internal/web"
+	"github.com/spf13/viper"
+)
+
+func InitAdminHandler(guardSvc service.LoginGuardService) *web.AdminHandler {
+	type Config struct {
+		Uids []int64 `yaml:"uids"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("admin", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return web.NewAdminHandler(guardSvc, cfg.Uids)
+}
@@ -0,0 +1,56 @@
+package ioc
+
+import (
+	"geekgo/week9/webook/internal/repository/dao"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+type articleConfig struct {
+	Storage string `yaml:"storage"`
+}
+
+func loadArticleConfig() articleConfig {
+	cfg := articleConfig{
+		Storage: "mysql",
+	}
+	err := viper.UnmarshalKey("article", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// InitArticleDAO 根据配置决定文章存在哪里
+// mysql: 制作库和线上库都在 MySQL
+// mongodb: 制作库和线上库都在 MongoDB，定时发表和热榜不可用，见 InitArticleScheduleDAO 和 InitRankingDAO
+// s3: 线上库的内容在对象存储，其余的在 MySQL，对象存储的配置见 InitOSS
+func InitArticleDAO(db *gorm.DB, l logger.LoggerV1) dao.ArticleDAO {
+	cfg := loadArticleConfig()
+	switch cfg.Storage {
+	case "mongodb":
+		return dao.NewMongoDBArticleDAO(InitMongoDB(), InitSnowflakeNode())
+	case "s3":
+		return dao.NewS3ArticleDAO(InitOSS(), loadOSSConfig().Bucket, db, l)
+	default:
+		return dao.NewGORMArticleDAO(db)
+	}
+}
+
+// InitArticleScheduleDAO 定时发表直接操作 MySQL 的 articles 表，文章存在 MongoDB 的时候不可用，
+// 接口返回暂不支持，后台任务启动之后就退出
+func InitArticleScheduleDAO(db *gorm.DB) dao.ArticleScheduleDAO {
+	if loadArticleConfig().Storage == "mongodb" {
+		return dao.NewUnsupportedArticleScheduleDAO()
+	}
+	return dao.NewGORMArticleScheduleDAO(db)
+}
+
+// InitRankingDAO 热榜直接查 MySQL 的 published_articles 表，文章存在 MongoDB 的时候不可用
+func InitRankingDAO(db *gorm.DB) dao.RankingDAO {
+	if loadArticleConfig().Storage == "mongodb" {
+		return dao.NewUnsupportedRankingDAO()
+	}
+	return dao.NewGORMRankingDAO(db)
+}
@@ -15,6 +15,7 @@ func InitDB() *gorm.DB {
 	err = dao.InitTable(db)
 
 	db.Use(gormx.NewPlugin())
+	db.Use(gormx.NewOTELPlugin())
 
 	if err != nil {
 		panic(err)
@@ -0,0 +1,58 @@
+package ioc
+
+import (
+	"geekgo/week9/webook/internal/repository"
+	"geekgo/week9/webook/internal/service"
+	"geekgo/week9/webook/internal/service/email"
+	"geekgo/week9/webook/internal/service/email/memory"
+	"geekgo/week9/webook/internal/service/email/smtp"
+	"github.com/spf13/viper"
+)
+
+// InitEmailSender 没有配置 smtp 的时候用 memory，邮件打印在控制台
+func InitEmailSender() email.Sender {
+	type Config struct {
+		Addr     string `yaml:"addr"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		From     string `yaml:"from"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("email.smtp", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if cfg.Addr == "" {
+		return memory.NewSender()
+	}
+	sender, err := smtp.NewSender(smtp.Config{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return sender
+}
+
+func InitUserEmailService(repo repository.UserRepository, tokenRepo repository.UserTokenRepository,
+	sender email.Sender) service.UserEmailService {
+	type Config struct {
+		// 给邮件里面的 token 签名用的
+		TokenKey         secretConfig `yaml:"tokenKey"`
+		VerifyURL        string       `yaml:"verifyURL"`
+		ResetPasswordURL string       `yaml:"resetPasswordURL"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("email", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return service.NewUserEmailService(repo, tokenRepo, sender, service.UserEmailConfig{
+		Key:              loadSecret("email.tokenKey", cfg.TokenKey),
+		VerifyURL:        cfg.VerifyURL,
+		ResetPasswordURL: cfg.ResetPasswordURL,
+	})
+}
@@ -0,0 +1,79 @@
+package ioc
+
+import (
+	ijwt "geekgo/week9/webook/internal/web/jwt"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"os"
+	"time"
+)
+
+func InitJWTHandler(cmd redis.Cmdable, keys ijwt.KeyProvider) ijwt.Handler {
+	type Config struct {
+		// 同时在线的设备上限，超过了踢掉最早登录的，0 表示不限制
+		MaxSessions int `yaml:"maxSessions"`
+	}
+	cfg := Config{
+		MaxSessions: 5,
+	}
+	err := viper.UnmarshalKey("session", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return ijwt.NewRedisJWT(cmd, keys, cfg.MaxSessions)
+}
+
+// InitJWTKeyProvider 私钥不能提交到 git 里面。
+// 线上用环境变量或者挂载进来的文件，开发环境第一次启动的时候生成一个
+func InitJWTKeyProvider() ijwt.KeyProvider {
+	type KeyConfig struct {
+		Kid  string `yaml:"kid"`
+		File string `yaml:"file"`
+		PEM  string `yaml:"pem"`
+		// Env 环境变量的名字，里面放 PEM，优先级在 PEM 和 File 之间
+		Env string `yaml:"env"`
+		// Generate File 不存在的时候生成一个新的，只在开发环境打开
+		Generate bool `yaml:"generate"`
+		// RFC3339 格式，轮换下来的旧 key 过了这个时间就不再接受
+		RetireAt string `yaml:"retireAt"`
+	}
+	type Config struct {
+		SigningKid string      `yaml:"signingKid"`
+		Keys       []KeyConfig `yaml:"keys"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("jwt", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	keys := make([]*ijwt.Key, 0, len(cfg.Keys))
+	for _, kc := range cfg.Keys {
+		var retireAt time.Time
+		if kc.RetireAt != "" {
+			retireAt, err = time.Parse(time.RFC3339, kc.RetireAt)
+			if err != nil {
+				panic(err)
+			}
+		}
+		var key *ijwt.Key
+		switch {
+		case kc.PEM != "":
+			key, err = ijwt.ParsePEMKey(kc.Kid, []byte(kc.PEM), retireAt)
+		case kc.Env != "" && os.Getenv(kc.Env) != "":
+			key, err = ijwt.ParsePEMKey(kc.Kid, []byte(os.Getenv(kc.Env)), retireAt)
+		case kc.Generate:
+			key, err = ijwt.LoadOrGenerateKeyFile(kc.Kid, kc.File, retireAt)
+		default:
+			key, err = ijwt.LoadKeyFile(kc.Kid, kc.File, retireAt)
+		}
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, key)
+	}
+	p, err := ijwt.NewStaticKeyProvider(cfg.SigningKid, keys...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
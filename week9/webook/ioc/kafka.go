@@ -2,6 +2,7 @@ package ioc
 
 import (
 	events "geekgo/week9/webook/internal/events/article"
+	"geekgo/week9/webook/pkgs/saramax"
 	"github.com/IBM/sarama"
 )
 
@@ -25,6 +26,11 @@ func NewSyncProducer(client sarama.Client) sarama.SyncProducer {
 	return res
 }
 
+// NewDeadLetterProducer 消费失败的消息转发到 <topic>_dlq，和业务共用一个 producer
+func NewDeadLetterProducer(producer sarama.SyncProducer) *saramax.DeadLetterProducer {
+	return saramax.NewDeadLetterProducer(producer)
+}
+
 // NewConsumers 面临的问题依旧是所有的 Consumer 在这里注册一下
 func NewConsumers(c1 *events.InteractiveReadEventConsumer) []events.Consumer {
 	return []events.Consumer{c1}
@@ -0,0 +1,83 @@
+package ioc
+
+import (
+	"fmt"
+	"geekgo/week9/webook/internal/service/oauth2"
+	"geekgo/week9/webook/internal/web"
+	"github.com/spf13/viper"
+	"net/http"
+	"time"
+)
+
+func InitOAuth2State() *web.OAuth2State {
+	type Config struct {
+		// 给 state cookie 签名用的
+		StateKey secretConfig `yaml:"stateKey"`
+		Secure   bool         `yaml:"secure"`
+	}
+	// 以前只有微信登录，配置在 wechat 下面，老的配置文件还能用
+	key := "oauth2"
+	if !viper.IsSet("oauth2.stateKey") {
+		key = "wechat"
+	}
+	var cfg Config
+	err := viper.UnmarshalKey(key, &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return web.NewOAuth2State(loadSecret(key+".stateKey", cfg.StateKey), cfg.Secure)
+}
+
+// InitOAuth2Providers 按照配置创建 GitHub 和 OIDC 的第三方登录，一个都没有配置也可以
+func InitOAuth2Providers() oauth2.Providers {
+	type ProviderConfig struct {
+		// 路由里面的 :provider
+		Name string `yaml:"name"`
+		// github 或者 oidc
+		Type         string `yaml:"type"`
+		ClientId     string `yaml:"clientId"`
+		ClientSecret string `yaml:"clientSecret"`
+		RedirectURL  string `yaml:"redirectURL"`
+		// 只有 oidc 需要
+		Issuer string   `yaml:"issuer"`
+		Scopes []string `yaml:"scopes"`
+	}
+	var cfgs []ProviderConfig
+	err := viper.UnmarshalKey("oauth2.providers", &cfgs)
+	if err != nil {
+		panic(err)
+	}
+	client := &http.Client{
+		Timeout: time.Second * 3,
+	}
+	ps := make([]oauth2.Provider, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		// 微信有自己的路由
+		if cfg.Name == "" || cfg.Name == "wechat" {
+			panic(fmt.Sprintf("oauth2 第三方登录的名字不能是 %q", cfg.Name))
+		}
+		switch cfg.Type {
+		case "github":
+			if cfg.Name != "github" {
+				panic("oauth2 github 的名字只能是 github")
+			}
+			ps = append(ps, oauth2.NewGitHubProvider(cfg.ClientId, cfg.ClientSecret, cfg.RedirectURL, client))
+		case "oidc":
+			ps = append(ps, oauth2.NewOIDCProvider(oauth2.OIDCConfig{
+				Name:         cfg.Name,
+				Issuer:       cfg.Issuer,
+				ClientId:     cfg.ClientId,
+				ClientSecret: cfg.ClientSecret,
+				RedirectURL:  cfg.RedirectURL,
+				Scopes:       cfg.Scopes,
+			}, client))
+		default:
+			panic(fmt.Sprintf("oauth2 %s 不支持的类型 %s", cfg.Name, cfg.Type))
+		}
+	}
+	res := oauth2.NewProviders(ps...)
+	if len(res) != len(ps) {
+		panic("oauth2 第三方登录的名字重复了")
+	}
+	return res
+}
@@ -0,0 +1,56 @@
+package ioc
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/viper"
+)
+
+type ossConfig struct {
+	// Endpoint 为空就用 AWS 自己的地址，minio 之类兼容 S3 协议的要配置
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// AccessKeyId 和 SecretAccessKey 不配置的时候走 AWS SDK 默认的方式，
+	// 比如 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY 环境变量，线上不要写在配置文件里面
+	AccessKeyId     string `yaml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	// PathStyle minio 要用 http://endpoint/bucket/key 这种路径
+	PathStyle  bool `yaml:"pathStyle"`
+	DisableSSL bool `yaml:"disableSSL"`
+}
+
+func loadOSSConfig() ossConfig {
+	cfg := ossConfig{
+		Region: "us-east-1",
+		Bucket: "webook-articles",
+	}
+	err := viper.UnmarshalKey("oss", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// InitOSS 兼容 S3 协议的对象存储，本地用 docker-compose 里面的 minio
+func InitOSS() *s3.S3 {
+	cfg := loadOSSConfig()
+	awsCfg := &aws.Config{
+		Region:           aws.String(cfg.Region),
+		S3ForcePathStyle: aws.Bool(cfg.PathStyle),
+		DisableSSL:       aws.Bool(cfg.DisableSSL),
+	}
+	if cfg.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+	}
+	if cfg.AccessKeyId != "" {
+		awsCfg.Credentials = credentials.NewStaticCredentials(cfg.AccessKeyId, cfg.SecretAccessKey, "")
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		panic(err)
+	}
+	return s3.New(sess)
+}
@@ -1 +1,42 @@
 package ioc
+
+import (
+	"context"
+	"geekgo/week9/webook/pkgs/otelx"
+	"github.com/spf13/viper"
+)
+
+// InitOTEL 初始化全局的 TracerProvider，返回的函数在退出的时候调用，把还没有上报的 span 发出去
+func InitOTEL() func(ctx context.Context) {
+	type Config struct {
+		ServiceName string `yaml:"serviceName"`
+		// none、stdout、otlp 或者 memory
+		Exporter string `yaml:"exporter"`
+		Endpoint string `yaml:"endpoint"`
+		Insecure bool   `yaml:"insecure"`
+		// 采样率，0 到 1
+		SampleRatio float64 `yaml:"sampleRatio"`
+	}
+	cfg := Config{
+		ServiceName: "webook",
+		Exporter:    otelx.ExporterNone,
+		SampleRatio: 1,
+	}
+	err := viper.UnmarshalKey("otel", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	tracing, err := otelx.Setup(otelx.Config{
+		ServiceName: cfg.ServiceName,
+		Exporter:    cfg.Exporter,
+		Endpoint:    cfg.Endpoint,
+		Insecure:    cfg.Insecure,
+		SampleRatio: cfg.SampleRatio,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return func(ctx context.Context) {
+		_ = tracing.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,75 @@
+package ioc
+
+import (
+	"fmt"
+	"geekgo/week9/webook/internal/web/middleware"
+	"geekgo/week9/webook/pkgs/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"time"
+)
+
+// InitRateLimitMiddleware 按照配置里面的规则给路由限流，
+// redis 挂了之后降级成单机限流，阈值还是用配置里面的，相当于放大了实例个数倍
+func InitRateLimitMiddleware(cmd redis.Cmdable) gin.HandlerFunc {
+	type RuleConfig struct {
+		Method string `yaml:"method"`
+		Path   string `yaml:"path"`
+		// ip 或者 uid
+		Key string `yaml:"key"`
+		// slidingWindow 或者 tokenBucket
+		Algorithm string        `yaml:"algorithm"`
+		Interval  time.Duration `yaml:"interval"`
+		Rate      int           `yaml:"rate"`
+		// 令牌桶的容量，不配置就和 rate 一样
+		Capacity int `yaml:"capacity"`
+	}
+	type Config struct {
+		// redis 出错之后多久不再请求 redis
+		FallbackCooldown time.Duration `yaml:"fallbackCooldown"`
+		Rules            []RuleConfig  `yaml:"rules"`
+	}
+	cfg := Config{
+		FallbackCooldown: time.Second * 5,
+	}
+	err := viper.UnmarshalKey("ratelimit", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	builder := middleware.NewRateLimitMiddlewareBuilder("ratelimit")
+	for _, rule := range cfg.Rules {
+		if rule.Interval <= 0 || rule.Rate <= 0 {
+			panic(fmt.Errorf("限流规则 %s %s 的 interval 和 rate 必须大于 0", rule.Method, rule.Path))
+		}
+		var key middleware.RateLimitKeyFunc
+		switch rule.Key {
+		case "ip", "":
+			key = middleware.RateLimitKeyByIP
+		case "uid":
+			key = middleware.RateLimitKeyByUid
+		default:
+			panic(fmt.Errorf("限流规则 %s %s 不支持的 key %s", rule.Method, rule.Path, rule.Key))
+		}
+		var primary, backup ratelimit.QuotaLimiter
+		switch rule.Algorithm {
+		case "slidingWindow", "":
+			primary = ratelimit.NewRedisSlidingWindowLimiter(cmd, rule.Interval, rule.Rate)
+			backup = ratelimit.NewLocalSlidingWindowLimiter(rule.Interval, rule.Rate)
+		case "tokenBucket":
+			if rule.Capacity <= 0 {
+				rule.Capacity = rule.Rate
+			}
+			primary = ratelimit.NewRedisTokenBucketLimiter(cmd, rule.Interval, rule.Rate, rule.Capacity)
+			backup = ratelimit.NewLocalTokenBucketLimiter(rule.Interval, rule.Rate, rule.Capacity)
+		default:
+			panic(fmt.Errorf("限流规则 %s %s 不支持的算法 %s", rule.Method, rule.Path, rule.Algorithm))
+		}
+		method := rule.Method
+		if method == "" {
+			method = "*"
+		}
+		builder.Route(method, rule.Path, ratelimit.NewFallbackLimiter(primary, backup, cfg.FallbackCooldown), key)
+	}
+	return builder.Build()
+}
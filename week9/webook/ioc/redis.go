@@ -1,10 +1,14 @@
 package ioc
 
-import "github.com/redis/go-redis/v9"
+import (
+	"geekgo/week9/webook/pkgs/redisx"
+	"github.com/redis/go-redis/v9"
+)
 
 func InitRedis() redis.Cmdable {
 	client := redis.NewClient(&redis.Options{
 		Addr: "localhost:6379",
 	})
+	client.AddHook(redisx.NewOTELHook())
 	return client
 }
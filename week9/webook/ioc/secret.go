@@ -0,0 +1,69 @@
+package ioc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// secretConfig 和 jwt 的私钥一样，对称密钥也不能提交到 git 里面。
+// 线上用 Env 指定的环境变量，或者 File 指向挂载进来的文件，开发环境打开 Generate，第一次启动的时候生成一个
+type secretConfig struct {
+	// Env 环境变量的名字，设置了就优先用它
+	Env  string `yaml:"env"`
+	File string `yaml:"file"`
+	// Generate File 不存在的时候生成一个新的，只在开发环境打开
+	Generate bool `yaml:"generate"`
+}
+
+// loadSecret name 是配置项的名字，只用在报错信息里面
+func loadSecret(name string, cfg secretConfig) []byte {
+	if cfg.Env != "" {
+		if val := os.Getenv(cfg.Env); val != "" {
+			return []byte(val)
+		}
+	}
+	if cfg.File == "" {
+		panic(fmt.Sprintf("%s 没有配置，要设置环境变量 %s 或者配置 file", name, cfg.Env))
+	}
+	key, err := loadOrGenerateSecretFile(cfg.File, cfg.Generate)
+	if err != nil {
+		panic(fmt.Errorf("加载 %s 失败: %w", name, err))
+	}
+	return key
+}
+
+func loadOrGenerateSecretFile(path string, generate bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil || !generate || !errors.Is(err, os.ErrNotExist) {
+		return bytes.TrimSpace(data), err
+	}
+	buf := make([]byte, 24)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	// 编码成 32 个字符，和以前写在配置文件里面的长度一样
+	data = []byte(base64.RawURLEncoding.EncodeToString(buf))
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, err
+	}
+	// O_EXCL 多个进程同时启动的时候，只有一个能写成功，其它的读它写的
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return loadOrGenerateSecretFile(path, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return data, err
+}
@@ -0,0 +1,19 @@
+package ioc
+
+import (
+	"geekgo/week9/webook/internal/service/sms"
+	"geekgo/week9/webook/internal/service/sms/memory"
+	"geekgo/week9/webook/pkgs/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+func InitSMSService() sms.Service {
+	// 换成真正的供应商的时候改这里
+	return memory.NewService()
+}
+
+// InitSMSLimiter 同一个 IP 一分钟之内最多调用 10 次发送或者校验验证码
+func InitSMSLimiter(cmd redis.Cmdable) ratelimit.Limiter {
+	return ratelimit.NewRedisSlidingWindowLimiter(cmd, time.Minute, 10)
+}
@@ -0,0 +1,77 @@
+package ioc
+
+import (
+	"geekgo/week9/webook/internal/repository"
+	"geekgo/week9/webook/internal/repository/cache"
+	"geekgo/week9/webook/internal/service"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"time"
+)
+
+func InitUserService(repo repository.UserRepository) service.UserService {
+	type Config struct {
+		// 打开之前要确认老用户都验证过邮箱了，不然他们就登录不了了
+		RequireEmailVerified bool `yaml:"requireEmailVerified"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("user", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return service.NewUserService(repo, cfg.RequireEmailVerified)
+}
+
+func InitLoginFailureCache(cmd redis.Cmdable) cache.LoginFailureCache {
+	type Config struct {
+		Window           time.Duration `yaml:"window"`
+		AccountThreshold int           `yaml:"accountThreshold"`
+		IPThreshold      int           `yaml:"ipThreshold"`
+		BaseLock         time.Duration `yaml:"baseLock"`
+		MaxLock          time.Duration `yaml:"maxLock"`
+		LevelTTL         time.Duration `yaml:"levelTTL"`
+	}
+	cfg := Config{
+		Window:           time.Minute * 15,
+		AccountThreshold: 5,
+		IPThreshold:      50,
+		BaseLock:         time.Minute,
+		MaxLock:          time.Hour,
+		LevelTTL:         time.Hour * 24,
+	}
+	err := viper.UnmarshalKey("login.lock", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cache.NewRedisLoginFailureCache(cmd, cache.LoginLockConfig{
+		Window:           cfg.Window,
+		AccountThreshold: cfg.AccountThreshold,
+		IPThreshold:      cfg.IPThreshold,
+		BaseLock:         cfg.BaseLock,
+		MaxLock:          cfg.MaxLock,
+		LevelTTL:         cfg.LevelTTL,
+	})
+}
+
+func InitTOTPService(repo repository.TOTPRepository, userRepo repository.UserRepository) service.TOTPService {
+	type Config struct {
+		Issuer string `yaml:"issuer"`
+		// 加密数据库里面的密钥，换了之后已经开启的两步验证就都用不了了
+		SecretKey secretConfig `yaml:"secretKey"`
+	}
+	cfg := Config{
+		Issuer: "webook",
+	}
+	err := viper.UnmarshalKey("totp", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	svc, err := service.NewTOTPService(repo, userRepo, service.TOTPConfig{
+		Issuer: cfg.Issuer,
+		Key:    loadSecret("totp.secretKey", cfg.SecretKey),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return svc
+}
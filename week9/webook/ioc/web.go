@@ -1,34 +1,85 @@
 package ioc
 
 import (
+	"geekgo/week9/webook/internal/service/oauth2"
 	"geekgo/week9/webook/internal/web"
 	ijwt "geekgo/week9/webook/internal/web/jwt"
 	"geekgo/week9/webook/internal/web/middleware"
 	"geekgo/week9/webook/pkgs/ginx/metrics"
+	"geekgo/week9/webook/pkgs/ginx/trace"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
 )
 
-func InitWebServer(mdls []gin.HandlerFunc, userHdl *web.UserHandler, artHdl *web.ArticleHandler) *gin.Engine {
+func InitWebServer(mdls []gin.HandlerFunc, userHdl *web.UserHandler, artHdl *web.ArticleHandler,
+	colHdl *web.CollectionHandler, jwksHdl *web.JWKSHandler, wechatHdl *web.OAuth2WechatHandler,
+	oauth2Hdl *web.OAuth2Handler, adminHdl *web.AdminHandler) *gin.Engine {
 	server := gin.Default()
+	initClientIP(server)
 	server.Use(mdls...)
 	userHdl.RegisterRoutes(server)
 	artHdl.RegisterRoutes(server)
+	colHdl.RegisterRoutes(server)
+	jwksHdl.RegisterRoutes(server)
+	wechatHdl.RegisterRoutes(server)
+	oauth2Hdl.RegisterRoutes(server)
+	adminHdl.RegisterRoutes(server)
 	return server
 }
 
-func InitMiddlewares(cmd redis.Cmdable, jwtHdl ijwt.Handler) []gin.HandlerFunc {
+func InitMiddlewares(cmd redis.Cmdable, jwtHdl ijwt.Handler, providers oauth2.Providers) []gin.HandlerFunc {
+	loginBuilder := middleware.NewLoginJWTMiddlewareBuilder(jwtHdl)
+	// 第三方登录的路由是按照配置注册的
+	for name := range providers {
+		loginBuilder.IgnorePath("/oauth2/" + name + "/authurl").
+			IgnorePath("/oauth2/" + name + "/callback")
+	}
 	return []gin.HandlerFunc{
-		middleware.NewLoginJWTMiddlewareBuilder(jwtHdl).
+		// 放在最前面，登录校验和限流也算在请求的 span 里面
+		trace.NewMiddlewareBuilder().Build(),
+		// 放在登录校验和限流前面，401 和 429 也要统计进来
+		metrics.NewMiddlewareBuilder("week9", "webook", "ginx_http", "ginx_metrics", "1").Build(),
+		loginBuilder.
 			IgnorePath("/users/signup").
 			IgnorePath("/users/refresh_token").
 			IgnorePath("/users/login_sms/code/send").
 			IgnorePath("/users/login_sms").
+			IgnorePath("/users/email/verify/send").
+			IgnorePath("/users/email/verify").
+			IgnorePath("/users/password/reset/send").
+			IgnorePath("/users/password/reset").
 			IgnorePath("/oauth2/wechat/authurl").
 			IgnorePath("/oauth2/wechat/callback").
 			IgnorePath("/users/login").
+			IgnorePath("/users/login/totp").
 			IgnorePath("/test/metric").
+			IgnorePath("/.well-known/jwks.json").
 			Build(),
-		metrics.NewMiddlewareBuilder("week9", "webook", "ginx_http", "ginx_metrics", "1").Build(),
+		// 放在登录校验后面，才能按照 uid 限流
+		InitRateLimitMiddleware(cmd),
+	}
+}
+
+// initClientIP 限流、登录失败锁定都是按照 ctx.ClientIP() 来的。
+// gin 默认谁的 X-Forwarded-For 都信，客户端每次换一个就能绕过去，所以只信配置里面的代理
+func initClientIP(server *gin.Engine) {
+	type Config struct {
+		// 前面的 nginx、负载均衡的地址或者网段，不配置就是直接用连接的地址
+		TrustedProxies []string `yaml:"trustedProxies"`
+		// 代理用来传客户端 IP 的头，从右往左找第一个不是代理的
+		RemoteIPHeaders []string `yaml:"remoteIPHeaders"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("web", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	err = server.SetTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	if len(cfg.RemoteIPHeaders) > 0 {
+		server.RemoteIPHeaders = cfg.RemoteIPHeaders
 	}
 }
@@ -0,0 +1,25 @@
+package ioc
+
+import (
+	"geekgo/week9/webook/internal/service/oauth2/wechat"
+	"github.com/spf13/viper"
+	"net/http"
+	"time"
+)
+
+func InitWechatService() wechat.Service {
+	type Config struct {
+		AppId     string `yaml:"appId"`
+		AppSecret string `yaml:"appSecret"`
+		// 要和微信开放平台上面配置的授权回调域一致
+		RedirectURL string `yaml:"redirectURL"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("wechat", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return wechat.NewService(cfg.AppId, cfg.AppSecret, cfg.RedirectURL, &http.Client{
+		Timeout: time.Second * 3,
+	})
+}
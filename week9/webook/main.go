@@ -1,13 +1,26 @@
 package main
 
-import "geekgo/week9/webook/ioc"
+import (
+	"context"
+	"geekgo/week9/webook/ioc"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"time"
+)
 
 func main() {
+	initViper()
 	//server := InitServer()
 	//server.Run(":8080")
 	ioc.InitPrometheus()
 	ioc.InitGinPrometheus()
 	ioc.InitKafkaPromethues()
+	shutdown := ioc.InitOTEL()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		shutdown(ctx)
+	}()
 
 	app := InitServer()
 	for _, c := range app.consumers {
@@ -16,7 +29,25 @@ func main() {
 			panic(err)
 		}
 	}
+	err := app.publisher.Start()
+	if err != nil {
+		panic(err)
+	}
+	err = app.ranking.Start()
+	if err != nil {
+		panic(err)
+	}
 
 	app.web.Run(":8080")
 
 }
+
+func initViper() {
+	cfile := pflag.String("config", "config/dev.yaml", "配置文件路径")
+	pflag.Parse()
+	viper.SetConfigFile(*cfile)
+	err := viper.ReadInConfig()
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,125 @@
+package ginx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+// 通用的业务错误码，和 Result.Code 的约定一致：4 是客户端的问题，5 是系统的问题。
+// 没登录、没权限、限流之类的只用 HTTP 状态码区分，业务错误码还是 4
+const (
+	CodeOK         = 0
+	CodeBadRequest = 4
+	CodeSystem     = 5
+)
+
+var (
+	ErrBadRequest   = NewError(http.StatusBadRequest, CodeBadRequest, "参数错误")
+	ErrUnauthorized = NewError(http.StatusUnauthorized, CodeBadRequest, "请先登录")
+	ErrForbidden    = NewError(http.StatusForbidden, CodeBadRequest, "没有权限")
+	ErrTooManyReqs  = NewError(http.StatusTooManyRequests, CodeBadRequest, "请求太频繁，请稍后再试")
+	ErrSystem       = NewError(http.StatusInternalServerError, CodeSystem, "系统错误")
+)
+
+// Error handler 可以直接返回这个，WrapReq 会按照里面的 HTTP 状态码和业务错误码返回。
+// Msg 是给用户看的，Cause 是真正的原因，只打日志，不会返回给前端
+type Error struct {
+	Code   int
+	Status int
+	Msg    string
+	// Data 比如校验失败的字段
+	Data  any
+	Cause error
+}
+
+func NewError(status int, code int, msg string) *Error {
+	return &Error{
+		Code:   code,
+		Status: status,
+		Msg:    msg,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Cause == nil {
+		return fmt.Sprintf("code: %d, msg: %s", e.Code, e.Msg)
+	}
+	return fmt.Sprintf("code: %d, msg: %s, cause: %s", e.Code, e.Msg, e.Cause)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is 只比较错误码和状态码，这样 errors.Is(err, ginx.ErrSystem) 不受 Cause 影响
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Code == t.Code && e.Status == t.Status
+}
+
+// Wrap 复制一份再带上原因，预定义的错误不会被改掉
+func (e *Error) Wrap(cause error) *Error {
+	res := *e
+	res.Cause = cause
+	return &res
+}
+
+func (e *Error) WithMsg(msg string) *Error {
+	res := *e
+	res.Msg = msg
+	return &res
+}
+
+func (e *Error) WithData(data any) *Error {
+	res := *e
+	res.Data = data
+	return &res
+}
+
+func (e *Error) Result() Result {
+	return Result{
+		Code: e.Code,
+		Msg:  e.Msg,
+		Data: e.Data,
+	}
+}
+
+// FieldError 参数校验失败的字段
+type FieldError struct {
+	Field string `json:"field"`
+	// Tag 没通过的校验规则，比如 required
+	Tag string `json:"tag"`
+	Msg string `json:"msg"`
+}
+
+// BindError 把 Bind 返回的错误转成 400，gin 自带的 binding 校验失败的时候带上每个字段的原因。
+// 推荐用 validate tag，提示会按照语言翻译好，见 validateReq
+func BindError(err error) *Error {
+	var ves validator.ValidationErrors
+	if errors.As(err, &ves) {
+		fields := make(FieldErrors, 0, len(ves))
+		for _, fe := range ves {
+			fields = append(fields, FieldError{
+				Field: fe.Field(),
+				Tag:   fe.Tag(),
+				Msg:   fmt.Sprintf("%s 没有通过 %s 校验", fe.Field(), fe.Tag()),
+			})
+		}
+		return fieldError(fields).Wrap(err)
+	}
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) {
+		return fieldError(FieldErrors{{
+			Field: ute.Field,
+			Tag:   "type",
+			Msg:   fmt.Sprintf("%s 类型不对", ute.Field),
+		}}).Wrap(err)
+	}
+	return ErrBadRequest.Wrap(err)
+}
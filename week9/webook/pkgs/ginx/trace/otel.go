@@ -0,0 +1,68 @@
+package trace
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+const instrumentationName = "geekgo/week9/webook/pkgs/ginx/trace"
+
+// MiddlewareBuilder 每个请求一个 span，上游通过 traceparent 头传了 trace 过来的话就接着上游的。
+// handler 里面要用 ctx.Request.Context() 往下传，直接传 *gin.Context 是拿不到 span 的。
+// 不要为了省事打开 gin.Engine 的 ContextWithFallback，那样所有的 handler 都会跟着客户端断开而取消
+type MiddlewareBuilder struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewMiddlewareBuilder 用的是全局的 TracerProvider 和 propagator，要在 otelx.Setup 之后调用
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		tracer:     otel.Tracer(instrumentationName),
+		propagator: otel.GetTextMapPropagator(),
+	}
+}
+
+func (m *MiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx := m.propagator.Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		route := ctx.FullPath()
+		name := ctx.Request.Method + " " + route
+		if route == "" {
+			// 没有命中路由，不能用路径做 span 的名字，不然名字会非常多
+			name = ctx.Request.Method + " unknown"
+		}
+		reqCtx, span := m.tracer.Start(reqCtx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(ctx.Request.Method),
+				semconv.HTTPRoute(route),
+				attribute.String("http.target", ctx.Request.URL.Path),
+				semconv.ClientAddress(ctx.ClientIP()),
+				semconv.UserAgentOriginal(ctx.Request.UserAgent()),
+			))
+		defer span.End()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		// 前端和日志可以用这个 id 查 trace
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			ctx.Header("X-Trace-Id", sc.TraceID().String())
+		}
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(ctx.Errors) > 0 {
+			span.SetStatus(codes.Error, ctx.Errors.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package trace
+
+import (
+	"context"
+	"geekgo/week9/webook/pkgs/otelx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareBuilder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracing, err := otelx.Setup(otelx.Config{ServiceName: "test", Exporter: otelx.ExporterMemory, SampleRatio: 1})
+	require.NoError(t, err)
+	defer tracing.Shutdown(context.Background())
+
+	server := gin.New()
+	server.Use(NewMiddlewareBuilder().Build())
+	var handlerSpan trace.SpanContext
+	server.GET("/users/:id", func(ctx *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(ctx.Request.Context())
+		ctx.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/123", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+
+	spans := tracing.Memory.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /users/:id", span.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.Equal(t, codes.Error, span.Status.Code)
+	assert.Equal(t, span.SpanContext.SpanID(), handlerSpan.SpanID())
+	assert.Equal(t, span.SpanContext.TraceID().String(), recorder.Header().Get("X-Trace-Id"))
+}
@@ -0,0 +1,169 @@
+package ginx
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	zhTranslations "github.com/go-playground/validator/v10/translations/zh"
+	"reflect"
+	"strings"
+)
+
+// 支持的语言，没有匹配上的都用中文
+const (
+	LocaleZH = "zh"
+	LocaleEN = "en"
+)
+
+var (
+	validate = validator.New()
+	uni      = ut.New(zh.New(), zh.New(), en.New())
+)
+
+// Validator 请求需要跨字段、查数据之外的复杂校验，就实现这个接口，在 tag 校验通过之后调用。
+// 返回 FieldErrors 会原样返回给前端，返回 *Error 就按照 Error 处理，别的错误都当成参数错误
+type Validator interface {
+	Validate() error
+}
+
+// FieldErrors Validate 里面可以直接返回这个
+type FieldErrors []FieldError
+
+func (f FieldErrors) Error() string {
+	msgs := make([]string, 0, len(f))
+	for _, fe := range f {
+		msgs = append(msgs, fe.Msg)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func init() {
+	// 不和 gin 自带的 binding 混在一起，用 validate 这个 tag
+	validate.SetTagName("validate")
+	// 返回给前端的字段名用 json 里面的名字
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	zhTrans, _ := uni.GetTranslator(LocaleZH)
+	if err := zhTranslations.RegisterDefaultTranslations(validate, zhTrans); err != nil {
+		panic(err)
+	}
+	enTrans, _ := uni.GetTranslator(LocaleEN)
+	if err := enTranslations.RegisterDefaultTranslations(validate, enTrans); err != nil {
+		panic(err)
+	}
+	// 英文的默认翻译里面没有 required_without，和中文一样按照 required 提示
+	err := RegisterTranslation("required_without", map[string]string{
+		LocaleEN: "{0} is a required field",
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterValidation 注册自定义的校验规则。
+// translations 的 key 是语言，value 是提示，{0} 会被替换成字段名，比如 {"zh": "{0}必须包含字母和数字"}。
+// 要在注册路由之前调用，validator 本身不是并发安全的
+func RegisterValidation(tag string, fn validator.Func, translations map[string]string) error {
+	err := validate.RegisterValidation(tag, fn)
+	if err != nil {
+		return err
+	}
+	return RegisterTranslation(tag, translations)
+}
+
+// RegisterTranslation 只注册提示，用在 validator 自带的规则没有翻译的时候，translations 和 RegisterValidation 一样
+func RegisterTranslation(tag string, translations map[string]string) error {
+	for locale, text := range translations {
+		trans, found := uni.FindTranslator(locale)
+		if !found {
+			return errors.New("ginx: 不支持的语言 " + locale)
+		}
+		err := validate.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+			return trans.Add(tag, text, true)
+		}, func(trans ut.Translator, fe validator.FieldError) string {
+			msg, err := trans.T(fe.Tag(), fe.Field())
+			if err != nil {
+				return fe.Error()
+			}
+			return msg
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Locale 按照 Accept-Language 选语言，只看第一个
+func Locale(ctx *gin.Context) string {
+	lang := ctx.GetHeader("Accept-Language")
+	lang, _, _ = strings.Cut(lang, ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == LocaleEN || strings.HasPrefix(lang, LocaleEN+"-") {
+		return LocaleEN
+	}
+	return LocaleZH
+}
+
+// validateReq 先按照 tag 校验，再调用 Validate
+func validateReq(ctx *gin.Context, req any) *Error {
+	if err := validate.Struct(req); err != nil {
+		var ves validator.ValidationErrors
+		if errors.As(err, &ves) {
+			return fieldError(fieldErrors(ctx, ves)).Wrap(err)
+		}
+		// 剩下的是 InvalidValidationError，T 不是结构体，比如 WrapReq[[]int64]，没有 tag 可以校验
+	}
+	v, ok := req.(Validator)
+	if !ok {
+		return nil
+	}
+	err := v.Validate()
+	if err == nil {
+		return nil
+	}
+	var fes FieldErrors
+	if errors.As(err, &fes) {
+		return fieldError(fes).Wrap(err)
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrBadRequest.WithMsg(err.Error()).Wrap(err)
+}
+
+func fieldErrors(ctx *gin.Context, ves validator.ValidationErrors) FieldErrors {
+	trans, _ := uni.GetTranslator(Locale(ctx))
+	res := make(FieldErrors, 0, len(ves))
+	for _, fe := range ves {
+		res = append(res, FieldError{
+			Field: fe.Field(),
+			Tag:   fe.Tag(),
+			Msg:   fe.Translate(trans),
+		})
+	}
+	return res
+}
+
+// fieldError 第一个字段的提示放在 Msg 里面，前端只展示 Msg 也能看懂
+func fieldError(fes FieldErrors) *Error {
+	e := ErrBadRequest.WithData(fes)
+	if len(fes) > 0 {
+		e = e.WithMsg(fes[0].Msg)
+	}
+	return e
+}
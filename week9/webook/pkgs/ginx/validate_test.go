@@ -0,0 +1,152 @@
+package ginx
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type signUpTestReq struct {
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required,test_strong"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+func (r signUpTestReq) Validate() error {
+	if r.ConfirmPassword != r.Password {
+		return FieldErrors{{Field: "confirmPassword", Tag: "eqfield", Msg: "两次密码不一致"}}
+	}
+	return nil
+}
+
+type ginxErrorReq struct {
+	Name string `json:"name"`
+}
+
+func (r *ginxErrorReq) Validate() error {
+	if r.Name == "admin" {
+		return ErrForbidden
+	}
+	if r.Name == "root" {
+		return errors.New("不能叫 root")
+	}
+	return nil
+}
+
+func TestRegisterValidation_UnknownLocale(t *testing.T) {
+	err := RegisterValidation("test_unknown_locale", func(fl validator.FieldLevel) bool {
+		return true
+	}, map[string]string{"fr": "{0}"})
+	assert.Error(t, err)
+}
+
+func TestWrapReq_Validate(t *testing.T) {
+	require.NoError(t, RegisterValidation("test_strong", func(fl validator.FieldLevel) bool {
+		return len(fl.Field().String()) >= 8
+	}, map[string]string{
+		LocaleZH: "{0}至少要 8 位",
+		LocaleEN: "{0} must be at least 8 characters",
+	}))
+	testCases := []struct {
+		name string
+		body string
+		lang string
+
+		wantStatus int
+		wantMsg    string
+		wantFields []FieldError
+	}{
+		{
+			name:       "通过",
+			body:       `{"email":"a@qq.com","password":"12345678","confirmPassword":"12345678"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "内置规则，中文",
+			body:       `{"email":"abc","password":"12345678","confirmPassword":"12345678"}`,
+			wantStatus: http.StatusBadRequest,
+			wantMsg:    "email必须是一个有效的邮箱",
+			wantFields: []FieldError{{Field: "email", Tag: "email", Msg: "email必须是一个有效的邮箱"}},
+		},
+		{
+			name:       "内置规则，英文",
+			body:       `{"email":"abc","password":"12345678","confirmPassword":"12345678"}`,
+			lang:       "en-US,en;q=0.9",
+			wantStatus: http.StatusBadRequest,
+			wantMsg:    "email must be a valid email address",
+			wantFields: []FieldError{{Field: "email", Tag: "email", Msg: "email must be a valid email address"}},
+		},
+		{
+			name:       "自定义规则，多个字段",
+			body:       `{"password":"123"}`,
+			lang:       "en",
+			wantStatus: http.StatusBadRequest,
+			wantMsg:    "email is a required field",
+			wantFields: []FieldError{
+				{Field: "email", Tag: "required", Msg: "email is a required field"},
+				{Field: "password", Tag: "test_strong", Msg: "password must be at least 8 characters"},
+			},
+		},
+		{
+			name:       "Validate 方法",
+			body:       `{"email":"a@qq.com","password":"12345678","confirmPassword":"87654321"}`,
+			wantStatus: http.StatusBadRequest,
+			wantMsg:    "两次密码不一致",
+			wantFields: []FieldError{{Field: "confirmPassword", Tag: "eqfield", Msg: "两次密码不一致"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.POST("/test", WrapReq[signUpTestReq](func(ctx *gin.Context, req signUpTestReq) (Result, error) {
+				return Result{}, nil
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tc.lang)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantStatus, recorder.Code)
+			var res struct {
+				Msg  string       `json:"msg"`
+				Data []FieldError `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+			assert.Equal(t, tc.wantMsg, res.Msg)
+			assert.Equal(t, tc.wantFields, res.Data)
+		})
+	}
+}
+
+func TestWrapReq_ValidateError(t *testing.T) {
+	server := gin.New()
+	server.POST("/test", WrapReq[ginxErrorReq](func(ctx *gin.Context, req ginxErrorReq) (Result, error) {
+		return Result{}, nil
+	}))
+	testCases := []struct {
+		body       string
+		wantStatus int
+		wantMsg    string
+	}{
+		{body: `{"name":"admin"}`, wantStatus: http.StatusForbidden, wantMsg: "没有权限"},
+		{body: `{"name":"root"}`, wantStatus: http.StatusBadRequest, wantMsg: "不能叫 root"},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		assert.Equal(t, tc.wantStatus, recorder.Code)
+		var res Result
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+		assert.Equal(t, tc.wantMsg, res.Msg)
+	}
+}
@@ -1,10 +1,12 @@
 package ginx
 
 import (
+	"errors"
 	"geekgo/week9/webook/pkgs/logger"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
+	"strconv"
 )
 
 var vector *prometheus.CounterVec
@@ -12,9 +14,8 @@ var L logger.LoggerV1
 
 func InitCounter(opt prometheus.CounterOpts) {
 	vector = prometheus.NewCounterVec(opt,
-		[]string{"code"})
+		[]string{"route", "method", "code"})
 	prometheus.MustRegister(vector)
-	// 你可以考虑使用 code, method, 命中路由，HTTP 状态码
 }
 
 type Result struct {
@@ -27,21 +28,53 @@ type Result struct {
 func WrapReq[T any](fn func(ctx *gin.Context, req T) (Result, error)) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var req T
-		if err := ctx.Bind(&req); err != nil {
+		if err := ctx.ShouldBind(&req); err != nil {
+			writeError(ctx, BindError(err))
+			return
+		}
+		if err := validateReq(ctx, &req); err != nil {
+			writeError(ctx, err)
 			return
 		}
 		res, err := fn(ctx, req)
-		if err != nil {
-			// 开始处理 error，其实就是记录一下日志
-			L.Error("处理业务逻辑出错",
-				logger.String("path", ctx.Request.URL.Path),
-				// 命中的路由
-				logger.String("route", ctx.FullPath()),
-				logger.Error(err))
+		if err == nil {
+			write(ctx, http.StatusOK, res)
+			return
 		}
-		go func() {
-			vector.WithLabelValues(string(res.Code)).Inc()
-		}()
-		ctx.JSON(http.StatusOK, res)
+		var e *Error
+		if errors.As(err, &e) {
+			writeError(ctx, e)
+			return
+		}
+		// 老的写法，handler 自己组装好了 Result，error 只用来打日志
+		logError(ctx, err)
+		write(ctx, http.StatusOK, res)
+	}
+}
+
+func writeError(ctx *gin.Context, e *Error) {
+	// 参数错误这种是前端的问题，没必要打日志
+	if e.Status >= http.StatusInternalServerError || e.Code == CodeSystem {
+		logError(ctx, e)
+	}
+	write(ctx, e.Status, e.Result())
+}
+
+func write(ctx *gin.Context, status int, res Result) {
+	if vector != nil {
+		vector.WithLabelValues(ctx.FullPath(), ctx.Request.Method, strconv.Itoa(res.Code)).Inc()
+	}
+	ctx.JSON(status, res)
+}
+
+func logError(ctx *gin.Context, err error) {
+	if L == nil {
+		return
 	}
+	// 开始处理 error，其实就是记录一下日志
+	L.Error("处理业务逻辑出错",
+		logger.String("path", ctx.Request.URL.Path),
+		// 命中的路由
+		logger.String("route", ctx.FullPath()),
+		logger.Error(err))
 }
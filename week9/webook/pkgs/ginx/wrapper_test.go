@@ -0,0 +1,151 @@
+package ginx
+
+import (
+	"encoding/json"
+	"errors"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	L = logger.NewNoOpLogger()
+	InitCounter(prometheus.CounterOpts{
+		Namespace: "test",
+		Name:      "ginx_wrapper",
+	})
+	os.Exit(m.Run())
+}
+
+type testReq struct {
+	Name string `json:"name" binding:"required"`
+	Age  int    `json:"age"`
+}
+
+func TestWrapReq(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+		fn   func(ctx *gin.Context, req testReq) (Result, error)
+
+		wantStatus int
+		wantCode   int
+		wantMsg    string
+		wantFields []FieldError
+	}{
+		{
+			name: "成功",
+			body: `{"name":"tom"}`,
+			fn: func(ctx *gin.Context, req testReq) (Result, error) {
+				return Result{Msg: "hello " + req.Name}, nil
+			},
+			wantStatus: http.StatusOK,
+			wantMsg:    "hello tom",
+		},
+		{
+			name:       "JSON 格式不对",
+			body:       `{"name":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeBadRequest,
+			wantMsg:    "参数错误",
+		},
+		{
+			name:       "类型不对",
+			body:       `{"name":"tom","age":"18"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeBadRequest,
+			wantMsg:    "age 类型不对",
+			wantFields: []FieldError{{Field: "age", Tag: "type", Msg: "age 类型不对"}},
+		},
+		{
+			name:       "校验失败",
+			body:       `{"age":18}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeBadRequest,
+			wantMsg:    "Name 没有通过 required 校验",
+			wantFields: []FieldError{{Field: "Name", Tag: "required", Msg: "Name 没有通过 required 校验"}},
+		},
+		{
+			name: "返回 ginx.Error",
+			body: `{"name":"tom"}`,
+			fn: func(ctx *gin.Context, req testReq) (Result, error) {
+				return Result{}, ErrForbidden.WithMsg("只有管理员可以操作")
+			},
+			wantStatus: http.StatusForbidden,
+			wantCode:   CodeBadRequest,
+			wantMsg:    "只有管理员可以操作",
+		},
+		{
+			name: "包装过的 ginx.Error",
+			body: `{"name":"tom"}`,
+			fn: func(ctx *gin.Context, req testReq) (Result, error) {
+				return Result{}, ErrSystem.Wrap(errors.New("db 挂了"))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   CodeSystem,
+			wantMsg:    "系统错误",
+		},
+		{
+			name: "老的写法",
+			body: `{"name":"tom"}`,
+			fn: func(ctx *gin.Context, req testReq) (Result, error) {
+				return Result{Code: 4, Msg: "用户名已存在"}, errors.New("duplicate")
+			},
+			wantStatus: http.StatusOK,
+			wantCode:   4,
+			wantMsg:    "用户名已存在",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.POST("/test", WrapReq[testReq](tc.fn))
+			req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantStatus, recorder.Code)
+			var res struct {
+				Code int          `json:"code"`
+				Msg  string       `json:"msg"`
+				Data []FieldError `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+			assert.Equal(t, tc.wantCode, res.Code)
+			assert.Equal(t, tc.wantMsg, res.Msg)
+			assert.Equal(t, tc.wantFields, res.Data)
+		})
+	}
+}
+
+func TestWrapReq_Counter(t *testing.T) {
+	server := gin.New()
+	server.POST("/users/:id", WrapReq[testReq](func(ctx *gin.Context, req testReq) (Result, error) {
+		return Result{}, nil
+	}))
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/users/123", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	// 按照路由统计，不是按照具体的路径
+	assert.Equal(t, float64(2), testutil.ToFloat64(vector.WithLabelValues("/users/:id", http.MethodPost, "4")))
+}
+
+func TestError_Is(t *testing.T) {
+	err := ErrSystem.Wrap(errors.New("db 挂了"))
+	assert.True(t, errors.Is(err, ErrSystem))
+	assert.False(t, errors.Is(err, ErrBadRequest))
+	// Wrap 不会改掉预定义的错误
+	assert.Nil(t, ErrSystem.Cause)
+}
@@ -0,0 +1,147 @@
+package gormx
+
+import (
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	instrumentationName = "geekgo/week9/webook/pkgs/gormx"
+	// 放在 gorm.DB 实例上的 span，同一个语句的 before 和 after 之间传递
+	otelSpanKey = "otel:span"
+)
+
+// OTELGormTracing 每条语句一个 span，父 span 从 db.WithContext 传进来的 context 里面拿，
+// 所以 DAO 里面一定要用 WithContext，不然 span 是断开的
+type OTELGormTracing struct {
+	tracer trace.Tracer
+	// 从 Dialector 拿，mysql、sqlite 之类的
+	system attribute.KeyValue
+}
+
+func NewOTELPlugin() gorm.Plugin {
+	return &OTELGormTracing{
+		tracer: otel.Tracer(instrumentationName),
+	}
+}
+
+func (o *OTELGormTracing) Name() string {
+	return "otel_gorm"
+}
+
+func (o *OTELGormTracing) Initialize(db *gorm.DB) error {
+	o.system = semconv.DBSystemKey.String(db.Dialector.Name())
+	o.registerAll(db)
+	return nil
+}
+
+func (o *OTELGormTracing) before(typ string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, span := o.tracer.Start(db.Statement.Context, "gorm:"+typ,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(o.system, semconv.DBOperation(typ)))
+		db.Statement.Context = ctx
+		db.InstanceSet(otelSpanKey, span)
+	}
+}
+
+func (o *OTELGormTracing) after() func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		val, ok := db.InstanceGet(otelSpanKey)
+		if !ok {
+			return
+		}
+		span, ok := val.(trace.Span)
+		if !ok {
+			return
+		}
+		defer span.End()
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		span.SetAttributes(
+			semconv.DBSQLTable(table),
+			// 参数是占位符，不会把用户的数据带出去
+			semconv.DBStatement(db.Statement.SQL.String()),
+			attribute.Int64("db.rows_affected", db.Statement.RowsAffected))
+		// 查不到数据是正常的业务情况，不算出错
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(db.Error)
+			span.SetStatus(codes.Error, db.Error.Error())
+		}
+	}
+}
+
+func (o *OTELGormTracing) registerAll(db *gorm.DB) {
+	err := db.Callback().Create().Before("*").
+		Register("otel_create_before", o.before("create"))
+	if err != nil {
+		panic(err)
+	}
+	err = db.Callback().Create().After("*").
+		Register("otel_create_after", o.after())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Callback().Query().Before("*").
+		Register("otel_query_before", o.before("query"))
+	if err != nil {
+		panic(err)
+	}
+	err = db.Callback().Query().After("*").
+		Register("otel_query_after", o.after())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Callback().Update().Before("*").
+		Register("otel_update_before", o.before("update"))
+	if err != nil {
+		panic(err)
+	}
+	err = db.Callback().Update().After("*").
+		Register("otel_update_after", o.after())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Callback().Delete().Before("*").
+		Register("otel_delete_before", o.before("delete"))
+	if err != nil {
+		panic(err)
+	}
+	err = db.Callback().Delete().After("*").
+		Register("otel_delete_after", o.after())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Callback().Raw().Before("*").
+		Register("otel_raw_before", o.before("raw"))
+	if err != nil {
+		panic(err)
+	}
+	err = db.Callback().Raw().After("*").
+		Register("otel_raw_after", o.after())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Callback().Row().Before("*").
+		Register("otel_row_before", o.before("row"))
+	if err != nil {
+		panic(err)
+	}
+	err = db.Callback().Row().After("*").
+		Register("otel_row_after", o.after())
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,56 @@
+package gormx
+
+import (
+	"context"
+	"geekgo/week9/webook/pkgs/otelx"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type tracedUser struct {
+	Id   int64 `gorm:"primaryKey,autoIncrement"`
+	Name string
+}
+
+func TestOTELGormTracing(t *testing.T) {
+	tracing, err := otelx.Setup(otelx.Config{ServiceName: "test", Exporter: otelx.ExporterMemory, SampleRatio: 1})
+	require.NoError(t, err)
+	defer tracing.Shutdown(context.Background())
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&tracedUser{}))
+	require.NoError(t, db.Use(NewOTELPlugin()))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	err = db.WithContext(ctx).Create(&tracedUser{Name: "Tom"}).Error
+	require.NoError(t, err)
+	var u tracedUser
+	// 查不到数据不算出错
+	err = db.WithContext(ctx).Where("id = ?", 100).First(&u).Error
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	parent.End()
+
+	spans := tracing.Memory.GetSpans()
+	require.Len(t, spans, 3)
+	names := []string{spans[0].Name, spans[1].Name}
+	assert.Equal(t, []string{"gorm:create", "gorm:query"}, names)
+	for _, span := range spans[:2] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+		assert.Equal(t, codes.Unset, span.Status.Code)
+		attrs := attribute.NewSet(span.Attributes...)
+		system, ok := attrs.Value(semconv.DBSystemKey)
+		require.True(t, ok)
+		assert.Equal(t, "sqlite", system.AsString())
+		table, ok := attrs.Value(semconv.DBSQLTableKey)
+		require.True(t, ok)
+		assert.Equal(t, "traced_users", table.AsString())
+	}
+}
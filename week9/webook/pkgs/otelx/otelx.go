@@ -0,0 +1,94 @@
+package otelx
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// 支持的 exporter
+const (
+	// ExporterNone 只生成 trace id，用来串日志，不上报
+	ExporterNone = "none"
+	// ExporterStdout 打印在控制台，本地调试用
+	ExporterStdout = "stdout"
+	// ExporterOTLP 通过 HTTP 上报给 collector、Jaeger 之类支持 OTLP 的后端
+	ExporterOTLP = "otlp"
+	// ExporterMemory 存在内存里面，测试用
+	ExporterMemory = "memory"
+)
+
+type Config struct {
+	ServiceName string
+	Exporter    string
+	// Endpoint OTLP 的地址，比如 localhost:4318，不带 http://
+	Endpoint string
+	// Insecure OTLP 用 HTTP 而不是 HTTPS
+	Insecure bool
+	// SampleRatio 采样率，0 到 1，上游已经采样的请求会跟着上游走
+	SampleRatio float64
+}
+
+// Tracing Setup 的结果，退出的时候要调用 Shutdown，把还没有上报的 span 发出去
+type Tracing struct {
+	Provider *sdktrace.TracerProvider
+	// Memory 只有 ExporterMemory 的时候才有，测试里面用来拿到所有的 span
+	Memory *tracetest.InMemoryExporter
+}
+
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.Provider.Shutdown(ctx)
+}
+
+// Setup 初始化 TracerProvider，并且设置成全局的，
+// 同时设置 W3C 的 traceparent 和 baggage 作为跨进程传递的格式
+func Setup(cfg Config) (*Tracing, error) {
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+	tracing := &Tracing{}
+	switch cfg.Exporter {
+	case ExporterNone, "":
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterOTLP:
+		clientOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		// 这里不会连 collector，连不上也不影响启动
+		exporter, err := otlptracehttp.New(context.Background(), clientOpts...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterMemory:
+		tracing.Memory = tracetest.NewInMemoryExporter()
+		// 同步导出，span 结束之后马上就能拿到
+		opts = append(opts, sdktrace.WithSyncer(tracing.Memory))
+	default:
+		return nil, fmt.Errorf("otelx: 不支持的 exporter %s", cfg.Exporter)
+	}
+	tracing.Provider = sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tracing.Provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	return tracing, nil
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// FallbackLimiter 优先用 primary，一般是 redis。
+// primary 出错的时候用 backup 兜底，并且在 cooldown 之内不再请求 primary，免得每个请求都要等 redis 超时。
+// backup 一般是单机的限流器，阈值要按照单机来配置
+type FallbackLimiter struct {
+	primary  QuotaLimiter
+	backup   QuotaLimiter
+	cooldown time.Duration
+	// primary 上一次出错的时间，UnixNano
+	failedAt atomic.Int64
+	now      func() time.Time
+}
+
+func NewFallbackLimiter(primary QuotaLimiter, backup QuotaLimiter, cooldown time.Duration) QuotaLimiter {
+	return &FallbackLimiter{
+		primary:  primary,
+		backup:   backup,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+func (f *FallbackLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := f.Take(ctx, key)
+	return res.Limited, err
+}
+
+func (f *FallbackLimiter) Take(ctx context.Context, key string) (Result, error) {
+	now := f.now()
+	if now.Sub(time.Unix(0, f.failedAt.Load())) < f.cooldown {
+		return f.backup.Take(ctx, key)
+	}
+	res, err := f.primary.Take(ctx, key)
+	if err != nil {
+		f.failedAt.Store(now.UnixNano())
+		return f.backup.Take(ctx, key)
+	}
+	return res, nil
+}
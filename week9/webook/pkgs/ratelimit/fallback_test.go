@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFallbackLimiter(t *testing.T) {
+	primary := &fakeQuotaLimiter{res: Result{Limit: 100}}
+	backup := &fakeQuotaLimiter{res: Result{Limit: 10}}
+	f := NewFallbackLimiter(primary, backup, time.Second).(*FallbackLimiter)
+	now := time.Unix(1700000000, 0)
+	f.now = func() time.Time {
+		return now
+	}
+	ctx := context.Background()
+
+	res, err := f.Take(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.Equal(t, 100, res.Limit)
+
+	// redis 挂了，用本地的
+	primary.err = errors.New("redis 连不上")
+	res, err = f.Take(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.Equal(t, 10, res.Limit)
+	assert.Equal(t, 2, primary.cnt)
+
+	// 冷却期内不再请求 redis
+	primary.err = nil
+	now = now.Add(time.Millisecond * 500)
+	res, err = f.Take(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.Equal(t, 10, res.Limit)
+	assert.Equal(t, 2, primary.cnt)
+
+	now = now.Add(time.Millisecond * 500)
+	res, err = f.Take(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.Equal(t, 100, res.Limit)
+	assert.Equal(t, 3, primary.cnt)
+}
+
+type fakeQuotaLimiter struct {
+	res Result
+	err error
+	cnt int
+}
+
+func (f *fakeQuotaLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := f.Take(ctx, key)
+	return res.Limited, err
+}
+
+func (f *fakeQuotaLimiter) Take(ctx context.Context, key string) (Result, error) {
+	f.cnt++
+	return f.res, f.err
+}
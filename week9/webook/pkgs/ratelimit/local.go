@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// LocalSlidingWindowLimiter 单机的滑动窗口，计数只在当前实例里面。
+// 主要用来在 redis 挂了的时候兜底，见 FallbackLimiter
+type LocalSlidingWindowLimiter struct {
+	interval time.Duration
+	rate     int
+
+	mu sync.Mutex
+	// 每个 key 窗口内的请求时间，按照时间先后排好
+	reqs map[string][]time.Time
+	// 上一次清理过期 key 的时间
+	cleanedAt time.Time
+	now       func() time.Time
+}
+
+func NewLocalSlidingWindowLimiter(interval time.Duration, rate int) QuotaLimiter {
+	return &LocalSlidingWindowLimiter{
+		interval: interval,
+		rate:     rate,
+		reqs:     make(map[string][]time.Time),
+		now:      time.Now,
+	}
+}
+
+func (l *LocalSlidingWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := l.Take(ctx, key)
+	return res.Limited, err
+}
+
+func (l *LocalSlidingWindowLimiter) Take(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	min := now.Add(-l.interval)
+	l.cleanup(now, min)
+
+	reqs := l.reqs[key]
+	i := 0
+	for i < len(reqs) && !reqs[i].After(min) {
+		i++
+	}
+	reqs = reqs[i:]
+	if len(reqs) >= l.rate {
+		l.reqs[key] = reqs
+		return Result{
+			Limited:    true,
+			Limit:      l.rate,
+			RetryAfter: reqs[0].Add(l.interval).Sub(now),
+			ResetAfter: reqs[len(reqs)-1].Add(l.interval).Sub(now),
+		}, nil
+	}
+	l.reqs[key] = append(reqs, now)
+	return Result{
+		Limit:      l.rate,
+		Remaining:  l.rate - len(reqs) - 1,
+		ResetAfter: l.interval,
+	}, nil
+}
+
+// cleanup 每过一个窗口清理一次已经没有请求的 key，不然 key 多了内存一直涨
+func (l *LocalSlidingWindowLimiter) cleanup(now time.Time, min time.Time) {
+	if now.Sub(l.cleanedAt) < l.interval {
+		return
+	}
+	l.cleanedAt = now
+	for key, reqs := range l.reqs {
+		if len(reqs) == 0 || !reqs[len(reqs)-1].After(min) {
+			delete(l.reqs, key)
+		}
+	}
+}
+
+// LocalTokenBucketLimiter 单机的令牌桶，和 RedisTokenBucketLimiter 的算法一样
+type LocalTokenBucketLimiter struct {
+	interval time.Duration
+	rate     int
+	capacity int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	cleanedAt time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+func NewLocalTokenBucketLimiter(interval time.Duration, rate int, capacity int) QuotaLimiter {
+	return &LocalTokenBucketLimiter{
+		interval: interval,
+		rate:     rate,
+		capacity: capacity,
+		buckets:  make(map[string]*tokenBucket),
+		now:      time.Now,
+	}
+}
+
+func (l *LocalTokenBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := l.Take(ctx, key)
+	return res.Limited, err
+}
+
+func (l *LocalTokenBucketLimiter) Take(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.cleanup(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.capacity), ts: now}
+		l.buckets[key] = b
+	}
+	b.refill(now, l.tokensPerNano(), l.capacity)
+	res := Result{Limit: l.capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		res.Limited = true
+		res.RetryAfter = l.durationFor(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = l.durationFor(float64(l.capacity) - b.tokens)
+	return res, nil
+}
+
+func (l *LocalTokenBucketLimiter) tokensPerNano() float64 {
+	return float64(l.rate) / float64(l.interval)
+}
+
+// durationFor 攒够 tokens 个令牌要多久
+func (l *LocalTokenBucketLimiter) durationFor(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.tokensPerNano()))
+}
+
+// cleanup 桶满了的 key 删掉也没关系，下次来的时候还是一个满的桶
+func (l *LocalTokenBucketLimiter) cleanup(now time.Time) {
+	full := l.durationFor(float64(l.capacity))
+	if now.Sub(l.cleanedAt) < full {
+		return
+	}
+	l.cleanedAt = now
+	for key, b := range l.buckets {
+		b.refill(now, l.tokensPerNano(), l.capacity)
+		if b.tokens >= float64(l.capacity) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time, tokensPerNano float64, capacity int) {
+	if !now.After(b.ts) {
+		return
+	}
+	b.tokens = math.Min(float64(capacity), b.tokens+float64(now.Sub(b.ts))*tokensPerNano)
+	b.ts = now
+}
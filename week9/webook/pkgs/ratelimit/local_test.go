@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLocalSlidingWindowLimiter(t *testing.T) {
+	l := NewLocalSlidingWindowLimiter(time.Second, 2).(*LocalSlidingWindowLimiter)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time {
+		return now
+	}
+	ctx := context.Background()
+	res, err := l.Take(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Limit: 2, Remaining: 1, ResetAfter: time.Second}, res)
+	now = now.Add(time.Millisecond * 300)
+	res, err = l.Take(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Remaining)
+
+	now = now.Add(time.Millisecond * 300)
+	res, err = l.Take(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.Equal(t, Result{
+		Limited:    true,
+		Limit:      2,
+		RetryAfter: time.Millisecond * 400,
+		ResetAfter: time.Millisecond * 700,
+	}, res)
+
+	// 第一个请求滑出窗口
+	now = now.Add(time.Millisecond * 400)
+	limited, err := l.Limit(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.False(t, limited)
+
+	// 过了一个窗口之后，没有请求的 key 会被清理掉
+	_, err = l.Take(ctx, "ip:2")
+	require.NoError(t, err)
+	now = now.Add(time.Second * 2)
+	_, err = l.Take(ctx, "ip:3")
+	require.NoError(t, err)
+	assert.Len(t, l.reqs, 1)
+}
+
+func TestLocalTokenBucketLimiter(t *testing.T) {
+	// 每秒 2 个令牌，最多攒 2 个
+	l := NewLocalTokenBucketLimiter(time.Second, 2, 2).(*LocalTokenBucketLimiter)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time {
+		return now
+	}
+	ctx := context.Background()
+	for i := 1; i >= 0; i-- {
+		res, err := l.Take(ctx, "uid:1")
+		require.NoError(t, err)
+		assert.False(t, res.Limited)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, err := l.Take(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.Equal(t, Result{
+		Limited:    true,
+		Limit:      2,
+		RetryAfter: time.Millisecond * 500,
+		ResetAfter: time.Second,
+	}, res)
+
+	now = now.Add(time.Millisecond * 500)
+	limited, err := l.Limit(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.False(t, limited)
+
+	// 桶满了的 key 会被清理掉
+	now = now.Add(time.Second * 2)
+	_, err = l.Take(ctx, "uid:2")
+	require.NoError(t, err)
+	assert.Len(t, l.buckets, 1)
+}
@@ -0,0 +1,25 @@
+-- 限流对象
+local key = KEYS[1]
+-- 窗口大小
+local window = tonumber(ARGV[1])
+-- 阈值
+local threshold = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+-- 同一毫秒可能有多个请求，member 不能直接用 now
+local member = ARGV[4]
+-- 窗口的起始时间
+local min = now - window
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', min)
+local cnt = redis.call('ZCARD', key)
+-- 返回 是否限流, 剩余次数, 多久之后可以重试, 多久之后完全恢复，时间都是毫秒
+if cnt >= threshold then
+    -- 执行限流，最早的那个请求滑出窗口之后才能再请求
+    local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+    local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+    return {1, 0, tonumber(oldest[2]) + window - now, tonumber(newest[2]) + window - now}
+else
+    redis.call('ZADD', key, now, member)
+    redis.call('PEXPIRE', key, window)
+    return {0, threshold - cnt - 1, 0, window}
+end
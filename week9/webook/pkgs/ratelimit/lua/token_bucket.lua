@@ -0,0 +1,38 @@
+-- 限流对象
+local key = KEYS[1]
+-- 桶的容量，也就是最多允许突发多少个请求
+local capacity = tonumber(ARGV[1])
+-- 每 interval 毫秒放 rate 个令牌
+local rate = tonumber(ARGV[2])
+local interval = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+
+local bucket = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+    -- 第一次请求，桶是满的
+    tokens = capacity
+    ts = now
+end
+-- 多个实例的时钟可能不一致，时间倒退的时候不补令牌
+if now > ts then
+    tokens = math.min(capacity, tokens + (now - ts) * rate / interval)
+    ts = now
+end
+
+local limited = 0
+local retry = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+else
+    limited = 1
+    retry = math.ceil((1 - tokens) * interval / rate)
+end
+-- 令牌数可能是小数，存成字符串
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', ts)
+-- 桶满了之后 key 就没用了
+local reset = math.ceil((capacity - tokens) * interval / rate)
+redis.call('PEXPIRE', key, math.max(reset, 1))
+-- 返回 是否限流, 剩余令牌, 多久之后可以重试, 多久之后桶满，时间都是毫秒
+return {limited, math.floor(tokens), retry, reset}
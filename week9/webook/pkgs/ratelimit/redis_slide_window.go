@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed lua/slide_window.lua
+var luaSlideWindow string
+
+// RedisSlidingWindowLimiter 基于 redis zset 的滑动窗口，多个实例共享同一个计数
+type RedisSlidingWindowLimiter struct {
+	cmd      redis.Cmdable
+	interval time.Duration
+	// 阈值
+	rate int
+}
+
+func NewRedisSlidingWindowLimiter(cmd redis.Cmdable, interval time.Duration, rate int) QuotaLimiter {
+	return &RedisSlidingWindowLimiter{
+		cmd:      cmd,
+		interval: interval,
+		rate:     rate,
+	}
+}
+
+func (r *RedisSlidingWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := r.Take(ctx, key)
+	return res.Limited, err
+}
+
+func (r *RedisSlidingWindowLimiter) Take(ctx context.Context, key string) (Result, error) {
+	vals, err := r.cmd.Eval(ctx, luaSlideWindow, []string{key},
+		r.interval.Milliseconds(), r.rate, time.Now().UnixMilli(), uuid.New().String()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(r.rate, vals), nil
+}
+
+// newResult 解析 lua 脚本返回的 是否限流, 剩余次数, 多久之后可以重试, 多久之后完全恢复
+func newResult(limit int, vals []int64) Result {
+	return Result{
+		Limited:    vals[0] == 1,
+		Limit:      limit,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		ResetAfter: time.Duration(vals[3]) * time.Millisecond,
+	}
+}
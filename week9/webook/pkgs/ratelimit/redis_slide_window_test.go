@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisSlidingWindowLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	limiter := NewRedisSlidingWindowLimiter(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}), time.Millisecond*100, 3)
+	ctx := context.Background()
+	// 同一毫秒里面的请求也要分别计数
+	for i := 0; i < 3; i++ {
+		limited, err := limiter.Limit(ctx, "ip:127.0.0.1")
+		require.NoError(t, err)
+		assert.False(t, limited)
+	}
+	limited, err := limiter.Limit(ctx, "ip:127.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, limited)
+	// 不同的 key 互不影响
+	limited, err = limiter.Limit(ctx, "ip:127.0.0.2")
+	require.NoError(t, err)
+	assert.False(t, limited)
+
+	// 窗口滑过去之后又可以了
+	time.Sleep(time.Millisecond * 110)
+	limited, err = limiter.Limit(ctx, "ip:127.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, limited)
+}
+
+func TestRedisSlidingWindowLimiter_Take(t *testing.T) {
+	mr := miniredis.RunT(t)
+	limiter := NewRedisSlidingWindowLimiter(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}), time.Second, 2)
+	ctx := context.Background()
+	res, err := limiter.Take(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Limit: 2, Remaining: 1, ResetAfter: time.Second}, res)
+	res, err = limiter.Take(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Remaining)
+	assert.False(t, res.Limited)
+
+	res, err = limiter.Take(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.True(t, res.Limited)
+	// 第一个请求滑出窗口之后就可以重试
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= time.Second, res.RetryAfter)
+	assert.True(t, res.ResetAfter >= res.RetryAfter)
+}
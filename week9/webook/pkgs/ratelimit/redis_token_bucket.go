@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+//go:embed lua/token_bucket.lua
+var luaTokenBucket string
+
+// RedisTokenBucketLimiter 基于 redis hash 的令牌桶。
+// 和滑动窗口比起来允许一定的突发流量，桶空了之后按照固定的速率放行
+type RedisTokenBucketLimiter struct {
+	cmd redis.Cmdable
+	// 每 interval 放 rate 个令牌
+	interval time.Duration
+	rate     int
+	// 桶的容量
+	capacity int
+}
+
+func NewRedisTokenBucketLimiter(cmd redis.Cmdable, interval time.Duration, rate int, capacity int) QuotaLimiter {
+	return &RedisTokenBucketLimiter{
+		cmd:      cmd,
+		interval: interval,
+		rate:     rate,
+		capacity: capacity,
+	}
+}
+
+func (r *RedisTokenBucketLimiter) Limit(ctx context.Context, key string) (bool, error) {
+	res, err := r.Take(ctx, key)
+	return res.Limited, err
+}
+
+func (r *RedisTokenBucketLimiter) Take(ctx context.Context, key string) (Result, error) {
+	vals, err := r.cmd.Eval(ctx, luaTokenBucket, []string{key},
+		r.capacity, r.rate, r.interval.Milliseconds(), time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(r.capacity, vals), nil
+}
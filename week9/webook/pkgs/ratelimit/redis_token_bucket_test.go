@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisTokenBucketLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	// 每 100ms 放一个令牌，最多攒 3 个
+	limiter := NewRedisTokenBucketLimiter(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}), time.Millisecond*100, 1, 3)
+	ctx := context.Background()
+	// 一开始桶是满的，允许突发
+	for i := 2; i >= 0; i-- {
+		res, err := limiter.Take(ctx, "uid:1")
+		require.NoError(t, err)
+		assert.False(t, res.Limited)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, err := limiter.Take(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.True(t, res.Limited)
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= time.Millisecond*100, res.RetryAfter)
+	assert.True(t, res.ResetAfter > time.Millisecond*200, res.ResetAfter)
+
+	// 不同的 key 互不影响
+	limited, err := limiter.Limit(ctx, "uid:2")
+	require.NoError(t, err)
+	assert.False(t, limited)
+
+	// 过了 100ms 又有了一个令牌，但是只有一个
+	time.Sleep(time.Millisecond * 110)
+	limited, err = limiter.Limit(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.False(t, limited)
+	limited, err = limiter.Limit(ctx, "uid:1")
+	require.NoError(t, err)
+	assert.True(t, limited)
+}
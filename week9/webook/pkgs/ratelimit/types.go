@@ -0,0 +1,30 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+type Limiter interface {
+	// Limit 要不要限流，返回 true 就是要限流
+	Limit(ctx context.Context, key string) (bool, error)
+}
+
+// Result 一次限流判断的详细结果，HTTP 中间件用来设置 Retry-After 和 X-RateLimit-* 响应头
+type Result struct {
+	Limited bool
+	// Limit 滑动窗口就是窗口内的阈值，令牌桶就是桶的容量
+	Limit int
+	// Remaining 这一次之后还能放过多少个请求
+	Remaining int
+	// RetryAfter 被限流的时候多久之后可以重试
+	RetryAfter time.Duration
+	// ResetAfter 多久之后额度完全恢复
+	ResetAfter time.Duration
+}
+
+// QuotaLimiter 除了要不要限流，还会返回剩下的额度
+type QuotaLimiter interface {
+	Limiter
+	Take(ctx context.Context, key string) (Result, error)
+}
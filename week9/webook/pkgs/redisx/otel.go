@@ -0,0 +1,66 @@
+package redisx
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "geekgo/week9/webook/pkgs/redisx"
+
+// OTELHook 每个命令一个 span，pipeline 和 lua 脚本整体算一个。
+// 用法是 client.AddHook(redisx.NewOTELHook())
+type OTELHook struct {
+	tracer trace.Tracer
+}
+
+func NewOTELHook() *OTELHook {
+	return &OTELHook{
+		tracer: otel.Tracer(instrumentationName),
+	}
+}
+
+func (h *OTELHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *OTELHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := h.tracer.Start(ctx, "redis:"+cmd.FullName(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			// 只记录命令名字，参数里面可能有用户的数据
+			trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(cmd.Name())))
+		defer span.End()
+		err := next(ctx, cmd)
+		recordError(span, err)
+		return err
+	}
+}
+
+func (h *OTELHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := h.tracer.Start(ctx, "redis:pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemRedis, attribute.Int("db.redis.num_cmd", len(cmds))))
+		defer span.End()
+		err := next(ctx, cmds)
+		recordError(span, err)
+		return err
+	}
+}
+
+// recordError key 不存在是正常的业务情况，不算出错
+func recordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+var _ redis.Hook = (*OTELHook)(nil)
@@ -0,0 +1,58 @@
+package redisx
+
+import (
+	"context"
+	"geekgo/week9/webook/pkgs/otelx"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"testing"
+)
+
+func TestOTELHook(t *testing.T) {
+	tracing, err := otelx.Setup(otelx.Config{ServiceName: "test", Exporter: otelx.ExporterMemory, SampleRatio: 1})
+	require.NoError(t, err)
+	defer tracing.Shutdown(context.Background())
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	client.AddHook(NewOTELHook())
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	// key 不存在不算出错
+	err = client.Get(ctx, "missing").Err()
+	assert.ErrorIs(t, err, redis.Nil)
+	// 类型不对，真的出错了
+	require.NoError(t, client.LPush(ctx, "list", "a").Err())
+	err = client.Get(ctx, "list").Err()
+	assert.Error(t, err)
+	pipe := client.Pipeline()
+	pipe.Set(ctx, "key", "val", 0)
+	pipe.Get(ctx, "key")
+	_, err = pipe.Exec(ctx)
+	require.NoError(t, err)
+	parent.End()
+
+	spans := tracing.Memory.GetSpans()
+	require.Len(t, spans, 5)
+	wantNames := []string{"redis:get", "redis:lpush", "redis:get", "redis:pipeline"}
+	wantStatus := []codes.Code{codes.Unset, codes.Unset, codes.Error, codes.Unset}
+	for i, span := range spans[:4] {
+		assert.Equal(t, wantNames[i], span.Name)
+		assert.Equal(t, wantStatus[i], span.Status.Code)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+		attrs := attribute.NewSet(span.Attributes...)
+		system, ok := attrs.Value(semconv.DBSystemKey)
+		require.True(t, ok)
+		assert.Equal(t, "redis", system.AsString())
+	}
+	attrs := attribute.NewSet(spans[3].Attributes...)
+	cnt, ok := attrs.Value("db.redis.num_cmd")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), cnt.AsInt64())
+}
@@ -0,0 +1,213 @@
+package saramax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+// BatchHandler 攒够 batchSize 条消息或者等了 batchDuration 之后，一次性交给 fn 处理
+// fn 成功之后才会提交这一批的偏移量。按照退避策略重试之后还是失败，整批投递到死信队列，每条投递成功之后提交。
+// 没有配置死信队列，或者投递失败的时候，ConsumeClaim 返回 error 结束这一轮消费，
+// 不能接着处理后面的消息，不然提交了后面的偏移量，失败的这一批就丢了。
+// 调用方要循环调用 ConsumerGroup.Consume，重新加入之后从上次提交的偏移量开始消费
+type BatchHandler[T any] struct {
+	l             logger.LoggerV1
+	fn            func(msgs []*sarama.ConsumerMessage, ts []T) error
+	batchSize     int
+	batchDuration time.Duration
+	retry         RetryConfig
+	// 为 nil 的时候不投递死信队列
+	dlq *DeadLetterProducer
+}
+
+func NewBatchHandler[T any](l logger.LoggerV1, batchSize int, batchDuration time.Duration,
+	fn func(msgs []*sarama.ConsumerMessage, ts []T) error) *BatchHandler[T] {
+	return &BatchHandler[T]{
+		l:             l,
+		fn:            fn,
+		batchSize:     batchSize,
+		batchDuration: batchDuration,
+		retry:         DefaultRetryConfig,
+	}
+}
+
+// WithRetry 替换默认的重试策略
+func (h *BatchHandler[T]) WithRetry(cfg RetryConfig) *BatchHandler[T] {
+	h.retry = cfg
+	return h
+}
+
+// WithDeadLetter 重试失败的整批消息和反序列化失败的消息投递到死信队列
+func (h *BatchHandler[T]) WithDeadLetter(dlq *DeadLetterProducer) *BatchHandler[T] {
+	h.dlq = dlq
+	return h
+}
+
+func (h *BatchHandler[T]) Setup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *BatchHandler[T]) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// invalidMsg 反序列化失败的消息
+type invalidMsg struct {
+	msg *sarama.ConsumerMessage
+	err error
+}
+
+func (h *BatchHandler[T]) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	msgs := claim.Messages()
+	for {
+		// 这一批拉到的所有消息，包括反序列化失败的，提交偏移量的时候要用
+		batch := make([]*sarama.ConsumerMessage, 0, h.batchSize)
+		// 真正要交给 fn 处理的
+		valid := make([]*sarama.ConsumerMessage, 0, h.batchSize)
+		ts := make([]T, 0, h.batchSize)
+		var invalid []invalidMsg
+		ctx, cancel := context.WithTimeout(context.Background(), h.batchDuration)
+		closed, timeout := false, false
+		for len(batch) < h.batchSize && !closed && !timeout {
+			select {
+			case <-ctx.Done():
+				timeout = true
+			case msg, ok := <-msgs:
+				if !ok {
+					// 再均衡或者退出了，剩下的这一点也要处理掉
+					closed = true
+					break
+				}
+				batch = append(batch, msg)
+				var t T
+				err := json.Unmarshal(msg.Value, &t)
+				if err != nil {
+					h.l.Error("反序列化消息失败",
+						logger.Error(err),
+						logger.String("topic", msg.Topic),
+						logger.Int32("partition", msg.Partition),
+						logger.Int64("offset", msg.Offset))
+					invalid = append(invalid, invalidMsg{msg: msg, err: err})
+					continue
+				}
+				valid = append(valid, msg)
+				ts = append(ts, t)
+			}
+		}
+		cancel()
+		err := h.consume(session, batch, valid, ts, invalid)
+		if err != nil {
+			return err
+		}
+		if closed {
+			return nil
+		}
+	}
+}
+
+func (h *BatchHandler[T]) consume(session sarama.ConsumerGroupSession,
+	batch []*sarama.ConsumerMessage, valid []*sarama.ConsumerMessage, ts []T, invalid []invalidMsg) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	// 反序列化失败的，重试多少次都没用，直接进死信队列
+	for _, im := range invalid {
+		if h.dlq == nil {
+			h.l.Warn("没有配置死信队列，丢弃反序列化失败的消息",
+				logger.String("topic", im.msg.Topic),
+				logger.Int32("partition", im.msg.Partition),
+				logger.Int64("offset", im.msg.Offset))
+			continue
+		}
+		err := h.deadLetter(im.msg, im.err)
+		if err != nil {
+			return err
+		}
+	}
+	if len(ts) > 0 {
+		err := h.process(session, batch, valid, ts)
+		if err != nil {
+			if session.Context().Err() != nil {
+				// 再均衡了，这一批没有处理完不是消息的问题，不进死信队列也不提交，会被重新消费
+				return err
+			}
+			if h.dlq == nil {
+				return err
+			}
+			return h.deadLetterBatch(session, batch, valid, err)
+		}
+	}
+	for _, msg := range batch {
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// process 按照退避策略重试，再均衡了就不再重试，这一批会被重新消费
+func (h *BatchHandler[T]) process(session sarama.ConsumerGroupSession,
+	batch []*sarama.ConsumerMessage, valid []*sarama.ConsumerMessage, ts []T) error {
+	for i := 0; ; i++ {
+		err := h.fn(valid, ts)
+		if err == nil {
+			return nil
+		}
+		h.l.Error("批量处理消息失败",
+			logger.Error(err),
+			logger.String("topic", batch[0].Topic),
+			logger.Int32("partition", batch[0].Partition),
+			logger.Int64("first_offset", batch[0].Offset),
+			logger.Int64("last_offset", batch[len(batch)-1].Offset))
+		if i >= h.retry.MaxRetries {
+			h.l.Error("批量处理消息失败-重试次数上限",
+				logger.Error(err),
+				logger.String("topic", batch[0].Topic),
+				logger.Int32("partition", batch[0].Partition),
+				logger.Int64("first_offset", batch[0].Offset),
+				logger.Int64("last_offset", batch[len(batch)-1].Offset))
+			return err
+		}
+		timer := time.NewTimer(h.retry.Interval(i))
+		select {
+		case <-timer.C:
+		case <-session.Context().Done():
+			timer.Stop()
+			return errors.Join(err, session.Context().Err())
+		}
+	}
+}
+
+// deadLetterBatch 按照偏移量的顺序投递，投递成功一条就提交一条，中间失败了就停下来。
+// 偏移量是连续提交的，前面投递过的不会在重新消费的时候再投递一次，重放死信队列也就不会重复计数。
+// 反序列化失败的在 consume 里面已经投递过了，这里只提交
+func (h *BatchHandler[T]) deadLetterBatch(session sarama.ConsumerGroupSession,
+	batch []*sarama.ConsumerMessage, valid []*sarama.ConsumerMessage, cause error) error {
+	// valid 是 batch 的子序列，顺序一样
+	j := 0
+	for _, msg := range batch {
+		if j < len(valid) && valid[j] == msg {
+			j++
+			err := h.deadLetter(msg, cause)
+			if err != nil {
+				return err
+			}
+		}
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+func (h *BatchHandler[T]) deadLetter(msg *sarama.ConsumerMessage, cause error) error {
+	err := h.dlq.Send(msg, cause)
+	if err != nil {
+		h.l.Error("投递死信队列失败",
+			logger.Error(errors.Join(cause, err)),
+			logger.String("topic", msg.Topic),
+			logger.Int32("partition", msg.Partition),
+			logger.Int64("offset", msg.Offset))
+	}
+	return err
+}
@@ -0,0 +1,255 @@
+package saramax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type testEvent struct {
+	Aid int64
+}
+
+func TestBatchHandler(t *testing.T) {
+	testCases := []struct {
+		name      string
+		msgs      []*sarama.ConsumerMessage
+		fnErr     error
+		wantCalls [][]int64
+		wantMark  []int64
+		wantErr   bool
+		// 为 nil 表示不配置死信队列
+		mock func(t *testing.T) *mocks.SyncProducer
+	}{
+		{
+			name:      "攒够一批",
+			msgs:      newTestMsgs(0, 1, 2, 3, 4),
+			wantCalls: [][]int64{{0, 1}, {2, 3}, {4}},
+			wantMark:  []int64{0, 1, 2, 3, 4},
+		},
+		{
+			name: "反序列化失败的也要提交",
+			msgs: append(newTestMsgs(0),
+				&sarama.ConsumerMessage{Offset: 1, Value: []byte("bad")}),
+			wantCalls: [][]int64{{0}},
+			wantMark:  []int64{0, 1},
+		},
+		{
+			name:  "处理失败不提交，也不再处理后面的",
+			msgs:  newTestMsgs(0, 1, 2, 3),
+			fnErr: errors.New("mock db error"),
+			// 后面的批次提交了的话，失败的这一批就丢了
+			wantCalls: [][]int64{{0, 1}, {0, 1}, {0, 1}},
+			wantErr:   true,
+		},
+		{
+			name:  "处理失败，整批进死信队列之后提交",
+			msgs:  newTestMsgs(0, 1, 2),
+			fnErr: errors.New("mock db error"),
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				for _, offset := range []string{"0", "1", "2"} {
+					offset := offset
+					p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(
+						func(msg *sarama.ProducerMessage) error {
+							assert.Equal(t, "test_topic_dlq", msg.Topic)
+							assert.Equal(t, offset, headerMap(msg.Headers)[HeaderOriginalOffset])
+							assert.Equal(t, "mock db error", headerMap(msg.Headers)[HeaderError])
+							return nil
+						})
+				}
+				return p
+			},
+			wantCalls: [][]int64{{0, 1}, {0, 1}, {0, 1}, {2}, {2}, {2}},
+			wantMark:  []int64{0, 1, 2},
+		},
+		{
+			name:  "死信队列投递失败，不提交",
+			msgs:  newTestMsgs(0, 1, 2),
+			fnErr: errors.New("mock db error"),
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				p.ExpectSendMessageAndFail(errors.New("mock kafka error"))
+				return p
+			},
+			wantCalls: [][]int64{{0, 1}, {0, 1}, {0, 1}},
+			wantErr:   true,
+		},
+		{
+			name:  "死信队列投递到一半失败，只提交投递成功的",
+			msgs:  newTestMsgs(0, 1),
+			fnErr: errors.New("mock db error"),
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				p.ExpectSendMessageAndSucceed()
+				p.ExpectSendMessageAndFail(errors.New("mock kafka error"))
+				return p
+			},
+			wantCalls: [][]int64{{0, 1}, {0, 1}, {0, 1}},
+			// 重新消费的时候从 1 开始，0 不会再投递一次
+			wantMark: []int64{0},
+			wantErr:  true,
+		},
+		{
+			name: "处理失败，中间反序列化失败的只投递一次",
+			msgs: []*sarama.ConsumerMessage{newTestMsgs(0)[0],
+				{Topic: "test_topic", Offset: 1, Value: []byte("bad")}},
+			fnErr: errors.New("mock db error"),
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				for _, offset := range []string{"1", "0"} {
+					offset := offset
+					p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(
+						func(msg *sarama.ProducerMessage) error {
+							assert.Equal(t, offset, headerMap(msg.Headers)[HeaderOriginalOffset])
+							return nil
+						})
+				}
+				return p
+			},
+			wantCalls: [][]int64{{0}, {0}, {0}},
+			wantMark:  []int64{0, 1},
+		},
+		{
+			name: "反序列化失败的进死信队列",
+			msgs: append(newTestMsgs(0),
+				&sarama.ConsumerMessage{Topic: "test_topic", Offset: 1, Value: []byte("bad")}),
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				p.ExpectSendMessageAndSucceed()
+				return p
+			},
+			wantCalls: [][]int64{{0}},
+			wantMark:  []int64{0, 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls [][]int64
+			h := NewBatchHandler[testEvent](logger.NewNoOpLogger(), 2, time.Second,
+				func(msgs []*sarama.ConsumerMessage, ts []testEvent) error {
+					require.Equal(t, len(msgs), len(ts))
+					aids := make([]int64, 0, len(ts))
+					for _, te := range ts {
+						aids = append(aids, te.Aid)
+					}
+					calls = append(calls, aids)
+					return tc.fnErr
+				}).WithRetry(RetryConfig{MaxRetries: 2, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond})
+			if tc.mock != nil {
+				p := tc.mock(t)
+				defer p.Close()
+				h.WithDeadLetter(NewDeadLetterProducer(p))
+			}
+			session := &testSession{}
+			err := h.ConsumeClaim(session, newTestClaim(tc.msgs))
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.wantCalls, calls)
+			assert.Equal(t, tc.wantMark, session.marked)
+		})
+	}
+}
+
+func TestBatchHandlerRebalance(t *testing.T) {
+	p := mocks.NewSyncProducer(t, nil)
+	defer p.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	h := NewBatchHandler[testEvent](logger.NewNoOpLogger(), 2, time.Second,
+		func(msgs []*sarama.ConsumerMessage, ts []testEvent) error {
+			// 处理到一半再均衡了
+			cancel()
+			return errors.New("mock db error")
+		}).WithRetry(RetryConfig{MaxRetries: 2, InitialInterval: time.Second, MaxInterval: time.Second}).
+		WithDeadLetter(NewDeadLetterProducer(p))
+	session := &testSession{ctx: ctx}
+	err := h.ConsumeClaim(session, newTestClaim(newTestMsgs(0, 1)))
+	assert.Error(t, err)
+	// 没有投递死信队列（mock producer 没有 expect，投递了 Close 会报错），也没有提交
+	assert.Nil(t, session.marked)
+}
+
+func TestBatchHandlerTimeout(t *testing.T) {
+	var calls [][]int64
+	h := NewBatchHandler[testEvent](logger.NewNoOpLogger(), 10, time.Millisecond*50,
+		func(msgs []*sarama.ConsumerMessage, ts []testEvent) error {
+			aids := make([]int64, 0, len(ts))
+			for _, te := range ts {
+				aids = append(aids, te.Aid)
+			}
+			calls = append(calls, aids)
+			return nil
+		})
+	ch := make(chan *sarama.ConsumerMessage)
+	session := &testSession{}
+	done := make(chan struct{})
+	go func() {
+		_ = h.ConsumeClaim(session, &testClaim{msgs: ch})
+		close(done)
+	}()
+	for _, msg := range newTestMsgs(0, 1) {
+		ch <- msg
+	}
+	// 没有攒够一批，等超时之后也要处理
+	time.Sleep(time.Millisecond * 200)
+	ch <- newTestMsgs(2)[0]
+	close(ch)
+	<-done
+	assert.Equal(t, [][]int64{{0, 1}, {2}}, calls)
+	assert.Equal(t, []int64{0, 1, 2}, session.marked)
+}
+
+func newTestMsgs(aids ...int64) []*sarama.ConsumerMessage {
+	res := make([]*sarama.ConsumerMessage, 0, len(aids))
+	for _, aid := range aids {
+		data, _ := json.Marshal(testEvent{Aid: aid})
+		res = append(res, &sarama.ConsumerMessage{
+			Topic:  "test_topic",
+			Offset: aid,
+			Value:  data,
+		})
+	}
+	return res
+}
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	// 为 nil 的时候用 context.Background()
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *testSession) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	msgs chan *sarama.ConsumerMessage
+}
+
+func newTestClaim(msgs []*sarama.ConsumerMessage) *testClaim {
+	ch := make(chan *sarama.ConsumerMessage, len(msgs))
+	for _, msg := range msgs {
+		ch <- msg
+	}
+	close(ch)
+	return &testClaim{msgs: ch}
+}
+
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.msgs
+}
@@ -2,13 +2,20 @@ package saramax
 
 import (
 	"encoding/json"
+	"errors"
 	"geekgo/week9/webook/pkgs/logger"
 	"github.com/IBM/sarama"
+	"time"
 )
 
 type Handler[T any] struct {
-	l  logger.LoggerV1
-	fn func(msg *sarama.ConsumerMessage, t T) error
+	l     logger.LoggerV1
+	fn    func(msg *sarama.ConsumerMessage, t T) error
+	retry RetryConfig
+	// 为 nil 的时候不投递死信队列，重试失败之后 ConsumeClaim 返回 error，不提交偏移量
+	dlq *DeadLetterProducer
+	// onErr 每次处理失败都会调用，用来接监控
+	onErr func(msg *sarama.ConsumerMessage, err error)
 }
 
 func (h *Handler[T]) Setup(session sarama.ConsumerGroupSession) error {
@@ -24,47 +31,114 @@ func (h *Handler[T]) Cleanup(session sarama.ConsumerGroupSession) error {
 func (h *Handler[T]) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	msgs := claim.Messages()
 	for msg := range msgs {
-		var t T
-		err := json.Unmarshal(msg.Value, &t)
+		err := h.Process(session, msg)
 		if err != nil {
-			h.l.Error("反序列化消息失败",
-				logger.Error(err),
-				logger.String("topic", msg.Topic),
-				logger.Int32("partition", msg.Partition),
-				logger.Int64("offset", msg.Offset))
-			continue
+			// 不能接着处理后面的消息，不然提交了后面的偏移量，这一条就丢了
+			return err
 		}
+	}
+	return nil
+}
 
-		//	consume fn 重试
-		for i := 0; i < 3; i++ {
-			err = h.fn(msg, t)
-			if err == nil {
-				break
-			}
-			h.l.Error("处理消息失败",
-				logger.Error(err),
+// Process 处理单条消息：反序列化，失败之后按照退避策略重试，最后还是失败就投递到死信队列
+// 成功处理或者成功投递到死信队列之后才提交偏移量。
+// 返回 error 的时候没有提交，调用方要结束这一轮消费，重新加入之后从上次提交的偏移量开始消费
+func (h *Handler[T]) Process(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error {
+	var t T
+	err := json.Unmarshal(msg.Value, &t)
+	if err != nil {
+		// 反序列化失败的，重试多少次都没用，直接进死信队列
+		h.l.Error("反序列化消息失败",
+			logger.Error(err),
+			logger.String("topic", msg.Topic),
+			logger.Int32("partition", msg.Partition),
+			logger.Int64("offset", msg.Offset))
+		if h.dlq == nil {
+			// 和 BatchHandler 一样，重新消费也还是失败，只能丢掉
+			h.l.Warn("没有配置死信队列，丢弃反序列化失败的消息",
 				logger.String("topic", msg.Topic),
 				logger.Int32("partition", msg.Partition),
 				logger.Int64("offset", msg.Offset))
-
+			session.MarkMessage(msg, "")
+			return nil
 		}
-		if err != nil {
-			h.l.Error("处理消息失败-重试次数上限",
-				logger.Error(err),
-				logger.String("topic", msg.Topic),
-				logger.Int64("partition", int64(msg.Partition)),
-				logger.Int64("offset", msg.Offset))
-		} else {
+		return h.deadLetter(session, msg, err)
+	}
+
+	//	consume fn 重试
+	for i := 0; ; i++ {
+		err = h.fn(msg, t)
+		if err == nil {
 			session.MarkMessage(msg, "")
+			return nil
 		}
+		if h.onErr != nil {
+			h.onErr(msg, err)
+		}
+		h.l.Error("处理消息失败",
+			logger.Error(err),
+			logger.String("topic", msg.Topic),
+			logger.Int32("partition", msg.Partition),
+			logger.Int64("offset", msg.Offset))
+		if i >= h.retry.MaxRetries {
+			break
+		}
+		timer := time.NewTimer(h.retry.Interval(i))
+		select {
+		case <-timer.C:
+		case <-session.Context().Done():
+			// 再均衡了，不提交，这条消息会被重新消费
+			timer.Stop()
+			return errors.Join(err, session.Context().Err())
+		}
+	}
+	h.l.Error("处理消息失败-重试次数上限",
+		logger.Error(err),
+		logger.String("topic", msg.Topic),
+		logger.Int32("partition", msg.Partition),
+		logger.Int64("offset", msg.Offset))
+	if h.dlq == nil {
+		return err
+	}
+	return h.deadLetter(session, msg, err)
+}
 
+func (h *Handler[T]) deadLetter(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage, cause error) error {
+	err := h.dlq.Send(msg, cause)
+	if err != nil {
+		h.l.Error("投递死信队列失败",
+			logger.Error(errors.Join(cause, err)),
+			logger.String("topic", msg.Topic),
+			logger.Int32("partition", msg.Partition),
+			logger.Int64("offset", msg.Offset))
+		return err
 	}
+	session.MarkMessage(msg, "")
 	return nil
 }
 
+// WithRetry 替换默认的重试策略
+func (h *Handler[T]) WithRetry(cfg RetryConfig) *Handler[T] {
+	h.retry = cfg
+	return h
+}
+
+// WithDeadLetter 重试失败和反序列化失败的消息投递到死信队列
+func (h *Handler[T]) WithDeadLetter(dlq *DeadLetterProducer) *Handler[T] {
+	h.dlq = dlq
+	return h
+}
+
+// OnError 每次处理失败的回调
+func (h *Handler[T]) OnError(fn func(msg *sarama.ConsumerMessage, err error)) *Handler[T] {
+	h.onErr = fn
+	return h
+}
+
 func NewHandler[T any](l logger.LoggerV1, fn func(msg *sarama.ConsumerMessage, t T) error) *Handler[T] {
 	return &Handler[T]{
-		l:  l,
-		fn: fn,
+		l:     l,
+		fn:    fn,
+		retry: DefaultRetryConfig,
 	}
 }
@@ -0,0 +1,192 @@
+package saramax
+
+import (
+	"errors"
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHandlerProcess(t *testing.T) {
+	retry := RetryConfig{
+		MaxRetries:      2,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond * 10,
+	}
+	testCases := []struct {
+		name string
+		msg  *sarama.ConsumerMessage
+		// 第几次调用 fn 之后成功，-1 表示一直失败
+		succeedAt int
+		// 为 nil 表示不配置死信队列
+		mock func(t *testing.T) *mocks.SyncProducer
+
+		wantCalls int
+		wantMark  []int64
+		wantErr   bool
+	}{
+		{
+			name:      "第一次就成功",
+			msg:       newTestMsgs(1)[0],
+			succeedAt: 1,
+			wantCalls: 1,
+			wantMark:  []int64{1},
+		},
+		{
+			name:      "重试之后成功",
+			msg:       newTestMsgs(1)[0],
+			succeedAt: 3,
+			wantCalls: 3,
+			wantMark:  []int64{1},
+		},
+		{
+			name:      "一直失败，进死信队列",
+			msg:       newTestMsgs(1)[0],
+			succeedAt: -1,
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(
+					func(msg *sarama.ProducerMessage) error {
+						assert.Equal(t, "test_topic_dlq", msg.Topic)
+						assert.Equal(t, map[string]string{
+							HeaderOriginalTopic:     "test_topic",
+							HeaderOriginalPartition: "0",
+							HeaderOriginalOffset:    "1",
+							HeaderError:             "mock error",
+						}, headerMap(msg.Headers))
+						return nil
+					})
+				return p
+			},
+			wantCalls: 3,
+			wantMark:  []int64{1},
+		},
+		{
+			name:      "一直失败，没有死信队列，不提交",
+			msg:       newTestMsgs(1)[0],
+			succeedAt: -1,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name: "反序列化失败，没有死信队列，丢弃",
+			msg: &sarama.ConsumerMessage{Topic: "test_topic", Offset: 2,
+				Value: []byte("bad")},
+			wantMark: []int64{2},
+		},
+		{
+			name: "反序列化失败，直接进死信队列",
+			msg: &sarama.ConsumerMessage{Topic: "test_topic", Offset: 2,
+				Value: []byte("bad")},
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				p.ExpectSendMessageAndSucceed()
+				return p
+			},
+			wantMark: []int64{2},
+		},
+		{
+			name:      "死信队列投递失败，不提交",
+			msg:       newTestMsgs(1)[0],
+			succeedAt: -1,
+			mock: func(t *testing.T) *mocks.SyncProducer {
+				p := mocks.NewSyncProducer(t, nil)
+				p.ExpectSendMessageAndFail(errors.New("mock kafka error"))
+				return p
+			},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			h := NewHandler[testEvent](logger.NewNoOpLogger(),
+				func(msg *sarama.ConsumerMessage, te testEvent) error {
+					calls++
+					if calls == tc.succeedAt {
+						return nil
+					}
+					return errors.New("mock error")
+				}).WithRetry(retry)
+			if tc.mock != nil {
+				p := tc.mock(t)
+				defer p.Close()
+				h.WithDeadLetter(NewDeadLetterProducer(p))
+			}
+			session := &testSession{}
+			err := h.Process(session, tc.msg)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.wantCalls, calls)
+			assert.Equal(t, tc.wantMark, session.marked)
+		})
+	}
+}
+
+func TestHandlerConsumeClaimStopOnFailure(t *testing.T) {
+	var handled []int64
+	h := NewHandler[testEvent](logger.NewNoOpLogger(),
+		func(msg *sarama.ConsumerMessage, te testEvent) error {
+			handled = append(handled, te.Aid)
+			if te.Aid == 2 {
+				return errors.New("mock error")
+			}
+			return nil
+		}).WithRetry(RetryConfig{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond})
+	session := &testSession{}
+	err := h.ConsumeClaim(session, newTestClaim(newTestMsgs(1, 2, 3)))
+	assert.Error(t, err)
+	// 2 失败之后就不再处理 3，也不会提交 3 把 2 跳过去
+	assert.Equal(t, []int64{1, 2}, handled)
+	assert.Equal(t, []int64{1}, session.marked)
+}
+
+func TestRetryConfigInterval(t *testing.T) {
+	cfg := RetryConfig{
+		InitialInterval: time.Millisecond * 100,
+		MaxInterval:     time.Millisecond * 500,
+	}
+	assert.Equal(t, time.Millisecond*100, cfg.Interval(0))
+	assert.Equal(t, time.Millisecond*200, cfg.Interval(1))
+	assert.Equal(t, time.Millisecond*400, cfg.Interval(2))
+	assert.Equal(t, time.Millisecond*500, cfg.Interval(3))
+	assert.Equal(t, time.Millisecond*500, cfg.Interval(10))
+}
+
+func TestDeadLetterReplayer(t *testing.T) {
+	p := mocks.NewSyncProducer(t, nil)
+	defer p.Close()
+	p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(
+		func(msg *sarama.ProducerMessage) error {
+			assert.Equal(t, "test_topic", msg.Topic)
+			// dlq- 开头的都去掉，业务自己的 header 保留
+			assert.Equal(t, map[string]string{"trace_id": "abc"}, headerMap(msg.Headers))
+			val, err := msg.Value.Encode()
+			assert.NoError(t, err)
+			assert.Equal(t, "value", string(val))
+			return nil
+		})
+	r := NewDeadLetterReplayer(logger.NewNoOpLogger(), p)
+	err := r.Replay(&sarama.ConsumerMessage{
+		Topic: "test_topic_dlq",
+		Value: []byte("value"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("trace_id"), Value: []byte("abc")},
+			{Key: []byte(HeaderOriginalTopic), Value: []byte("test_topic")},
+			{Key: []byte(HeaderOriginalOffset), Value: []byte("1")},
+			{Key: []byte(HeaderError), Value: []byte("mock error")},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func headerMap(headers []sarama.RecordHeader) map[string]string {
+	res := make(map[string]string, len(headers))
+	for _, h := range headers {
+		res[string(h.Key)] = string(h.Value)
+	}
+	return res
+}
@@ -0,0 +1,133 @@
+package saramax
+
+import (
+	"geekgo/week9/webook/pkgs/logger"
+	"github.com/IBM/sarama"
+	"strconv"
+	"strings"
+)
+
+// 投递到死信队列的消息，在 header 里面记录原始消息的位置和失败原因
+const (
+	HeaderOriginalTopic     = "dlq-original-topic"
+	HeaderOriginalPartition = "dlq-original-partition"
+	HeaderOriginalOffset    = "dlq-original-offset"
+	HeaderError             = "dlq-error"
+
+	headerPrefix = "dlq-"
+)
+
+// DeadLetterTopic 死信队列的 topic，read_article 对应 read_article_dlq
+func DeadLetterTopic(topic string) string {
+	return topic + "_dlq"
+}
+
+// DeadLetterProducer 把处理不了的消息转发到死信队列，后面人工排查或者用 DeadLetterReplayer 重放
+type DeadLetterProducer struct {
+	producer sarama.SyncProducer
+}
+
+func NewDeadLetterProducer(producer sarama.SyncProducer) *DeadLetterProducer {
+	return &DeadLetterProducer{producer: producer}
+}
+
+func (p *DeadLetterProducer) Send(msg *sarama.ConsumerMessage, cause error) error {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+4)
+	for _, h := range msg.Headers {
+		// 重放之后又失败的，用这一次的记录覆盖掉之前的
+		if strings.HasPrefix(string(h.Key), headerPrefix) {
+			continue
+		}
+		headers = append(headers, *h)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition),
+			Value: []byte(strconv.FormatInt(int64(msg.Partition), 10))},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset),
+			Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(cause.Error())},
+	)
+	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   DeadLetterTopic(msg.Topic),
+		Key:     keyOf(msg),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	return err
+}
+
+// keyOf 原来没有 key 的，转发的时候也不能有，不然会全部落到同一个分区
+func keyOf(msg *sarama.ConsumerMessage) sarama.Encoder {
+	if msg.Key == nil {
+		return nil
+	}
+	return sarama.ByteEncoder(msg.Key)
+}
+
+// DeadLetterReplayer 消费死信队列，把消息重新投递回原来的 topic
+// 问题修复之后用：cg.Consume(ctx, []string{"read_article_dlq"}, replayer)
+type DeadLetterReplayer struct {
+	l        logger.LoggerV1
+	producer sarama.SyncProducer
+}
+
+func NewDeadLetterReplayer(l logger.LoggerV1, producer sarama.SyncProducer) *DeadLetterReplayer {
+	return &DeadLetterReplayer{l: l, producer: producer}
+}
+
+func (r *DeadLetterReplayer) Setup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (r *DeadLetterReplayer) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (r *DeadLetterReplayer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		err := r.Replay(msg)
+		if err != nil {
+			// 不提交，下次启动重放的时候还会再来一次
+			r.l.Error("重放死信消息失败",
+				logger.Error(err),
+				logger.String("topic", msg.Topic),
+				logger.Int32("partition", msg.Partition),
+				logger.Int64("offset", msg.Offset))
+			return err
+		}
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// Replay 原来的 dlq- header 去掉，其余的 header、key 和 value 原样发回去
+func (r *DeadLetterReplayer) Replay(msg *sarama.ConsumerMessage) error {
+	var topic string
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		key := string(h.Key)
+		if key == HeaderOriginalTopic {
+			topic = string(h.Value)
+		}
+		if strings.HasPrefix(key, headerPrefix) {
+			continue
+		}
+		headers = append(headers, *h)
+	}
+	if topic == "" {
+		// 不是 DeadLetterProducer 投递的，不知道该发到哪里
+		r.l.Warn("死信消息缺少原始 topic，丢弃",
+			logger.String("topic", msg.Topic),
+			logger.Int32("partition", msg.Partition),
+			logger.Int64("offset", msg.Offset))
+		return nil
+	}
+	_, _, err := r.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     keyOf(msg),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	return err
+}
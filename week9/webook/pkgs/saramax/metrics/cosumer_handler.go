@@ -1,8 +1,8 @@
 package metrics
 
 import (
-	"encoding/json"
 	"geekgo/week9/webook/pkgs/logger"
+	"geekgo/week9/webook/pkgs/saramax"
 	"github.com/IBM/sarama"
 	"github.com/prometheus/client_golang/prometheus"
 	"time"
@@ -23,74 +23,44 @@ func InitSummary(opt prometheus.SummaryOpts) {
 	prometheus.MustRegister(summary)
 }
 
+// PrometheusKafkaConsumerHandler 重试、死信队列的逻辑和 saramax.Handler 一样，额外统计失败次数和处理时间
 type PrometheusKafkaConsumerHandler[T any] struct {
+	*saramax.Handler[T]
 	count   *prometheus.CounterVec
 	summary *prometheus.SummaryVec
-	l       logger.LoggerV1
-	fn      func(msg *sarama.ConsumerMessage, t T) error
 }
 
 func (h *PrometheusKafkaConsumerHandler[T]) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	msgs := claim.Messages()
 	for msg := range msgs {
-
 		startTime := time.Now()
-
-		var t T
-		err := json.Unmarshal(msg.Value, &t)
-		if err != nil {
-			h.l.Error("反序列化消息失败",
-				logger.Error(err),
-				logger.String("topic", msg.Topic),
-				logger.Int32("partition", msg.Partition),
-				logger.Int64("offset", msg.Offset))
-			continue
-		}
-
-		//	consume fn 重试
-		for i := 0; i < 3; i++ {
-			err = h.fn(msg, t)
-			if err == nil {
-				break
-			}
-			h.count.WithLabelValues(msg.Topic).Inc()
-			h.l.Error("处理消息失败",
-				logger.Error(err),
-				logger.String("topic", msg.Topic),
-				logger.Int32("partition", msg.Partition),
-				logger.Int64("offset", msg.Offset))
-
-		}
+		err := h.Process(session, msg)
+		h.summary.WithLabelValues(msg.Topic).Observe(float64(time.Since(startTime).Milliseconds()))
 		if err != nil {
-			h.l.Error("处理消息失败-重试次数上限",
-				logger.Error(err),
-				logger.String("topic", msg.Topic),
-				logger.Int64("partition", int64(msg.Partition)),
-				logger.Int64("offset", msg.Offset))
-		} else {
-			session.MarkMessage(msg, "")
+			return err
 		}
-		h.summary.WithLabelValues(msg.Topic).Observe(float64(time.Since(startTime).Milliseconds()))
 	}
 	return nil
 
 }
 
-func (h *PrometheusKafkaConsumerHandler[T]) Setup(session sarama.ConsumerGroupSession) error {
-	return nil
-
+func (h *PrometheusKafkaConsumerHandler[T]) WithRetry(cfg saramax.RetryConfig) *PrometheusKafkaConsumerHandler[T] {
+	h.Handler.WithRetry(cfg)
+	return h
 }
 
-func (h *PrometheusKafkaConsumerHandler[T]) Cleanup(session sarama.ConsumerGroupSession) error {
-	return nil
-
+func (h *PrometheusKafkaConsumerHandler[T]) WithDeadLetter(dlq *saramax.DeadLetterProducer) *PrometheusKafkaConsumerHandler[T] {
+	h.Handler.WithDeadLetter(dlq)
+	return h
 }
 
 func NewPrometheusKafkaConsumerHandler[T any](l logger.LoggerV1, fn func(msg *sarama.ConsumerMessage, t T) error) *PrometheusKafkaConsumerHandler[T] {
-	return &PrometheusKafkaConsumerHandler[T]{
-		l:       l,
-		fn:      fn,
+	h := &PrometheusKafkaConsumerHandler[T]{
 		count:   counter,
 		summary: summary,
 	}
+	h.Handler = saramax.NewHandler[T](l, fn).OnError(func(msg *sarama.ConsumerMessage, err error) {
+		h.count.WithLabelValues(msg.Topic).Inc()
+	})
+	return h
 }
@@ -0,0 +1,32 @@
+package saramax
+
+import "time"
+
+// RetryConfig 处理失败之后的重试策略，重试间隔按照指数增长
+type RetryConfig struct {
+	// MaxRetries 最多重试多少次，不包括第一次
+	MaxRetries int
+	// InitialInterval 第一次重试之前等待的时间
+	InitialInterval time.Duration
+	// MaxInterval 重试间隔的上限
+	MaxInterval time.Duration
+}
+
+// DefaultRetryConfig 100ms、200ms、400ms
+var DefaultRetryConfig = RetryConfig{
+	MaxRetries:      3,
+	InitialInterval: time.Millisecond * 100,
+	MaxInterval:     time.Second * 5,
+}
+
+// Interval 第 retries 次重试之前要等多久，retries 从 0 开始
+func (c RetryConfig) Interval(retries int) time.Duration {
+	interval := c.InitialInterval
+	for i := 0; i < retries; i++ {
+		interval = interval * 2
+		if interval >= c.MaxInterval {
+			return c.MaxInterval
+		}
+	}
+	return interval
+}
@@ -0,0 +1,121 @@
+package saramax
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "geekgo/week9/webook/pkgs/saramax"
+
+// StartProduceSpan 发消息之前调用，开一个 producer 的 span，并且把 trace 写到消息头里面，
+// 消费者用 StartConsumeSpan 接着这个 trace。发完之后要 End 返回的 span
+func StartProduceSpan(ctx context.Context, msg *sarama.ProducerMessage) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, msg.Topic+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(msg.Topic)))
+	otel.GetTextMapPropagator().Inject(ctx, producerMessageCarrier{msg: msg})
+	return ctx, span
+}
+
+// StartConsumeSpan 处理消息的时候调用，从消息头里面拿到生产者的 trace。
+// 批量消费的时候，一批消息可能来自不同的 trace，这个时候 span 挂在第一条消息的 trace 下面，
+// 其它消息的 trace 用 link 关联起来，只有一条消息的时候就是完整的一条链路
+func StartConsumeSpan(ctx context.Context, msgs ...*sarama.ConsumerMessage) (context.Context, trace.Span) {
+	if len(msgs) == 0 {
+		return otel.Tracer(instrumentationName).Start(ctx, "kafka process",
+			trace.WithSpanKind(trace.SpanKindConsumer))
+	}
+	propagator := otel.GetTextMapPropagator()
+	parent := propagator.Extract(ctx, consumerMessageCarrier{msg: msgs[0]})
+	links := make([]trace.Link, 0, len(msgs)-1)
+	for _, msg := range msgs[1:] {
+		sc := trace.SpanContextFromContext(propagator.Extract(ctx, consumerMessageCarrier{msg: msg}))
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	return otel.Tracer(instrumentationName).Start(parent, msgs[0].Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationReceive,
+			semconv.MessagingDestinationName(msgs[0].Topic),
+			semconv.MessagingBatchMessageCount(len(msgs)),
+			attribute.Int64("messaging.kafka.first_offset", msgs[0].Offset)))
+}
+
+type producerMessageCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c producerMessageCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set 重试发送的时候同一条消息会 Set 多次，要覆盖掉原来的
+func (c producerMessageCarrier) Set(key string, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{
+		Key:   []byte(key),
+		Value: []byte(value),
+	})
+}
+
+func (c producerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
+
+type consumerMessageCarrier struct {
+	msg *sarama.ConsumerMessage
+}
+
+func (c consumerMessageCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set 消费者这边只读
+func (c consumerMessageCarrier) Set(key string, value string) {
+}
+
+func (c consumerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
+
+var (
+	_ propagation.TextMapCarrier = producerMessageCarrier{}
+	_ propagation.TextMapCarrier = consumerMessageCarrier{}
+)
@@ -0,0 +1,48 @@
+package saramax
+
+import (
+	"context"
+	"geekgo/week9/webook/pkgs/otelx"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestTraceSpan(t *testing.T) {
+	tracing, err := otelx.Setup(otelx.Config{ServiceName: "test", Exporter: otelx.ExporterMemory, SampleRatio: 1})
+	require.NoError(t, err)
+	defer tracing.Shutdown(context.Background())
+
+	produce := func() (*sarama.ConsumerMessage, trace.SpanContext) {
+		msg := &sarama.ProducerMessage{Topic: "read_article"}
+		_, span := StartProduceSpan(context.Background(), msg)
+		span.End()
+		res := &sarama.ConsumerMessage{Topic: msg.Topic}
+		for _, h := range msg.Headers {
+			h := h
+			res.Headers = append(res.Headers, &h)
+		}
+		return res, span.SpanContext()
+	}
+	msg1, sc1 := produce()
+	msg2, sc2 := produce()
+
+	tracing.Memory.Reset()
+	_, span := StartConsumeSpan(context.Background(), msg1)
+	span.End()
+	_, span = StartConsumeSpan(context.Background(), msg1, msg2)
+	span.End()
+
+	spans := tracing.Memory.GetSpans()
+	require.Len(t, spans, 2)
+	// 单条消息，和生产者是同一条链路
+	assert.Equal(t, "read_article process", spans[0].Name)
+	assert.Equal(t, sc1.TraceID(), spans[0].SpanContext.TraceID())
+	assert.Equal(t, sc1.SpanID(), spans[0].Parent.SpanID())
+	// 批量消费，挂在第一条消息下面，第二条消息用 link 关联
+	assert.Equal(t, sc1.TraceID(), spans[1].SpanContext.TraceID())
+	require.Len(t, spans[1].Links, 1)
+	assert.Equal(t, sc2.TraceID(), spans[1].Links[0].SpanContext.TraceID())
+}
@@ -4,12 +4,12 @@ package main
 
 import (
 	"geekgo/week9/webook/internal/events/article"
+	"geekgo/week9/webook/internal/job"
 	"geekgo/week9/webook/internal/repository"
 	"geekgo/week9/webook/internal/repository/cache"
 	"geekgo/week9/webook/internal/repository/dao"
 	"geekgo/week9/webook/internal/service"
 	"geekgo/week9/webook/internal/web"
-	ijwt "geekgo/week9/webook/internal/web/jwt"
 	"geekgo/week9/webook/ioc"
 	"github.com/google/wire"
 )
@@ -21,21 +21,58 @@ func InitServer() *App {
 		dao.NewGORMUserDAO,
 		cache.NewRedisUserCache,
 		repository.NewUserRepository,
-		service.NewUserService,
+		ioc.InitUserService,
+		cache.NewRedisCodeCache,
+		repository.NewCodeRepository,
+		service.NewCodeService,
+		ioc.InitSMSService,
+		ioc.InitSMSLimiter,
+		cache.NewRedisUserTokenCache,
+		repository.NewUserTokenRepository,
+		ioc.InitEmailSender,
+		ioc.InitUserEmailService,
+		ioc.InitLoginFailureCache,
+		repository.NewLoginFailureRepository,
+		service.NewLoginGuardService,
+		dao.NewGORMTOTPDAO,
+		cache.NewRedisTOTPCache,
+		repository.NewTOTPRepository,
+		ioc.InitTOTPService,
+		ioc.InitAdminHandler,
+		ioc.InitWechatService,
+		ioc.InitOAuth2State,
+		web.NewOAuth2WechatHandler,
+		ioc.InitOAuth2Providers,
+		dao.NewGORMOAuthBindingDAO,
+		repository.NewOAuthBindingRepository,
+		service.NewOAuthBindingService,
+		web.NewOAuth2Handler,
 		web.NewUserHandler,
-		ijwt.NewRedisJWT,
+		ioc.InitJWTHandler,
+		ioc.InitJWTKeyProvider,
+		web.NewJWKSHandler,
 		ioc.InitWebServer,
 
-		dao.NewGORMArticleDAO,
+		ioc.InitArticleDAO,
+		ioc.InitArticleScheduleDAO,
+		cache.NewRedisArticleCache,
 		repository.NewArticleRepository,
 		service.NewArticleService,
 		web.NewArticleHandler,
+		job.NewScheduledPublisher,
+
+		ioc.InitRankingDAO,
+		cache.NewRedisRankingCache,
+		repository.NewRankingRepository,
+		service.NewRankingService,
+		job.NewRankingJob,
 
 		ioc.InitMiddlewares,
 
 		ioc.InitKafka,
 		ioc.NewConsumers,
 		ioc.NewSyncProducer,
+		ioc.NewDeadLetterProducer,
 
 		article.NewKafkaProducer,
 		article.NewInteractiveReadEventConsumer,
@@ -45,6 +82,11 @@ func InitServer() *App {
 		repository.NewCachedReadCntRepository,
 		service.NewInteractiveService,
 
+		dao.NewGORMCollectionDAO,
+		repository.NewCollectionRepository,
+		service.NewCollectionService,
+		web.NewCollectionHandler,
+
 		ioc.InitLogger,
 
 		wire.Struct(new(App), "*"),
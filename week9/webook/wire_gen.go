@@ -8,12 +8,12 @@ package main
 
 import (
 	"geekgo/week9/webook/internal/events/article"
+	"geekgo/week9/webook/internal/job"
 	"geekgo/week9/webook/internal/repository"
 	"geekgo/week9/webook/internal/repository/cache"
 	"geekgo/week9/webook/internal/repository/dao"
 	"geekgo/week9/webook/internal/service"
 	"geekgo/week9/webook/internal/web"
-	"geekgo/week9/webook/internal/web/jwt"
 	"geekgo/week9/webook/ioc"
 )
 
@@ -21,32 +21,74 @@ import (
 
 func InitServer() *App {
 	cmdable := ioc.InitRedis()
-	handler := jwt.NewRedisJWT(cmdable)
-	v := ioc.InitMiddlewares(cmdable, handler)
+	keyProvider := ioc.InitJWTKeyProvider()
+	handler := ioc.InitJWTHandler(cmdable, keyProvider)
+	providers := ioc.InitOAuth2Providers()
+	v := ioc.InitMiddlewares(cmdable, handler, providers)
 	db := ioc.InitDB()
 	userDAO := dao.NewGORMUserDAO(db)
 	userCache := cache.NewRedisUserCache()
 	userRepository := repository.NewUserRepository(userDAO, userCache)
-	userService := service.NewUserService(userRepository)
-	userHandler := web.NewUserHandler(userService, handler)
-	articleDAO := dao.NewGORMArticleDAO(db)
-	articleRepository := repository.NewArticleRepository(articleDAO)
+	userService := ioc.InitUserService(userRepository)
+	codeCache := cache.NewRedisCodeCache(cmdable)
+	codeRepository := repository.NewCodeRepository(codeCache)
+	smsService := ioc.InitSMSService()
+	codeService := service.NewCodeService(codeRepository, smsService)
+	limiter := ioc.InitSMSLimiter(cmdable)
+	userTokenCache := cache.NewRedisUserTokenCache(cmdable)
+	userTokenRepository := repository.NewUserTokenRepository(userTokenCache)
+	sender := ioc.InitEmailSender()
+	userEmailService := ioc.InitUserEmailService(userRepository, userTokenRepository, sender)
+	loginFailureCache := ioc.InitLoginFailureCache(cmdable)
+	loginFailureRepository := repository.NewLoginFailureRepository(loginFailureCache)
+	loginGuardService := service.NewLoginGuardService(loginFailureRepository)
+	totpdao := dao.NewGORMTOTPDAO(db)
+	totpCache := cache.NewRedisTOTPCache(cmdable)
+	totpRepository := repository.NewTOTPRepository(totpdao, totpCache)
+	totpService := ioc.InitTOTPService(totpRepository, userRepository)
+	loggerV1 := ioc.InitLogger()
+	articleDAO := ioc.InitArticleDAO(db, loggerV1)
+	articleScheduleDAO := ioc.InitArticleScheduleDAO(db)
+	articleCache := cache.NewRedisArticleCache(cmdable)
+	articleRepository := repository.NewArticleRepository(articleDAO, articleScheduleDAO, articleCache, loggerV1)
 	client := ioc.InitKafka()
 	syncProducer := ioc.NewSyncProducer(client)
 	producer := article.NewKafkaProducer(syncProducer)
 	articleService := service.NewArticleService(articleRepository, producer)
 	interactiveCache := cache.NewRedisInteractiveCache(cmdable)
 	interactiveDAO := dao.NewGORMInteractiveDAO(db)
-	interactiveRepository := repository.NewCachedReadCntRepository(interactiveCache, interactiveDAO)
+	interactiveRepository := repository.NewCachedReadCntRepository(interactiveCache, interactiveDAO, loggerV1)
 	interactiveService := service.NewInteractiveService(interactiveRepository)
-	articleHandler := web.NewArticleHandler(articleService, interactiveService)
-	engine := ioc.InitWebServer(v, userHandler, articleHandler)
-	loggerV1 := ioc.InitLogger()
-	interactiveReadEventConsumer := article.NewInteractiveReadEventConsumer(client, interactiveRepository, loggerV1)
+	rankingDAO := ioc.InitRankingDAO(db)
+	rankingCache := cache.NewRedisRankingCache(cmdable)
+	rankingRepository := repository.NewRankingRepository(rankingDAO, rankingCache)
+	rankingService := service.NewRankingService(rankingRepository)
+	articleHandler := web.NewArticleHandler(articleService, interactiveService, rankingService)
+	collectionDAO := dao.NewGORMCollectionDAO(db)
+	collectionRepository := repository.NewCollectionRepository(collectionDAO)
+	collectionService := service.NewCollectionService(collectionRepository, interactiveRepository)
+	collectionHandler := web.NewCollectionHandler(collectionService)
+	jwksHandler := web.NewJWKSHandler(keyProvider)
+	wechatService := ioc.InitWechatService()
+	oAuth2State := ioc.InitOAuth2State()
+	oAuth2WechatHandler := web.NewOAuth2WechatHandler(wechatService, userService, totpService, loginGuardService, handler, oAuth2State)
+	oAuthBindingDAO := dao.NewGORMOAuthBindingDAO(db)
+	oAuthBindingRepository := repository.NewOAuthBindingRepository(oAuthBindingDAO)
+	oAuthBindingService := service.NewOAuthBindingService(oAuthBindingRepository, userRepository)
+	userHandler := web.NewUserHandler(userService, codeService, userEmailService, loginGuardService, totpService, handler, limiter, oAuthBindingService, providers, oAuth2State)
+	oAuth2Handler := web.NewOAuth2Handler(providers, oAuthBindingService, totpService, loginGuardService, handler, oAuth2State)
+	adminHandler := ioc.InitAdminHandler(loginGuardService)
+	engine := ioc.InitWebServer(v, userHandler, articleHandler, collectionHandler, jwksHandler, oAuth2WechatHandler, oAuth2Handler, adminHandler)
+	deadLetterProducer := ioc.NewDeadLetterProducer(syncProducer)
+	interactiveReadEventConsumer := article.NewInteractiveReadEventConsumer(client, interactiveRepository, loggerV1, deadLetterProducer)
 	v2 := ioc.NewConsumers(interactiveReadEventConsumer)
+	scheduledPublisher := job.NewScheduledPublisher(articleService, loggerV1)
+	rankingJob := job.NewRankingJob(rankingService, loggerV1)
 	app := &App{
 		web:       engine,
 		consumers: v2,
+		publisher: scheduledPublisher,
+		ranking:   rankingJob,
 	}
 	return app
 }